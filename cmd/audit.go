@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+	"github.com/wot-oss/tmc/internal/audit"
+)
+
+const auditDateFormat = time.DateOnly
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the audit log",
+	Long: `Query the audit log, which records all pushes, deletions, promotions, index updates and repository config changes.
+The audit log is written to the file given by config key/env var TMC_AUDITLOGFILE (default ~/.tm-catalog/audit.log).
+Setting it to an empty string disables audit logging.
+The log is rotated when it grows larger than TMC_AUDITLOGMAXSIZE megabytes (default 0, meaning no rotation),
+keeping TMC_AUDITLOGMAXBACKUPS old files (default 5). Rotated files are included in queries.
+
+Filters can be combined to narrow down the result.`,
+	Example:           "audit --operation delete --since 2024-03-01 --until 2024-03-31",
+	Args:              cobra.NoArgs,
+	Run:               executeAudit,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().String("operation", "", fmt.Sprintf("Show only records of given operation, one of %v", audit.SupportedOperations))
+	_ = auditCmd.RegisterFlagCompletionFunc("operation", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return audit.SupportedOperations, cobra.ShellCompDirectiveNoFileComp
+	})
+	auditCmd.Flags().String("id", "", "Show only records with TM ids starting with given value")
+	_ = auditCmd.RegisterFlagCompletionFunc("id", completion.NoCompletionNoFile)
+	auditCmd.Flags().StringP("repo", "r", "", "Show only records concerning the named repository")
+	_ = auditCmd.RegisterFlagCompletionFunc("repo", completion.CompleteRepoNames)
+	auditCmd.Flags().String("subject", "", "Show only records of operations requested via the REST API by given JWT subject")
+	_ = auditCmd.RegisterFlagCompletionFunc("subject", completion.NoCompletionNoFile)
+	auditCmd.Flags().String("user", "", "Show only records of operations performed by given OS user")
+	_ = auditCmd.RegisterFlagCompletionFunc("user", completion.NoCompletionNoFile)
+	auditCmd.Flags().String("since", "", "Show only records at or after given time. Format: RFC3339 or YYYY-MM-DD")
+	_ = auditCmd.RegisterFlagCompletionFunc("since", completion.NoCompletionNoFile)
+	auditCmd.Flags().String("until", "", "Show only records at or before given time. Format: RFC3339 or YYYY-MM-DD, which includes the whole day")
+	_ = auditCmd.RegisterFlagCompletionFunc("until", completion.NoCompletionNoFile)
+	auditCmd.Flags().StringP("format", "f", cli.AuditFormatTable, fmt.Sprintf("Output format, one of [%s, %s]", cli.AuditFormatTable, cli.AuditFormatJSON))
+	_ = auditCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{cli.AuditFormatTable, cli.AuditFormatJSON}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func executeAudit(cmd *cobra.Command, args []string) {
+	filter := audit.Filter{
+		Operation: cmd.Flag("operation").Value.String(),
+		TMID:      cmd.Flag("id").Value.String(),
+		Repo:      cmd.Flag("repo").Value.String(),
+		Subject:   cmd.Flag("subject").Value.String(),
+		User:      cmd.Flag("user").Value.String(),
+	}
+	var err error
+	filter.Since, err = parseTimeFlag(cmd.Flag("since").Value.String(), false)
+	if err != nil {
+		cli.Stderrf("invalid --since: %v", err)
+		cli.Exit(1)
+	}
+	filter.Until, err = parseTimeFlag(cmd.Flag("until").Value.String(), true)
+	if err != nil {
+		cli.Stderrf("invalid --until: %v", err)
+		cli.Exit(1)
+	}
+
+	err = cli.AuditQuery(filter, cmd.Flag("format").Value.String())
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+// parseTimeFlag parses s as RFC3339 timestamp or as a date in local time. When endOfDay is set, a date is
+// interpreted as the last moment of that day
+func parseTimeFlag(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(auditDateFormat, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither an RFC3339 timestamp nor a date in format YYYY-MM-DD", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change settings in the config file",
+	Long: `The command config and its subcommands allow to show and change settings other than repos, which are
+managed with 'repo'. Changes are saved to the config file in use, or to the profile selected with --profile.
+The config file is the one given by --config (env var TMC_CONFIG) or the first found of .tmc/config.json in
+the working directory or any of its parents, ~/.tm-catalog/config.json, and ./config.json. Thus, a project
+can have its own repos and settings by keeping them in .tmc/config.json.
+Because a config file can run commands and read secrets through its repo configs, a project config is used only
+after it has been trusted with 'config trust'. A trusted project config has to be trusted again after it has been
+changed other than with 'config set' or 'repo'.
+A config file may have profiles, whose keys replace the top-level keys with the same name when selected with
+--profile (env var TMC_PROFILE), e.g.
+
+{
+  "repos": { ... },
+  "profiles": {
+    "prod": { "repos": { ... }, "corsAllowedOrigins": "https://catalog.example.com" }
+  }
+}
+
+When no subcommand is given, defaults to list.`,
+	Args: cobra.NoArgs,
+	Run:  executeConfigList,
+}
+
+var configListCmd = &cobra.Command{
+	Use:               "list",
+	Short:             "List settings",
+	Long:              `List all settings with their effective values from flags, environment variables, config file or defaults.`,
+	Args:              cobra.NoArgs,
+	Run:               executeConfigList,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:               "get <key>",
+	Short:             "Show a setting",
+	Long:              `Show the effective value of a setting from flags, environment variables, config file or defaults.`,
+	Args:              cobra.ExactArgs(1),
+	Run:               executeConfigGet,
+	ValidArgsFunction: completion.CompleteConfigKeys,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:               "set <key> <value>",
+	Short:             "Change a setting",
+	Long:              `Save the value of a setting to the config file in use, or to the selected profile of it.`,
+	Example:           "config set corsAllowedOrigins https://catalog.example.com\ntmc --profile prod config set logLevel warn",
+	Args:              cobra.ExactArgs(2),
+	Run:               executeConfigSet,
+	ValidArgsFunction: completion.CompleteConfigKeys,
+}
+
+var configTrustCmd = &cobra.Command{
+	Use:   "trust [<file>]",
+	Short: "Trust a project config file",
+	Long: `Trust the current contents of a project config file, by default of the .tmc/config.json found in the working
+directory or its parents, so that it is used. Review the file before trusting it.`,
+	Args:              cobra.MaximumNArgs(1),
+	Run:               executeConfigTrust,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configTrustCmd)
+}
+
+func executeConfigList(cmd *cobra.Command, args []string) {
+	err := cli.ConfigList()
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeConfigGet(cmd *cobra.Command, args []string) {
+	err := cli.ConfigGet(args[0])
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeConfigSet(cmd *cobra.Command, args []string) {
+	err := cli.ConfigSet(args[0], args[1])
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeConfigTrust(cmd *cobra.Command, args []string) {
+	file := ""
+	if len(args) > 0 {
+		file = args[0]
+	}
+	err := cli.ConfigTrust(file)
+	if err != nil {
+		cli.Exit(1)
+	}
+}
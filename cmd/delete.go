@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
@@ -39,17 +37,17 @@ func executeDelete(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
 	if force != "true" {
 		cli.Stderrf("Cannot delete a TM unless --force is set to \"true\"")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
-	err = cli.Delete(context.Background(), spec, args[0])
+	err = cli.Delete(cmd.Context(), spec, args[0])
 	if err != nil {
 		cli.Stderrf("delete failed")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
@@ -41,12 +39,12 @@ func executeFetch(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
-	err = cli.Fetch(context.Background(), spec, args[0], outputPath, restoreId)
+	err = cli.Fetch(cmd.Context(), spec, args[0], outputPath, restoreId)
 	if err != nil {
 		cli.Stderrf("fetch failed")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
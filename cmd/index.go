@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/internal/app/cli"
@@ -36,12 +34,12 @@ func executeCreateIndex(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repoName, dir)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 	log.Debug(fmt.Sprintf("creating table of contents for repository %s", spec))
 
-	err = cli.Index(context.Background(), spec, args)
+	err = cli.Index(cmd.Context(), spec, args)
 	if err != nil {
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
@@ -49,12 +47,12 @@ func executeList(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
 	search := cli.CreateSearchParamsFromCLI(filterFlags, name)
-	err = cli.List(context.Background(), spec, search)
+	err = cli.List(cmd.Context(), spec, search)
 	if err != nil {
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
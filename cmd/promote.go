@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os/user"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+	"github.com/wot-oss/tmc/internal/commands"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote <TMID> --from <repo> --to <repo>",
+	Short: "Promote a TM from one repository to another",
+	Long: `Promote a TM from one named repository to another, e.g. from staging to production, keeping its id.
+Before the TM is promoted, the validations listed in --validations (or config key/env var TMC_PROMOTIONVALIDATIONS) are run.
+Supported validations are: ` + "schema, digest, id" + `.
+Promotion is refused if the target repository already contains the same TM or a TM with a conflicting id.
+Every successful promotion is recorded with its approver in the audit log (config key/env var TMC_AUDITLOGFILE,
+default ~/.tm-catalog/audit.log). Promotion is refused if the audit log is disabled.`,
+	Example:           "promote omnicorp/omnicorp/omnilamp/v1.0.0-20240409155220-3f779458e453.tm.json --from staging --to production",
+	Args:              cobra.ExactArgs(1),
+	Run:               executePromote,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+func init() {
+	RootCmd.AddCommand(promoteCmd)
+	promoteCmd.Flags().String("from", "", "Name of the repository to promote the TM from")
+	_ = promoteCmd.RegisterFlagCompletionFunc("from", completion.CompleteRepoNames)
+	_ = promoteCmd.MarkFlagRequired("from")
+	promoteCmd.Flags().String("to", "", "Name of the repository to promote the TM to")
+	_ = promoteCmd.RegisterFlagCompletionFunc("to", completion.CompleteRepoNames)
+	_ = promoteCmd.MarkFlagRequired("to")
+	promoteCmd.Flags().String("approver", "", "Name of the person approving the promotion. Defaults to the current user name")
+	_ = promoteCmd.RegisterFlagCompletionFunc("approver", completion.NoCompletionNoFile)
+	promoteCmd.Flags().String(config.KeyPromotionValidations, "", "Comma-separated list of validations to run before promoting (env var TMC_PROMOTIONVALIDATIONS)")
+	_ = viper.BindPFlag(config.KeyPromotionValidations, promoteCmd.Flags().Lookup(config.KeyPromotionValidations))
+}
+
+func executePromote(cmd *cobra.Command, args []string) {
+	from := cmd.Flag("from").Value.String()
+	to := cmd.Flag("to").Value.String()
+	approver := cmd.Flag("approver").Value.String()
+	if approver == "" {
+		if u, err := user.Current(); err == nil {
+			approver = u.Username
+		}
+	}
+
+	opts := commands.PromoteOptions{
+		Approver:    approver,
+		Validations: GetPromoteValidations(),
+	}
+	err := cli.Promote(cmd.Context(), args[0], model.NewRepoSpec(from), model.NewRepoSpec(to), opts)
+	if err != nil {
+		cli.Stderrf("promote failed")
+		cli.Exit(1)
+	}
+}
+
+// GetPromoteValidations returns the validations configured for promotions, or the default validations if none are configured
+func GetPromoteValidations() []string {
+	vs := utils.ParseAsList(viper.GetString(config.KeyPromotionValidations), cli.DefaultListSeparator, true)
+	if len(vs) == 0 {
+		return commands.DefaultPromoteValidations
+	}
+	return vs
+}
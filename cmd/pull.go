@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
@@ -13,6 +11,8 @@ import (
 
 var pFilterFlags = cli.FilterFlags{}
 
+const defaultPullJobs = 8
+
 var pullCmd = &cobra.Command{
 	Use:   "pull <NAME PATTERN>",
 	Short: "Pull multiple TMs from a catalog.",
@@ -20,7 +20,8 @@ var pullCmd = &cobra.Command{
 The name can be a full name or a prefix consisting of complete path parts. 
 E.g. 'MyCompany/BarTech' will not match 'MyCompany/BarTechCorp', but will match 'MyCompany/BarTech/BazLamp'.
 
-Name pattern, filters and search can be combined to narrow down the result.`,
+Name pattern, filters and search can be combined to narrow down the result.
+TMs which already exist in the output directory with the same digest are skipped, so that an interrupted pull can be resumed.`,
 	Args:              cobra.MaximumNArgs(1),
 	Run:               executePull,
 	ValidArgsFunction: completion.CompleteTMNames,
@@ -41,6 +42,8 @@ func init() {
 	pullCmd.Flags().StringVarP(&pFilterFlags.Search, "search", "s", "", "search TMs by their content matching the search term")
 	_ = pullCmd.MarkFlagRequired("output")
 	pullCmd.Flags().BoolP("restore-id", "R", false, "restore the TMs' original external ids, if they had one")
+	pullCmd.Flags().IntP("jobs", "j", defaultPullJobs, "maximum number of TMs to fetch concurrently")
+	pullCmd.Flags().Bool("latest-only", false, "pull only the most recent version of each TM")
 }
 
 func executePull(cmd *cobra.Command, args []string) {
@@ -48,11 +51,17 @@ func executePull(cmd *cobra.Command, args []string) {
 	dirName := cmd.Flag("directory").Value.String()
 	outputPath := cmd.Flag("output").Value.String()
 	restoreId, _ := cmd.Flags().GetBool("restore-id")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	latestOnly, _ := cmd.Flags().GetBool("latest-only")
+	if jobs < 1 {
+		cli.Stderrf("--jobs must be at least 1")
+		cli.Exit(1)
+	}
 
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
 	name := ""
@@ -60,10 +69,14 @@ func executePull(cmd *cobra.Command, args []string) {
 		name = args[0]
 	}
 	search := cli.CreateSearchParamsFromCLI(pFilterFlags, name)
-	err = cli.Pull(context.Background(), spec, search, outputPath, restoreId)
+	err = cli.Pull(cmd.Context(), spec, search, outputPath, cli.PullOptions{
+		RestoreId:  restoreId,
+		Jobs:       jobs,
+		LatestOnly: latestOnly,
+	})
 
 	if err != nil {
 		cli.Stderrf("pull failed")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
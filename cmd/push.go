@@ -1,10 +1,11 @@
 package cmd
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -22,6 +23,9 @@ file-or-dirname
 	The name of the file or directory to push. Pushing a directory will walk the directory tree recursively and 
 	push all found ThingModels.
 
+With --watch, the directory is pushed and then watched for changes. Created or modified ThingModel files are validated
+and pushed as soon as they are saved, and the index is updated with the pushed ThingModels.
+
 Specifying the target repository with --directory or --repo is optional if there's exactly one enabled named catalog in the config
 `,
 	Args: cobra.ExactArgs(1),
@@ -39,6 +43,11 @@ func init() {
 	pushCmd.Flags().BoolP("opt-tree", "t", false, `Use original directory tree structure below file-or-dirname as --opt-path for each found ThingModel file.
 	Has no effect when file-or-dirname points to a file.
 	Overrides --opt-path`)
+	pushCmd.Flags().Bool("atomic", false, `Push all files or none. All files are validated and prepared before any of them is pushed, and are then
+	committed together with the index update. Supported only by local file repositories`)
+	pushCmd.Flags().Bool("watch", false, `Push the directory and keep watching it, pushing every created or modified ThingModel file until interrupted.
+	Deleting a file does not delete the ThingModel from the repository`)
+	pushCmd.MarkFlagsMutuallyExclusive("watch", "atomic")
 }
 
 func executePush(cmd *cobra.Command, args []string) {
@@ -46,18 +55,36 @@ func executePush(cmd *cobra.Command, args []string) {
 	dirName := cmd.Flag("directory").Value.String()
 	optPath := cmd.Flag("opt-path").Value.String()
 	optTree, _ := cmd.Flags().GetBool("opt-tree")
+	atomic, _ := cmd.Flags().GetBool("atomic")
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
-	results, err := cli.NewPushExecutor(time.Now).Push(context.Background(), args[0], spec, optPath, optTree)
+	e := cli.NewPushExecutor(time.Now)
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = e.Watch(ctx, args[0], spec, optPath, optTree, func(res cli.PushResult) {
+			fmt.Println(res)
+		})
+		if err != nil {
+			cli.Stderrf("watch failed: %v", err)
+			cli.Exit(1)
+		}
+		return
+	}
+	push := e.Push
+	if atomic {
+		push = e.PushAtomic
+	}
+	results, err := push(cmd.Context(), args[0], spec, optPath, optTree)
 	for _, res := range results {
 		fmt.Println(res)
 	}
 	if err != nil {
 		fmt.Println("push failed")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
@@ -1,8 +1,6 @@
 package repo
 
 import (
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd"
 	"github.com/wot-oss/tmc/internal/app/cli"
@@ -31,6 +29,6 @@ func init() {
 func repoList(cmd *cobra.Command, args []string) {
 	err := cli.RepoList()
 	if err != nil {
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
@@ -1,8 +1,6 @@
 package repo
 
 import (
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
 	"github.com/wot-oss/tmc/internal/app/cli"
@@ -21,7 +19,7 @@ the config may be a simple string, like a URL, or a json file.
 		typ, err := cmd.Flags().GetString("type")
 		if err != nil {
 			cli.Stderrf("internal error: %v", err)
-			os.Exit(1)
+			cli.Exit(1)
 		}
 		name := args[0]
 		confStr := ""
@@ -32,13 +30,13 @@ the config may be a simple string, like a URL, or a json file.
 		confFile, err := cmd.Flags().GetString("file")
 		if err != nil {
 			cli.Stderrf("internal error: %v", err)
-			os.Exit(1)
+			cli.Exit(1)
 		}
 
 		err = cli.RepoAdd(name, typ, confStr, confFile)
 		if err != nil {
 			_ = cmd.Usage()
-			os.Exit(1)
+			cli.Exit(1)
 		}
 	},
 }
@@ -1,8 +1,6 @@
 package repo
 
 import (
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
 	"github.com/wot-oss/tmc/internal/app/cli"
@@ -17,7 +15,7 @@ var repoRenameCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := cli.RepoRename(args[0], args[1])
 		if err != nil {
-			os.Exit(1)
+			cli.Exit(1)
 		}
 	},
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+)
+
+// repoSetPriorityCmd represents the 'repo set-priority' command
+var repoSetPriorityCmd = &cobra.Command{
+	Use:   "set-priority <name> <priority>",
+	Short: "Set the priority of the named repository",
+	Long: `Set the priority of the named repository. The priority is an integer, which defaults to 0.
+When the same TM is found in several repositories, the one from the repository with the highest priority is used.
+Repositories with equal priorities are ranked by name.`,
+	Example: `tmc repo set-priority internal 10`,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := cli.RepoSetPriority(args[0], args[1])
+		if err != nil {
+			cli.Exit(1)
+		}
+	},
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return completion.CompleteRepoNames(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoSetPriorityCmd)
+}
@@ -1,8 +1,6 @@
 package repo
 
 import (
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
 	"github.com/wot-oss/tmc/internal/app/cli"
@@ -17,7 +15,7 @@ var repoShowCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := cli.RepoShow(args[0])
 		if err != nil {
-			os.Exit(1)
+			cli.Exit(1)
 		}
 	},
 	ValidArgsFunction: completion.CompleteRepoNames,
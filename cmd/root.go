@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"os"
 	"slices"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/cmd/completion"
 	"github.com/wot-oss/tmc/internal"
+	"github.com/wot-oss/tmc/internal/app/cli"
 	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/secrets"
+	"github.com/wot-oss/tmc/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -23,18 +28,41 @@ ThingModel catalogs.`,
 var loglevel string
 var logEnabledDefaultCmd = []string{"serve"}
 
+// longRunningCmd are the commands which are not traced as a whole, but export the spans of their operations in batches
+var longRunningCmd = []string{"serve"}
+
+var (
+	shutdownTracing = func(context.Context) error { return nil }
+	cmdSpan         trace.Span
+)
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the RootCmd.
 func Execute() {
 	cf := viper.ConfigFileUsed()
 	if cf == "" {
-		cf = "No config.json file found in ~/.tm-catalog or workdir. Using default settings"
+		cf = "No config.json file found in .tmc, ~/.tm-catalog or workdir. Using default settings"
+	}
+	if p := config.ActiveProfile(); p != "" {
+		cf += fmt.Sprintf(" with profile %s", p)
 	}
 	RootCmd.Long = RootCmd.Long + fmt.Sprintf("\n\nConfiguration file used: %s", cf)
 	err := RootCmd.Execute()
+	finishTracing()
 	if err != nil {
-		os.Exit(1)
+		cli.Exit(1)
+	}
+}
+
+// finishTracing ends the span covering the command and exports the pending spans. It is run when the command returns
+// and when it exits early with cli.Exit
+func finishTracing() {
+	if cmdSpan != nil {
+		cmdSpan.End()
+		cmdSpan = nil
 	}
+	_ = shutdownTracing(context.Background())
+	shutdownTracing = func(context.Context) error { return nil }
 }
 
 func init() {
@@ -42,15 +70,31 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.tmc.yaml)")
+	RootCmd.PersistentFlags().String(config.KeyConfig, "", "config file to use (env var TMC_CONFIG). By default, the first found of .tmc/config.json in the working directory or its parents, if trusted with 'config trust', ~/.tm-catalog/config.json, and ./config.json")
+	_ = RootCmd.MarkPersistentFlagFilename(config.KeyConfig, "json")
+	RootCmd.PersistentFlags().String(config.KeyProfile, "", "name of the profile from the config file to apply (env var TMC_PROFILE)")
+	_ = RootCmd.RegisterFlagCompletionFunc(config.KeyProfile, completion.CompleteProfiles)
 	RootCmd.PersistentFlags().StringVarP(&loglevel, "loglevel", "l", "", "enable logging by setting a log level, one of [error, warn, info, debug, off]")
 	RootCmd.PersistentPreRun = preRunAll
 	config.InitViper()
 	// bind viper variable "loglevel" to CLI flag --loglevel of root command
 	_ = viper.BindPFlag(config.KeyLogLevel, RootCmd.PersistentFlags().Lookup("loglevel"))
+	_ = viper.BindPFlag(config.KeyConfig, RootCmd.PersistentFlags().Lookup(config.KeyConfig))
+	_ = viper.BindPFlag(config.KeyProfile, RootCmd.PersistentFlags().Lookup(config.KeyProfile))
+	secrets.PromptPassphrase = cli.PromptPassphrase
+	cli.OnExit(finishTracing)
 }
 
 func preRunAll(cmd *cobra.Command, args []string) {
+	// the config file has been read before flags were parsed. Read it again, if flags select another one, and to
+	// report a missing profile
+	if cmd != nil && (cmd.Flags().Changed(config.KeyConfig) || viper.GetString(config.KeyProfile) != "") {
+		err := config.LoadConfigFile()
+		if err != nil {
+			cli.Stderrf("cannot read config: %v", err)
+			cli.Exit(1)
+		}
+	}
 	// set default loglevel depending on subcommand
 	logDefault := cmd != nil && slices.Contains(logEnabledDefaultCmd, cmd.CalledAs())
 	if logDefault {
@@ -59,5 +103,31 @@ func preRunAll(cmd *cobra.Command, args []string) {
 		viper.SetDefault(config.KeyLogLevel, config.LogLevelOff)
 	}
 
+	if f := config.UntrustedConfigFile(); f != "" && cmd != configTrustCmd {
+		cli.Stderrf("ignoring untrusted project config %s. Review it and run 'tmc config trust' to use it", f)
+	}
 	internal.InitLogging()
+	initTracing(cmd)
+}
+
+// initTracing sets up the export of spans and starts the span covering cmd, unless cmd is long-running
+func initTracing(cmd *cobra.Command) {
+	longRunning := cmd != nil && slices.Contains(longRunningCmd, cmd.CalledAs())
+	shutdown, err := tracing.Init(context.Background(), tracing.Options{
+		Exporter: viper.GetString(config.KeyTracingExporter),
+		Endpoint: viper.GetString(config.KeyTracingEndpoint),
+		Version:  cli.TmcVersion,
+		Batch:    longRunning,
+	})
+	if err != nil {
+		cli.Stderrf("cannot initialize tracing: %v", err)
+		cli.Exit(1)
+	}
+	shutdownTracing = shutdown
+	if cmd == nil || longRunning {
+		return
+	}
+	ctx, span := tracing.Start(cmd.Context(), cmd.CommandPath())
+	cmdSpan = span
+	cmd.SetContext(ctx)
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage secrets referenced by repo configs",
+	Long: `The command secret and its subcommands allow to manage the secret store, which keeps credentials out of the
+plaintext config file. The store is a file encrypted with a passphrase, given by config key secretsFile
+(env var TMC_SECRETSFILE, default ~/.tm-catalog/secrets.enc). The passphrase is taken from env var
+TMC_SECRETSPASSPHRASE or asked for on the terminal.
+Repo config values reference secrets with ${secret:<name>}, environment variables with ${env:<VAR>}, and the
+contents of files with ${file:<path>}. See also 'repo set-auth --store'.
+When no subcommand is given, defaults to list.`,
+	Args: cobra.NoArgs,
+	Run:  executeSecretList,
+}
+
+var secretListCmd = &cobra.Command{
+	Use:               "list",
+	Short:             "List secrets",
+	Long:              `List the names of the secrets in the store. The secrets themselves are not shown.`,
+	Args:              cobra.NoArgs,
+	Run:               executeSecretList,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <name> [<value>]",
+	Short: "Store a secret",
+	Long: `Store a secret with given name, replacing an existing one. If the value is omitted, it is read from the terminal
+without echo, or from stdin. Prefer this over giving the value as argument, which may end up in the shell history.`,
+	Example:           "secret set gitlab-token\necho $GITLAB_TOKEN | tmc secret set gitlab-token",
+	Args:              cobra.RangeArgs(1, 2),
+	Run:               executeSecretSet,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+var secretDeleteCmd = &cobra.Command{
+	Use:               "delete <name>",
+	Short:             "Delete a secret",
+	Long:              `Delete the secret with given name from the store. Repo configs referencing it cannot be used anymore.`,
+	Args:              cobra.ExactArgs(1),
+	Run:               executeSecretDelete,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+func init() {
+	RootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretListCmd)
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretDeleteCmd)
+}
+
+func executeSecretList(cmd *cobra.Command, args []string) {
+	err := cli.SecretList()
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeSecretSet(cmd *cobra.Command, args []string) {
+	value := ""
+	if len(args) > 1 {
+		value = args[1]
+	}
+	err := cli.SecretSet(args[0], value)
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeSecretDelete(cmd *cobra.Command, args []string) {
+	err := cli.SecretDelete(args[0])
+	if err != nil {
+		cli.Exit(1)
+	}
+}
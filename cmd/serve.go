@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"errors"
-	"os"
 
+	"github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/app/http/accesslog"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
 	"github.com/wot-oss/tmc/internal/app/http/cors"
+	"github.com/wot-oss/tmc/internal/app/http/mtls"
 	"github.com/wot-oss/tmc/internal/model"
 
 	"github.com/wot-oss/tmc/internal/app/http/jwt"
@@ -47,6 +50,32 @@ func init() {
 	serveCmd.Flags().Bool(config.KeyJWTValidation, false, "If set to 'true', jwt tokens are used to grant access to the API (env var TMC_JWTVALIDATION)")
 	serveCmd.Flags().String(config.KeyJWTServiceID, "", "If set to an identifier, value will be compared to 'aud' claim in validated JWT (env var TMC_JWTSERVICEID)")
 	serveCmd.Flags().String(config.KeyJWKSURL, "", "URL to periodically fetch JSON Web Key Sets for token validation (env var TMC_JWKSURL)")
+	serveCmd.Flags().Bool(config.KeyAPIKeyValidation, false, "If set to 'true', API keys created with 'serve keys create' are used to grant access to the API (env var TMC_APIKEYVALIDATION)")
+	serveCmd.PersistentFlags().String(config.KeyAPIKeysFile, "", "File to store API keys in (env var TMC_APIKEYSFILE, default ~/.tm-catalog/apikeys.json)")
+	_ = serveCmd.MarkPersistentFlagFilename(config.KeyAPIKeysFile)
+	serveCmd.Flags().String("tls-cert", "", "PEM file with the server certificate. Enables HTTPS. The file is reloaded when changed (env var TMC_TLSCERT)")
+	serveCmd.Flags().String("tls-key", "", "PEM file with the private key for --tls-cert (env var TMC_TLSKEY)")
+	serveCmd.Flags().String("tls-client-ca", "", "PEM file with CA certificates to verify client certificates with. Enables mutual TLS (env var TMC_TLSCLIENTCA)")
+	serveCmd.Flags().String("tls-client-permissions", "", "JSON file mapping client certificate subjects to permissions (read, push, delete) (env var TMC_TLSCLIENTPERMISSIONS)")
+	serveCmd.Flags().Duration(config.KeyReadTimeout, 0, "Maximum duration for reading an entire request. 0 means no timeout (env var TMC_READTIMEOUT, default 1m)")
+	serveCmd.Flags().Duration(config.KeyWriteTimeout, 0, "Maximum duration before timing out writes of a response. 0 means no timeout (env var TMC_WRITETIMEOUT, default 1m)")
+	serveCmd.Flags().Duration(config.KeyIdleTimeout, 0, "Maximum time to wait for the next request on a keep-alive connection. 0 means no timeout (env var TMC_IDLETIMEOUT, default 2m)")
+	serveCmd.Flags().Duration(config.KeyShutdownTimeout, 0, "Maximum time to wait for in-flight requests to complete on SIGINT or SIGTERM. 0 means no timeout (env var TMC_SHUTDOWNTIMEOUT, default 30s)")
+	serveCmd.Flags().Duration(config.KeyShutdownDelay, 0, "Time to keep serving requests after the readiness probe started failing on shutdown (env var TMC_SHUTDOWNDELAY)")
+	serveCmd.Flags().Int64(config.KeyMaxPushBodySize, 0, "Maximum size in bytes of a TM pushed via the REST API. 0 or less means no limit (env var TMC_MAXPUSHBODYSIZE, default 10485760)")
+	serveCmd.Flags().Int64(config.KeyMaxBulkPushBodySize, 0, "Maximum size in bytes of a request pushing multiple TMs via the REST API. 0 or less means no limit (env var TMC_MAXBULKPUSHBODYSIZE, default 104857600)")
+	serveCmd.Flags().Bool(config.KeyWatchRepos, true, "Watch file repositories for changes made by other programs, e.g. git, and update their index (env var TMC_WATCHREPOS)")
+	serveCmd.Flags().Duration(config.KeyIndexLockTimeout, 0, "Maximum time to wait for the lock on a repository index, unless configured per repository (env var TMC_INDEXLOCKTIMEOUT, default 5s)")
+	serveCmd.Flags().Duration(config.KeyHealthTimeout, 0, "Maximum time to wait for a repository to answer a health probe (env var TMC_HEALTHTIMEOUT, default 5s)")
+	serveCmd.Flags().Duration(config.KeyHealthMaxIndexAge, 0, "Report a file repository as degraded if it has a TM changed longer than this after its index has last been updated. 0 means no limit (env var TMC_HEALTHMAXINDEXAGE)")
+	serveCmd.Flags().String(config.KeyHealthTolerance, "", "Which failing repositories make the service unavailable: 'none' tolerates no failing repository, 'remote' tolerates failing remote repositories, 'all' tolerates any as long as one repository is up (env var TMC_HEALTHTOLERANCE, default remote)")
+	serveCmd.Flags().String(config.KeyPromotionRepos, "", "Comma-separated list of repositories allowed as source and target of promotions via the REST API. If omitted, TMs can only be promoted from the served repositories to the push target (env var TMC_PROMOTIONREPOS)")
+	serveCmd.Flags().String(config.KeyAccessLogFormat, "", "Format of the access log, one of 'none', 'json' or 'clf' (common log format) (env var TMC_ACCESSLOGFORMAT, default none)")
+	serveCmd.Flags().String(config.KeyAccessLogFile, "", "File to append the access log to (env var TMC_ACCESSLOGFILE, default stdout)")
+	_ = serveCmd.MarkFlagFilename("tls-cert")
+	_ = serveCmd.MarkFlagFilename("tls-key")
+	_ = serveCmd.MarkFlagFilename("tls-client-ca")
+	_ = serveCmd.MarkFlagFilename("tls-client-permissions")
 
 	_ = viper.BindPFlag(config.KeyUrlContextRoot, serveCmd.Flags().Lookup(config.KeyUrlContextRoot))
 	_ = viper.BindPFlag(config.KeyCorsAllowedOrigins, serveCmd.Flags().Lookup(config.KeyCorsAllowedOrigins))
@@ -56,6 +85,27 @@ func init() {
 	_ = viper.BindPFlag(config.KeyJWTValidation, serveCmd.Flags().Lookup(config.KeyJWTValidation))
 	_ = viper.BindPFlag(config.KeyJWTServiceID, serveCmd.Flags().Lookup(config.KeyJWTServiceID))
 	_ = viper.BindPFlag(config.KeyJWKSURL, serveCmd.Flags().Lookup(config.KeyJWKSURL))
+	_ = viper.BindPFlag(config.KeyAPIKeyValidation, serveCmd.Flags().Lookup(config.KeyAPIKeyValidation))
+	_ = viper.BindPFlag(config.KeyAPIKeysFile, serveCmd.PersistentFlags().Lookup(config.KeyAPIKeysFile))
+	_ = viper.BindPFlag(config.KeyReadTimeout, serveCmd.Flags().Lookup(config.KeyReadTimeout))
+	_ = viper.BindPFlag(config.KeyWriteTimeout, serveCmd.Flags().Lookup(config.KeyWriteTimeout))
+	_ = viper.BindPFlag(config.KeyIdleTimeout, serveCmd.Flags().Lookup(config.KeyIdleTimeout))
+	_ = viper.BindPFlag(config.KeyShutdownTimeout, serveCmd.Flags().Lookup(config.KeyShutdownTimeout))
+	_ = viper.BindPFlag(config.KeyShutdownDelay, serveCmd.Flags().Lookup(config.KeyShutdownDelay))
+	_ = viper.BindPFlag(config.KeyMaxPushBodySize, serveCmd.Flags().Lookup(config.KeyMaxPushBodySize))
+	_ = viper.BindPFlag(config.KeyMaxBulkPushBodySize, serveCmd.Flags().Lookup(config.KeyMaxBulkPushBodySize))
+	_ = viper.BindPFlag(config.KeyWatchRepos, serveCmd.Flags().Lookup(config.KeyWatchRepos))
+	_ = viper.BindPFlag(config.KeyIndexLockTimeout, serveCmd.Flags().Lookup(config.KeyIndexLockTimeout))
+	_ = viper.BindPFlag(config.KeyHealthTimeout, serveCmd.Flags().Lookup(config.KeyHealthTimeout))
+	_ = viper.BindPFlag(config.KeyHealthMaxIndexAge, serveCmd.Flags().Lookup(config.KeyHealthMaxIndexAge))
+	_ = viper.BindPFlag(config.KeyHealthTolerance, serveCmd.Flags().Lookup(config.KeyHealthTolerance))
+	_ = viper.BindPFlag(config.KeyPromotionRepos, serveCmd.Flags().Lookup(config.KeyPromotionRepos))
+	_ = viper.BindPFlag(config.KeyAccessLogFormat, serveCmd.Flags().Lookup(config.KeyAccessLogFormat))
+	_ = viper.BindPFlag(config.KeyAccessLogFile, serveCmd.Flags().Lookup(config.KeyAccessLogFile))
+	_ = viper.BindPFlag(config.KeyTLSCert, serveCmd.Flags().Lookup("tls-cert"))
+	_ = viper.BindPFlag(config.KeyTLSKey, serveCmd.Flags().Lookup("tls-key"))
+	_ = viper.BindPFlag(config.KeyTLSClientCA, serveCmd.Flags().Lookup("tls-client-ca"))
+	_ = viper.BindPFlag(config.KeyTLSClientPermissions, serveCmd.Flags().Lookup("tls-client-permissions"))
 }
 
 func serve(cmd *cobra.Command, args []string) {
@@ -67,7 +117,7 @@ func serve(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repo, dir)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of repository to be served. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
 	opts := getServeOptions()
@@ -79,7 +129,7 @@ func serve(cmd *cobra.Command, args []string) {
 	err = cli.Serve(host, port, opts, spec, pushSpec)
 	if err != nil {
 		cli.Stderrf("serve failed")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
 
@@ -89,7 +139,38 @@ func getServeOptions() cli.ServeOptions {
 	opts.UrlCtxRoot = viper.GetString(config.KeyUrlContextRoot)
 	opts.JWTValidation = viper.GetBool(config.KeyJWTValidation)
 	opts.JWTValidationOpts = getJWKSOptions()
+	opts.APIKeyValidation = viper.GetBool(config.KeyAPIKeyValidation)
+	opts.APIKeyValidationOpts = apikey.APIKeyValidationOpts{
+		KeysFile: viper.GetString(config.KeyAPIKeysFile),
+	}
+	opts.ServerOpts = mtls.ServerOpts{
+		CertFile:     viper.GetString(config.KeyTLSCert),
+		KeyFile:      viper.GetString(config.KeyTLSKey),
+		ClientCAFile: viper.GetString(config.KeyTLSClientCA),
+	}
+	opts.ClientPermissionsFile = viper.GetString(config.KeyTLSClientPermissions)
+	opts.ServerTimeouts = cli.ServerTimeouts{
+		ReadTimeout:     viper.GetDuration(config.KeyReadTimeout),
+		WriteTimeout:    viper.GetDuration(config.KeyWriteTimeout),
+		IdleTimeout:     viper.GetDuration(config.KeyIdleTimeout),
+		ShutdownTimeout: viper.GetDuration(config.KeyShutdownTimeout),
+		ShutdownDelay:   viper.GetDuration(config.KeyShutdownDelay),
+	}
+	opts.MaxPushBodySize = viper.GetInt64(config.KeyMaxPushBodySize)
+	opts.MaxBulkPushBodySize = viper.GetInt64(config.KeyMaxBulkPushBodySize)
+	opts.WatchRepos = viper.GetBool(config.KeyWatchRepos)
 	opts.CORSOptions = getCORSOptions()
+	opts.PromoteValidations = GetPromoteValidations()
+	opts.PromotionRepos = utils.ParseAsList(viper.GetString(config.KeyPromotionRepos), cli.DefaultListSeparator, true)
+	opts.HealthOptions = http.HealthOptions{
+		Timeout:     viper.GetDuration(config.KeyHealthTimeout),
+		MaxIndexAge: viper.GetDuration(config.KeyHealthMaxIndexAge),
+		Tolerance:   viper.GetString(config.KeyHealthTolerance),
+	}
+	opts.AccessLogOptions = accesslog.Options{
+		Format: viper.GetString(config.KeyAccessLogFormat),
+		File:   viper.GetString(config.KeyAccessLogFile),
+	}
 	return opts
 }
 
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/cmd/completion"
+	"github.com/wot-oss/tmc/internal/app/cli"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+var serveKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage API keys for the REST API server",
+	Long: `The command keys and its subcommands allow to manage the API keys which grant access to the REST API
+when the server is started with --apiKeyValidation=true. Keys are stored hashed in the file given by
+--apiKeysFile (env var TMC_APIKEYSFILE, default ~/.tm-catalog/apikeys.json).
+Changes take effect immediately, also on a running server.
+When no subcommand is given, defaults to list.`,
+	Args: cobra.NoArgs,
+	Run:  executeServeKeysList,
+}
+
+var serveKeysListCmd = &cobra.Command{
+	Use:               "list",
+	Short:             "List API keys",
+	Long:              `List API keys with their permissions and expiry. The keys themselves are not shown.`,
+	Args:              cobra.NoArgs,
+	Run:               executeServeKeysList,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+var serveKeysCreateCmd = &cobra.Command{
+	Use:   "create <name> --permissions <permissions> [--expires <expiry>]",
+	Short: "Create an API key",
+	Long: fmt.Sprintf(`Create an API key with given name and permissions and print it.
+The key is shown only once and cannot be recovered later.
+Permissions are a comma-separated list of %v. 'read' grants access to GET endpoints, 'push' to POST endpoints
+and 'delete' to DELETE endpoints.
+Expiry can be given as a duration from now, e.g. 720h, as a date YYYY-MM-DD or as an RFC3339 timestamp.`, apikey.SupportedPermissions),
+	Example:           "serve keys create plant-a-reader --permissions read --expires 2025-12-31",
+	Args:              cobra.ExactArgs(1),
+	Run:               executeServeKeysCreate,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+var serveKeysRevokeCmd = &cobra.Command{
+	Use:               "revoke <id>",
+	Short:             "Revoke an API key",
+	Long:              `Revoke the API key with given id. Requests using the key are rejected from then on.`,
+	Args:              cobra.ExactArgs(1),
+	Run:               executeServeKeysRevoke,
+	ValidArgsFunction: completion.NoCompletionNoFile,
+}
+
+func init() {
+	serveCmd.AddCommand(serveKeysCmd)
+	serveKeysCmd.AddCommand(serveKeysListCmd)
+	serveKeysCmd.AddCommand(serveKeysCreateCmd)
+	serveKeysCmd.AddCommand(serveKeysRevokeCmd)
+	serveKeysCreateCmd.Flags().String("permissions", "", fmt.Sprintf("Comma-separated list of permissions granted by the key, out of %v", apikey.SupportedPermissions))
+	_ = serveKeysCreateCmd.MarkFlagRequired("permissions")
+	_ = serveKeysCreateCmd.RegisterFlagCompletionFunc("permissions", completion.NoCompletionNoFile)
+	serveKeysCreateCmd.Flags().String("expires", "", "Expiry of the key as duration, date or timestamp. The key does not expire if omitted")
+	_ = serveKeysCreateCmd.RegisterFlagCompletionFunc("expires", completion.NoCompletionNoFile)
+}
+
+func executeServeKeysList(cmd *cobra.Command, args []string) {
+	err := cli.APIKeyList(viper.GetString(config.KeyAPIKeysFile))
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeServeKeysCreate(cmd *cobra.Command, args []string) {
+	perms := utils.ParseAsList(cmd.Flag("permissions").Value.String(), cli.DefaultListSeparator, true)
+	expires, err := parseExpiry(cmd.Flag("expires").Value.String(), time.Now())
+	if err != nil {
+		cli.Stderrf("invalid --expires: %v", err)
+		cli.Exit(1)
+	}
+	err = cli.APIKeyCreate(viper.GetString(config.KeyAPIKeysFile), args[0], perms, expires)
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+func executeServeKeysRevoke(cmd *cobra.Command, args []string) {
+	err := cli.APIKeyRevoke(viper.GetString(config.KeyAPIKeysFile), args[0])
+	if err != nil {
+		cli.Exit(1)
+	}
+}
+
+// parseExpiry parses s as a duration from now, a date or an RFC3339 timestamp. Returns nil if s is empty
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("duration must be positive: %s", s)
+		}
+		t := now.Add(d)
+		return &t, nil
+	}
+	t, err := parseTimeFlag(s, true)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/internal/app/cli"
 )
@@ -15,7 +13,7 @@ var validateCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := cli.ValidateFile(args[0])
 		if err != nil {
-			os.Exit(1)
+			cli.Exit(1)
 		}
 	},
 }
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"context"
 	"errors"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmc/cmd/completion"
@@ -34,12 +32,12 @@ func listVersions(cmd *cobra.Command, args []string) {
 	spec, err := model.NewSpec(repoName, dirName)
 	if errors.Is(err, model.ErrInvalidSpec) {
 		cli.Stderrf("Invalid specification of target repository. --repo and --directory are mutually exclusive. Set at most one")
-		os.Exit(1)
+		cli.Exit(1)
 	}
 
 	name := args[0]
-	err = cli.ListVersions(context.Background(), spec, name)
+	err = cli.ListVersions(cmd.Context(), spec, name)
 	if err != nil {
-		os.Exit(1)
+		cli.Exit(1)
 	}
 }
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+)
+
+// APIKeyCreate creates a new API key in keysFile and prints it. The plain key is printed only once
+func APIKeyCreate(keysFile, name string, permissions []string, expires *time.Time) error {
+	perms, err := apikey.ParsePermissions(permissions)
+	if err != nil {
+		Stderrf("%v", err)
+		return err
+	}
+	plain, k, err := apikey.NewStore(keysFile).Create(name, perms, expires, time.Now())
+	if err != nil {
+		Stderrf("could not create API key: %v", err)
+		return err
+	}
+	fmt.Printf("created API key %s\n", k.ID)
+	fmt.Println(plain)
+	Stderrf("Store the key in a safe place. It cannot be shown again")
+	return nil
+}
+
+// APIKeyList prints all API keys in keysFile without their secrets
+func APIKeyList(keysFile string) error {
+	keys, err := apikey.NewStore(keysFile).List()
+	if err != nil {
+		Stderrf("could not read API keys: %v", err)
+		return err
+	}
+	colWidth := columnWidth()
+	now := time.Now()
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(table, "ID\tNAME\tPERMISSIONS\tCREATED\tEXPIRES\n")
+	for _, k := range keys {
+		var perms []string
+		for _, p := range k.Permissions {
+			perms = append(perms, string(p))
+		}
+		exp := "never"
+		if k.Expires != nil {
+			exp = k.Expires.Format(time.RFC3339)
+			if k.IsExpired(now) {
+				exp += " (expired)"
+			}
+		}
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", k.ID, elideString(k.Name, colWidth), strings.Join(perms, DefaultListSeparator),
+			k.Created.Format(time.RFC3339), exp)
+	}
+	_ = table.Flush()
+	return nil
+}
+
+// APIKeyRevoke removes the API key with given id from keysFile
+func APIKeyRevoke(keysFile, id string) error {
+	err := apikey.NewStore(keysFile).Revoke(id)
+	if err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			Stderrf("API key %s not found", id)
+		} else {
+			Stderrf("could not revoke API key: %v", err)
+		}
+		return err
+	}
+	fmt.Printf("revoked API key %s\n", id)
+	return nil
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/audit"
+)
+
+const (
+	AuditFormatTable = "table"
+	AuditFormatJSON  = "json"
+)
+
+// AuditQuery prints the records of the configured audit log which match filter in given format
+func AuditQuery(filter audit.Filter, format string) error {
+	l := audit.Default()
+	if l == nil {
+		Stderrf("audit log is disabled. Set an audit log file to enable it")
+		return errors.New("audit log disabled")
+	}
+	recs, err := l.Query(filter)
+	if err != nil {
+		Stderrf("could not read audit log: %v", err)
+		return err
+	}
+	switch format {
+	case AuditFormatJSON:
+		for _, r := range recs {
+			b, _ := json.Marshal(r)
+			fmt.Println(string(b))
+		}
+	case AuditFormatTable, "":
+		printAuditRecords(recs)
+	default:
+		Stderrf("unknown output format: %s", format)
+		return ErrInvalidArgs
+	}
+	return nil
+}
+
+func printAuditRecords(recs []audit.Record) {
+	colWidth := columnWidth()
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(table, "TIME\tOPERATION\tREPO\tTMID\tDETAIL\tUSER\tSUBJECT\tCLIENT\n")
+	for _, r := range recs {
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Format(time.RFC3339), r.Operation, elideString(r.Repo, colWidth), r.TMID, r.Detail,
+			elideString(r.User, colWidth), elideString(r.Subject, colWidth), r.ClientIP)
+	}
+	_ = table.Flush()
+}
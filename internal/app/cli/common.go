@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
@@ -16,6 +17,30 @@ const DefaultListSeparator = ","
 
 var TmcVersion = "n/a"
 
+var (
+	exitHooksMu sync.Mutex
+	exitHooks   []func()
+)
+
+// OnExit registers f to be run by Exit before the process exits
+func OnExit(f func()) {
+	exitHooksMu.Lock()
+	defer exitHooksMu.Unlock()
+	exitHooks = append(exitHooks, f)
+}
+
+// Exit runs the functions registered with OnExit and exits the process with code. Commands exit with Exit instead of
+// os.Exit, which does not run deferred functions, so that work like exporting the command's traces is not lost
+func Exit(code int) {
+	exitHooksMu.Lock()
+	hooks := exitHooks
+	exitHooksMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+	os.Exit(code)
+}
+
 // Stderrf prints a message to os.Stderr, followed by newline
 func Stderrf(format string, args ...any) {
 	_, _ = fmt.Fprintf(os.Stderr, format, args...)
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/config"
+)
+
+var ErrUnknownConfigKey = errors.New("unknown config key")
+var ErrConfigFileNotFound = errors.New("config file not found")
+var ErrInvalidConfigValue = errors.New("invalid config value")
+
+// ConfigList prints the effective values of all keys settable with ConfigSet
+func ConfigList() error {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(table, "KEY\tVALUE\n")
+	for _, k := range config.SettableKeys {
+		_, _ = fmt.Fprintf(table, "%s\t%v\n", k, viper.Get(k))
+	}
+	_ = table.Flush()
+	return nil
+}
+
+// ConfigGet prints the effective value of key
+func ConfigGet(key string) error {
+	k, ok := config.SettableKey(key)
+	if !ok {
+		Stderrf("unknown config key: %s. Known keys are %v", key, config.SettableKeys)
+		return ErrUnknownConfigKey
+	}
+	fmt.Println(viper.Get(k))
+	return nil
+}
+
+// ConfigSet saves value for key in the config file in use, or in the active profile of it. Booleans and integers are
+// saved as such, all other values, including durations, as strings
+func ConfigSet(key, value string) error {
+	k, ok := config.SettableKey(key)
+	if !ok {
+		Stderrf("unknown config key: %s. Known keys are %v", key, config.SettableKeys)
+		return ErrUnknownConfigKey
+	}
+	if k == config.KeyHealthTolerance && !slices.Contains(config.HealthTolerances, value) {
+		err := fmt.Errorf("%w: %s must be one of %s", ErrInvalidConfigValue, k, strings.Join(config.HealthTolerances, ", "))
+		Stderrf(err.Error())
+		return err
+	}
+	var v any = value
+	if slices.Contains(config.DurationKeys, k) {
+		// a bare number would be read as nanoseconds
+		if _, err := time.ParseDuration(value); err != nil {
+			err := fmt.Errorf("%w: %s must be a duration with unit, e.g. \"30s\"", ErrInvalidConfigValue, k)
+			Stderrf(err.Error())
+			return err
+		}
+	} else if value == "true" || value == "false" {
+		v = value == "true"
+	} else if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		v = i
+	}
+	err := config.Save(k, v)
+	if err != nil {
+		Stderrf("error saving config: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ConfigTrust trusts the config file, or the project config file found for the working directory if file is empty,
+// so that it is used when found as project config
+func ConfigTrust(file string) error {
+	if file == "" {
+		file = config.FindProjectConfigFile()
+		if file == "" {
+			Stderrf("no %s/config.json found in the working directory or its parents", config.ProjectConfigDir)
+			return ErrConfigFileNotFound
+		}
+	}
+	err := config.TrustConfigFile(file)
+	if err != nil {
+		Stderrf("error trusting config file: %v", err)
+		return err
+	}
+	fmt.Printf("trusted %s\n", file)
+	return nil
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/config"
+)
+
+func TestConfigSet(t *testing.T) {
+	orgDir := config.DefaultConfigDir
+	config.DefaultConfigDir = t.TempDir()
+	defer func() { config.DefaultConfigDir = orgDir }()
+	defer viper.Set(config.KeyReadTimeout, nil)
+	defer viper.Set(config.KeyAuditLogMaxBackups, nil)
+
+	t.Run("duration", func(t *testing.T) {
+		assert.NoError(t, ConfigSet("readTimeout", "90s"))
+		b, err := os.ReadFile(filepath.Join(config.DefaultConfigDir, "config.json"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), `"readTimeout": "90s"`)
+	})
+	t.Run("duration without unit", func(t *testing.T) {
+		assert.ErrorIs(t, ConfigSet("shutdownDelay", "5"), ErrInvalidConfigValue)
+		assert.ErrorIs(t, ConfigSet("healthMaxIndexAge", "an hour"), ErrInvalidConfigValue)
+	})
+	t.Run("integer", func(t *testing.T) {
+		assert.NoError(t, ConfigSet("auditLogMaxBackups", "5"))
+		assert.Equal(t, int64(5), viper.Get(config.KeyAuditLogMaxBackups))
+	})
+}
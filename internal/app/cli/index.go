@@ -2,7 +2,9 @@ package cli
 
 import (
 	"context"
+	"strings"
 
+	"github.com/wot-oss/tmc/internal/audit"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
 )
@@ -20,5 +22,10 @@ func Index(ctx context.Context, spec model.RepoSpec, ids []string) error {
 		Stderrf("could not create Index: %v", err)
 		return err
 	}
+	audit.Write(ctx, audit.Record{
+		Operation: audit.OpIndex,
+		TMID:      strings.Join(ids, ","),
+		Repo:      audit.RepoName(spec),
+	})
 	return nil
 }
@@ -32,13 +32,14 @@ func printIndex(res model.SearchResult) {
 	colWidth := columnWidth()
 	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 
-	_, _ = fmt.Fprintf(table, "NAME\tAUTHOR\tMANUFACTURER\tMPN\n")
+	_, _ = fmt.Fprintf(table, "NAME\tAUTHOR\tMANUFACTURER\tMPN\tREPOSITORY\n")
 	for _, value := range res.Entries {
 		name := value.Name
 		man := elideString(value.Manufacturer.Name, colWidth)
 		mpn := elideString(value.Mpn, colWidth)
 		auth := elideString(value.Author.Name, colWidth)
-		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", name, auth, man, mpn)
+		repo := formatSources(value.Sources())
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", name, auth, man, mpn, repo)
 	}
 	_ = table.Flush()
 }
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const progressBarWidth = 40
+
+// progressBar renders the progress of a long-running operation on a single terminal line.
+// When not writing to a terminal, it renders nothing and only passes on messages
+type progressBar struct {
+	mu      sync.Mutex
+	w       io.Writer
+	enabled bool
+	label   string
+	total   int
+	done    int
+}
+
+func newProgressBar(f *os.File, label string, total int) *progressBar {
+	return &progressBar{w: f, enabled: isTerminal(f), label: label, total: total}
+}
+
+// isTerminal reports whether f is a character device, i.e. most likely a terminal
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Increment marks one more item as done and redraws the bar
+func (b *progressBar) Increment() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done++
+	b.draw()
+}
+
+// Printf prints a message on a line of its own, followed by newline, without garbling the bar
+func (b *progressBar) Printf(format string, args ...any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	_, _ = fmt.Fprintf(b.w, format, args...)
+	_, _ = fmt.Fprintln(b.w)
+	b.draw()
+}
+
+// Finish removes the bar from the terminal
+func (b *progressBar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+}
+
+func (b *progressBar) clear() {
+	if !b.enabled {
+		return
+	}
+	_, _ = fmt.Fprint(b.w, "\r\033[K")
+}
+
+func (b *progressBar) draw() {
+	if !b.enabled || b.total == 0 {
+		return
+	}
+	filled := b.done * progressBarWidth / b.total
+	_, _ = fmt.Fprintf(b.w, "\r%s [%s%s] %d/%d", b.label, strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), b.done, b.total)
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressBar(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		b := &progressBar{w: buf, enabled: true, label: "Pulling", total: 4}
+		b.Increment()
+		assert.Contains(t, buf.String(), "\rPulling [==========                              ] 1/4")
+		buf.Reset()
+		b.Printf("error %d", 1)
+		assert.Equal(t, "\r\033[Kerror 1\n\rPulling [==========                              ] 1/4", buf.String())
+		buf.Reset()
+		b.Finish()
+		assert.Equal(t, "\r\033[K", buf.String())
+	})
+	t.Run("disabled", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		b := &progressBar{w: buf, label: "Pulling", total: 4}
+		b.Increment()
+		b.Printf("error %d", 1)
+		b.Finish()
+		assert.Equal(t, "error 1\n", buf.String())
+	})
+}
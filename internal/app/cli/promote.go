@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wot-oss/tmc/internal/audit"
+	"github.com/wot-oss/tmc/internal/commands"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+)
+
+func Promote(ctx context.Context, id string, from, to model.RepoSpec, opts commands.PromoteOptions) error {
+	promotedId, err := commands.NewPromoteCommand().Promote(ctx, from, to, id, opts)
+	if err != nil {
+		var errConflict *repos.ErrTMIDConflict
+		switch {
+		case errors.As(err, &errConflict):
+			Stderrf("Cannot promote %s: %s already contains a conflicting TM (%v) with id %s", id, to, errConflict.Type, errConflict.ExistingId)
+		case errors.Is(err, repos.ErrTmNotFound):
+			Stderrf("Cannot promote %s: not found in %s", id, from)
+		case errors.Is(err, audit.ErrLogDisabled):
+			Stderrf("Cannot promote %s: audit log is disabled. Set an audit log file to enable it", id)
+		default:
+			Stderrf("Cannot promote %s: %v", id, err)
+		}
+		return err
+	}
+	fmt.Printf("promoted %s from %s to %s\n", promotedId, from, to)
+	return nil
+}
@@ -6,15 +6,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/wot-oss/tmc/internal/commands"
 	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
 	"github.com/wot-oss/tmc/internal/utils"
 )
 
 const (
 	PullOK = PullResultType(iota)
 	PullErr
+	PullSkipped
 )
 
 type PullResultType int
@@ -25,6 +28,8 @@ func (t PullResultType) String() string {
 		return "OK"
 	case PullErr:
 		return "error"
+	case PullSkipped:
+		return "skipped"
 	default:
 		return "unknown"
 	}
@@ -40,7 +45,17 @@ func (r PullResult) String() string {
 	return fmt.Sprintf("%v\t %s %s", r.typ, r.tmid, r.text)
 }
 
-func Pull(ctx context.Context, repo model.RepoSpec, search *model.SearchParams, outputPath string, restoreId bool) error {
+// PullOptions control how TMs are pulled
+type PullOptions struct {
+	// RestoreId restores the TMs' original external ids, if they had one
+	RestoreId bool
+	// Jobs is the maximum number of TMs fetched concurrently
+	Jobs int
+	// LatestOnly limits pulling to the most recent version of each TM name
+	LatestOnly bool
+}
+
+func Pull(ctx context.Context, repo model.RepoSpec, search *model.SearchParams, outputPath string, opts PullOptions) error {
 	if len(outputPath) == 0 {
 		Stderrf("requires output target folder --output")
 		return errors.New("--output not provided")
@@ -57,29 +72,27 @@ func Pull(ctx context.Context, repo model.RepoSpec, search *model.SearchParams,
 		Stderrf("Error listing: %v", err)
 		return err
 	}
+	if opts.LatestOnly {
+		searchResult.Entries = commands.LatestVersions(searchResult.Entries)
+	}
 
-	vc := 0
+	var versions []model.FoundVersion
 	for _, m := range searchResult.Entries {
-		vc += len(m.Versions)
+		versions = append(versions, m.Versions...)
 	}
 
-	fmt.Printf("Pulling %d ThingModels with %d versions...\n", len(searchResult.Entries), vc)
-
-	var totalRes []PullResult
-	for _, entry := range searchResult.Entries {
-		for _, version := range entry.Versions {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+	fmt.Printf("Pulling %d ThingModels with %d versions...\n", len(searchResult.Entries), len(versions))
 
-			res, pErr := pullThingModel(ctx, outputPath, version, restoreId)
-			totalRes = append(totalRes, res)
-			if pErr != nil {
-				err = pErr
-			}
-		}
+	p := &puller{
+		outputPath: outputPath,
+		restoreId:  opts.RestoreId,
+		unions:     map[string]*repos.Union{},
+		progress:   newProgressBar(os.Stderr, "Pulling", len(versions)),
+	}
+	totalRes, err := p.pullAll(ctx, versions, opts.Jobs)
+	p.progress.Finish()
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
 	for _, res := range totalRes {
@@ -90,31 +103,118 @@ func Pull(ctx context.Context, repo model.RepoSpec, search *model.SearchParams,
 	return err
 }
 
-func pullThingModel(ctx context.Context, outputPath string, version model.FoundVersion, restoreId bool) (PullResult, error) {
+// puller fetches TMs and writes them to outputPath
+type puller struct {
+	outputPath string
+	restoreId  bool
+	// unions holds one repos.Union per repo the TMs have been found in. Must be complete before pulling starts
+	unions   map[string]*repos.Union
+	progress *progressBar
+}
+
+// pullAll pulls versions with at most jobs concurrent fetches. Returns the results in the order of versions
+// and the last error that occurred
+func (p *puller) pullAll(ctx context.Context, versions []model.FoundVersion, jobs int) ([]PullResult, error) {
+	for _, v := range versions {
+		spec := model.NewSpecFromFoundSource(v.FoundIn)
+		if _, ok := p.unions[spec.String()]; ok {
+			continue
+		}
+		u, err := repos.GetSpecdOrAll(spec)
+		if err != nil {
+			// versions from this repo fail in pullThingModel
+			p.progress.Printf("Could not initialize a repo instance for %s: %v", spec, err)
+			u = nil
+		}
+		p.unions[spec.String()] = u
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]PullResult, len(versions))
+	errs := make([]error, len(versions))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i], errs[i] = p.pullThingModel(ctx, versions[i])
+				p.progress.Increment()
+			}
+		}()
+	}
+loop:
+	for i := range versions {
+		select {
+		case <-ctx.Done():
+			break loop
+		case work <- i:
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = e
+		}
+	}
+	return results, err
+}
+
+func (p *puller) pullThingModel(ctx context.Context, version model.FoundVersion) (PullResult, error) {
+	finalOutput := filepath.Join(p.outputPath, version.TMID)
+	if p.existsLocally(finalOutput, version.Digest) {
+		return PullResult{PullSkipped, version.TMID, "(already exists)"}, nil
+	}
+
 	spec := model.NewSpecFromFoundSource(version.FoundIn)
-	id, thing, err, errs := commands.FetchByTMID(ctx, spec, version.TMID, restoreId)
+	u := p.unions[spec.String()]
+	if u == nil {
+		err := fmt.Errorf("could not initialize a repo instance for %s", spec)
+		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot fetch from repo %s)", version.FoundIn)}, err
+	}
+	id, thing, err, errs := commands.FetchByTMIDFrom(ctx, u, version.TMID, p.restoreId)
 	if err == nil && len(errs) > 0 { // spec cannot be empty, therefore, there can be at most one RepoAccessError
 		err = errs[0]
 	}
 	if err != nil {
-		Stderrf("Error fetch %s: %v", version.TMID, err)
+		p.progress.Printf("Error fetch %s: %v", version.TMID, err)
 		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot fetch from repo %s)", version.FoundIn)}, err
 	}
 	thing = utils.ConvertToNativeLineEndings(thing)
 
-	finalOutput := filepath.Join(outputPath, id)
+	finalOutput = filepath.Join(p.outputPath, id)
 
 	err = os.MkdirAll(filepath.Dir(finalOutput), 0770)
 	if err != nil {
-		Stderrf("Could not write ThingModel to file %s: %v", finalOutput, err)
-		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot write to ouput directory %s)", outputPath)}, err
+		p.progress.Printf("Could not write ThingModel to file %s: %v", finalOutput, err)
+		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot write to ouput directory %s)", p.outputPath)}, err
 	}
 
-	err = os.WriteFile(finalOutput, thing, 0660)
+	err = utils.AtomicWriteFile(finalOutput, thing, 0660)
 	if err != nil {
-		Stderrf("Could not write ThingModel to file %s: %v", finalOutput, err)
-		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot write to ouput directory %s)", outputPath)}, err
+		p.progress.Printf("Could not write ThingModel to file %s: %v", finalOutput, err)
+		return PullResult{PullErr, version.TMID, fmt.Sprintf("(cannot write to ouput directory %s)", p.outputPath)}, err
 	}
 
 	return PullResult{PullOK, version.TMID, ""}, err
 }
+
+// existsLocally reports whether file exists and its content has given digest, i.e. it has already been pulled.
+// Files written with restored ids do not match their digest and are pulled again
+func (p *puller) existsLocally(file, digest string) bool {
+	if digest == "" {
+		return false
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	localDigest, _, err := commands.CalculateFileDigest(raw)
+	return err == nil && localDigest == digest
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/wot-oss/tmc/internal/repos"
 	"github.com/wot-oss/tmc/internal/repos/mocks"
 	rMocks "github.com/wot-oss/tmc/internal/testutils/reposmocks"
+	"github.com/wot-oss/tmc/internal/utils"
 )
 
 var listResult = model.SearchResult{
@@ -92,7 +93,7 @@ func TestPullExecutor_Pull(t *testing.T) {
 	r.On("Fetch", mock.Anything, tmID_3).Return(tmID_3, tmContent3, nil).Once()
 
 	// when: pulling from repo
-	err = Pull(context.Background(), model.NewRepoSpec("r1"), search, tempDir, false)
+	err = Pull(context.Background(), model.NewRepoSpec("r1"), search, tempDir, PullOptions{Jobs: 2})
 	// then: there is no error
 	assert.NoError(t, err)
 	// and then: the pulled ThingModels are written to the output path
@@ -113,12 +114,19 @@ func TestPullExecutor_pullThingModel(t *testing.T) {
 	r.On("Spec").Return(spec)
 
 	tmID := listResult.Entries[0].Versions[0].TMID
+	u, err := repos.GetSpecdOrAll(spec)
+	assert.NoError(t, err)
+	p := &puller{
+		outputPath: tempDir,
+		unions:     map[string]*repos.Union{spec.String(): u},
+		progress:   newProgressBar(os.Stderr, "", 1),
+	}
 
 	t.Run("result with success", func(t *testing.T) {
 		// given: ThingModel can be fetched successfully
 		r.On("Fetch", mock.Anything, tmID).Return(tmID, []byte("some TM content"), nil).Once()
 		// when: pulling from repo
-		res, err := pullThingModel(context.Background(), tempDir, listResult.Entries[0].Versions[0], false)
+		res, err := p.pullThingModel(context.Background(), listResult.Entries[0].Versions[0])
 		// then: there is no error
 		assert.NoError(t, err)
 		// and then: the result is PullOK
@@ -131,7 +139,7 @@ func TestPullExecutor_pullThingModel(t *testing.T) {
 		// given: ThingModel cannot be fetched successfully
 		r.On("Fetch", mock.Anything, tmID).Return(tmID, nil, errors.New("fetch failed")).Once()
 		// when: pulling from repo
-		res, err := pullThingModel(context.Background(), tempDir, listResult.Entries[0].Versions[0], false)
+		res, err := p.pullThingModel(context.Background(), listResult.Entries[0].Versions[0])
 		// then: there is an error
 		assert.Error(t, err)
 		// and then: the result is PullErr
@@ -141,6 +149,47 @@ func TestPullExecutor_pullThingModel(t *testing.T) {
 	})
 }
 
+func TestPullExecutor_Pull_Resume(t *testing.T) {
+	tempDir := t.TempDir()
+	_, raw, err := utils.ReadRequiredFile("../../../test/data/index/omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json")
+	assert.NoError(t, err)
+
+	// given: a repo with two ThingModels, one of which has been pulled already
+	r := mocks.NewRepo(t)
+	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("r1"), r, nil))
+	pulledID := "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"
+	otherID := "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155221-3f779458e453.tm.json"
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tempDir, pulledID)), 0770))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, pulledID), raw, 0660))
+	res := model.SearchResult{Entries: []model.FoundEntry{{
+		Name: "omnicorp-tm-department/omnicorp/omnilamp",
+		Versions: []model.FoundVersion{
+			{IndexVersion: model.IndexVersion{TMID: otherID, Digest: "3f779458e453", Version: model.Version{Model: "3.2.1"}, TimeStamp: "20240409155221"}, FoundIn: model.FoundSource{RepoName: "r1"}},
+			{IndexVersion: model.IndexVersion{TMID: pulledID, Digest: "3f779458e453", Version: model.Version{Model: "3.2.1"}, TimeStamp: "20240409155220"}, FoundIn: model.FoundSource{RepoName: "r1"}},
+		},
+	}}}
+	search := &model.SearchParams{}
+	r.On("List", mock.Anything, search).Return(res, nil)
+	r.On("Fetch", mock.Anything, otherID).Return(otherID, raw, nil).Once()
+
+	// when: pulling from repo
+	err = Pull(context.Background(), model.NewRepoSpec("r1"), search, tempDir, PullOptions{Jobs: 4})
+	// then: only the missing ThingModel is fetched
+	assert.NoError(t, err)
+	assertFile(t, filepath.Join(tempDir, otherID), raw)
+
+	t.Run("latest only", func(t *testing.T) {
+		// when: pulling only the latest version into a new directory
+		dir := t.TempDir()
+		r.On("Fetch", mock.Anything, otherID).Return(otherID, raw, nil).Once()
+		err = Pull(context.Background(), model.NewRepoSpec("r1"), search, dir, PullOptions{Jobs: 1, LatestOnly: true})
+		// then: only the latest version is pulled
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dir, otherID))
+		assert.NoFileExists(t, filepath.Join(dir, pulledID))
+	})
+}
+
 func TestPullExecutor_Pull_InvalidOutputPath(t *testing.T) {
 	// given: a Repo having 3 ThingModels
 	r := mocks.NewRepo(t)
@@ -152,7 +201,7 @@ func TestPullExecutor_Pull_InvalidOutputPath(t *testing.T) {
 		// given: an empty output path
 		outputPath := ""
 		// when: pulling from repo
-		err := Pull(context.Background(), model.NewRepoSpec("r1"), search, outputPath, false)
+		err := Pull(context.Background(), model.NewRepoSpec("r1"), search, outputPath, PullOptions{})
 		// then: there is an error
 		assert.Error(t, err)
 		// and then: there are no calls on Repo
@@ -169,7 +218,7 @@ func TestPullExecutor_Pull_InvalidOutputPath(t *testing.T) {
 		outputPath := filepath.Join(tempDir, "foo.bar")
 		_ = os.WriteFile(outputPath, []byte("foobar"), 0660)
 		// when: pulling from repo
-		err = Pull(context.Background(), model.NewRepoSpec("r1"), search, outputPath, false)
+		err = Pull(context.Background(), model.NewRepoSpec("r1"), search, outputPath, PullOptions{})
 		// then: there is an error
 		assert.Error(t, err)
 		// and then: there are no calls on Repo
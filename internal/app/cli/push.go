@@ -79,7 +79,13 @@ func (p *PushExecutor) Push(ctx context.Context, filename string, spec model.Rep
 
 	var res []PushResult
 	if stat.IsDir() {
-		res, err = p.pushDirectory(ctx, abs, repo, optPath, optTree)
+		bp, isBulk := repo.(repos.BulkPusher)
+		if isBulk {
+			res, err = p.pushDirectoryBulk(ctx, abs, bp, optPath, optTree)
+		}
+		if !isBulk || errors.Is(err, repos.ErrBulkPushNotSupported) {
+			res, err = p.pushDirectory(ctx, abs, repo, optPath, optTree)
+		}
 	} else {
 		singleRes, pushErr := p.pushFile(ctx, filename, repo, optPath)
 		res = []PushResult{singleRes}
@@ -130,6 +136,116 @@ func (p *PushExecutor) pushDirectory(ctx context.Context, absDirname string, rep
 
 }
 
+// pushDirectoryBulk pushes all files in the directory with a single call to repo
+func (p *PushExecutor) pushDirectoryBulk(ctx context.Context, absDirname string, repo repos.BulkPusher, optPath string, optTree bool) ([]PushResult, error) {
+	files, err := readDirectoryFiles(absDirname)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	bulkRes, err := repo.PushBulk(ctx, files, optPath, optTree)
+	if err != nil {
+		if !errors.Is(err, repos.ErrBulkPushNotSupported) {
+			Stderrf("Could not push files: %v", err)
+		}
+		return nil, err
+	}
+	return toPushResults(absDirname, bulkRes)
+}
+
+// PushAtomic pushes file or directory to the specified repository with all-or-nothing semantics: either all files are
+// pushed and indexed, or none. Returns the list of push results for all files, and the error
+func (p *PushExecutor) PushAtomic(ctx context.Context, filename string, spec model.RepoSpec, optPath string, optTree bool) ([]PushResult, error) {
+	repo, err := repos.Get(spec)
+	if err != nil {
+		Stderrf("Could not ìnitialize a repo instance for %s: %v\ncheck config", spec, err)
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		Stderrf("Error expanding file name %s: %v", filename, err)
+		return nil, err
+	}
+
+	stat, err := os.Stat(abs)
+	if err != nil {
+		Stderrf("Cannot read file or directory %s: %v", filename, err)
+		return nil, err
+	}
+
+	baseDir := abs
+	var files []repos.BulkPushFile
+	if stat.IsDir() {
+		files, err = readDirectoryFiles(abs)
+	} else {
+		baseDir = filepath.Dir(abs)
+		optTree = false
+		var raw []byte
+		_, raw, err = utils.ReadRequiredFile(abs)
+		files = []repos.BulkPushFile{{Name: filepath.Base(abs), Raw: raw}}
+	}
+	if err != nil {
+		Stderrf("Couldn't read files: %v", err)
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	bulkRes, err := commands.NewPushCommand(p.now).PushFilesAtomic(ctx, files, repo, optPath, optTree)
+	if err != nil && bulkRes == nil {
+		Stderrf("Could not push files: %v", err)
+		return nil, err
+	}
+	res, _ := toPushResults(baseDir, bulkRes)
+	return res, err
+}
+
+// readDirectoryFiles reads all TM files in the directory tree below absDirname
+func readDirectoryFiles(absDirname string) ([]repos.BulkPushFile, error) {
+	var files []repos.BulkPushFile
+	err := filepath.WalkDir(absDirname, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		_, raw, err := utils.ReadRequiredFile(path)
+		if err != nil {
+			Stderrf("Couldn't read file %s: %v", path, err)
+			return err
+		}
+		rel, _ := filepath.Rel(absDirname, path)
+		files = append(files, repos.BulkPushFile{Name: filepath.ToSlash(rel), Raw: raw})
+		return nil
+	})
+	return files, err
+}
+
+// toPushResults converts the results of pushing files from absDirname in bulk to PushResults.
+// Returns an error for the first file that could not be pushed
+func toPushResults(absDirname string, bulkRes []repos.BulkPushResult) ([]PushResult, error) {
+	var results []PushResult
+	var firstErr error
+	for _, br := range bulkRes {
+		filename := filepath.Join(absDirname, filepath.FromSlash(br.Name))
+		switch br.Type {
+		case repos.BulkPushOK:
+			results = append(results, PushResult{PushOK, fmt.Sprintf("file %s pushed as %s", filename, br.TMID), br.TMID})
+		case repos.BulkPushExists:
+			results = append(results, PushResult{TMExists, fmt.Sprintf("file %s already exists as %s", filename, br.TMID), br.TMID})
+		default:
+			results = append(results, PushResult{PushErr, fmt.Sprintf("error pushing file %s: %s", filename, br.Message), br.TMID})
+			if firstErr == nil {
+				firstErr = errors.New(br.Message)
+			}
+		}
+	}
+	return results, firstErr
+}
+
 func (p *PushExecutor) pushFile(ctx context.Context, filename string, repo repos.Repo, optPath string) (PushResult, error) {
 	_, raw, err := utils.ReadRequiredFile(filename)
 	if err != nil {
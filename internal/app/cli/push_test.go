@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 
 func TestPushExecutor_Push(t *testing.T) {
 	r := mocks.NewRepo(t)
+	r.On("Spec").Return(model.NewRepoSpec("repo")).Maybe()
 	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), r, nil))
 
 	t.Run("push when none exists", func(t *testing.T) {
@@ -89,6 +91,7 @@ func TestPushExecutor_Push(t *testing.T) {
 
 func TestPushExecutor_Push_Directory(t *testing.T) {
 	r := mocks.NewRepo(t)
+	r.On("Spec").Return(model.NewRepoSpec("repo")).Maybe()
 	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), r, nil))
 
 	t.Run("push directory", func(t *testing.T) {
@@ -170,3 +173,99 @@ func TestPushExecutor_Push_Directory(t *testing.T) {
 	})
 
 }
+
+type bulkPusherRepo struct {
+	*mocks.Repo
+	pushBulk func(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error)
+}
+
+func (b bulkPusherRepo) PushBulk(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+	return b.pushBulk(ctx, files, optPath, optTree)
+}
+
+func TestPushExecutor_Push_DirectoryBulk(t *testing.T) {
+	t.Run("push directory in bulk", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		var pushedFiles []string
+		br := bulkPusherRepo{Repo: r, pushBulk: func(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+			assert.Equal(t, "opt", optPath)
+			assert.True(t, optTree)
+			var res []repos.BulkPushResult
+			for i, f := range files {
+				pushedFiles = append(pushedFiles, f.Name)
+				res = append(res, repos.BulkPushResult{Name: f.Name, Type: repos.BulkPushOK, TMID: fmt.Sprintf("a/b/c/v1.0.0-2024010100000%d-abcdef012345.tm.json", i)})
+			}
+			res[1].Type = repos.BulkPushExists
+			return res, nil
+		}}
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), br, nil))
+		r.On("Index", mock.Anything,
+			"a/b/c/v1.0.0-20240101000000-abcdef012345.tm.json",
+			"a/b/c/v1.0.0-20240101000002-abcdef012345.tm.json",
+			"a/b/c/v1.0.0-20240101000003-abcdef012345.tm.json").Return(nil).Once()
+
+		res, err := NewPushExecutor(time.Now).Push(context.Background(), "../../../test/data/push", model.NewRepoSpec("repo"), "opt", true)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"omnilamp-versioned.json", "omnilamp.json", "subfolder/omnilamp-versioned.json", "subfolder/omnilamp.json"}, pushedFiles)
+		if assert.Len(t, res, 4) {
+			assert.Equal(t, PushOK, res[0].typ)
+			assert.Equal(t, TMExists, res[1].typ)
+			assert.Equal(t, PushOK, res[2].typ)
+		}
+	})
+	t.Run("push directory with error in bulk", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		br := bulkPusherRepo{Repo: r, pushBulk: func(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+			return []repos.BulkPushResult{{Name: files[0].Name, Type: repos.BulkPushError, Message: "invalid"}}, nil
+		}}
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), br, nil))
+
+		res, err := NewPushExecutor(time.Now).Push(context.Background(), "../../../test/data/push", model.NewRepoSpec("repo"), "", false)
+		assert.ErrorContains(t, err, "invalid")
+		if assert.Len(t, res, 1) {
+			assert.Equal(t, PushErr, res[0].typ)
+		}
+	})
+	t.Run("fall back when bulk push not supported", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("Spec").Return(model.NewRepoSpec("repo")).Maybe()
+		br := bulkPusherRepo{Repo: r, pushBulk: func(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+			return nil, repos.ErrBulkPushNotSupported
+		}}
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), br, nil))
+		r.On("Push", mock.Anything, mock.Anything, mock.Anything).Return(nil).Times(4)
+		r.On("Index", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+		res, err := NewPushExecutor(testutils.NewTestClock(time.Now(), time.Second).Now).Push(context.Background(), "../../../test/data/push", model.NewRepoSpec("repo"), "", false)
+		assert.NoError(t, err)
+		assert.Len(t, res, 4)
+	})
+}
+
+func TestPushExecutor_PushAtomic(t *testing.T) {
+	t.Run("push directory atomically", func(t *testing.T) {
+		root := t.TempDir()
+		repo, err := repos.NewFileRepo(map[string]any{"type": "file", "loc": root}, model.NewRepoSpec("repo"))
+		assert.NoError(t, err)
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), repo, nil))
+
+		res, err := NewPushExecutor(time.Now).PushAtomic(context.Background(), "../../../test/data/push", model.NewRepoSpec("repo"), "", true)
+		assert.NoError(t, err)
+		if assert.Len(t, res, 4) {
+			assert.Equal(t, PushOK, res[0].typ)
+			assert.Equal(t, PushOK, res[1].typ)
+			assert.Equal(t, PushOK, res[2].typ)
+			assert.Equal(t, PushOK, res[3].typ)
+		}
+		idx, err := repo.List(context.Background(), &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, idx.Entries, 2)
+	})
+	t.Run("not supported", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), r, nil))
+
+		_, err := NewPushExecutor(time.Now).PushAtomic(context.Background(), "../../../test/data/push", model.NewRepoSpec("repo"), "", false)
+		assert.ErrorIs(t, err, repos.ErrAtomicPushNotSupported)
+	})
+}
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/secrets"
 	"github.com/wot-oss/tmc/internal/utils"
 )
 
@@ -22,8 +25,9 @@ func RepoList() error {
 	}
 	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 
-	_, _ = fmt.Fprintf(table, "NAME\tTYPE\tENBL\tLOCATION\n")
-	for name, value := range config {
+	_, _ = fmt.Fprintf(table, "NAME\tTYPE\tENBL\tPRIO\tLOCATION\n")
+	for _, name := range repos.SortedNames(config) {
+		value := config[name]
 		typ := fmt.Sprintf("%v", value[repos.KeyRepoType])
 		e := utils.JsGetBool(value, repos.KeyRepoEnabled)
 		enbl := e == nil || *e
@@ -33,8 +37,8 @@ func RepoList() error {
 		} else {
 			enblS = "N"
 		}
-		u := fmt.Sprintf("%v", value[repos.KeyRepoLoc])
-		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", elideString(name, colWidth), typ, enblS, u)
+		u := fmt.Sprintf("%v", repos.MaskSecrets(value)[repos.KeyRepoLoc])
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%s\n", elideString(name, colWidth), typ, enblS, repos.RepoPriority(value), u)
 	}
 	_ = table.Flush()
 	return nil
@@ -109,6 +113,19 @@ func RepoToggleEnabled(name string) error {
 	return err
 }
 
+func RepoSetPriority(name, priority string) error {
+	p, err := strconv.Atoi(priority)
+	if err != nil {
+		Stderrf("invalid priority: %s. must be an integer", priority)
+		return ErrInvalidArgs
+	}
+	err = repos.SetPriority(name, p)
+	if err != nil {
+		Stderrf("%v", err)
+	}
+	return err
+}
+
 func RepoRemove(name string) error {
 	err := repos.Remove(name)
 	if err != nil {
@@ -124,7 +141,7 @@ func RepoShow(name string) error {
 		return err
 	}
 	if rc, ok := config[name]; ok {
-		bytes, err := json.MarshalIndent(rc, "", "  ")
+		bytes, err := json.MarshalIndent(repos.MaskSecrets(rc), "", "  ")
 		if err != nil {
 			Stderrf("couldn't print config: %v", err)
 			return err
@@ -153,7 +170,9 @@ func RepoRename(oldName, newName string) (err error) {
 	return
 }
 
-func RepoSetAuth(name, kind, data string) error {
+// RepoSetAuth overwrites the auth config of repo name. If storeSecrets is true, the secret values are moved to the
+// secret store and the config only references them
+func RepoSetAuth(name, kind, data string, storeSecrets bool) error {
 	conf, err := repos.ReadConfig()
 	if err != nil {
 		Stderrf("error setting auth: %v", err)
@@ -166,15 +185,97 @@ func RepoSetAuth(name, kind, data string) error {
 		return repos.ErrRepoNotFound
 	}
 	switch kind {
-	case "bearer":
+	case repos.AuthKindBearer:
 		delete(rc, repos.KeyRepoAuth)
 		rc[repos.KeyRepoAuth] = map[string]any{
-			"bearer": data,
+			repos.AuthKindBearer: data,
+		}
+	case repos.AuthKindOAuth2:
+		var oauth2Auth map[string]any
+		err := json.Unmarshal([]byte(data), &oauth2Auth)
+		if err != nil {
+			Stderrf("invalid oauth2 auth data. must be a JSON object with %s, %s, %s, and optionally %s and %s",
+				repos.KeyOAuth2TokenURL, repos.KeyOAuth2ClientID, repos.KeyOAuth2ClientSecret, repos.KeyOAuth2Scopes, repos.KeyOAuth2Audience)
+			return errors.New("invalid auth data")
+		}
+		rc[repos.KeyRepoAuth] = map[string]any{
+			repos.AuthKindOAuth2: oauth2Auth,
+		}
+	case repos.AuthKindBasic:
+		user, password, found := strings.Cut(data, ":")
+		if !found || user == "" {
+			Stderrf("invalid basic auth data. must be <username>:<password>")
+			return errors.New("invalid auth data")
+		}
+		rc[repos.KeyRepoAuth] = map[string]any{
+			repos.AuthKindBasic: map[string]any{
+				repos.KeyBasicUsername: user,
+				repos.KeyBasicPassword: password,
+			},
+		}
+	case repos.AuthKindHeaders:
+		headers := map[string]any{}
+		if strings.HasPrefix(strings.TrimSpace(data), "{") {
+			err = json.Unmarshal([]byte(data), &headers)
+		} else if name, value, found := strings.Cut(data, ":"); found {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		} else {
+			err = errors.New("invalid auth data")
+		}
+		if err != nil {
+			Stderrf("invalid headers auth data. must be <header-name>:<value> or a JSON object mapping header names to values")
+			return errors.New("invalid auth data")
+		}
+		rc[repos.KeyRepoAuth] = map[string]any{
+			repos.AuthKindHeaders: headers,
+		}
+	case repos.AuthKindCredentialHelper:
+		var helper any = data
+		if strings.HasPrefix(strings.TrimSpace(data), "{") {
+			var helperConf map[string]any
+			err := json.Unmarshal([]byte(data), &helperConf)
+			if err != nil {
+				Stderrf("invalid credential helper auth data. must be a command or a JSON object with %s and optionally %s",
+					repos.KeyCredentialHelperCommand, repos.KeyCredentialHelperHeader)
+				return errors.New("invalid auth data")
+			}
+			helper = helperConf
+		}
+		rc[repos.KeyRepoAuth] = map[string]any{
+			repos.AuthKindCredentialHelper: helper,
+		}
+	case repos.AuthKindS3:
+		parts := strings.SplitN(data, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			Stderrf("invalid s3 auth data. must be <access-key-id>:<secret-access-key>[:<session-token>]")
+			return errors.New("invalid auth data")
+		}
+		s3Auth := map[string]any{
+			repos.KeyS3AccessKeyID:     parts[0],
+			repos.KeyS3SecretAccessKey: parts[1],
+		}
+		if len(parts) == 3 && parts[2] != "" {
+			s3Auth[repos.KeyS3SessionToken] = parts[2]
+		}
+		rc[repos.KeyRepoAuth] = map[string]any{
+			repos.AuthKindS3: s3Auth,
 		}
 	default:
 		Stderrf("unknown auth type: %s", kind)
 		return errors.New("unknown auth type")
 	}
+	if storeSecrets {
+		store, err := secrets.Default()
+		if err != nil {
+			Stderrf("cannot open secret store: %v", err)
+			return err
+		}
+		rc, err = repos.StoreSecrets(name, rc, store)
+		if err != nil {
+			Stderrf("%v", err)
+			return err
+		}
+	}
 	rb, _ := json.Marshal(rc)
 
 	err = repos.SetConfig(name, fmt.Sprint(rc[repos.KeyRepoType]), "", rb)
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wot-oss/tmc/internal/secrets"
+	"golang.org/x/term"
+)
+
+// PromptPassphrase asks for the passphrase of the secret store on the terminal. Returns an empty passphrase if
+// stdin is not a terminal
+func PromptPassphrase() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+	return readHidden("Secret store passphrase: ")
+}
+
+// SecretSet stores the secret with given name. If value is empty, the secret is read from the terminal without echo
+// or from the first line of stdin
+func SecretSet(name, value string) error {
+	store, err := secrets.Default()
+	if err != nil {
+		Stderrf("cannot open secret store: %v", err)
+		return err
+	}
+	if value == "" {
+		value, err = readSecretValue(name)
+		if err != nil {
+			Stderrf("cannot read secret: %v", err)
+			return err
+		}
+	}
+	err = store.Set(name, value)
+	if err != nil {
+		Stderrf("could not store secret: %v", err)
+		return err
+	}
+	fmt.Printf("stored secret %s. Reference it in repo configs with %s\n", name, secrets.Reference(secrets.RefKindSecret, name))
+	return nil
+}
+
+// SecretList prints the names of all secrets in the store, but not their values
+func SecretList() error {
+	store, err := secrets.Default()
+	if err != nil {
+		Stderrf("cannot open secret store: %v", err)
+		return err
+	}
+	names, err := store.List()
+	if err != nil {
+		Stderrf("could not read secrets: %v", err)
+		return err
+	}
+	for _, n := range names {
+		fmt.Println(n)
+	}
+	return nil
+}
+
+// SecretDelete removes the secret with given name from the store
+func SecretDelete(name string) error {
+	store, err := secrets.Default()
+	if err != nil {
+		Stderrf("cannot open secret store: %v", err)
+		return err
+	}
+	err = store.Delete(name)
+	if err != nil {
+		if errors.Is(err, secrets.ErrSecretNotFound) {
+			Stderrf("secret %s not found", name)
+		} else {
+			Stderrf("could not delete secret: %v", err)
+		}
+		return err
+	}
+	fmt.Printf("deleted secret %s\n", name)
+	return nil
+}
+
+func readSecretValue(name string) (string, error) {
+	var value string
+	var err error
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err = readHidden(fmt.Sprintf("Value of secret %s: ", name))
+	} else {
+		value, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value != "" {
+			err = nil
+		}
+		value = strings.TrimRight(value, "\r\n")
+	}
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", errors.New("secret must not be empty")
+	}
+	return value, nil
+}
+
+func readHidden(prompt string) (string, error) {
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
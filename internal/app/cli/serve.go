@@ -1,14 +1,23 @@
 package cli
 
 import (
+	"context"
+	"crypto/tls"
 	_ "embed"
 	"errors"
 	"fmt"
 	"net"
 	nethttp "net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/wot-oss/tmc/internal/app/http/accesslog"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
 	"github.com/wot-oss/tmc/internal/app/http/cors"
+	"github.com/wot-oss/tmc/internal/app/http/mtls"
 	"github.com/wot-oss/tmc/internal/model"
 
 	"github.com/wot-oss/tmc/internal/app/http/jwt"
@@ -16,16 +25,58 @@ import (
 
 	"github.com/wot-oss/tmc/internal/app/http"
 	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/tracing"
 )
 
 //go:embed banner.txt
 var banner string
 
+// ErrShutdownTimeout is returned when the server had to close connections forcibly, because requests did not complete
+// within the shutdown timeout
+var ErrShutdownTimeout = errors.New("requests did not complete within shutdown timeout")
+
 type ServeOptions struct {
 	UrlCtxRoot string
 	cors.CORSOptions
 	jwt.JWTValidationOpts
 	JWTValidation bool
+	apikey.APIKeyValidationOpts
+	APIKeyValidation bool
+	mtls.ServerOpts
+	// ClientPermissionsFile maps client certificate subjects to permissions. Used only if a client CA is given
+	ClientPermissionsFile string
+	// PromoteValidations lists the validations run on TMs promoted via the REST API
+	PromoteValidations []string
+	// PromotionRepos are the names of the repos allowed as source and target of promotions via the REST API
+	PromotionRepos []string
+	ServerTimeouts
+	// MaxPushBodySize limits the size of TMs pushed via the REST API in bytes. No limit if not positive
+	MaxPushBodySize int64
+	// MaxBulkPushBodySize limits the size of requests pushing multiple TMs via the REST API in bytes. No limit if not positive
+	MaxBulkPushBodySize int64
+	// WatchRepos enables updating the index of served repos when they are changed by other programs
+	WatchRepos bool
+	// HealthOptions configures the probes of the served repos in the health endpoints
+	HealthOptions http.HealthOptions
+	// AccessLogOptions configures the log of all requests handled by the server
+	AccessLogOptions accesslog.Options
+}
+
+// ServerTimeouts configures the timeouts of the http server and its shutdown. Zero values mean no timeout
+type ServerTimeouts struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is the maximum time to wait for in-flight requests to complete on shutdown
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is the time between failing the readiness probe and starting to drain requests on shutdown,
+	// giving load balancers time to stop routing new requests to the server
+	ShutdownDelay time.Duration
+}
+
+// shutdowner is notified when the server starts shutting down
+type shutdowner interface {
+	SetShuttingDown()
 }
 
 func Serve(host, port string, opts ServeOptions, repo, pushTarget model.RepoSpec) error {
@@ -53,37 +104,96 @@ func Serve(host, port string, opts ServeOptions, repo, pushTarget model.RepoSpec
 	}
 
 	// create an instance of our handler (server interface)
-	handlerService, err := http.NewDefaultHandlerService(repo, pushTarget)
+	handlerService, err := http.NewDefaultHandlerService(repo, pushTarget,
+		http.WithPromoteOptions(opts.PromoteValidations),
+		http.WithPromotionRepos(opts.PromotionRepos),
+		http.WithHealthOptions(opts.HealthOptions))
 	if err != nil {
 		Stderrf("Could not start tm-catalog server on %s:%s, %v\n", host, port, err)
 		return err
 	}
 
 	handler := http.NewTmcHandler(
-		handlerService,
+		http.NewTracingHandlerService(handlerService),
 		http.TmcHandlerOptions{
-			UrlContextRoot: opts.UrlCtxRoot,
+			UrlContextRoot:      opts.UrlCtxRoot,
+			MaxPushBodySize:     opts.MaxPushBodySize,
+			MaxBulkPushBodySize: opts.MaxBulkPushBodySize,
 		})
 
+	useTLS := opts.CertFile != "" || opts.KeyFile != ""
+	if !useTLS && opts.ClientCAFile != "" {
+		err = errors.New("client CA for mTLS requires TLS certificate and key")
+		Stderrf(err.Error())
+		return err
+	}
+	var tlsConfig *tls.Config
+	if useTLS {
+		tlsConfig, err = mtls.NewServerTLSConfig(opts.ServerOpts)
+		if err != nil {
+			Stderrf("invalid TLS configuration: %v", err)
+			return err
+		}
+	}
+	var clientPerms map[string][]apikey.Permission
+	if opts.ClientCAFile != "" && opts.ClientPermissionsFile != "" {
+		clientPerms, err = mtls.LoadClientPermissions(opts.ClientPermissionsFile)
+		if err != nil {
+			Stderrf("invalid client certificate permissions: %v", err)
+			return err
+		}
+	}
+
 	// collect Middlewares for the main http handler
-	var mws = getMiddlewares(opts)
+	var mws = getMiddlewares(opts, clientPerms)
 	// create a http handler
 	httpHandler := http.NewHttpHandler(handler, mws)
 	// protect main handler with CORS
 	httpHandler = cors.Protect(httpHandler, opts.CORSOptions)
+	// trace all requests, including CORS preflight requests
+	httpHandler = tracing.Handler(httpHandler)
+	accessLog, err := accesslog.Open(opts.AccessLogOptions)
+	if err != nil {
+		Stderrf(err.Error())
+		return err
+	}
+	defer accessLog.Close()
+	httpHandler = accessLog.Handler(httpHandler)
+	// assign an id to each request before anything is logged about it
+	httpHandler = http.WithRequestID(httpHandler)
 
 	s := &nethttp.Server{
-		Handler: httpHandler,
-		Addr:    net.JoinHostPort(host, port),
+		Handler:      httpHandler,
+		Addr:         net.JoinHostPort(host, port),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
 	}
 
 	// valid configuration, we can print the banner and start the server
 	fmt.Println(banner)
 	fmt.Printf("Version of tmc: %s\n", TmcVersion)
-	fmt.Printf("Starting tm-catalog server on %s:%s\n", host, port)
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	fmt.Printf("Starting tm-catalog server on %s:%s (%s)\n", host, port, scheme)
 
-	// start server
-	err = s.ListenAndServe()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.WatchRepos {
+		startIndexWatchers(ctx, repo)
+	}
+	listen := s.ListenAndServe
+	if useTLS {
+		// certificate and key are provided by tlsConfig.GetCertificate
+		listen = func() error { return s.ListenAndServeTLS("", "") }
+	}
+	err = runServer(ctx, s, listen, handlerService, opts.ServerTimeouts)
+	if errors.Is(err, ErrShutdownTimeout) {
+		return err
+	}
 	if err != nil {
 		Stderrf("Could not start tm-catalog server on %s:%s, %v\n", host, port, err)
 		return err
@@ -92,6 +202,80 @@ func Serve(host, port string, opts ServeOptions, repo, pushTarget model.RepoSpec
 	return nil
 }
 
+// startIndexWatchers starts watching all repos specified by spec which support it, until ctx is done
+func startIndexWatchers(ctx context.Context, spec model.RepoSpec) {
+	var rs []repos.Repo
+	if spec.RepoName() != "" || spec.Dir() != "" {
+		r, err := repos.Get(spec)
+		if err != nil {
+			return
+		}
+		rs = append(rs, r)
+	} else {
+		all, err := repos.All()
+		if err != nil {
+			return
+		}
+		rs = all
+	}
+	for _, r := range rs {
+		w, ok := r.(repos.IndexWatcher)
+		if !ok {
+			continue
+		}
+		go func(r repos.Repo) {
+			err := w.WatchIndex(ctx)
+			if err != nil {
+				Stderrf("Could not watch repo %s for changes: %v", r.Spec(), err)
+			}
+		}(r)
+	}
+}
+
+// runServer starts the server with listen and shuts it down gracefully when ctx is done.
+// On shutdown, svc is notified first, so that readiness probes fail, then in-flight requests are drained for at most
+// timeouts.ShutdownTimeout. Requests still running after that have their contexts canceled, which makes them abort
+// waiting for and release repository locks, and ErrShutdownTimeout is returned
+func runServer(ctx context.Context, s *nethttp.Server, listen func() error, svc shutdowner, timeouts ServerTimeouts) error {
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	s.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- listen()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down tm-catalog server")
+	svc.SetShuttingDown()
+	time.Sleep(timeouts.ShutdownDelay)
+
+	shCtx := context.Background()
+	if timeouts.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shCtx, cancel = context.WithTimeout(shCtx, timeouts.ShutdownTimeout)
+		defer cancel()
+	}
+	err := s.Shutdown(shCtx)
+	if err != nil {
+		cancelBase()
+		_ = s.Close()
+		Stderrf("Requests did not complete within shutdown timeout of %v", timeouts.ShutdownTimeout)
+		return ErrShutdownTimeout
+	}
+	err = <-errCh
+	if errors.Is(err, nethttp.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
 func validateContextRoot(ctxRoot string) error {
 	vCtxRoot, _ := url.JoinPath("/", ctxRoot)
 	_, err := url.ParseRequestURI(vCtxRoot)
@@ -101,10 +285,23 @@ func validateContextRoot(ctxRoot string) error {
 	return nil
 }
 
-func getMiddlewares(opts ServeOptions) []server.MiddlewareFunc {
+func getMiddlewares(opts ServeOptions, clientPerms map[string][]apikey.Permission) []server.MiddlewareFunc {
 	var mws []server.MiddlewareFunc
 	if opts.JWTValidation == true {
 		mws = append(mws, jwt.GetMiddleware(opts.JWTValidationOpts))
 	}
+	// middlewares are applied in reverse order, so API keys are checked before JWT
+	if opts.APIKeyValidation {
+		akOpts := opts.APIKeyValidationOpts
+		akOpts.PassOtherTokens = opts.JWTValidation
+		mws = append(mws, apikey.GetMiddleware(akOpts))
+	}
+	// client certificates are checked first of all
+	if opts.ClientCAFile != "" {
+		mws = append(mws, mtls.GetMiddleware(mtls.ClientCertValidationOpts{
+			Permissions:         clientPerms,
+			PassUnauthenticated: opts.APIKeyValidation || opts.JWTValidation,
+		}))
+	}
 	return mws
 }
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net"
+	nethttp "net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type shutdownRecorder struct {
+	called atomic.Bool
+}
+
+func (s *shutdownRecorder) SetShuttingDown() {
+	s.called.Store(true)
+}
+
+func TestRunServer(t *testing.T) {
+	t.Run("drains in-flight requests", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		s := &nethttp.Server{Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("done"))
+		})}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		svc := &shutdownRecorder{}
+		ctx, cancel := context.WithCancel(context.Background())
+		res := make(chan error, 1)
+		go func() {
+			res <- runServer(ctx, s, func() error { return s.Serve(l) }, svc, ServerTimeouts{ShutdownTimeout: 5 * time.Second})
+		}()
+
+		body := make(chan string, 1)
+		go func() {
+			resp, err := nethttp.Get("http://" + l.Addr().String())
+			if assert.NoError(t, err) {
+				b, _ := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				body <- string(b)
+			}
+		}()
+		<-started
+		cancel()
+		assert.Eventually(t, svc.called.Load, time.Second, 10*time.Millisecond)
+		close(release)
+
+		assert.Equal(t, "done", <-body)
+		assert.NoError(t, <-res)
+	})
+	t.Run("cancels requests after shutdown timeout", func(t *testing.T) {
+		started := make(chan struct{})
+		canceled := make(chan struct{})
+		s := &nethttp.Server{Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			close(started)
+			<-r.Context().Done()
+			close(canceled)
+		})}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		res := make(chan error, 1)
+		go func() {
+			res <- runServer(ctx, s, func() error { return s.Serve(l) }, &shutdownRecorder{}, ServerTimeouts{ShutdownTimeout: 50 * time.Millisecond})
+		}()
+		go func() {
+			_, _ = nethttp.Get("http://" + l.Addr().String())
+		}()
+		<-started
+		cancel()
+
+		assert.ErrorIs(t, <-res, ErrShutdownTimeout)
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			assert.Fail(t, "request context has not been canceled")
+		}
+	})
+	t.Run("listen error", func(t *testing.T) {
+		s := &nethttp.Server{}
+		err := runServer(context.Background(), s, func() error { return assert.AnError }, &shutdownRecorder{}, ServerTimeouts{})
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/wot-oss/tmc/internal/commands"
@@ -27,7 +28,24 @@ func printIndexThing(name string, versions []model.FoundVersion) {
 
 	_, _ = fmt.Fprintf(table, "NAME\tVERSION\tDESCRIPTION\tREPOSITORY\tID\n")
 	for _, v := range versions {
-		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", name, v.Version.Model, v.Description, v.FoundIn, v.Links["content"])
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", name, v.Version.Model, v.Description, formatSources([]model.FoundSource{v.FoundIn}, v.Shadows), v.Links["content"])
 	}
 	_ = table.Flush()
 }
+
+// formatSources formats the sources a TM has been found in, followed by the sources they shadow, if any
+func formatSources(found, shadowed []model.FoundSource) string {
+	res := joinSources(found)
+	if len(shadowed) > 0 {
+		res += " (shadows " + joinSources(shadowed) + ")"
+	}
+	return res
+}
+
+func joinSources(srcs []model.FoundSource) string {
+	ss := make([]string, len(srcs))
+	for i, s := range srcs {
+		ss[i] = s.String()
+	}
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+// watchDebounce is the time to wait for further changes after a file has changed before pushing.
+// Editors often write a file in several steps, which must not result in several pushes
+var watchDebounce = 300 * time.Millisecond
+
+// Watch pushes the directory dirname to the specified repository and then keeps watching it for changes until ctx is done.
+// Each created or modified TM file is validated and pushed, and the index is updated with the pushed TMs only.
+// Every push result is passed to report as soon as it is available. Deleted files are not removed from the repository
+func (p *PushExecutor) Watch(ctx context.Context, dirname string, spec model.RepoSpec, optPath string, optTree bool, report func(PushResult)) error {
+	repo, err := repos.Get(spec)
+	if err != nil {
+		Stderrf("Could not ìnitialize a repo instance for %s: %v\ncheck config", spec, err)
+		return err
+	}
+	abs, err := filepath.Abs(dirname)
+	if err != nil {
+		Stderrf("Error expanding file name %s: %v", dirname, err)
+		return err
+	}
+	stat, err := os.Stat(abs)
+	if err != nil {
+		Stderrf("Cannot read directory %s: %v", dirname, err)
+		return err
+	}
+	if !stat.IsDir() {
+		err = fmt.Errorf("%s is not a directory", dirname)
+		Stderrf("Cannot watch: %v", err)
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		Stderrf("Cannot watch directory %s: %v", dirname, err)
+		return err
+	}
+	defer watcher.Close()
+	err = addWatchesRecursive(watcher, abs)
+	if err != nil {
+		Stderrf("Cannot watch directory %s: %v", dirname, err)
+		return err
+	}
+
+	// push the current state of the directory before watching for changes
+	var initial []string
+	_ = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && isWatchedFile(d) {
+			initial = append(initial, path)
+		}
+		return nil
+	})
+	p.pushChanged(ctx, repo, abs, initial, optPath, optTree, report)
+
+	changed := map[string]struct{}{}
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Stderrf("Error watching directory %s: %v", dirname, err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Rename) {
+				continue
+			}
+			info, err := os.Stat(ev.Name)
+			if err != nil {
+				// the file has been removed or renamed away
+				continue
+			}
+			if info.IsDir() {
+				if ev.Has(fsnotify.Create) {
+					// files created in the new directory before the watch has been added are only found by walking it
+					p.watchNewDir(watcher, ev.Name, changed)
+				}
+			} else if strings.HasSuffix(info.Name(), ".json") {
+				changed[ev.Name] = struct{}{}
+			} else {
+				continue
+			}
+			timer.Reset(watchDebounce)
+		case <-timer.C:
+			files := make([]string, 0, len(changed))
+			for f := range changed {
+				files = append(files, f)
+			}
+			slices.Sort(files)
+			clear(changed)
+			p.pushChanged(ctx, repo, abs, files, optPath, optTree, report)
+		}
+	}
+}
+
+func (p *PushExecutor) watchNewDir(watcher *fsnotify.Watcher, dir string, changed map[string]struct{}) {
+	err := addWatchesRecursive(watcher, dir)
+	if err != nil {
+		Stderrf("Cannot watch directory %s: %v", dir, err)
+	}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && isWatchedFile(d) {
+			changed[path] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// pushChanged pushes files and updates the index of repo with the successfully pushed TMs
+func (p *PushExecutor) pushChanged(ctx context.Context, repo repos.Repo, absDirname string, files []string, optPath string, optTree bool, report func(PushResult)) {
+	var results []PushResult
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		op := optPath
+		if optTree {
+			op = filepath.Dir(strings.TrimPrefix(f, absDirname))
+		}
+		res, err := p.pushFile(ctx, f, repo, op)
+		if err != nil {
+			utils.Logger(ctx).Debug("watch: could not push file", "file", f, "error", err)
+		}
+		report(res)
+		results = append(results, res)
+	}
+	okIds := getOkIds(results)
+	if len(okIds) > 0 {
+		err := repo.Index(ctx, okIds...)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			Stderrf("Cannot update index: %v", err)
+		}
+	}
+}
+
+func addWatchesRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func isWatchedFile(d fs.DirEntry) bool {
+	return !d.IsDir() && strings.HasSuffix(d.Name(), ".json")
+}
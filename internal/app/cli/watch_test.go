@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+	rMocks "github.com/wot-oss/tmc/internal/testutils/reposmocks"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+func TestPushExecutor_Watch(t *testing.T) {
+	oldDebounce := watchDebounce
+	watchDebounce = 20 * time.Millisecond
+	defer func() { watchDebounce = oldDebounce }()
+
+	root := t.TempDir()
+	repo, err := repos.NewFileRepo(map[string]any{"type": "file", "loc": root}, model.NewRepoSpec("repo"))
+	assert.NoError(t, err)
+	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), repo, nil))
+	_, omnilamp, err := utils.ReadRequiredFile("../../../test/data/push/omnilamp.json")
+	assert.NoError(t, err)
+	_, versioned, err := utils.ReadRequiredFile("../../../test/data/push/omnilamp-versioned.json")
+	assert.NoError(t, err)
+
+	// given: a working directory with one TM
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "omnilamp.json"), omnilamp, 0660))
+
+	results := make(chan PushResult, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewPushExecutor(time.Now).Watch(ctx, dir, model.NewRepoSpec("repo"), "", true, func(r PushResult) { results <- r })
+	}()
+	next := func() PushResult {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no push result reported")
+			return PushResult{}
+		}
+	}
+
+	// then: the existing TM is pushed initially
+	r := next()
+	assert.Equal(t, PushOK, r.typ)
+
+	// when: a TM is created in a new subdirectory
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0770))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "versioned.json"), versioned, 0660))
+	// then: it is pushed with the subdirectory as optional path and indexed
+	r = next()
+	assert.Equal(t, PushOK, r.typ)
+	assert.Contains(t, r.tmid, "/sub/")
+	assert.Eventually(t, func() bool {
+		res, err := repo.List(context.Background(), &model.SearchParams{})
+		return err == nil && len(res.Entries) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// when: a TM is changed to be invalid
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "omnilamp.json"), []byte("{}"), 0660))
+	// then: the validation failure is reported
+	r = next()
+	assert.Equal(t, PushErr, r.typ)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestPushExecutor_Watch_NotADirectory(t *testing.T) {
+	root := t.TempDir()
+	repo, err := repos.NewFileRepo(map[string]any{"type": "file", "loc": root}, model.NewRepoSpec("repo"))
+	assert.NoError(t, err)
+	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("repo"), repo, nil))
+
+	err = NewPushExecutor(time.Now).Watch(context.Background(), "../../../test/data/push/omnilamp.json", model.NewRepoSpec("repo"), "", false, func(PushResult) {})
+	assert.ErrorContains(t, err, "not a directory")
+}
@@ -0,0 +1,161 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	// FormatNone disables the access log
+	FormatNone = "none"
+	// FormatJSON writes a JSON object per request
+	FormatJSON = "json"
+	// FormatCLF writes a line in common log format per request, followed by the request id and the duration in ms
+	FormatCLF = "clf"
+
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// Options configure the access log
+type Options struct {
+	// Format is one of FormatNone, FormatJSON or FormatCLF. Empty means FormatNone
+	Format string
+	// File is the file to append the access log to. Empty means stdout
+	File string
+}
+
+// Log writes an entry for each request handled by the server
+type Log struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	now    func() time.Time
+}
+
+// entry is an access log entry of a request
+type entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId"`
+	Client     string    `json:"client"`
+	Subject    string    `json:"subject,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+}
+
+// Open creates the access log configured in opts. Returns nil if the access log is disabled
+func Open(opts Options) (*Log, error) {
+	switch opts.Format {
+	case "", FormatNone:
+		return nil, nil
+	case FormatJSON, FormatCLF:
+	default:
+		return nil, fmt.Errorf("invalid access log format %q. Must be one of %s, %s, %s", opts.Format, FormatNone, FormatJSON, FormatCLF)
+	}
+	var w io.Writer = os.Stdout
+	if opts.File != "" {
+		f, err := os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open access log file: %w", err)
+		}
+		w = f
+	}
+	return newLog(w, opts.Format), nil
+}
+
+func newLog(w io.Writer, format string) *Log {
+	return &Log{w: w, format: format, now: time.Now}
+}
+
+// Close closes the file the log is written to, if any
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	if c, ok := l.w.(io.Closer); ok && l.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// Handler wraps h so that each request is written to the access log after it has been handled. Returns h unchanged
+// if l is nil
+func (l *Log) Handler(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, subject := httptmc.ContextRecordingAuthSubject(r.Context())
+		r = r.WithContext(ctx)
+		start := l.now()
+		m := httpsnoop.CaptureMetrics(h, w, r)
+		l.write(entry{
+			Time:       start,
+			RequestID:  utils.RequestIDFromContext(ctx),
+			Client:     clientIP(r),
+			Subject:    subject(),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     m.Code,
+			Bytes:      m.Written,
+			DurationMs: float64(m.Duration.Microseconds()) / 1000,
+		})
+	})
+}
+
+func (l *Log) write(e entry) {
+	var line []byte
+	switch l.format {
+	case FormatJSON:
+		line, _ = json.Marshal(e)
+	case FormatCLF:
+		line = []byte(formatCLF(e))
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(line)
+	if err != nil {
+		slog.Default().Error("could not write access log", "error", err)
+	}
+}
+
+// formatCLF formats e in common log format, followed by the request id and the duration in ms
+func formatCLF(e entry) string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = fmt.Sprint(e.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %.3f", e.Client, orDash(e.Subject), e.Time.Format(clfTimeFormat),
+		e.Method+" "+e.Path+" "+e.Proto, e.Status, bytes, orDash(e.RequestID), e.DurationMs)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,99 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+func TestOpen(t *testing.T) {
+	l, err := Open(Options{})
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+	rec := httptest.NewRecorder()
+	l.Handler(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, l.Close())
+
+	_, err = Open(Options{Format: "combined"})
+	assert.ErrorContains(t, err, "invalid access log format")
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	l, err = Open(Options{Format: FormatJSON, File: file})
+	assert.NoError(t, err)
+	l.write(entry{Method: http.MethodGet, Path: "/inventory", Status: http.StatusOK})
+	assert.NoError(t, l.Close())
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"path":"/inventory"`)
+}
+
+func TestHandler(t *testing.T) {
+	// given: a handler which authenticates the client and writes a response
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(httptmc.ContextWithAuthSubject(r.Context(), "apikey:ci"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/thing-models?force=true", nil)
+		req.RemoteAddr = "192.0.2.1:51234"
+		return req.WithContext(utils.ContextWithRequestID(req.Context(), "req-1"))
+	}
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := newLog(buf, FormatJSON)
+		l.now = func() time.Time { return start }
+		rec := httptest.NewRecorder()
+		// when: handling a request
+		l.Handler(h).ServeHTTP(rec, newRequest())
+		// then: the response is passed through
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "hello", rec.Body.String())
+		// and then: the request is logged
+		var e entry
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+		assert.True(t, start.Equal(e.Time))
+		e.Time, e.DurationMs = time.Time{}, 0
+		assert.Equal(t, entry{
+			RequestID: "req-1",
+			Client:    "192.0.2.1",
+			Subject:   "apikey:ci",
+			Method:    http.MethodPost,
+			Path:      "/thing-models?force=true",
+			Proto:     "HTTP/1.1",
+			Status:    http.StatusCreated,
+			Bytes:     5,
+		}, e)
+	})
+	t.Run("clf", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := newLog(buf, FormatCLF)
+		l.now = func() time.Time { return start }
+		l.Handler(h).ServeHTTP(httptest.NewRecorder(), newRequest())
+		assert.Regexp(t, `^192\.0\.2\.1 - apikey:ci \[01/May/2024:10:00:00 \+0000\] "POST /thing-models\?force=true HTTP/1\.1" 201 5 "req-1" \d+\.\d{3}\n$`, buf.String())
+	})
+}
+
+func TestFormatCLF(t *testing.T) {
+	e := entry{
+		Time:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Client: "2001:db8::1",
+		Method: http.MethodGet,
+		Path:   "/healthz",
+		Proto:  "HTTP/1.1",
+		Status: http.StatusNoContent,
+	}
+	assert.Equal(t, `2001:db8::1 - - [01/May/2024:10:00:00 +0000] "GET /healthz HTTP/1.1" 204 - "-" 0.000`, formatCLF(e))
+}
@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+// subjectPrefix is prepended to the key's id and name to form the auth subject of requests authenticated with a key,
+// e.g. apikey:<id>(<name>). Key names need not be unique, ids are
+const subjectPrefix = "apikey:"
+
+type APIKeyValidationOpts struct {
+	// KeysFile is the name of the file the API keys are stored in
+	KeysFile string
+	// PassOtherTokens lets requests bearing a token which is not an API key pass on to the next middleware,
+	// e.g. for JWT validation, instead of rejecting them
+	PassOtherTokens bool
+}
+
+var TokenNotFoundError = errors.New("Authorization header does not contain a bearer token")
+
+var now = time.Now
+
+// GetMiddleware returns a middleware that authenticates requests to protected endpoints with the API keys from
+// opts.KeysFile and checks that the key grants the permission required by the request
+func GetMiddleware(opts APIKeyValidationOpts) server.MiddlewareFunc {
+	store := NewStore(opts.KeysFile)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// existing scopes in ctx is the only hint for a protected endpoint.
+			// a subject in ctx means the request has already been authenticated, e.g. with a client certificate
+			if r.Context().Value(server.BearerAuthScopes) == nil || httptmc.AuthSubjectFromContext(r.Context()) != "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			token, err := extractBearerToken(r)
+			if err != nil {
+				httptmc.HandleErrorResponse(w, r, httptmc.NewUnauthorizedError(nil, err.Error()))
+				return
+			}
+			if !IsAPIKey(token) {
+				if opts.PassOtherTokens {
+					h.ServeHTTP(w, r)
+					return
+				}
+				httptmc.HandleErrorResponse(w, r, httptmc.NewUnauthorizedError(nil, ErrKeyInvalid.Error()))
+				return
+			}
+			key, err := store.Authenticate(token, now())
+			if err != nil {
+				if errors.Is(err, ErrKeyInvalid) || errors.Is(err, ErrKeyExpired) {
+					httptmc.HandleErrorResponse(w, r, httptmc.NewUnauthorizedError(nil, err.Error()))
+				} else {
+					utils.Logger(r.Context()).Error("could not read API keys", "error", err)
+					httptmc.HandleErrorResponse(w, r, err)
+				}
+				return
+			}
+			required := RequiredPermission(r)
+			if !key.HasPermission(required) {
+				httptmc.HandleErrorResponse(w, r, httptmc.NewForbiddenError(nil, "API key %s lacks permission '%s'", key.ID, required))
+				return
+			}
+			utils.Logger(r.Context()).Debug("apikey: authenticated", "path", r.URL, "key", key.ID)
+			r = r.WithContext(httptmc.ContextWithAuthSubject(r.Context(), subjectPrefix+key.ID+"("+key.Name+")"))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequiredPermission derives the permission needed for a request from its method
+func RequiredPermission(r *http.Request) Permission {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return PermissionRead
+	case http.MethodDelete:
+		return PermissionDelete
+	default:
+		return PermissionPush
+	}
+}
+
+func extractBearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get(httptmc.HeaderAuthorization)
+	parts := strings.Split(header, " ")
+
+	if !(len(parts) == 2 && parts[0] == "Bearer") {
+		return "", TokenNotFoundError
+	}
+	return parts[1], nil
+}
@@ -0,0 +1,72 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/app/http/server"
+)
+
+func TestMiddleware(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "apikeys.json")
+	s := NewStore(file)
+	created := time.Now()
+	reader, readerKey, err := s.Create("reader", []Permission{PermissionRead}, nil, created)
+	assert.NoError(t, err)
+	pusher, pusherKey, err := s.Create("pusher", []Permission{PermissionRead, PermissionPush}, nil, created)
+	assert.NoError(t, err)
+	exp := created.Add(-time.Minute)
+	expired, _, err := s.Create("expired", []Permission{PermissionRead}, &exp, created)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		method          string
+		protected       bool
+		authHeader      string
+		passOtherTokens bool
+		expStatus       int
+		expSubject      string
+	}{
+		{"unprotected endpoint", http.MethodGet, false, "", false, http.StatusOK, ""},
+		{"missing token", http.MethodGet, true, "", false, http.StatusUnauthorized, ""},
+		{"read with read permission", http.MethodGet, true, "Bearer " + reader, false, http.StatusOK, "apikey:" + readerKey.ID + "(reader)"},
+		{"push without push permission", http.MethodPost, true, "Bearer " + reader, false, http.StatusForbidden, ""},
+		{"push with push permission", http.MethodPost, true, "Bearer " + pusher, false, http.StatusOK, "apikey:" + pusherKey.ID + "(pusher)"},
+		{"delete without delete permission", http.MethodDelete, true, "Bearer " + pusher, false, http.StatusForbidden, ""},
+		{"expired key", http.MethodGet, true, "Bearer " + expired, false, http.StatusUnauthorized, ""},
+		{"unknown key", http.MethodGet, true, "Bearer " + reader + "x", false, http.StatusUnauthorized, ""},
+		{"other token rejected", http.MethodGet, true, "Bearer some.jwt.token", false, http.StatusUnauthorized, ""},
+		{"other token passed on", http.MethodGet, true, "Bearer some.jwt.token", true, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject = httptmc.AuthSubjectFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			h := GetMiddleware(APIKeyValidationOpts{KeysFile: file, PassOtherTokens: test.passOtherTokens})(next)
+
+			req := httptest.NewRequest(test.method, "/thing-models", nil)
+			if test.protected {
+				req = req.WithContext(context.WithValue(req.Context(), server.BearerAuthScopes, []string{}))
+			}
+			if test.authHeader != "" {
+				req.Header.Set(httptmc.HeaderAuthorization, test.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expStatus, rec.Code)
+			assert.Equal(t, test.expSubject, subject)
+		})
+	}
+}
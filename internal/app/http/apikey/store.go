@@ -0,0 +1,274 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+type Permission string
+
+const (
+	PermissionRead   = Permission("read")
+	PermissionPush   = Permission("push")
+	PermissionDelete = Permission("delete")
+
+	// KeyPrefix is the prefix of all API keys. It allows to tell API keys apart from JWTs
+	KeyPrefix = "tmc_"
+
+	idLength     = 8
+	secretLength = 32
+
+	keysDirPermissions  = 0700
+	keysFilePermissions = 0600
+)
+
+var SupportedPermissions = []Permission{PermissionRead, PermissionPush, PermissionDelete}
+
+var (
+	ErrKeyNotFound        = errors.New("API key not found")
+	ErrKeyInvalid         = errors.New("API key is invalid")
+	ErrKeyExpired         = errors.New("API key is expired")
+	ErrUnknownPermission  = errors.New("unknown permission")
+	ErrPermissionsMissing = errors.New("at least one permission must be given")
+)
+
+// Key is an API key as stored in the keys file. Only the hash of the actual key is stored
+type Key struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Hash        string       `json:"hash"`
+	Permissions []Permission `json:"permissions"`
+	Created     time.Time    `json:"created"`
+	Expires     *time.Time   `json:"expires,omitempty"`
+}
+
+// HasPermission reports whether k grants permission p
+func (k Key) HasPermission(p Permission) bool {
+	return slices.Contains(k.Permissions, p)
+}
+
+// IsExpired reports whether k is expired at time now
+func (k Key) IsExpired(now time.Time) bool {
+	return k.Expires != nil && !now.Before(*k.Expires)
+}
+
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Store manages API keys in a JSON file. The file is re-read when it has been modified, so that
+// keys created or revoked while the server is running take effect immediately
+type Store struct {
+	file string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    []Key
+}
+
+func NewStore(file string) *Store {
+	return &Store{file: file}
+}
+
+// ParsePermissions parses a list of permission names
+func ParsePermissions(names []string) ([]Permission, error) {
+	if len(names) == 0 {
+		return nil, ErrPermissionsMissing
+	}
+	var res []Permission
+	for _, n := range names {
+		p := Permission(strings.ToLower(strings.TrimSpace(n)))
+		if !slices.Contains(SupportedPermissions, p) {
+			return nil, fmt.Errorf("%w: %s. Supported permissions are %v", ErrUnknownPermission, n, SupportedPermissions)
+		}
+		if !slices.Contains(res, p) {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// Create generates a new API key with given name, permissions and optional expiry time and saves its hash to the store.
+// Returns the plain key, which cannot be recovered later, and the stored Key
+func (s *Store) Create(name string, perms []Permission, expires *time.Time, now time.Time) (string, Key, error) {
+	if len(perms) == 0 {
+		return "", Key{}, ErrPermissionsMissing
+	}
+	for _, p := range perms {
+		if !slices.Contains(SupportedPermissions, p) {
+			return "", Key{}, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	idBytes := make([]byte, idLength)
+	secret := make([]byte, secretLength)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", Key{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	plain := KeyPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	k := Key{
+		ID:          id,
+		Name:        name,
+		Hash:        hashKey(plain),
+		Permissions: perms,
+		Created:     now.UTC(),
+	}
+	if expires != nil {
+		e := expires.UTC()
+		k.Expires = &e
+	}
+	keys = append(keys, k)
+	err = s.save(keys)
+	if err != nil {
+		return "", Key{}, err
+	}
+	return plain, k, nil
+}
+
+// List returns all keys in the store, including expired ones
+func (s *Store) List() ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Revoke removes the key with given id from the store. Returns ErrKeyNotFound if there is no such key
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(keys, func(k Key) bool { return k.ID == id })
+	if idx < 0 {
+		return ErrKeyNotFound
+	}
+	keys = slices.Delete(keys, idx, idx+1)
+	return s.save(keys)
+}
+
+// Authenticate finds the stored key matching the plain key.
+// Returns ErrKeyInvalid if there is no matching key and ErrKeyExpired if the key is expired at time now
+func (s *Store) Authenticate(plain string, now time.Time) (Key, error) {
+	id, ok := keyID(plain)
+	if !ok {
+		return Key{}, ErrKeyInvalid
+	}
+	s.mu.Lock()
+	keys, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return Key{}, err
+	}
+	hash := hashKey(plain)
+	for _, k := range keys {
+		if k.ID != id {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) != 1 {
+			return Key{}, ErrKeyInvalid
+		}
+		if k.IsExpired(now) {
+			return Key{}, ErrKeyExpired
+		}
+		return k, nil
+	}
+	return Key{}, ErrKeyInvalid
+}
+
+// IsAPIKey reports whether token has the format of an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+func keyID(plain string) (string, bool) {
+	if !IsAPIKey(plain) {
+		return "", false
+	}
+	id, _, found := strings.Cut(strings.TrimPrefix(plain, KeyPrefix), "_")
+	return id, found && id != ""
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// load returns the keys from file, re-reading it only if it has been modified since last load. Must be called with s.mu held
+func (s *Store) load() ([]Key, error) {
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.keys = nil
+			s.modTime = time.Time{}
+			return nil, nil
+		}
+		return nil, err
+	}
+	if s.keys != nil && stat.ModTime().Equal(s.modTime) {
+		return slices.Clone(s.keys), nil
+	}
+	b, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+	var kf keysFile
+	err = json.Unmarshal(b, &kf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API keys file %s: %w", s.file, err)
+	}
+	if kf.Keys == nil {
+		kf.Keys = []Key{}
+	}
+	s.keys = kf.Keys
+	s.modTime = stat.ModTime()
+	return slices.Clone(s.keys), nil
+}
+
+// save writes keys to file. Must be called with s.mu held
+func (s *Store) save(keys []Key) error {
+	err := os.MkdirAll(filepath.Dir(s.file), keysDirPermissions)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		keys = []Key{}
+	}
+	b, err := json.MarshalIndent(keysFile{Keys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = utils.AtomicWriteFile(s.file, b, keysFilePermissions)
+	if err != nil {
+		return err
+	}
+	// force reload on next access
+	s.keys = nil
+	return nil
+}
@@ -0,0 +1,108 @@
+package apikey
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePermissions(t *testing.T) {
+	perms, err := ParsePermissions([]string{"read", " Push", "read"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Permission{PermissionRead, PermissionPush}, perms)
+
+	_, err = ParsePermissions([]string{"read", "admin"})
+	assert.ErrorIs(t, err, ErrUnknownPermission)
+
+	_, err = ParsePermissions(nil)
+	assert.ErrorIs(t, err, ErrPermissionsMissing)
+}
+
+func TestStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys", "apikeys.json")
+	s := NewStore(file)
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	keys, err := s.List()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	plain, k, err := s.Create("reader", []Permission{PermissionRead}, nil, now)
+	assert.NoError(t, err)
+	assert.True(t, IsAPIKey(plain))
+	assert.True(t, strings.HasPrefix(plain, KeyPrefix+k.ID+"_"))
+	assert.Equal(t, "reader", k.Name)
+	assert.Equal(t, now, k.Created)
+	assert.Nil(t, k.Expires)
+
+	exp := now.Add(time.Hour)
+	plain2, k2, err := s.Create("pusher", []Permission{PermissionRead, PermissionPush}, &exp, now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, k.ID, k2.ID)
+
+	t.Run("keys are stored hashed", func(t *testing.T) {
+		b, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), plain)
+		assert.NotContains(t, string(b), plain2)
+		stat, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(keysFilePermissions), stat.Mode().Perm())
+	})
+
+	t.Run("list", func(t *testing.T) {
+		keys, err := NewStore(file).List()
+		assert.NoError(t, err)
+		assert.Equal(t, []Key{k, k2}, keys)
+	})
+
+	t.Run("authenticate", func(t *testing.T) {
+		ak, err := s.Authenticate(plain, now)
+		assert.NoError(t, err)
+		assert.Equal(t, k.ID, ak.ID)
+		assert.True(t, ak.HasPermission(PermissionRead))
+		assert.False(t, ak.HasPermission(PermissionPush))
+
+		ak, err = s.Authenticate(plain2, now.Add(30*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, k2.ID, ak.ID)
+	})
+
+	t.Run("authenticate expired", func(t *testing.T) {
+		_, err := s.Authenticate(plain2, now.Add(time.Hour))
+		assert.ErrorIs(t, err, ErrKeyExpired)
+	})
+
+	t.Run("authenticate invalid", func(t *testing.T) {
+		_, err := s.Authenticate(plain+"x", now)
+		assert.ErrorIs(t, err, ErrKeyInvalid)
+		_, err = s.Authenticate(KeyPrefix+"unknown_secret", now)
+		assert.ErrorIs(t, err, ErrKeyInvalid)
+		_, err = s.Authenticate("not-an-api-key", now)
+		assert.ErrorIs(t, err, ErrKeyInvalid)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		// revoke using a different store instance, as 'serve keys revoke' would do while the server is running
+		err := NewStore(file).Revoke(k.ID)
+		assert.NoError(t, err)
+		_, err = s.Authenticate(plain, now)
+		assert.ErrorIs(t, err, ErrKeyInvalid)
+
+		err = s.Revoke(k.ID)
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+
+		keys, err := s.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []Key{k2}, keys)
+	})
+
+	t.Run("create without permissions", func(t *testing.T) {
+		_, _, err := s.Create("nothing", nil, nil, now)
+		assert.ErrorIs(t, err, ErrPermissionsMissing)
+	})
+}
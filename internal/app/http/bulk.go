@@ -0,0 +1,139 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/wot-oss/tmc/internal/repos"
+)
+
+// readBulkPushFiles reads the Thing Models to be pushed from the body of a bulk push request, which may be
+// a multipart form, a zip archive or a JSON array. maxSize limits the total uncompressed size of zip archives
+func readBulkPushFiles(r *http.Request, maxSize int64) ([]repos.BulkPushFile, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+	if err != nil {
+		return nil, NewBadRequestError(err, "Invalid Content-Type header: %s", r.Header.Get(HeaderContentType))
+	}
+	var files []repos.BulkPushFile
+	switch mediaType {
+	case MimeMultipartForm:
+		files, err = readMultipartFiles(r)
+	case MimeZip:
+		files, err = readZipFiles(r.Body, maxSize)
+	case MimeJSON:
+		files, err = readJSONArrayFiles(r.Body)
+	default:
+		return nil, NewBadRequestError(nil, "Invalid Content-Type header: %s", mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, NewBadRequestError(nil, "Request contains no Thing Models")
+	}
+	return files, nil
+}
+
+func readMultipartFiles(r *http.Request) ([]repos.BulkPushFile, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, NewBadRequestError(err, "Invalid multipart request body")
+	}
+	var files []repos.BulkPushFile
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, bulkReadError(err, "Invalid multipart request body")
+		}
+		// part.FileName() strips the directories, which are needed for optTree
+		_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		name := params["filename"]
+		if name == "" {
+			_ = part.Close()
+			continue
+		}
+		raw, err := io.ReadAll(part)
+		_ = part.Close()
+		if err != nil {
+			return nil, bulkReadError(err, "Invalid multipart request body")
+		}
+		files = append(files, repos.BulkPushFile{Name: cleanBulkFileName(name), Raw: raw})
+	}
+	return files, nil
+}
+
+func readZipFiles(body io.Reader, maxSize int64) ([]repos.BulkPushFile, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, bulkReadError(err, "Cannot read request body")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, NewBadRequestError(err, "Invalid zip archive")
+	}
+	var files []repos.BulkPushFile
+	var total int64
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || !strings.HasSuffix(zf.Name, ".json") {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, NewBadRequestError(err, "Invalid zip archive entry %s", zf.Name)
+		}
+		var src io.Reader = rc
+		if maxSize > 0 {
+			// guard against archives which decompress to much more than their own size
+			src = io.LimitReader(rc, maxSize-total+1)
+		}
+		raw, err := io.ReadAll(src)
+		_ = rc.Close()
+		if err != nil {
+			return nil, NewBadRequestError(err, "Invalid zip archive entry %s", zf.Name)
+		}
+		total += int64(len(raw))
+		if maxSize > 0 && total > maxSize {
+			return nil, NewPayloadTooLargeError(nil, "Uncompressed zip archive exceeds the maximum size of %d bytes", maxSize)
+		}
+		files = append(files, repos.BulkPushFile{Name: cleanBulkFileName(zf.Name), Raw: raw})
+	}
+	return files, nil
+}
+
+func readJSONArrayFiles(body io.Reader) ([]repos.BulkPushFile, error) {
+	var tms []json.RawMessage
+	err := json.NewDecoder(body).Decode(&tms)
+	if err != nil {
+		return nil, bulkReadError(err, "Invalid request body")
+	}
+	files := make([]repos.BulkPushFile, 0, len(tms))
+	for i, tm := range tms {
+		files = append(files, repos.BulkPushFile{Name: strconv.Itoa(i), Raw: tm})
+	}
+	return files, nil
+}
+
+// bulkReadError returns err unchanged if the request body is too large, to be reported with 413, and a bad request error otherwise
+func bulkReadError(err error, detail string) error {
+	var mbErr *http.MaxBytesError
+	if errors.As(err, &mbErr) {
+		return err
+	}
+	return NewBadRequestError(err, detail)
+}
+
+func cleanBulkFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -5,22 +5,28 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/audit"
 	"github.com/wot-oss/tmc/internal/commands"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/utils"
 )
 
 const (
 	Error400Title  = "Bad Request"
 	Error401Title  = "Unauthorized"
+	Error403Title  = "Forbidden"
 	Error404Title  = "Not Found"
 	Error409Title  = "Conflict"
+	Error413Title  = "Payload Too Large"
 	Error503Title  = "Service Unavailable"
+	Error503Detail = "The index of a Thing Model repository is being updated by another process. Try again later"
 	Error500Title  = "Internal Server Error"
 	Error500Detail = "An unhandled error has occurred. Try again later. If it is a bug we already recorded it. Retrying will most likely not help"
 	Error502Title  = "Bad Gateway"
@@ -30,17 +36,26 @@ const (
 	HeaderContentType         = "Content-Type"
 	HeaderCacheControl        = "Cache-Control"
 	HeaderXContentTypeOptions = "X-Content-Type-Options"
+	HeaderRetryAfter          = "Retry-After"
+	HeaderXRequestID          = "X-Request-ID"
 	MimeText                  = "text/plain"
 	MimeJSON                  = "application/json"
 	MimeProblemJSON           = "application/problem+json"
+	MimeZip                   = "application/zip"
+	MimeMultipartForm         = "multipart/form-data"
 	NoSniff                   = "nosniff"
 	NoCache                   = "no-cache, no-store, max-age=0, must-revalidate"
+	// indexLockedRetryAfter is the number of seconds a client is asked to wait before retrying a request which failed
+	// because a repo index was locked
+	indexLockedRetryAfter = "1"
 
 	basePathInventory   = "/inventory"
 	basePathThingModels = "/thing-models"
 
 	ctxUrlRoot      = "urlContextRoot"
 	ctxRelPathDepth = "relPathDepth"
+	ctxAuthSubject  = "authSubject"
+	ctxAuthRecorder = "authSubjectRecorder"
 )
 
 func HandleJsonResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
@@ -69,11 +84,6 @@ func HandleHealthyResponse(w http.ResponseWriter, r *http.Request) {
 
 func HandleErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 
-	if err != nil {
-		//todo: log
-		fmt.Println(err)
-	}
-
 	errTitle := Error500Title
 	errDetail := Error500Detail
 	errStatus := http.StatusInternalServerError
@@ -96,6 +106,11 @@ func HandleErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 		errTitle = Error400Title
 		errDetail = err.Error()
 		errStatus = http.StatusBadRequest
+	case errors.Is(err, repos.ErrIndexLocked):
+		errTitle = Error503Title
+		errDetail = Error503Detail
+		errStatus = http.StatusServiceUnavailable
+		w.Header().Set(HeaderRetryAfter, indexLockedRetryAfter)
 	// handle error values we want to access with errors.As()
 	case errors.As(err, &bErr):
 		errTitle = bErr.Title
@@ -129,6 +144,13 @@ func HandleErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	default:
 	}
 
+	log := utils.Logger(r.Context())
+	if errStatus >= http.StatusInternalServerError {
+		log.Error("request failed", "path", r.URL.Path, "status", errStatus, "error", err)
+	} else {
+		log.Debug("request failed", "path", r.URL.Path, "status", errStatus, "error", err)
+	}
+
 	problem := server.ErrorResponse{
 		Title:    errTitle,
 		Detail:   &errDetail,
@@ -136,6 +158,9 @@ func HandleErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 		Instance: &r.RequestURI,
 		Code:     &errCode,
 	}
+	if id := utils.RequestIDFromContext(r.Context()); id != "" {
+		problem.RequestId = &id
+	}
 
 	respBody, _ := json.MarshalIndent(problem, "", "  ")
 	w.Header().Set(HeaderContentType, MimeProblemJSON)
@@ -168,6 +193,10 @@ func NewUnauthorizedError(err error, detail string, args ...any) error {
 	return newBaseHttpError(err, http.StatusUnauthorized, Error401Title, detail, args...)
 }
 
+func NewForbiddenError(err error, detail string, args ...any) error {
+	return newBaseHttpError(err, http.StatusForbidden, Error403Title, detail, args...)
+}
+
 func NewNotFoundError(err error, detail string, args ...any) error {
 	return newBaseHttpError(err, http.StatusNotFound, Error404Title, detail, args...)
 }
@@ -176,6 +205,10 @@ func NewBadRequestError(err error, detail string, args ...any) error {
 	return newBaseHttpError(err, http.StatusBadRequest, Error400Title, detail, args...)
 }
 
+func NewPayloadTooLargeError(err error, detail string, args ...any) error {
+	return newBaseHttpError(err, http.StatusRequestEntityTooLarge, Error413Title, detail, args...)
+}
+
 func NewServiceUnavailableError(err error, detail string) error {
 	return newBaseHttpError(err, http.StatusServiceUnavailable, Error503Title, detail)
 }
@@ -308,3 +341,100 @@ func toPushThingModelResponse(tmID string) server.PushThingModelResponse {
 		Data: data,
 	}
 }
+
+func toPushThingModelsResponse(results []repos.BulkPushResult) server.PushThingModelsResponse {
+	data := make([]server.PushThingModelsResult, 0, len(results))
+	for _, r := range results {
+		r := r
+		res := server.PushThingModelsResult{
+			Name:   r.Name,
+			Result: server.PushThingModelsResultResult(r.Type),
+		}
+		if r.TMID != "" {
+			res.TmID = &r.TMID
+		}
+		if r.Message != "" {
+			res.Message = &r.Message
+		}
+		data = append(data, res)
+	}
+	return server.PushThingModelsResponse{
+		Data: data,
+	}
+}
+
+func toPromoteThingModelResponse(tmID, approver string) server.PromoteThingModelResponse {
+	data := server.PromoteThingModelResult{
+		TmID:     tmID,
+		Approver: approver,
+	}
+	return server.PromoteThingModelResponse{
+		Data: data,
+	}
+}
+
+func toHealthResponse(report repos.HealthReport, err error) server.HealthResponse {
+	resp := server.HealthResponse{
+		Status: server.HealthStatus(report.Status),
+		Repos:  []server.RepoHealth{},
+	}
+	if err != nil {
+		resp.Status = server.Down
+		detail := err.Error()
+		resp.Detail = &detail
+	}
+	for _, h := range report.Repos {
+		rh := server.RepoHealth{
+			Repo:      h.Repo,
+			Status:    server.HealthStatus(h.Status),
+			Remote:    h.Remote,
+			LatencyMs: int(h.Latency.Milliseconds()),
+		}
+		if !h.IndexUpdated.IsZero() {
+			updated := h.IndexUpdated.UTC()
+			rh.IndexUpdated = &updated
+		}
+		if h.Message != "" {
+			msg := h.Message
+			rh.Message = &msg
+		}
+		resp.Repos = append(resp.Repos, rh)
+	}
+	return resp
+}
+
+// ContextWithAuthSubject returns a copy of ctx carrying the subject of the authenticated client
+func ContextWithAuthSubject(ctx context.Context, subject string) context.Context {
+	if rec, ok := ctx.Value(ctxAuthRecorder).(*string); ok {
+		*rec = subject
+	}
+	return context.WithValue(ctx, ctxAuthSubject, subject)
+}
+
+// ContextRecordingAuthSubject returns a copy of ctx which records the subject of the authenticated client, once it is
+// set with ContextWithAuthSubject in a context derived from it, and a function returning the recorded subject. Lets
+// handlers wrapping the authentication middlewares learn the subject
+func ContextRecordingAuthSubject(ctx context.Context) (context.Context, func() string) {
+	rec := new(string)
+	return context.WithValue(ctx, ctxAuthRecorder, rec), func() string { return *rec }
+}
+
+// AuthSubjectFromContext returns the subject of the authenticated client or empty string if there is none
+func AuthSubjectFromContext(ctx context.Context) string {
+	if s, ok := ctx.Value(ctxAuthSubject).(string); ok {
+		return s
+	}
+	return ""
+}
+
+// auditContext returns the request's context carrying the remote client, to be recorded in the audit log
+func auditContext(r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return audit.ContextWithClient(r.Context(), audit.Client{
+		IP:      ip,
+		Subject: AuthSubjectFromContext(r.Context()),
+	})
+}
@@ -41,12 +41,13 @@ func (co *CORSOptions) MaxAge(max int) {
 
 func Protect(h http.Handler, opts CORSOptions) http.Handler {
 	// add supported default values to the CORS options
-	opts.AddAllowedHeaders(httptmc.HeaderContentType)
+	opts.AddAllowedHeaders(httptmc.HeaderContentType, httptmc.HeaderXRequestID)
 
 	// add CORS middleware to the http handler
 	var corsOpts []handlers.CORSOption
 	corsOpts = append(corsOpts, handlers.AllowedHeaders(opts.allowedHeaders))
 	corsOpts = append(corsOpts, handlers.AllowedOrigins(opts.allowedOrigins))
+	corsOpts = append(corsOpts, handlers.ExposedHeaders([]string{httptmc.HeaderXRequestID}))
 	corsOpts = append(corsOpts, handlers.AllowedMethods([]string{
 		http.MethodGet,
 		http.MethodPost,
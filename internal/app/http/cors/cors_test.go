@@ -53,11 +53,14 @@ func TestWithCORS(t *testing.T) {
 	corsHeaders := fmt.Sprintf("%v", reflect.Indirect(immutable).FieldByName("allowedHeaders"))
 	corsCredentials := fmt.Sprintf("%v", reflect.Indirect(immutable).FieldByName("allowCredentials"))
 	corsMaxAge := fmt.Sprintf("%v", reflect.Indirect(immutable).FieldByName("maxAge"))
+	corsExposed := fmt.Sprintf("%v", reflect.Indirect(immutable).FieldByName("exposedHeaders"))
 
 	// then: origins are set correct on CORS middleware handler
 	assert.Equal(t, "[http://example.org https://sample.com]", corsOrigins)
-	// then: headers contain the default CORS allowed header, the manual allowed header and the default header set by WithCORS()
-	assert.Equal(t, "[Accept Accept-Language Content-Language Origin X-Api-Key X-Bar Content-Type]", corsHeaders)
+	// then: headers contain the default CORS allowed header, the manual allowed header and the default headers set by WithCORS()
+	assert.Equal(t, "[Accept Accept-Language Content-Language Origin X-Api-Key X-Bar Content-Type X-Request-Id]", corsHeaders)
+	// then: the request id is exposed to clients
+	assert.Equal(t, "[X-Request-Id]", corsExposed)
 	// then: allow credentials is set correct on CORS middleware handler
 	assert.Equal(t, "true", corsCredentials)
 	// then: max age is set correct on CORS middleware handler
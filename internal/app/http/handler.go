@@ -3,6 +3,8 @@ package http
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,6 +20,10 @@ type TmcHandler struct {
 
 type TmcHandlerOptions struct {
 	UrlContextRoot string
+	// MaxPushBodySize limits the size of request bodies accepted by PushThingModel in bytes. No limit if not positive
+	MaxPushBodySize int64
+	// MaxBulkPushBodySize limits the size of request bodies accepted by PushThingModels in bytes. No limit if not positive
+	MaxBulkPushBodySize int64
 }
 
 func NewTmcHandler(handlerService HandlerService, options TmcHandlerOptions) *TmcHandler {
@@ -100,7 +106,7 @@ func (h *TmcHandler) DeleteThingModelById(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err := h.Service.DeleteThingModel(r.Context(), tmIDOrName)
+	err := h.Service.DeleteThingModel(auditContext(r), tmIDOrName)
 	if err != nil {
 		HandleErrorResponse(w, r, err)
 		return
@@ -118,16 +124,26 @@ func (h *TmcHandler) PushThingModel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.Options.MaxPushBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.Options.MaxPushBodySize)
+	}
 	defer r.Body.Close()
 	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		var mbErr *http.MaxBytesError
+		if errors.As(err, &mbErr) {
+			err = NewPayloadTooLargeError(nil, "Request body exceeds the maximum size of %d bytes", mbErr.Limit)
+		}
+		HandleErrorResponse(w, r, err)
+		return
+	}
 	err = r.Body.Close()
-
 	if err != nil {
 		HandleErrorResponse(w, r, err)
 		return
 	}
 
-	tmID, err := h.Service.PushThingModel(r.Context(), b)
+	tmID, err := h.Service.PushThingModel(auditContext(r), b)
 	if err != nil {
 		HandleErrorResponse(w, r, err)
 		return
@@ -138,6 +154,73 @@ func (h *TmcHandler) PushThingModel(w http.ResponseWriter, r *http.Request) {
 	HandleJsonResponse(w, r, http.StatusCreated, resp)
 }
 
+// PushThingModels Push multiple Thing Models at once
+// (POST /thing-models/.bulk)
+func (h *TmcHandler) PushThingModels(w http.ResponseWriter, r *http.Request, params server.PushThingModelsParams) {
+	if h.Options.MaxBulkPushBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.Options.MaxBulkPushBodySize)
+	}
+	defer r.Body.Close()
+	files, err := readBulkPushFiles(r, h.Options.MaxBulkPushBodySize)
+	if err != nil {
+		var mbErr *http.MaxBytesError
+		if errors.As(err, &mbErr) {
+			err = NewPayloadTooLargeError(nil, "Request body exceeds the maximum size of %d bytes", mbErr.Limit)
+		}
+		HandleErrorResponse(w, r, err)
+		return
+	}
+
+	optPath := ""
+	if params.OptPath != nil {
+		optPath = *params.OptPath
+	}
+	optTree := params.OptTree != nil && *params.OptTree
+
+	results, err := h.Service.PushThingModels(auditContext(r), files, optPath, optTree)
+	if err != nil {
+		HandleErrorResponse(w, r, err)
+		return
+	}
+
+	resp := toPushThingModelsResponse(results)
+	HandleJsonResponse(w, r, http.StatusOK, resp)
+}
+
+// PromoteThingModel Promote a Thing Model from one repository to another
+// (POST /promotions)
+func (h *TmcHandler) PromoteThingModel(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get(HeaderContentType)
+
+	if contentType != MimeJSON {
+		HandleErrorResponse(w, r, NewBadRequestError(nil, "Invalid Content-Type header: %s", contentType))
+		return
+	}
+
+	var req server.PromoteThingModelRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		HandleErrorResponse(w, r, NewBadRequestError(err, "Invalid request body"))
+		return
+	}
+
+	// the approver is recorded in the audit log, so it must not be chosen by the client
+	approver := AuthSubjectFromContext(r.Context())
+	if approver == "" {
+		HandleErrorResponse(w, r, NewUnauthorizedError(nil, "Promotions require an authenticated client to be recorded as approver"))
+		return
+	}
+
+	tmID, err := h.Service.PromoteThingModel(auditContext(r), req.TmID, req.From, req.To, approver)
+	if err != nil {
+		HandleErrorResponse(w, r, err)
+		return
+	}
+
+	resp := toPromoteThingModelResponse(tmID, approver)
+	HandleJsonResponse(w, r, http.StatusCreated, resp)
+}
+
 func (h *TmcHandler) GetAuthors(w http.ResponseWriter, r *http.Request, params server.GetAuthorsParams) {
 
 	searchParams := convertParams(params)
@@ -187,12 +270,14 @@ func (h *TmcHandler) GetMpns(w http.ResponseWriter, r *http.Request, params serv
 // (GET /healthz)
 func (h *TmcHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
 
-	err := h.Service.CheckHealth(r.Context())
+	report, err := h.Service.CheckHealth(r.Context())
+	resp := toHealthResponse(report, err)
+	status := http.StatusOK
 	if err != nil {
-		HandleErrorResponse(w, r, NewServiceUnavailableError(err, err.Error()))
-		return
+		status = http.StatusServiceUnavailable
 	}
-	HandleHealthyResponse(w, r)
+	w.Header().Set(HeaderCacheControl, NoCache)
+	HandleJsonResponse(w, r, status, resp)
 }
 
 // GetHealthLive Returns the liveness of the service
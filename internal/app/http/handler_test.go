@@ -1,14 +1,18 @@
 package http
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/wot-oss/tmc/internal/app/http/mocks"
 	"github.com/wot-oss/tmc/internal/commands"
@@ -61,6 +65,14 @@ func setupTestHttpHandler(hs HandlerService) http.Handler {
 	return NewHttpHandler(handler, nil)
 }
 
+func withAuthSubject(subject string) server.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(ContextWithAuthSubject(r.Context(), subject)))
+		})
+	}
+}
+
 func Test_healthLive(t *testing.T) {
 
 	route := "/healthz/live"
@@ -140,20 +152,47 @@ func Test_health(t *testing.T) {
 	hs := mocks.NewHandlerService(t)
 	httpHandler := setupTestHttpHandler(hs)
 
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := repos.HealthReport{
+		Status: repos.HealthDegraded,
+		Repos: []repos.RepoHealth{
+			{Repo: "r1", Status: repos.HealthUp, Latency: 12 * time.Millisecond, IndexUpdated: updated},
+			{Repo: "r2", Status: repos.HealthDown, Remote: true, Latency: 5 * time.Second, Message: "no answer within 5s"},
+		},
+	}
+
 	t.Run("with success", func(t *testing.T) {
-		hs.On("CheckHealth", mock.Anything).Return(nil).Once()
+		hs.On("CheckHealth", mock.Anything).Return(report, nil).Once()
 		// when: calling the route
 		rec := testutils.NewRequest(http.MethodGet, route).RunOnHandler(httpHandler)
-		// then: it returns 204 status and empty body
-		assertHealthyResponse204(t, rec)
+		// then: it returns 200 status and the health of each repo
+		assertResponse200(t, rec)
+		assert.Equal(t, NoCache, rec.Header().Get(HeaderCacheControl))
+		var resp server.HealthResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &resp)
+		assert.Equal(t, server.Degraded, resp.Status)
+		assert.Nil(t, resp.Detail)
+		if assert.Len(t, resp.Repos, 2) {
+			assert.Equal(t, server.RepoHealth{Repo: "r1", Status: server.Up, LatencyMs: 12, IndexUpdated: &updated}, resp.Repos[0])
+			msg := "no answer within 5s"
+			assert.Equal(t, server.RepoHealth{Repo: "r2", Status: server.Down, Remote: true, LatencyMs: 5000, Message: &msg}, resp.Repos[1])
+		}
 	})
 
 	t.Run("with error", func(t *testing.T) {
-		hs.On("CheckHealth", mock.Anything).Return(unknownErr).Once()
+		hs.On("CheckHealth", mock.Anything).Return(repos.HealthReport{Status: repos.HealthDown}, unknownErr).Once()
 		// when: calling the route
 		rec := testutils.NewRequest(http.MethodGet, route).RunOnHandler(httpHandler)
-		// then: it returns 503 status and json error as body
-		assertResponse503(t, rec, route)
+		// then: it returns 503 status and the reason as detail
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, NoCache, rec.Header().Get(HeaderCacheControl))
+		var resp server.HealthResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &resp)
+		assert.Equal(t, server.Down, resp.Status)
+		if assert.NotNil(t, resp.Detail) {
+			assert.Equal(t, unknownErr.Error(), *resp.Detail)
+		}
+		assert.Empty(t, resp.Repos)
 	})
 }
 
@@ -612,6 +651,22 @@ func Test_PushThingModel(t *testing.T) {
 		assertResponse400(t, rec, route)
 	})
 
+	t.Run("with body exceeding max size", func(t *testing.T) {
+		// given: a handler limiting the size of pushed TMs
+		limitedHandler := NewHttpHandler(NewTmcHandler(hs, TmcHandlerOptions{MaxPushBodySize: int64(len(tmContent) - 1)}), nil)
+		// when: calling the route
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody(tmContent).
+			RunOnHandler(limitedHandler)
+
+		// then: it returns status 413
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		var errResponse server.ErrorResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &errResponse)
+		assert.Equal(t, Error413Title, errResponse.Title)
+	})
+
 	t.Run("with conflicting id", func(t *testing.T) {
 		// given: a thing model file that conflicts with existing id
 		cErr := &repos.ErrTMIDConflict{
@@ -645,6 +700,222 @@ func Test_PushThingModel(t *testing.T) {
 	})
 }
 
+func Test_PushThingModels(t *testing.T) {
+	route := "/thing-models/.bulk"
+	tm1 := []byte(`{"title":"one"}`)
+	tm2 := []byte(`{"title":"two"}`)
+	results := []repos.BulkPushResult{
+		{Name: "a/one.json", Type: repos.BulkPushOK, TMID: "a/b/c/v1.0.0-20240101000000-abcdef012345.tm.json"},
+		{Name: "two.json", Type: repos.BulkPushError, Message: "invalid"},
+	}
+
+	hs := mocks.NewHandlerService(t)
+	httpHandler := setupTestHttpHandler(hs)
+
+	assertResults := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response server.PushThingModelsResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &response)
+		if assert.Len(t, response.Data, 2) {
+			assert.Equal(t, server.PushResultOK, response.Data[0].Result)
+			assert.Equal(t, results[0].TMID, *response.Data[0].TmID)
+			assert.Equal(t, server.PushResultError, response.Data[1].Result)
+			assert.Equal(t, "invalid", *response.Data[1].Message)
+			assert.Nil(t, response.Data[1].TmID)
+		}
+	}
+
+	t.Run("with multipart form", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("files", "a/one.json")
+		_, _ = fw.Write(tm1)
+		fw, _ = mw.CreateFormFile("files", "two.json")
+		_, _ = fw.Write(tm2)
+		_ = mw.WriteField("comment", "ignored")
+		_ = mw.Close()
+		expFiles := []repos.BulkPushFile{{Name: "a/one.json", Raw: tm1}, {Name: "two.json", Raw: tm2}}
+		hs.On("PushThingModels", mock.Anything, expFiles, "x", true).Return(results, nil).Once()
+
+		rec := testutils.NewRequest(http.MethodPost, route+"?optPath=x&optTree=true").
+			WithHeader(HeaderContentType, mw.FormDataContentType()).
+			WithBody(body.Bytes()).
+			RunOnHandler(httpHandler)
+
+		assertResults(t, rec)
+	})
+
+	t.Run("with zip archive", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		zw := zip.NewWriter(body)
+		_, _ = zw.Create("a/")
+		fw, _ := zw.Create("a/one.json")
+		_, _ = fw.Write(tm1)
+		fw, _ = zw.Create("README.md")
+		_, _ = fw.Write([]byte("# not a TM"))
+		fw, _ = zw.Create("two.json")
+		_, _ = fw.Write(tm2)
+		_ = zw.Close()
+		expFiles := []repos.BulkPushFile{{Name: "a/one.json", Raw: tm1}, {Name: "two.json", Raw: tm2}}
+		hs.On("PushThingModels", mock.Anything, expFiles, "", false).Return(results, nil).Once()
+
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeZip).
+			WithBody(body.Bytes()).
+			RunOnHandler(httpHandler)
+
+		assertResults(t, rec)
+	})
+
+	t.Run("with json array", func(t *testing.T) {
+		expFiles := []repos.BulkPushFile{{Name: "0", Raw: tm1}, {Name: "1", Raw: tm2}}
+		hs.On("PushThingModels", mock.Anything, expFiles, "", false).Return(results, nil).Once()
+
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody([]byte(`[` + string(tm1) + `,` + string(tm2) + `]`)).
+			RunOnHandler(httpHandler)
+
+		assertResults(t, rec)
+	})
+
+	t.Run("with invalid requests", func(t *testing.T) {
+		tests := []struct {
+			contentType string
+			body        []byte
+		}{
+			{"", tm1},
+			{"application/xml", tm1},
+			{MimeJSON, tm1},
+			{MimeJSON, []byte("[]")},
+			{MimeZip, tm1},
+			{"multipart/form-data", tm1},
+		}
+		for _, test := range tests {
+			rec := testutils.NewRequest(http.MethodPost, route).
+				WithHeader(HeaderContentType, test.contentType).
+				WithBody(test.body).
+				RunOnHandler(httpHandler)
+
+			assertResponse400(t, rec, route)
+		}
+	})
+
+	t.Run("with body exceeding max size", func(t *testing.T) {
+		limitedHandler := NewHttpHandler(NewTmcHandler(hs, TmcHandlerOptions{MaxBulkPushBodySize: 10}), nil)
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody([]byte(`[` + string(tm1) + `,` + string(tm2) + `]`)).
+			RunOnHandler(limitedHandler)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("with unknown error", func(t *testing.T) {
+		hs.On("PushThingModels", mock.Anything, mock.Anything, "", false).Return(nil, unknownErr).Once()
+
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody([]byte(`[` + string(tm1) + `]`)).
+			RunOnHandler(httpHandler)
+
+		assertResponse500(t, rec, route)
+	})
+}
+
+func Test_PromoteThingModel(t *testing.T) {
+
+	tmID := "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"
+	reqBody := []byte(`{"tmID": "` + tmID + `", "from": "staging", "to": "production", "approver": "mallory"}`)
+
+	route := "/promotions"
+
+	hs := mocks.NewHandlerService(t)
+	httpHandler := NewHttpHandler(NewTmcHandler(hs, TmcHandlerOptions{}), []server.MiddlewareFunc{withAuthSubject("apikey:alice")})
+
+	t.Run("with success", func(t *testing.T) {
+		hs.On("PromoteThingModel", mock.Anything, tmID, "staging", "production", "apikey:alice").Return(tmID, nil).Once()
+		// when: calling the route
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody(reqBody).
+			RunOnHandler(httpHandler)
+
+		// then: it returns status 201
+		assertResponse201(t, rec)
+		// and then: the body is of correct type
+		var response server.PromoteThingModelResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &response)
+		// and then: tmID and approver are set in response
+		assert.Equal(t, tmID, response.Data.TmID)
+		assert.Equal(t, "apikey:alice", response.Data.Approver)
+	})
+
+	t.Run("without authenticated client", func(t *testing.T) {
+		// when: calling the route without authentication
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody(reqBody).
+			RunOnHandler(setupTestHttpHandler(hs))
+
+		// then: it returns status 401
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("with missing or wrong Content-Type", func(t *testing.T) {
+		contentTypes := []string{"", "application/pdf", "application/xml"}
+
+		for _, c := range contentTypes {
+			rec := testutils.NewRequest(http.MethodPost, route).
+				WithHeader(HeaderContentType, c).
+				WithBody(reqBody).
+				RunOnHandler(httpHandler)
+
+			// then: it returns status 400
+			assertResponse400(t, rec, route)
+		}
+	})
+
+	t.Run("with invalid body", func(t *testing.T) {
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody([]byte("not json")).
+			RunOnHandler(httpHandler)
+
+		// then: it returns status 400
+		assertResponse400(t, rec, route)
+	})
+
+	t.Run("with conflicting id", func(t *testing.T) {
+		// given: the target repo already contains the TM
+		cErr := &repos.ErrTMIDConflict{
+			Type:       repos.IdConflictSameContent,
+			ExistingId: tmID,
+		}
+		hs.On("PromoteThingModel", mock.Anything, tmID, "staging", "production", "apikey:alice").Return("", cErr).Once()
+		// when: calling the route
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody(reqBody).
+			RunOnHandler(httpHandler)
+
+		// then: it returns status 409 with appropriate error
+		assertResponse409(t, rec, route, cErr)
+	})
+
+	t.Run("with not found", func(t *testing.T) {
+		hs.On("PromoteThingModel", mock.Anything, tmID, "staging", "production", "apikey:alice").Return("", repos.ErrTmNotFound).Once()
+		// when: calling the route
+		rec := testutils.NewRequest(http.MethodPost, route).
+			WithHeader(HeaderContentType, MimeJSON).
+			WithBody(reqBody).
+			RunOnHandler(httpHandler)
+
+		// then: it returns status 404
+		assertResponse404(t, rec, route)
+	})
+}
+
 func Test_DeleteThingModelById(t *testing.T) {
 	tmID := listResult2.Entries[0].Versions[0].TMID
 
@@ -696,6 +967,19 @@ func Test_DeleteThingModelById(t *testing.T) {
 		assertResponse404(t, rec, route)
 	})
 
+	t.Run("with locked index", func(t *testing.T) {
+		route := "/thing-models/" + tmID + "?force=true"
+		hs.On("DeleteThingModel", mock.Anything, tmID).Return(repos.NewRepoAccessError(model.NewRepoSpec("rem"), repos.ErrIndexLocked)).Once()
+		// when: calling the route
+		rec := testutils.NewRequest(http.MethodDelete, route).RunOnHandler(httpHandler)
+		// then: it returns status 503 with Retry-After and json error as body
+		assertResponse503(t, rec, route)
+		assert.Equal(t, "1", rec.Header().Get(HeaderRetryAfter))
+		var errResponse server.ErrorResponse
+		assertUnmarshalResponse(t, rec.Body.Bytes(), &errResponse)
+		assert.Equal(t, Error503Detail, *errResponse.Detail)
+	})
+
 }
 
 func Test_Completions(t *testing.T) {
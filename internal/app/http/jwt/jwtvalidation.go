@@ -2,13 +2,13 @@ package jwt
 
 import (
 	"errors"
-	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	httptmc "github.com/wot-oss/tmc/internal/app/http"
 	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/utils"
 )
 
 var jwksKeyFunc jwt.Keyfunc
@@ -27,8 +27,9 @@ func jwtValidationMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// existing scopes in ctx is the only hint for a protected endpoint
 		scopes := extractAuthScopes(r)
-		if scopes != nil {
-			slog.Default().Debug("jwt: protected endpoint:", "path", r.URL)
+		// a subject in ctx means the request has already been authenticated, e.g. with an API key
+		if scopes != nil && httptmc.AuthSubjectFromContext(r.Context()) == "" {
+			utils.Logger(r.Context()).Debug("jwt: protected endpoint:", "path", r.URL)
 			// protected endpoint, check for bearer tokenString in header
 			tokenString, err := extractBearerToken(r)
 			if err != nil {
@@ -47,6 +48,9 @@ func jwtValidationMiddleware(h http.Handler) http.Handler {
 				httptmc.HandleErrorResponse(w, r, httptmc.NewUnauthorizedError(nil, err.Error()))
 				return
 			}
+			if sub, err := token.Claims.GetSubject(); err == nil && sub != "" {
+				r = r.WithContext(httptmc.ContextWithAuthSubject(r.Context(), sub))
+			}
 		}
 		h.ServeHTTP(w, r)
 	})
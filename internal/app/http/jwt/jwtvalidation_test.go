@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
 )
 
 func newToken(claims jwt.MapClaims, key *rsa.PrivateKey) string {
@@ -130,3 +131,30 @@ func Test_Authorization(t *testing.T) {
 		authorized = false
 	}
 }
+
+func Test_AlreadyAuthenticatedRequestIsPassed(t *testing.T) {
+	authorized := false
+	authorizedFunc := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized = true
+	})
+	protected := jwtValidationMiddleware(authorizedFunc)
+
+	// inject an invalid bearer token
+	extractBearerToken = func(r *http.Request) (string, error) {
+		return "not a jwt", nil
+	}
+	// inject auth scopes, so the endpoint it protected
+	extractAuthScopes = func(r *http.Request) any {
+		return []string{}
+	}
+
+	out := httpt.NewRecorder()
+	req := httpt.NewRequest("", "/inventory", nil)
+	// request has been authenticated by a preceding middleware
+	req = req.WithContext(httptmc.ContextWithAuthSubject(req.Context(), "apikey:reader"))
+	protected.ServeHTTP(out, req)
+
+	if out.Result().StatusCode != http.StatusOK || !authorized {
+		t.Fatal(out)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	model "github.com/wot-oss/tmc/internal/model"
+
+	repos "github.com/wot-oss/tmc/internal/repos"
 )
 
 // HandlerService is an autogenerated mock type for the HandlerService type
@@ -16,21 +18,31 @@ type HandlerService struct {
 }
 
 // CheckHealth provides a mock function with given fields: ctx
-func (_m *HandlerService) CheckHealth(ctx context.Context) error {
+func (_m *HandlerService) CheckHealth(ctx context.Context) (repos.HealthReport, error) {
 	ret := _m.Called(ctx)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CheckHealth")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+	var r0 repos.HealthReport
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (repos.HealthReport, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) repos.HealthReport); ok {
 		r0 = rf(ctx)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(repos.HealthReport)
 	}
 
-	return r0
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // CheckHealthLive provides a mock function with given fields: ctx
@@ -315,6 +327,34 @@ func (_m *HandlerService) ListMpns(ctx context.Context, search *model.SearchPara
 	return r0, r1
 }
 
+// PromoteThingModel provides a mock function with given fields: ctx, tmID, from, to, approver
+func (_m *HandlerService) PromoteThingModel(ctx context.Context, tmID string, from string, to string, approver string) (string, error) {
+	ret := _m.Called(ctx, tmID, from, to, approver)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PromoteThingModel")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) (string, error)); ok {
+		return rf(ctx, tmID, from, to, approver)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) string); ok {
+		r0 = rf(ctx, tmID, from, to, approver)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string) error); ok {
+		r1 = rf(ctx, tmID, from, to, approver)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // PushThingModel provides a mock function with given fields: ctx, file
 func (_m *HandlerService) PushThingModel(ctx context.Context, file []byte) (string, error) {
 	ret := _m.Called(ctx, file)
@@ -343,6 +383,36 @@ func (_m *HandlerService) PushThingModel(ctx context.Context, file []byte) (stri
 	return r0, r1
 }
 
+// PushThingModels provides a mock function with given fields: ctx, files, optPath, optTree
+func (_m *HandlerService) PushThingModels(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+	ret := _m.Called(ctx, files, optPath, optTree)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PushThingModels")
+	}
+
+	var r0 []repos.BulkPushResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []repos.BulkPushFile, string, bool) ([]repos.BulkPushResult, error)); ok {
+		return rf(ctx, files, optPath, optTree)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []repos.BulkPushFile, string, bool) []repos.BulkPushResult); ok {
+		r0 = rf(ctx, files, optPath, optTree)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]repos.BulkPushResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []repos.BulkPushFile, string, bool) error); ok {
+		r1 = rf(ctx, files, optPath, optTree)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewHandlerService creates a new instance of HandlerService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewHandlerService(t interface {
@@ -0,0 +1,157 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+)
+
+const reloadCheckInterval = 2 * time.Second
+
+// ServerOpts configures TLS for the REST API server
+type ServerOpts struct {
+	// CertFile and KeyFile are the server's certificate and private key in PEM format. They are reloaded when changed
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM file with the CA certificates used to verify client certificates. Enables mTLS if set
+	ClientCAFile string
+}
+
+// NewServerTLSConfig creates the tls.Config for the REST API server
+func NewServerTLSConfig(opts ServerOpts) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("both TLS certificate and key must be given")
+	}
+	reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", opts.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		// requests without client certificate may still be authenticated otherwise or access unprotected endpoints
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tc, nil
+}
+
+// CertReloader provides a certificate loaded from files and reloads it when the files have been modified
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is meant to be used as tls.Config.GetCertificate.
+// If reloading a modified certificate fails, the previous certificate keeps being used
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) >= reloadCheckInterval {
+		r.lastCheck = time.Now()
+		if r.modified() {
+			err := r.reload()
+			if err != nil {
+				slog.Default().Error("could not reload TLS certificate. Keeping previous certificate", "certFile", r.certFile, "error", err)
+			} else {
+				slog.Default().Info("reloaded TLS certificate", "certFile", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *CertReloader) modified() bool {
+	cm, km, err := r.modTimes()
+	if err != nil {
+		return false
+	}
+	return !cm.Equal(r.certMod) || !km.Equal(r.keyMod)
+}
+
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	cs, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	ks, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return cs.ModTime(), ks.ModTime(), nil
+}
+
+func (r *CertReloader) reload() error {
+	cm, km, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = cm
+	r.keyMod = km
+	return nil
+}
+
+// LoadClientPermissions reads the mapping of client certificate subjects to permissions from a JSON file.
+// The file contains an object whose keys are either full subject DNs as formatted by pkix.Name.String(), e.g.
+// "CN=plant-a,O=Acme", or plain common names, and whose values are lists of permissions
+func LoadClientPermissions(file string) (map[string][]apikey.Permission, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string][]string
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client permissions file %s: %w", file, err)
+	}
+	res := make(map[string][]apikey.Permission, len(raw))
+	for subject, names := range raw {
+		perms, err := apikey.ParsePermissions(names)
+		if err != nil {
+			return nil, fmt.Errorf("invalid permissions for %s: %w", subject, err)
+		}
+		res[subject] = perms
+	}
+	return res, nil
+}
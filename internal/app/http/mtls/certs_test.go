@@ -0,0 +1,142 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+)
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	caFile, _ := writeCert(t, dir, "ca")
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := NewServerTLSConfig(ServerOpts{CertFile: certFile})
+		assert.Error(t, err)
+	})
+	t.Run("without client ca", func(t *testing.T) {
+		tc, err := NewServerTLSConfig(ServerOpts{CertFile: certFile, KeyFile: keyFile})
+		assert.NoError(t, err)
+		assert.Nil(t, tc.ClientCAs)
+		assert.Equal(t, tls.NoClientCert, tc.ClientAuth)
+		cert, err := tc.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, cert)
+	})
+	t.Run("with client ca", func(t *testing.T) {
+		tc, err := NewServerTLSConfig(ServerOpts{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+		assert.NoError(t, err)
+		assert.NotNil(t, tc.ClientCAs)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, tc.ClientAuth)
+	})
+	t.Run("invalid client ca", func(t *testing.T) {
+		_, err := NewServerTLSConfig(ServerOpts{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile})
+		assert.ErrorContains(t, err, "no certificates found")
+	})
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	first, err := r.GetCertificate(nil)
+	assert.NoError(t, err)
+
+	t.Run("unchanged", func(t *testing.T) {
+		r.lastCheck = time.Time{}
+		c, err := r.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.Same(t, first, c)
+	})
+	t.Run("invalid new certificate keeps previous", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0600))
+		touch(t, certFile)
+		r.lastCheck = time.Time{}
+		c, err := r.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.Same(t, first, c)
+	})
+	t.Run("reloaded", func(t *testing.T) {
+		writeCert(t, dir, "server")
+		touch(t, certFile)
+		r.lastCheck = time.Time{}
+		c, err := r.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.NotSame(t, first, c)
+		assert.NotEqual(t, first.Certificate[0], c.Certificate[0])
+	})
+}
+
+func TestLoadClientPermissions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "perms.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"CN=plant-a,O=Acme": ["read"], "plant-b": ["read", "push"]}`), 0600))
+	perms, err := LoadClientPermissions(file)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]apikey.Permission{
+		"CN=plant-a,O=Acme": {apikey.PermissionRead},
+		"plant-b":           {apikey.PermissionRead, apikey.PermissionPush},
+	}, perms)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"plant-b": ["admin"]}`), 0600))
+	_, err = LoadClientPermissions(file)
+	assert.ErrorIs(t, err, apikey.ErrUnknownPermission)
+}
+
+// writeCert writes a new self-signed certificate and its key with common name cn to dir
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+	t.Helper()
+	cert, key := newCert(t, cn)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile := filepath.Join(dir, cn+".crt")
+	keyFile := filepath.Join(dir, cn+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+	return certFile, keyFile
+}
+
+func newCert(t *testing.T, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+// touch sets the modification time of file into the future to make sure the change is detected
+func touch(t *testing.T, file string) {
+	t.Helper()
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(file, future, future))
+}
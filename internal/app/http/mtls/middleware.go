@@ -0,0 +1,71 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"net/http"
+	"slices"
+
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const subjectPrefix = "cert:"
+
+type ClientCertValidationOpts struct {
+	// Permissions maps client certificate subjects to the permissions granted to them. See LoadClientPermissions
+	Permissions map[string][]apikey.Permission
+	// PassUnauthenticated lets requests without client certificate pass on to the next middleware,
+	// e.g. for API key or JWT validation, instead of rejecting them
+	PassUnauthenticated bool
+}
+
+// GetMiddleware returns a middleware that authenticates requests to protected endpoints with verified client
+// certificates and checks that the certificate's subject is granted the permission required by the request
+func GetMiddleware(opts ClientCertValidationOpts) server.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// existing scopes in ctx is the only hint for a protected endpoint
+			if r.Context().Value(server.BearerAuthScopes) == nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				if opts.PassUnauthenticated {
+					h.ServeHTTP(w, r)
+					return
+				}
+				httptmc.HandleErrorResponse(w, r, httptmc.NewUnauthorizedError(nil, "client certificate required"))
+				return
+			}
+			cert := r.TLS.VerifiedChains[0][0]
+			subject := cert.Subject.String()
+			perms, ok := permissionsOf(cert, opts.Permissions)
+			if !ok {
+				httptmc.HandleErrorResponse(w, r, httptmc.NewForbiddenError(nil, "client certificate subject %s is not granted any permissions", subject))
+				return
+			}
+			required := apikey.RequiredPermission(r)
+			if !slices.Contains(perms, required) {
+				httptmc.HandleErrorResponse(w, r, httptmc.NewForbiddenError(nil, "client certificate subject %s lacks permission '%s'", subject, required))
+				return
+			}
+			utils.Logger(r.Context()).Debug("mtls: authenticated", "path", r.URL, "subject", subject)
+			r = r.WithContext(httptmc.ContextWithAuthSubject(r.Context(), subjectPrefix+subject))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func permissionsOf(cert *x509.Certificate, permissions map[string][]apikey.Permission) ([]apikey.Permission, bool) {
+	if perms, ok := permissions[cert.Subject.String()]; ok {
+		return perms, true
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		if perms, ok := permissions[cn]; ok {
+			return perms, true
+		}
+	}
+	return nil, false
+}
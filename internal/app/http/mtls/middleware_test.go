@@ -0,0 +1,68 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	httptmc "github.com/wot-oss/tmc/internal/app/http"
+	"github.com/wot-oss/tmc/internal/app/http/apikey"
+	"github.com/wot-oss/tmc/internal/app/http/server"
+)
+
+func TestMiddleware(t *testing.T) {
+	plantA, _ := newCert(t, "plant-a")
+	plantB, _ := newCert(t, "plant-b")
+	stranger, _ := newCert(t, "stranger")
+	perms := map[string][]apikey.Permission{
+		"CN=plant-a,O=Acme": {apikey.PermissionRead},
+		"plant-b":           {apikey.PermissionRead, apikey.PermissionPush},
+	}
+
+	tests := []struct {
+		name                string
+		method              string
+		protected           bool
+		cert                *x509.Certificate
+		passUnauthenticated bool
+		expStatus           int
+		expSubject          string
+	}{
+		{"unprotected endpoint", http.MethodGet, false, nil, false, http.StatusOK, ""},
+		{"missing certificate", http.MethodGet, true, nil, false, http.StatusUnauthorized, ""},
+		{"missing certificate passed on", http.MethodGet, true, nil, true, http.StatusOK, ""},
+		{"read by subject dn", http.MethodGet, true, plantA, false, http.StatusOK, "cert:CN=plant-a,O=Acme"},
+		{"push without push permission", http.MethodPost, true, plantA, false, http.StatusForbidden, ""},
+		{"push by common name", http.MethodPost, true, plantB, false, http.StatusOK, "cert:CN=plant-b,O=Acme"},
+		{"delete without delete permission", http.MethodDelete, true, plantB, false, http.StatusForbidden, ""},
+		{"unknown subject", http.MethodGet, true, stranger, true, http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject = httptmc.AuthSubjectFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+			h := GetMiddleware(ClientCertValidationOpts{Permissions: perms, PassUnauthenticated: test.passUnauthenticated})(next)
+
+			req := httptest.NewRequest(test.method, "/thing-models", nil)
+			if test.protected {
+				req = req.WithContext(context.WithValue(req.Context(), server.BearerAuthScopes, []string{}))
+			}
+			if test.cert != nil {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{test.cert}}}
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expStatus, rec.Code)
+			assert.Equal(t, test.expSubject, subject)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+// maxRequestIDLength is the maximum length of a request id accepted from a client
+const maxRequestIDLength = 128
+
+// WithRequestID wraps h so that each request has an id. The id is taken from the X-Request-ID header sent by the
+// client, if it is valid, or generated otherwise. It is returned in the X-Request-ID header of the response and put into
+// the request's context, from where it is added to log lines, error responses and requests to remote repos
+func WithRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(HeaderXRequestID, id)
+		h.ServeHTTP(w, r.WithContext(utils.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is not empty, not too long and consists of printable ASCII characters other than
+// space only, so that it can be safely written to logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
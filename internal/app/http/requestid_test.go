@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wot-oss/tmc/internal/app/http/mocks"
+	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var ctxID string
+	h := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID = utils.RequestIDFromContext(r.Context())
+	}))
+
+	t.Run("propagates valid id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/inventory", nil)
+		req.Header.Set(HeaderXRequestID, "ticket-4711")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, "ticket-4711", ctxID)
+		assert.Equal(t, "ticket-4711", rec.Header().Get(HeaderXRequestID))
+	})
+
+	for _, id := range []string{"", "with space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		t.Run("generates id instead of "+id, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/inventory", nil)
+			req.Header.Set(HeaderXRequestID, id)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Len(t, ctxID, 36)
+			assert.NotEqual(t, id, ctxID)
+			assert.Equal(t, ctxID, rec.Header().Get(HeaderXRequestID))
+		})
+	}
+}
+
+func TestWithRequestID_ErrorResponse(t *testing.T) {
+	// given: a service which fails
+	hs := mocks.NewHandlerService(t)
+	hs.On("DeleteThingModel", mock.Anything, mock.Anything).Return(repos.ErrTmNotFound).Once()
+	httpHandler := WithRequestID(setupTestHttpHandler(hs))
+
+	// when: sending a request with a request id
+	req := httptest.NewRequest(http.MethodDelete, "/thing-models/a-corp/eagle/bt2000/v1.0.0-20240108140117-243d1b462ccc.tm.json?force=true", nil)
+	req.Header.Set(HeaderXRequestID, "ticket-4711")
+	rec := httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, req)
+
+	// then: the error response contains the request id
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var errResponse server.ErrorResponse
+	assertUnmarshalResponse(t, rec.Body.Bytes(), &errResponse)
+	if assert.NotNil(t, errResponse.RequestId) {
+		assert.Equal(t, "ticket-4711", *errResponse.RequestId)
+	}
+}
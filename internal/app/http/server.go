@@ -5,6 +5,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/wot-oss/tmc/internal/app/http/server"
+	"github.com/wot-oss/tmc/internal/tracing"
 )
 
 // READ ME !!!
@@ -21,6 +22,8 @@ import (
 func NewHttpHandler(si server.ServerInterface, mws []server.MiddlewareFunc) http.Handler {
 	r := mux.NewRouter()
 	r.NotFoundHandler = http.HandlerFunc(handleNoRoute)
+	// middlewares are applied in reverse order, so the route is recorded before all others run
+	mws = append(mws[:len(mws):len(mws)], traceRoute)
 	options := server.GorillaServerOptions{
 		BaseRouter:       r,
 		ErrorHandlerFunc: HandleErrorResponse,
@@ -32,3 +35,15 @@ func NewHttpHandler(si server.ServerInterface, mws []server.MiddlewareFunc) http
 func handleNoRoute(w http.ResponseWriter, r *http.Request) {
 	HandleErrorResponse(w, r, NewNotFoundError(nil, "Path not handled by Thing Model Catalog"))
 }
+
+// traceRoute names the span of a request after the matched route
+func traceRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				tracing.SetRoute(r.Context(), r.Method, tmpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,10 +3,30 @@
 // Code generated by github.com/deepmap/oapi-codegen/v2 version v2.1.0 DO NOT EDIT.
 package server
 
+import (
+	"time"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
 const (
 	BearerAuthScopes = "BearerAuth.Scopes"
 )
 
+// Defines values for HealthStatus.
+const (
+	Degraded HealthStatus = "degraded"
+	Down     HealthStatus = "down"
+	Up       HealthStatus = "up"
+)
+
+// Defines values for PushThingModelsResultResult.
+const (
+	PushResultError  PushThingModelsResultResult = "error"
+	PushResultExists PushThingModelsResultResult = "exists"
+	PushResultOK     PushThingModelsResultResult = "ok"
+)
+
 // Defines values for GetCompletionsParamsKind.
 const (
 	FetchNames GetCompletionsParamsKind = "fetchNames"
@@ -23,11 +43,25 @@ type ErrorResponse struct {
 	Code     *string `json:"code,omitempty"`
 	Detail   *string `json:"detail,omitempty"`
 	Instance *string `json:"instance,omitempty"`
-	Status   int     `json:"status"`
-	Title    string  `json:"title"`
-	Type     *string `json:"type,omitempty"`
+
+	// RequestId Id of the request, as sent by the client in the X-Request-ID header or generated by the server
+	RequestId *string `json:"requestId,omitempty"`
+	Status    int     `json:"status"`
+	Title     string  `json:"title"`
+	Type      *string `json:"type,omitempty"`
 }
 
+// HealthResponse defines model for HealthResponse.
+type HealthResponse struct {
+	// Detail Reason why the service is unavailable
+	Detail *string      `json:"detail,omitempty"`
+	Repos  []RepoHealth `json:"repos"`
+	Status HealthStatus `json:"status"`
+}
+
+// HealthStatus defines model for HealthStatus.
+type HealthStatus string
+
 // InventoryEntry defines model for InventoryEntry.
 type InventoryEntry struct {
 	Links              *InventoryEntryLinks    `json:"links,omitempty"`
@@ -100,6 +134,24 @@ type MpnsResponse struct {
 	Data []string `json:"data"`
 }
 
+// PromoteThingModelRequest defines model for PromoteThingModelRequest.
+type PromoteThingModelRequest struct {
+	From string `json:"from"`
+	TmID string `json:"tmID"`
+	To   string `json:"to"`
+}
+
+// PromoteThingModelResponse defines model for PromoteThingModelResponse.
+type PromoteThingModelResponse struct {
+	Data PromoteThingModelResult `json:"data"`
+}
+
+// PromoteThingModelResult defines model for PromoteThingModelResult.
+type PromoteThingModelResult struct {
+	Approver string `json:"approver"`
+	TmID     string `json:"tmID"`
+}
+
 // PushThingModelResponse defines model for PushThingModelResponse.
 type PushThingModelResponse struct {
 	Data PushThingModelResult `json:"data"`
@@ -110,6 +162,43 @@ type PushThingModelResult struct {
 	TmID string `json:"tmID"`
 }
 
+// PushThingModelsResponse defines model for PushThingModelsResponse.
+type PushThingModelsResponse struct {
+	Data []PushThingModelsResult `json:"data"`
+}
+
+// PushThingModelsResult defines model for PushThingModelsResult.
+type PushThingModelsResult struct {
+	Message *string `json:"message,omitempty"`
+
+	// Name File name of the Thing Model in the upload, or its index in a JSON array
+	Name   string                      `json:"name"`
+	Result PushThingModelsResultResult `json:"result"`
+
+	// TmID ID the Thing Model has been pushed as, or the ID of the existing Thing Model
+	TmID *string `json:"tmID,omitempty"`
+}
+
+// PushThingModelsResultResult defines model for PushThingModelsResult.Result.
+type PushThingModelsResultResult string
+
+// RepoHealth defines model for RepoHealth.
+type RepoHealth struct {
+	// IndexUpdated Time the index of the repository has last been updated, if known
+	IndexUpdated *time.Time `json:"indexUpdated,omitempty"`
+
+	// LatencyMs Time the repository took to answer the probe in milliseconds
+	LatencyMs int `json:"latencyMs"`
+
+	// Message Reason why the repository is degraded or down
+	Message *string `json:"message,omitempty"`
+
+	// Remote Whether the repository is accessed over the network
+	Remote bool         `json:"remote"`
+	Repo   string       `json:"repo"`
+	Status HealthStatus `json:"status"`
+}
+
 // SchemaAuthor defines model for SchemaAuthor.
 type SchemaAuthor struct {
 	SchemaName string `json:"schema:name"`
@@ -120,6 +209,9 @@ type SchemaManufacturer struct {
 	SchemaName string `json:"schema:name"`
 }
 
+// ForbiddenError defines model for ForbiddenError.
+type ForbiddenError = ErrorResponse
+
 // UnauthorizedError defines model for UnauthorizedError.
 type UnauthorizedError = ErrorResponse
 
@@ -211,6 +303,23 @@ type GetMpnsParams struct {
 // PushThingModelJSONBody defines parameters for PushThingModel.
 type PushThingModelJSONBody = map[string]interface{}
 
+// PushThingModelsJSONBody defines parameters for PushThingModels.
+type PushThingModelsJSONBody = []map[string]interface{}
+
+// PushThingModelsMultipartBody defines parameters for PushThingModels.
+type PushThingModelsMultipartBody struct {
+	Files *[]openapi_types.File `json:"files,omitempty"`
+}
+
+// PushThingModelsParams defines parameters for PushThingModels.
+type PushThingModelsParams struct {
+	// OptPath Optional path parts to append to the target path (and id) of the pushed Thing Models
+	OptPath *string `form:"optPath,omitempty" json:"optPath,omitempty"`
+
+	// OptTree Use the directory part of the file names in a multipart form or zip archive as optPath for each Thing Model. Overrides optPath
+	OptTree *bool `form:"optTree,omitempty" json:"optTree,omitempty"`
+}
+
 // DeleteThingModelByIdParams defines parameters for DeleteThingModelById.
 type DeleteThingModelByIdParams struct {
 	// Force flag to force the deletion. must be set to "true"
@@ -223,5 +332,14 @@ type GetThingModelByIdParams struct {
 	RestoreId *bool `form:"restoreId,omitempty" json:"restoreId,omitempty"`
 }
 
+// PromoteThingModelJSONRequestBody defines body for PromoteThingModel for application/json ContentType.
+type PromoteThingModelJSONRequestBody = PromoteThingModelRequest
+
 // PushThingModelJSONRequestBody defines body for PushThingModel for application/json ContentType.
 type PushThingModelJSONRequestBody = PushThingModelJSONBody
+
+// PushThingModelsJSONRequestBody defines body for PushThingModels for application/json ContentType.
+type PushThingModelsJSONRequestBody = PushThingModelsJSONBody
+
+// PushThingModelsMultipartRequestBody defines body for PushThingModels for multipart/form-data ContentType.
+type PushThingModelsMultipartRequestBody PushThingModelsMultipartBody
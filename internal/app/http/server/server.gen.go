@@ -47,9 +47,15 @@ type ServerInterface interface {
 	// Get the contained mpns (manufacturer part numbers) of the inventory
 	// (GET /mpns)
 	GetMpns(w http.ResponseWriter, r *http.Request, params GetMpnsParams)
+	// Promote a Thing Model from one repository to another
+	// (POST /promotions)
+	PromoteThingModel(w http.ResponseWriter, r *http.Request)
 	// Push a new Thing Model
 	// (POST /thing-models)
 	PushThingModel(w http.ResponseWriter, r *http.Request)
+	// Push multiple Thing Models at once
+	// (POST /thing-models/.bulk)
+	PushThingModels(w http.ResponseWriter, r *http.Request, params PushThingModelsParams)
 	// Delete a Thing Model by ID
 	// (DELETE /thing-models/{tmIDOrName})
 	DeleteThingModelById(w http.ResponseWriter, r *http.Request, tmIDOrName string, params DeleteThingModelByIdParams)
@@ -421,6 +427,23 @@ func (siw *ServerInterfaceWrapper) GetMpns(w http.ResponseWriter, r *http.Reques
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// PromoteThingModel operation middleware
+func (siw *ServerInterfaceWrapper) PromoteThingModel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PromoteThingModel(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // PushThingModel operation middleware
 func (siw *ServerInterfaceWrapper) PushThingModel(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -438,6 +461,44 @@ func (siw *ServerInterfaceWrapper) PushThingModel(w http.ResponseWriter, r *http
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// PushThingModels operation middleware
+func (siw *ServerInterfaceWrapper) PushThingModels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PushThingModelsParams
+
+	// ------------- Optional query parameter "optPath" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "optPath", r.URL.Query(), &params.OptPath)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "optPath", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "optTree" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "optTree", r.URL.Query(), &params.OptTree)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "optTree", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PushThingModels(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // DeleteThingModelById operation middleware
 func (siw *ServerInterfaceWrapper) DeleteThingModelById(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -640,8 +701,12 @@ func HandlerWithOptions(si ServerInterface, options GorillaServerOptions) http.H
 
 	r.HandleFunc(options.BaseURL+"/thing-models/{tmIDOrName:.+}", wrapper.DeleteThingModelById).Methods("DELETE")
 
+	r.HandleFunc(options.BaseURL+"/thing-models/.bulk", wrapper.PushThingModels).Methods("POST")
+
 	r.HandleFunc(options.BaseURL+"/thing-models", wrapper.PushThingModel).Methods("POST")
 
+	r.HandleFunc(options.BaseURL+"/promotions", wrapper.PromoteThingModel).Methods("POST")
+
 	r.HandleFunc(options.BaseURL+"/mpns", wrapper.GetMpns).Methods("GET")
 
 	r.HandleFunc(options.BaseURL+"/manufacturers", wrapper.GetManufacturers).Methods("GET")
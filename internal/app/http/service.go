@@ -3,12 +3,18 @@ package http
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/wot-oss/tmc/internal/commands"
+	"github.com/wot-oss/tmc/internal/config"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/utils"
 )
 
 //go:generate mockery --name HandlerService --outpkg mocks --output mocks
@@ -20,24 +26,89 @@ type HandlerService interface {
 	FindInventoryEntry(ctx context.Context, name string) (*model.FoundEntry, error)
 	FetchThingModel(ctx context.Context, tmID string, restoreId bool) ([]byte, error)
 	PushThingModel(ctx context.Context, file []byte) (string, error)
+	PushThingModels(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error)
 	DeleteThingModel(ctx context.Context, tmID string) error
-	CheckHealth(ctx context.Context) error
+	CheckHealth(ctx context.Context) (repos.HealthReport, error)
 	CheckHealthLive(ctx context.Context) error
 	CheckHealthReady(ctx context.Context) error
 	CheckHealthStartup(ctx context.Context) error
 	GetCompletions(ctx context.Context, kind, toComplete string) ([]string, error)
+	PromoteThingModel(ctx context.Context, tmID, from, to, approver string) (string, error)
+}
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+const defaultHealthTimeout = 5 * time.Second
+
+// HealthOptions configures the probes of the served repos in the health endpoints
+type HealthOptions struct {
+	// Timeout is the maximum time to wait for a repo to answer a probe. Defaults to 5s
+	Timeout time.Duration
+	// MaxIndexAge is how much older than the newest TM a repo's index may be before the repo is reported as degraded.
+	// 0 means no limit
+	MaxIndexAge time.Duration
+	// Tolerance is one of config.HealthToleranceNone, config.HealthToleranceRemote or config.HealthToleranceAll and
+	// decides which failing repos make the service unavailable. Defaults to config.HealthToleranceRemote
+	Tolerance string
 }
 
 type defaultHandlerService struct {
-	serveRepo model.RepoSpec
-	pushRepo  model.RepoSpec
+	serveRepo    model.RepoSpec
+	pushRepo     model.RepoSpec
+	promoteOpts  commands.PromoteOptions
+	promoteRepos []string
+	healthOpts   HealthOptions
+	shuttingDown atomic.Bool
+}
+
+// HandlerServiceOption configures optional behaviour of the default HandlerService
+type HandlerServiceOption func(*defaultHandlerService)
+
+// WithPromoteOptions sets the validations to be run before promoting a TM
+func WithPromoteOptions(validations []string) HandlerServiceOption {
+	return func(dhs *defaultHandlerService) {
+		dhs.promoteOpts.Validations = validations
+	}
+}
+
+// WithPromotionRepos allows promotions only between the repos with the given names. By default, TMs can only be
+// promoted from the served repos to the push repo
+func WithPromotionRepos(names []string) HandlerServiceOption {
+	return func(dhs *defaultHandlerService) {
+		dhs.promoteRepos = names
+	}
+}
+
+// WithHealthOptions configures the probes of the served repos in the health endpoints
+func WithHealthOptions(o HealthOptions) HandlerServiceOption {
+	return func(dhs *defaultHandlerService) {
+		dhs.healthOpts = o
+	}
 }
 
-func NewDefaultHandlerService(servedRepo model.RepoSpec, pushRepo model.RepoSpec) (*defaultHandlerService, error) {
+func NewDefaultHandlerService(servedRepo model.RepoSpec, pushRepo model.RepoSpec, opts ...HandlerServiceOption) (*defaultHandlerService, error) {
 	dhs := &defaultHandlerService{
 		serveRepo: servedRepo,
 		pushRepo:  pushRepo,
+		promoteOpts: commands.PromoteOptions{
+			Validations: commands.DefaultPromoteValidations,
+		},
+	}
+	for _, o := range opts {
+		o(dhs)
+	}
+	if dhs.healthOpts.Timeout <= 0 {
+		dhs.healthOpts.Timeout = defaultHealthTimeout
+	}
+	tolerance := strings.ToLower(strings.TrimSpace(dhs.healthOpts.Tolerance))
+	if tolerance == "" {
+		tolerance = config.HealthToleranceRemote
+	}
+	if !slices.Contains(config.HealthTolerances, tolerance) {
+		return nil, fmt.Errorf("invalid health tolerance %q. Must be one of %s", dhs.healthOpts.Tolerance,
+			strings.Join(config.HealthTolerances, ", "))
 	}
+	dhs.healthOpts.Tolerance = tolerance
 	return dhs, nil
 }
 
@@ -149,12 +220,49 @@ func (dhs *defaultHandlerService) PushThingModel(ctx context.Context, file []byt
 	}
 	err = repo.Index(ctx, tmID)
 	if err != nil {
+		discardUnindexed(ctx, repo, err, tmID)
 		return "", err
 	}
 
 	return tmID, nil
 }
 
+func (dhs *defaultHandlerService) PushThingModels(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+	repo, err := repos.Get(dhs.pushRepo)
+	if err != nil {
+		return nil, err
+	}
+	results := commands.NewPushCommand(time.Now).PushFiles(ctx, files, repo, optPath, optTree)
+	var okIds []string
+	for _, r := range results {
+		if r.Type == repos.BulkPushOK {
+			okIds = append(okIds, r.TMID)
+		}
+	}
+	if len(okIds) > 0 {
+		err = repo.Index(ctx, okIds...)
+		if err != nil {
+			discardUnindexed(ctx, repo, err, okIds...)
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// discardUnindexed removes the just pushed TMs with given ids when the index could not be locked, so that the client's
+// retry pushes them again instead of running into an id conflict with TMs that never made it into the index
+func discardUnindexed(ctx context.Context, repo repos.Repo, indexErr error, ids ...string) {
+	if !errors.Is(indexErr, repos.ErrIndexLocked) {
+		return
+	}
+	log := utils.Logger(ctx)
+	for _, id := range ids {
+		if err := repo.Delete(ctx, id); err != nil {
+			log.Warn("could not remove unindexed TM", "id", id, "error", err)
+		}
+	}
+}
+
 func (dhs *defaultHandlerService) DeleteThingModel(ctx context.Context, tmID string) error {
 	pushRepo := dhs.pushRepo
 
@@ -162,6 +270,52 @@ func (dhs *defaultHandlerService) DeleteThingModel(ctx context.Context, tmID str
 	return err
 }
 
+func (dhs *defaultHandlerService) PromoteThingModel(ctx context.Context, tmID, from, to, approver string) (string, error) {
+	err := dhs.checkPromotionRepos(from, to)
+	if err != nil {
+		return "", err
+	}
+	opts := dhs.promoteOpts
+	opts.Approver = approver
+	id, err := commands.NewPromoteCommand().Promote(ctx, model.NewRepoSpec(from), model.NewRepoSpec(to), tmID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, repos.ErrRepoNotFound):
+			return "", NewBadRequestError(err, "invalid source or target repo of promotion")
+		case errors.Is(err, commands.ErrPromotionValidation),
+			errors.Is(err, commands.ErrPromoteSameRepo),
+			errors.Is(err, commands.ErrApproverMissing):
+			return "", NewBadRequestError(err, "cannot promote %s", tmID)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// checkPromotionRepos returns a forbidden error unless the repos named from and to may be used as source and target
+// of a promotion
+func (dhs *defaultHandlerService) checkPromotionRepos(from, to string) error {
+	if len(dhs.promoteRepos) > 0 {
+		for _, name := range []string{from, to} {
+			if !slices.Contains(dhs.promoteRepos, name) {
+				return NewForbiddenError(nil, "Promotions from or to repo %s are not allowed", name)
+			}
+		}
+		return nil
+	}
+	if dhs.serveRepo != model.EmptySpec && dhs.serveRepo.RepoName() != from {
+		return NewForbiddenError(nil, "Promotions are only allowed from the served repo")
+	}
+	pushRepo, err := repos.Get(dhs.pushRepo)
+	if err != nil {
+		return err
+	}
+	if pushRepo.Spec().RepoName() == "" || pushRepo.Spec().RepoName() != to {
+		return NewForbiddenError(nil, "Promotions are only allowed to the push target repo")
+	}
+	return nil
+}
+
 func (dhs *defaultHandlerService) GetCompletions(ctx context.Context, kind, toComplete string) ([]string, error) {
 	rs, err := repos.GetSpecdOrAll(dhs.serveRepo)
 	if err != nil {
@@ -170,14 +324,13 @@ func (dhs *defaultHandlerService) GetCompletions(ctx context.Context, kind, toCo
 	return rs.ListCompletions(ctx, kind, toComplete), nil
 }
 
-func (dhs *defaultHandlerService) CheckHealth(ctx context.Context) error {
+func (dhs *defaultHandlerService) CheckHealth(ctx context.Context) (repos.HealthReport, error) {
 	err := dhs.CheckHealthLive(ctx)
 	if err != nil {
-		return err
+		return repos.HealthReport{Status: repos.HealthDown}, err
 	}
 
-	err = dhs.CheckHealthReady(ctx)
-	return err
+	return dhs.checkRepos(ctx)
 }
 
 func (dhs *defaultHandlerService) CheckHealthLive(ctx context.Context) error {
@@ -185,14 +338,70 @@ func (dhs *defaultHandlerService) CheckHealthLive(ctx context.Context) error {
 }
 
 func (dhs *defaultHandlerService) CheckHealthReady(ctx context.Context) error {
+	_, err := dhs.checkRepos(ctx)
+	return err
+}
 
-	pushRepo := dhs.pushRepo
+// checkRepos probes the served repos and aggregates their health according to the configured tolerance. Returns an
+// error if the service cannot serve requests
+func (dhs *defaultHandlerService) checkRepos(ctx context.Context) (repos.HealthReport, error) {
+	if dhs.shuttingDown.Load() {
+		return repos.HealthReport{Status: repos.HealthDown}, ErrShuttingDown
+	}
 
-	_, err := repos.Get(pushRepo)
+	_, err := repos.Get(dhs.pushRepo)
 	if err != nil {
-		return errors.New("invalid repo configuration or push repo not found")
+		return repos.HealthReport{Status: repos.HealthDown}, errors.New("invalid repo configuration or push repo not found")
 	}
-	return nil
+	u, err := repos.GetSpecdOrAll(dhs.serveRepo)
+	if err != nil {
+		return repos.HealthReport{Status: repos.HealthDown}, errors.New("invalid repo configuration or served repo not found")
+	}
+
+	rh := u.CheckHealth(ctx, dhs.healthOpts.Timeout, dhs.healthOpts.MaxIndexAge)
+	report := repos.HealthReport{Status: aggregateHealth(rh, dhs.healthOpts.Tolerance), Repos: rh}
+	if report.Status == repos.HealthDown {
+		var failing []string
+		for _, h := range rh {
+			if h.Status != repos.HealthUp {
+				failing = append(failing, fmt.Sprintf("%s: %s", h.Repo, h.Message))
+			}
+		}
+		return report, fmt.Errorf("repositories not healthy: %s", strings.Join(failing, "; "))
+	}
+	return report, nil
+}
+
+// aggregateHealth computes the overall health of the service from the health of the served repos. The service is down
+// if all repos are down or if a repo is down which is not tolerated. It is degraded if any other repo is not up.
+// An unknown tolerance tolerates no failing repo
+func aggregateHealth(rh []repos.RepoHealth, tolerance string) repos.HealthStatus {
+	res := repos.HealthUp
+	allDown := len(rh) > 0
+	for _, h := range rh {
+		if h.Status != repos.HealthDown {
+			allDown = false
+		}
+		if h.Status == repos.HealthUp {
+			continue
+		}
+		down := h.Status == repos.HealthDown
+		tolerated := tolerance == config.HealthToleranceAll || tolerance == config.HealthToleranceRemote && h.Remote
+		if down && !tolerated {
+			return repos.HealthDown
+		}
+		res = repos.HealthDegraded
+	}
+	if allDown {
+		return repos.HealthDown
+	}
+	return res
+}
+
+// SetShuttingDown marks the service as shutting down, making CheckHealthReady fail so that no new requests are
+// routed to the server while in-flight requests are drained
+func (dhs *defaultHandlerService) SetShuttingDown() {
+	dhs.shuttingDown.Store(true)
 }
 
 func (dhs *defaultHandlerService) CheckHealthStartup(ctx context.Context) error {
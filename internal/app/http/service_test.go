@@ -24,22 +24,39 @@ func Test_CheckHealthLive(t *testing.T) {
 	// given: a service under test
 	underTest, _ := NewDefaultHandlerService(model.EmptySpec, repo)
 	// when: check health live
-	err := underTest.CheckHealthLive(nil)
+	err := underTest.CheckHealthLive(context.Background())
 	// then: there is no error
 	assert.NoError(t, err)
 }
 
-func Test_CheckHealthReady(t *testing.T) {
+// newHealthyRepo creates a mock repo which answers health probes
+func newHealthyRepo(t *testing.T, spec model.RepoSpec) *mocks.Repo {
+	r := mocks.NewRepo(t)
+	r.On("Spec").Return(spec).Maybe()
+	r.On("List", mock.Anything, mock.Anything).Return(model.SearchResult{}, nil).Maybe()
+	return r
+}
 
+// newFailingRepo creates a mock repo which fails health probes
+func newFailingRepo(t *testing.T, spec model.RepoSpec) *mocks.Repo {
 	r := mocks.NewRepo(t)
+	r.On("Spec").Return(spec).Maybe()
+	r.On("List", mock.Anything, mock.Anything).Return(model.SearchResult{}, errors.New("connection refused")).Maybe()
+	return r
+}
+
+func Test_CheckHealthReady(t *testing.T) {
+
+	r := newHealthyRepo(t, repo)
 	underTest, _ := NewDefaultHandlerService(model.EmptySpec, repo)
 
 	t.Run("with valid repo", func(t *testing.T) {
 		// given: a repo
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, r, nil))
+		rMocks.MockReposAll(t, rMocks.CreateMockAllFunction(nil, r))
 
 		// when check health ready
-		err := underTest.CheckHealthReady(nil)
+		err := underTest.CheckHealthReady(context.Background())
 		// then: no error is thrown
 		assert.NoError(t, err)
 	})
@@ -48,22 +65,45 @@ func Test_CheckHealthReady(t *testing.T) {
 		// given: the repo cannot be found
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, nil, errors.New("invalid repo name")))
 		// when check health ready
-		err := underTest.CheckHealthReady(nil)
+		err := underTest.CheckHealthReady(context.Background())
 		// then: an error is thrown
 		assert.Error(t, err)
 	})
+
+	t.Run("with failing repo", func(t *testing.T) {
+		// given: the repo fails to answer
+		rf := newFailingRepo(t, repo)
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, rf, nil))
+		rMocks.MockReposAll(t, rMocks.CreateMockAllFunction(nil, rf))
+		// when check health ready
+		err := underTest.CheckHealthReady(context.Background())
+		// then: an error is thrown
+		assert.ErrorContains(t, err, "connection refused")
+	})
+
+	t.Run("when shutting down", func(t *testing.T) {
+		// given: a valid repo and a service which is shutting down
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, r, nil))
+		underTest.SetShuttingDown()
+		// when check health ready
+		err := underTest.CheckHealthReady(context.Background())
+		// then: ErrShuttingDown is thrown
+		assert.ErrorIs(t, err, ErrShuttingDown)
+		// and then: the service is still alive
+		assert.NoError(t, underTest.CheckHealthLive(context.Background()))
+	})
 }
 
 func Test_CheckHealthStartup(t *testing.T) {
 
-	r := mocks.NewRepo(t)
+	r := newHealthyRepo(t, repo)
 	underTest, _ := NewDefaultHandlerService(repo, repo)
 
 	t.Run("with valid repo", func(t *testing.T) {
 		// given: the repo can be found
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, r, nil))
 		// when check health startup
-		err := underTest.CheckHealthStartup(nil)
+		err := underTest.CheckHealthStartup(context.Background())
 		// then: no error is thrown
 		assert.NoError(t, err)
 	})
@@ -72,7 +112,7 @@ func Test_CheckHealthStartup(t *testing.T) {
 		// given: the repo cannot be found
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, nil, errors.New("invalid repo name")))
 		// when check health startup
-		err := underTest.CheckHealthStartup(nil)
+		err := underTest.CheckHealthStartup(context.Background())
 		// then: an error is thrown
 		assert.Error(t, err)
 	})
@@ -80,7 +120,7 @@ func Test_CheckHealthStartup(t *testing.T) {
 
 func Test_CheckHealth(t *testing.T) {
 
-	r := mocks.NewRepo(t)
+	r := newHealthyRepo(t, repo)
 	underTest, _ := NewDefaultHandlerService(repo, repo)
 
 	t.Run("with valid repo", func(t *testing.T) {
@@ -88,21 +128,87 @@ func Test_CheckHealth(t *testing.T) {
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, r, nil))
 
 		// when check health
-		err := underTest.CheckHealth(nil)
+		report, err := underTest.CheckHealth(context.Background())
 		// then: no error is thrown
 		assert.NoError(t, err)
+		// and then: the repo is reported as up
+		assert.Equal(t, repos.HealthUp, report.Status)
+		if assert.Len(t, report.Repos, 1) {
+			assert.Equal(t, "someRepo", report.Repos[0].Repo)
+			assert.Equal(t, repos.HealthUp, report.Repos[0].Status)
+		}
 	})
 
 	t.Run("with invalid repo", func(t *testing.T) {
 		// given: the repo cannot be found
 		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, nil, errors.New("invalid repo name")))
 		// when check health
-		err := underTest.CheckHealth(nil)
+		report, err := underTest.CheckHealth(context.Background())
 		// then: an error is thrown
 		assert.Error(t, err)
+		assert.Equal(t, repos.HealthDown, report.Status)
 	})
 }
 
+func Test_CheckHealth_Tolerance(t *testing.T) {
+	r1 := newHealthyRepo(t, model.NewRepoSpec("r1"))
+	r2 := newFailingRepo(t, model.NewRepoSpec("r2"))
+	rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, repo, r1, nil))
+	rMocks.MockReposAll(t, rMocks.CreateMockAllFunction(nil, r1, r2))
+
+	tests := []struct {
+		tolerance string
+		expStatus repos.HealthStatus
+		expErr    bool
+	}{
+		{"none", repos.HealthDown, true},
+		// mock repos are not remote
+		{"remote", repos.HealthDown, true},
+		{"all", repos.HealthDegraded, false},
+		{" All", repos.HealthDegraded, false},
+	}
+	for _, test := range tests {
+		t.Run(test.tolerance, func(t *testing.T) {
+			underTest, err := NewDefaultHandlerService(model.EmptySpec, repo, WithHealthOptions(HealthOptions{Tolerance: test.tolerance}))
+			assert.NoError(t, err)
+			report, err := underTest.CheckHealth(context.Background())
+			assert.Equal(t, test.expStatus, report.Status)
+			if test.expErr {
+				assert.ErrorContains(t, err, "r2: connection refused")
+			} else {
+				assert.NoError(t, err)
+			}
+			if assert.Len(t, report.Repos, 2) {
+				assert.Equal(t, repos.HealthUp, report.Repos[0].Status)
+				assert.Equal(t, repos.HealthDown, report.Repos[1].Status)
+			}
+		})
+	}
+
+	t.Run("invalid tolerance", func(t *testing.T) {
+		_, err := NewDefaultHandlerService(model.EmptySpec, repo, WithHealthOptions(HealthOptions{Tolerance: "some"}))
+		assert.ErrorContains(t, err, "invalid health tolerance")
+	})
+}
+
+func Test_AggregateHealth(t *testing.T) {
+	up := repos.RepoHealth{Status: repos.HealthUp}
+	degraded := repos.RepoHealth{Status: repos.HealthDegraded}
+	localDown := repos.RepoHealth{Status: repos.HealthDown}
+	remoteDown := repos.RepoHealth{Status: repos.HealthDown, Remote: true}
+
+	assert.Equal(t, repos.HealthUp, aggregateHealth(nil, "none"))
+	assert.Equal(t, repos.HealthUp, aggregateHealth([]repos.RepoHealth{up, up}, "none"))
+	assert.Equal(t, repos.HealthDegraded, aggregateHealth([]repos.RepoHealth{up, degraded}, "none"))
+	assert.Equal(t, repos.HealthDown, aggregateHealth([]repos.RepoHealth{up, remoteDown}, "none"))
+	assert.Equal(t, repos.HealthDegraded, aggregateHealth([]repos.RepoHealth{up, remoteDown}, "remote"))
+	assert.Equal(t, repos.HealthDown, aggregateHealth([]repos.RepoHealth{up, localDown}, "remote"))
+	assert.Equal(t, repos.HealthDown, aggregateHealth([]repos.RepoHealth{remoteDown, remoteDown}, "remote"))
+	assert.Equal(t, repos.HealthDegraded, aggregateHealth([]repos.RepoHealth{up, localDown}, "all"))
+	assert.Equal(t, repos.HealthDown, aggregateHealth([]repos.RepoHealth{localDown, remoteDown}, "all"))
+	assert.Equal(t, repos.HealthDown, aggregateHealth([]repos.RepoHealth{up, remoteDown}, "alll"))
+}
+
 func Test_ListInventory(t *testing.T) {
 
 	underTest, _ := NewDefaultHandlerService(model.EmptySpec, repo)
@@ -465,6 +571,7 @@ func Test_DeleteThingModel(t *testing.T) {
 func Test_PushingThingModel(t *testing.T) {
 	r := mocks.NewRepo(t)
 	pushTarget := model.NewRepoSpec("pushRepo")
+	r.On("Spec").Return(pushTarget).Maybe()
 	underTest, _ := NewDefaultHandlerService(repo, pushTarget)
 
 	t.Run("with validation error", func(t *testing.T) {
@@ -525,4 +632,136 @@ func Test_PushingThingModel(t *testing.T) {
 		// and then: there is an error
 		assert.NoError(t, err)
 	})
+	t.Run("with locked index", func(t *testing.T) {
+		// given: a repo whose index stays locked
+		r := mocks.NewRepo(t)
+		r.On("Spec").Return(pushTarget).Maybe()
+		_, tmContent, _ := utils.ReadRequiredFile("../../../test/data/push/omnilamp.json")
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, pushTarget, r, nil))
+		r.On("Push", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		r.On("Index", mock.Anything, mock.Anything).Return(repos.ErrIndexLocked).Once()
+		var deleted string
+		r.On("Delete", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			deleted = args.String(1)
+		}).Return(nil).Once()
+		// when: pushing ThingModel
+		res, err := underTest.PushThingModel(nil, tmContent)
+		// then: the error is returned
+		assert.Equal(t, "", res)
+		assert.ErrorIs(t, err, repos.ErrIndexLocked)
+		// and then: the pushed TM has been removed again
+		assert.NotEmpty(t, deleted)
+	})
+}
+
+func Test_PushingThingModels(t *testing.T) {
+	r := mocks.NewRepo(t)
+	pushTarget := model.NewRepoSpec("pushRepo")
+	r.On("Spec").Return(pushTarget).Maybe()
+	underTest, _ := NewDefaultHandlerService(repo, pushTarget)
+	_, tmContent, _ := utils.ReadRequiredFile("../../../test/data/push/omnilamp.json")
+	_, versionedContent, _ := utils.ReadRequiredFile("../../../test/data/push/omnilamp-versioned.json")
+
+	t.Run("with push repo name that cannot be found", func(t *testing.T) {
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, pushTarget, nil, repos.ErrRepoNotFound))
+		_, err := underTest.PushThingModels(nil, []repos.BulkPushFile{{Name: "a.json", Raw: tmContent}}, "", false)
+		assert.ErrorIs(t, err, repos.ErrRepoNotFound)
+	})
+	t.Run("with mixed results", func(t *testing.T) {
+		// given: a valid, an invalid and a conflicting ThingModel
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, pushTarget, r, nil))
+		cErr := &repos.ErrTMIDConflict{
+			Type:       repos.IdConflictSameContent,
+			ExistingId: "existing-id",
+		}
+		r.On("Push", mock.Anything, mock.MatchedBy(func(id model.TMID) bool { return id.Mpn == "omnilamp" && id.Version.Base.String() == "0.0.0" }), mock.Anything).Return(nil).Once()
+		r.On("Push", mock.Anything, mock.Anything, mock.Anything).Return(cErr).Once()
+		// and given: the repo expects a single index update with the pushed TM only
+		var indexed []string
+		r.On("Index", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			indexed = append(indexed, args.Get(1).(string))
+		}).Return(nil).Once()
+		files := []repos.BulkPushFile{
+			{Name: "a.json", Raw: tmContent},
+			{Name: "b.json", Raw: []byte("invalid")},
+			{Name: "c.json", Raw: versionedContent},
+		}
+		// when: pushing ThingModels
+		res, err := underTest.PushThingModels(nil, files, "", false)
+		// then: there is a result for each file
+		assert.NoError(t, err)
+		if assert.Len(t, res, 3) {
+			assert.Equal(t, repos.BulkPushOK, res[0].Type)
+			assert.Equal(t, repos.BulkPushError, res[1].Type)
+			assert.Equal(t, repos.BulkPushExists, res[2].Type)
+			assert.Equal(t, "existing-id", res[2].TMID)
+			assert.Equal(t, []string{res[0].TMID}, indexed)
+		}
+	})
+}
+
+func Test_PromotingThingModel(t *testing.T) {
+	tmid := "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"
+	underTest, _ := NewDefaultHandlerService(repo, repo, WithPromoteOptions(nil),
+		WithPromotionRepos([]string{"staging", "production"}))
+
+	t.Run("with repo name that cannot be found", func(t *testing.T) {
+		// given: an invalid source repo
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, model.NewRepoSpec("staging"), nil, repos.ErrRepoNotFound))
+		// when: promoting ThingModel
+		res, err := underTest.PromoteThingModel(context.Background(), tmid, "staging", "production", "alice")
+		// then: it returns empty tmID
+		assert.Equal(t, "", res)
+		// and then: there is a bad request error
+		var bErr *BaseHttpError
+		if assert.ErrorAs(t, err, &bErr) {
+			assert.Equal(t, http.StatusBadRequest, bErr.Status)
+		}
+	})
+
+	t.Run("without approver", func(t *testing.T) {
+		// when: promoting ThingModel without approver
+		res, err := underTest.PromoteThingModel(context.Background(), tmid, "staging", "production", "")
+		// then: it returns empty tmID
+		assert.Equal(t, "", res)
+		// and then: there is a bad request error
+		assert.ErrorIs(t, err, commands.ErrApproverMissing)
+		var bErr *BaseHttpError
+		if assert.ErrorAs(t, err, &bErr) {
+			assert.Equal(t, http.StatusBadRequest, bErr.Status)
+		}
+	})
+
+	t.Run("with repo not allowed for promotions", func(t *testing.T) {
+		// when: promoting ThingModel to a repo which is not in the allowed list
+		_, err := underTest.PromoteThingModel(context.Background(), tmid, "staging", "someRepo", "alice")
+		// then: there is a forbidden error
+		var bErr *BaseHttpError
+		if assert.ErrorAs(t, err, &bErr) {
+			assert.Equal(t, http.StatusForbidden, bErr.Status)
+		}
+	})
+
+	t.Run("without allowed repos", func(t *testing.T) {
+		// given: a service serving all repos and pushing to 'production'
+		production := model.NewRepoSpec("production")
+		r := newHealthyRepo(t, production)
+		rMocks.MockReposGet(t, rMocks.CreateMockGetFunction(t, production, r, nil))
+		dhs, _ := NewDefaultHandlerService(model.EmptySpec, production)
+		// when: promoting ThingModel to another repo than the push repo
+		_, err := dhs.PromoteThingModel(context.Background(), tmid, "production", "staging", "alice")
+		// then: there is a forbidden error
+		var bErr *BaseHttpError
+		if assert.ErrorAs(t, err, &bErr) {
+			assert.Equal(t, http.StatusForbidden, bErr.Status)
+		}
+		// and given: a service serving only 'production'
+		dhs, _ = NewDefaultHandlerService(production, production)
+		// when: promoting ThingModel from another repo than the served repo
+		_, err = dhs.PromoteThingModel(context.Background(), tmid, "staging", "production", "alice")
+		// then: there is a forbidden error
+		if assert.ErrorAs(t, err, &bErr) {
+			assert.Equal(t, http.StatusForbidden, bErr.Status)
+		}
+	})
 }
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracingHandlerService records a span for each call to the wrapped HandlerService
+type tracingHandlerService struct {
+	s HandlerService
+}
+
+// NewTracingHandlerService returns a HandlerService which records a span for each call to s
+func NewTracingHandlerService(s HandlerService) HandlerService {
+	return &tracingHandlerService{s: s}
+}
+
+func (t *tracingHandlerService) ListInventory(ctx context.Context, search *model.SearchParams) (res *model.SearchResult, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.ListInventory")
+	defer func() { tracing.End(span, err) }()
+	return t.s.ListInventory(ctx, search)
+}
+
+func (t *tracingHandlerService) ListAuthors(ctx context.Context, search *model.SearchParams) (res []string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.ListAuthors")
+	defer func() { tracing.End(span, err) }()
+	return t.s.ListAuthors(ctx, search)
+}
+
+func (t *tracingHandlerService) ListManufacturers(ctx context.Context, search *model.SearchParams) (res []string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.ListManufacturers")
+	defer func() { tracing.End(span, err) }()
+	return t.s.ListManufacturers(ctx, search)
+}
+
+func (t *tracingHandlerService) ListMpns(ctx context.Context, search *model.SearchParams) (res []string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.ListMpns")
+	defer func() { tracing.End(span, err) }()
+	return t.s.ListMpns(ctx, search)
+}
+
+func (t *tracingHandlerService) FindInventoryEntry(ctx context.Context, name string) (res *model.FoundEntry, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.FindInventoryEntry", attribute.String("tmc.name", name))
+	defer func() { tracing.End(span, err) }()
+	return t.s.FindInventoryEntry(ctx, name)
+}
+
+func (t *tracingHandlerService) FetchThingModel(ctx context.Context, tmID string, restoreId bool) (res []byte, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.FetchThingModel", attribute.String("tmc.id", tmID))
+	defer func() { tracing.End(span, err) }()
+	return t.s.FetchThingModel(ctx, tmID, restoreId)
+}
+
+func (t *tracingHandlerService) PushThingModel(ctx context.Context, file []byte) (res string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.PushThingModel")
+	defer func() {
+		span.SetAttributes(attribute.String("tmc.id", res))
+		tracing.End(span, err)
+	}()
+	return t.s.PushThingModel(ctx, file)
+}
+
+func (t *tracingHandlerService) PushThingModels(ctx context.Context, files []repos.BulkPushFile, optPath string, optTree bool) (res []repos.BulkPushResult, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.PushThingModels", attribute.Int("tmc.files", len(files)))
+	defer func() { tracing.End(span, err) }()
+	return t.s.PushThingModels(ctx, files, optPath, optTree)
+}
+
+func (t *tracingHandlerService) DeleteThingModel(ctx context.Context, tmID string) (err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.DeleteThingModel", attribute.String("tmc.id", tmID))
+	defer func() { tracing.End(span, err) }()
+	return t.s.DeleteThingModel(ctx, tmID)
+}
+
+func (t *tracingHandlerService) CheckHealth(ctx context.Context) (res repos.HealthReport, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.CheckHealth")
+	defer func() {
+		span.SetAttributes(attribute.String("tmc.health", string(res.Status)))
+		tracing.End(span, err)
+	}()
+	return t.s.CheckHealth(ctx)
+}
+
+func (t *tracingHandlerService) CheckHealthLive(ctx context.Context) error {
+	// not traced, as it is called too frequently and does no work
+	return t.s.CheckHealthLive(ctx)
+}
+
+func (t *tracingHandlerService) CheckHealthReady(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.CheckHealthReady")
+	defer func() { tracing.End(span, err) }()
+	return t.s.CheckHealthReady(ctx)
+}
+
+func (t *tracingHandlerService) CheckHealthStartup(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.CheckHealthStartup")
+	defer func() { tracing.End(span, err) }()
+	return t.s.CheckHealthStartup(ctx)
+}
+
+func (t *tracingHandlerService) GetCompletions(ctx context.Context, kind, toComplete string) (res []string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.GetCompletions", attribute.String("tmc.kind", kind))
+	defer func() { tracing.End(span, err) }()
+	return t.s.GetCompletions(ctx, kind, toComplete)
+}
+
+func (t *tracingHandlerService) PromoteThingModel(ctx context.Context, tmID, from, to, approver string) (res string, err error) {
+	ctx, span := tracing.Start(ctx, "HandlerService.PromoteThingModel", attribute.String("tmc.id", tmID),
+		attribute.String("tmc.from", from), attribute.String("tmc.to", to))
+	defer func() { tracing.End(span, err) }()
+	return t.s.PromoteThingModel(ctx, tmID, from, to, approver)
+}
@@ -0,0 +1,330 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	OpPush       = "push"
+	OpDelete     = "delete"
+	OpIndex      = "index"
+	OpPromote    = "promote"
+	OpRepoConfig = "repoConfig"
+
+	logDirPermissions  = 0770
+	logFilePermissions = 0660
+	lockTimeout        = 5 * time.Second
+	lockRetryDelay     = 10 * time.Millisecond
+	bytesInMegabyte    = 1024 * 1024
+
+	ctxClient = "auditClient"
+)
+
+var SupportedOperations = []string{OpPush, OpDelete, OpIndex, OpPromote, OpRepoConfig}
+
+var (
+	ErrLogLocked   = errors.New("could not acquire lock on audit log")
+	ErrLogDisabled = errors.New("audit log is disabled")
+)
+
+var (
+	defaultLogMu sync.Mutex
+	// defaultLog is the Log returned by Default, shared by all goroutines of the process so that they write to it in turn
+	defaultLog *Log
+)
+
+// Record is a single entry in the audit log
+type Record struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	TMID      string    `json:"tmID,omitempty"`
+	Digest    string    `json:"digest,omitempty"`
+	Repo      string    `json:"repo,omitempty"`
+	// Detail further describes the operation, e.g. the kind of repo config change
+	Detail string `json:"detail,omitempty"`
+	// ClientIP is the address of the remote client, if the operation has been requested via the REST API
+	ClientIP string `json:"clientIP,omitempty"`
+	// Subject is the JWT subject of the remote client, if the operation has been requested via the REST API
+	Subject string `json:"subject,omitempty"`
+	// User is the name of the OS user running tmc
+	User string `json:"user,omitempty"`
+}
+
+// Client identifies the remote client requesting an operation
+type Client struct {
+	IP      string
+	Subject string
+}
+
+// ContextWithClient returns a copy of ctx carrying the remote client, to be recorded with all operations audited within ctx
+func ContextWithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, ctxClient, c)
+}
+
+func clientFromContext(ctx context.Context) Client {
+	if c, ok := ctx.Value(ctxClient).(Client); ok {
+		return c
+	}
+	return Client{}
+}
+
+// RepoName returns the name of the repo given by spec to be recorded in the audit log, or its directory for local repos
+func RepoName(spec model.RepoSpec) string {
+	if spec.RepoName() != "" {
+		return spec.RepoName()
+	}
+	return spec.Dir()
+}
+
+// Log is an append-only audit log stored as JSON lines in a file.
+// When the file grows larger than maxSize bytes, it is rotated to <file>.1, <file>.2, etc., keeping at most maxBackups
+// old files. Rotation is disabled if maxSize is not positive
+type Log struct {
+	file       string
+	maxSize    int64
+	maxBackups int
+	// mu serializes appends within the process, the file lock those of different processes
+	mu sync.Mutex
+}
+
+func NewLog(file string, maxSize int64, maxBackups int) *Log {
+	return &Log{
+		file:       file,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+}
+
+// Default returns the audit log configured with config.KeyAuditLogFile, config.KeyAuditLogMaxSize and
+// config.KeyAuditLogMaxBackups, or nil if audit logging is disabled by setting an empty file name.
+// The same Log is returned as long as the config does not change
+var Default = func() *Log {
+	file := viper.GetString(config.KeyAuditLogFile)
+	if file == "" {
+		return nil
+	}
+	maxSize := viper.GetInt64(config.KeyAuditLogMaxSize) * bytesInMegabyte
+	maxBackups := viper.GetInt(config.KeyAuditLogMaxBackups)
+	defaultLogMu.Lock()
+	defer defaultLogMu.Unlock()
+	if defaultLog == nil || defaultLog.file != file || defaultLog.maxSize != maxSize || defaultLog.maxBackups != maxBackups {
+		defaultLog = NewLog(file, maxSize, maxBackups)
+	}
+	return defaultLog
+}
+
+// Write records an operation in the default audit log, adding time, user and remote client found in ctx to rec.
+// Failing to write the record does not fail the operation, so errors are only logged
+func Write(ctx context.Context, rec Record) {
+	l := Default()
+	if l == nil {
+		return
+	}
+	err := l.Add(ctx, rec)
+	if err != nil {
+		utils.Logger(ctx).Error("could not write audit record", "operation", rec.Operation, "id", rec.TMID, "error", err)
+	}
+}
+
+// Add appends rec to the log, adding time, user and remote client found in ctx to rec
+func (l *Log) Add(ctx context.Context, rec Record) error {
+	c := clientFromContext(ctx)
+	rec.ClientIP = c.IP
+	rec.Subject = c.Subject
+	rec.Time = time.Now().UTC()
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	}
+	return l.Append(ctx, rec)
+}
+
+// Append appends rec to the log, rotating the log file if necessary
+func (l *Log) Append(ctx context.Context, rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lock(ctx)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+
+	err = l.rotateIfNeeded(int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, logFilePermissions)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (l *Log) lock(ctx context.Context) (func(), error) {
+	err := os.MkdirAll(filepath.Dir(l.file), logDirPermissions)
+	if err != nil {
+		return func() {}, err
+	}
+	fl := flock.New(l.file + ".lock")
+	ctx, cancel := context.WithTimeout(ctx, lockTimeout)
+	unlock := func() {
+		cancel()
+		_ = fl.Unlock()
+	}
+	locked, err := fl.TryLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return unlock, err
+	}
+	if !locked {
+		return unlock, ErrLogLocked
+	}
+	return unlock, nil
+}
+
+func (l *Log) rotateIfNeeded(incoming int64) error {
+	if l.maxSize <= 0 {
+		return nil
+	}
+	stat, err := os.Stat(l.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if stat.Size() == 0 || stat.Size()+incoming <= l.maxSize {
+		return nil
+	}
+	if l.maxBackups <= 0 {
+		return os.Remove(l.file)
+	}
+	_ = os.Remove(l.backupName(l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(l.backupName(i), l.backupName(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(l.file, l.backupName(1))
+}
+
+func (l *Log) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", l.file, i)
+}
+
+// Filter selects records from the audit log. Empty fields match any value
+type Filter struct {
+	Operation string
+	// TMID matches records whose TMID starts with given value
+	TMID    string
+	Repo    string
+	Subject string
+	// User matches records by the OS user
+	User  string
+	Since time.Time
+	Until time.Time
+}
+
+func (f Filter) matches(r Record) bool {
+	if f.Operation != "" && f.Operation != r.Operation {
+		return false
+	}
+	if f.TMID != "" && !strings.HasPrefix(r.TMID, f.TMID) {
+		return false
+	}
+	if f.Repo != "" && f.Repo != r.Repo {
+		return false
+	}
+	if f.Subject != "" && f.Subject != r.Subject {
+		return false
+	}
+	if f.User != "" && f.User != r.User {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Query returns all records matching filter from the log and its rotated backups, oldest first
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	var files []string
+	for i := l.maxBackups; i >= 1; i-- {
+		files = append(files, l.backupName(i))
+	}
+	files = append(files, l.file)
+
+	var res []Record
+	for _, name := range files {
+		recs, err := readRecords(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			if filter.matches(r) {
+				res = append(res, r)
+			}
+		}
+	}
+	return res, nil
+}
+
+func readRecords(name string) ([]Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), bytesInMegabyte)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var r Record
+		err := json.Unmarshal(sc.Bytes(), &r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit record in %s line %d: %w", name, line, err)
+		}
+		res = append(res, r)
+	}
+	return res, sc.Err()
+}
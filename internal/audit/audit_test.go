@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/config"
+)
+
+func TestWrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logs", "audit.log")
+	viper.Set(config.KeyAuditLogFile, file)
+	defer viper.Set(config.KeyAuditLogFile, "")
+
+	Write(context.Background(), Record{Operation: OpPush, TMID: "author/manufacturer/mpn/v1.0.0-20240101120000-abcdef012345.tm.json", Repo: "r1"})
+	ctx := ContextWithClient(context.Background(), Client{IP: "10.0.0.1", Subject: "alice"})
+	Write(ctx, Record{Operation: OpDelete, TMID: "author/manufacturer/mpn/v1.0.0-20240101120000-abcdef012345.tm.json", Repo: "r1"})
+
+	recs, err := Default().Query(Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, recs, 2) {
+		assert.Equal(t, OpPush, recs[0].Operation)
+		assert.Equal(t, "", recs[0].ClientIP)
+		assert.Equal(t, "", recs[0].Subject)
+		assert.False(t, recs[0].Time.IsZero())
+		assert.Equal(t, OpDelete, recs[1].Operation)
+		assert.Equal(t, "10.0.0.1", recs[1].ClientIP)
+		assert.Equal(t, "alice", recs[1].Subject)
+	}
+}
+
+func TestDefault_Shared(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set(config.KeyAuditLogFile, filepath.Join(dir, "audit.log"))
+	defer viper.Set(config.KeyAuditLogFile, "")
+
+	l := Default()
+	assert.Same(t, l, Default())
+	viper.Set(config.KeyAuditLogFile, filepath.Join(dir, "other.log"))
+	assert.NotSame(t, l, Default())
+}
+
+func TestWrite_Disabled(t *testing.T) {
+	viper.Set(config.KeyAuditLogFile, "")
+	assert.Nil(t, Default())
+	// must not panic
+	Write(context.Background(), Record{Operation: OpPush})
+}
+
+func TestLog_Rotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	l := NewLog(file, 300, 2)
+
+	for i := 0; i < 10; i++ {
+		err := l.Append(context.Background(), Record{Operation: OpIndex, Repo: "r1", Detail: "a detail to make the record longer"})
+		assert.NoError(t, err)
+	}
+
+	stat, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, stat.Size(), int64(300))
+	_, err = os.Stat(file + ".1")
+	assert.NoError(t, err)
+	_, err = os.Stat(file + ".2")
+	assert.NoError(t, err)
+	_, err = os.Stat(file + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	recs, err := l.Query(Filter{})
+	assert.NoError(t, err)
+	assert.Less(t, len(recs), 10)
+	assert.Greater(t, len(recs), 2)
+}
+
+func TestLog_Query(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	l := NewLog(file, 0, 0)
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: t0, Operation: OpPush, TMID: "a/b/c/v1.0.0-20240301120000-abcdef012345.tm.json", Repo: "r1", User: "bob"},
+		{Time: t0.Add(24 * time.Hour), Operation: OpDelete, TMID: "a/b/c/v1.0.0-20240301120000-abcdef012345.tm.json", Repo: "r1", Subject: "alice"},
+		{Time: t0.Add(48 * time.Hour), Operation: OpRepoConfig, Repo: "r2", Detail: "add", User: "bob"},
+		{Time: t0.Add(72 * time.Hour), Operation: OpPush, TMID: "x/y/z/v1.0.0-20240304120000-abcdef012345.tm.json", Repo: "r2", User: "bob"},
+	}
+	for _, r := range records {
+		assert.NoError(t, l.Append(context.Background(), r))
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		exp    []Record
+	}{
+		{"all", Filter{}, records},
+		{"operation", Filter{Operation: OpPush}, []Record{records[0], records[3]}},
+		{"id prefix", Filter{TMID: "a/b/c"}, []Record{records[0], records[1]}},
+		{"repo", Filter{Repo: "r2"}, []Record{records[2], records[3]}},
+		{"subject", Filter{Subject: "alice"}, []Record{records[1]}},
+		{"user", Filter{User: "bob", Repo: "r1"}, []Record{records[0]}},
+		{"since", Filter{Since: t0.Add(48 * time.Hour)}, []Record{records[2], records[3]}},
+		{"until", Filter{Until: t0.Add(24 * time.Hour)}, []Record{records[0], records[1]}},
+		{"none", Filter{Operation: OpPromote}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := l.Query(test.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, test.exp, res)
+		})
+	}
+}
+
+func TestLog_Query_InvalidRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	assert.NoError(t, os.WriteFile(file, []byte("{\"operation\":\"push\"}\nnot json\n"), 0660))
+	_, err := NewLog(file, 0, 0).Query(Filter{})
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 
+	"github.com/wot-oss/tmc/internal/audit"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
 )
@@ -22,6 +23,15 @@ func (c *DeleteCommand) Delete(ctx context.Context, rSpec model.RepoSpec, id str
 	if err != nil {
 		return err
 	}
+	rec := audit.Record{
+		Operation: audit.OpDelete,
+		TMID:      id,
+		Repo:      audit.RepoName(rSpec),
+	}
+	if tmid, err := model.ParseTMID(id); err == nil {
+		rec.Digest = tmid.Version.Hash
+	}
+	audit.Write(ctx, rec)
 	err = r.Index(ctx, id)
 	return err
 }
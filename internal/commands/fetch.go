@@ -83,6 +83,11 @@ func FetchByTMID(ctx context.Context, spec model.RepoSpec, tmid string, restoreI
 		return "", nil, err, nil
 	}
 
+	return FetchByTMIDFrom(ctx, rs, tmid, restoreId)
+}
+
+// FetchByTMIDFrom fetches the TM with given tmid from rs. Allows reusing rs for many fetches
+func FetchByTMIDFrom(ctx context.Context, rs *repos.Union, tmid string, restoreId bool) (string, []byte, error, []*repos.RepoAccessError) {
 	fetch, bytes, err, accessErrors := rs.Fetch(ctx, tmid)
 	if err == nil && restoreId {
 		bytes = restoreExternalId(bytes)
@@ -149,7 +154,7 @@ func restoreExternalId(raw []byte) []byte {
 }
 
 func FetchByName(ctx context.Context, spec model.RepoSpec, fn FetchName, restoreId bool) (string, []byte, error, []*repos.RepoAccessError) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	res, err, errs := NewVersionsCommand().ListVersions(ctx, spec, fn.Name)
 	if err != nil {
 		return "", nil, err, errs
@@ -189,7 +194,7 @@ func findMostRecentVersion(versions []model.FoundVersion) (string, model.RepoSpe
 		return "", model.EmptySpec, err
 	}
 
-	sortFoundVersionsDesc(versions)
+	sortFoundVersionsDesc(versions, repos.Priorities())
 
 	v := versions[0]
 	return v.TMID, model.NewSpecFromFoundSource(v.FoundIn), nil
@@ -232,17 +237,37 @@ func findMostRecentMatchingVersion(versions []model.FoundVersion, ver string) (i
 		return "", model.EmptySpec, err
 	}
 
-	// sort the remaining by semver then timestamp in descending order
-	sortFoundVersionsDesc(versions)
+	// sort the remaining by priority, semver, then timestamp in descending order
+	sortFoundVersionsDesc(versions, repos.Priorities())
 
 	// and here's our winner
 	v := versions[0]
 	return v.TMID, model.NewSpecFromFoundSource(v.FoundIn), nil
 }
 
-// sortFoundVersionsDesc sorts by semver then timestamp in descending order, ie. from newest to oldest
-func sortFoundVersionsDesc(versions []model.FoundVersion) {
+// LatestVersions returns a copy of entries, where each entry retains only its most recent version
+func LatestVersions(entries []model.FoundEntry) []model.FoundEntry {
+	res := make([]model.FoundEntry, 0, len(entries))
+	priority := repos.Priorities()
+	for _, e := range entries {
+		if len(e.Versions) > 1 {
+			versions := slices.Clone(e.Versions)
+			sortFoundVersionsDesc(versions, priority)
+			e.Versions = versions[:1]
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// sortFoundVersionsDesc sorts by priority of the repo they've been found in, then by semver, then by timestamp in
+// descending order, ie. from newest to oldest within each repo. Thus, a TM name is resolved in the repo with the
+// highest priority containing it, which shadows newer versions in repos with lower priority
+func sortFoundVersionsDesc(versions []model.FoundVersion, priority model.PriorityFunc) {
 	slices.SortStableFunc(versions, func(a, b model.FoundVersion) int {
+		if pc := priority(b.FoundIn) - priority(a.FoundIn); pc != 0 {
+			return pc
+		}
 		av := semver.MustParse(a.Version.Model)
 		bv := semver.MustParse(b.Version.Model)
 		vc := bv.Compare(av)
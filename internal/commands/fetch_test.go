@@ -479,3 +479,48 @@ func TestFetchCommand_FetchByTMIDOrName_RestoresId(t *testing.T) {
 	}
 
 }
+
+func TestLatestVersions(t *testing.T) {
+	v := func(ver, ts string) model.FoundVersion {
+		return model.FoundVersion{IndexVersion: model.IndexVersion{TMID: ver + "-" + ts, Version: model.Version{Model: ver}, TimeStamp: ts}}
+	}
+	entries := []model.FoundEntry{
+		{Name: "a", Versions: []model.FoundVersion{v("1.0.0", "20240101000000"), v("1.1.0", "20230101000000"), v("1.1.0", "20230102000000")}},
+		{Name: "b", Versions: []model.FoundVersion{v("0.0.0", "20240101000000")}},
+	}
+
+	res := LatestVersions(entries)
+	if assert.Len(t, res, 2) {
+		assert.Equal(t, []model.FoundVersion{v("1.1.0", "20230102000000")}, res[0].Versions)
+		assert.Equal(t, []model.FoundVersion{v("0.0.0", "20240101000000")}, res[1].Versions)
+	}
+	// and: the original entries are unchanged
+	assert.Len(t, entries[0].Versions, 3)
+	assert.Equal(t, "1.0.0-20240101000000", entries[0].Versions[0].TMID)
+}
+
+func TestSortFoundVersionsDesc_PriorityFirst(t *testing.T) {
+	v := func(ver, repo string) model.FoundVersion {
+		return model.FoundVersion{
+			IndexVersion: model.IndexVersion{TMID: repo + "-" + ver, Version: model.Version{Model: ver}, TimeStamp: "20240101000000"},
+			FoundIn:      model.FoundSource{RepoName: repo},
+		}
+	}
+	priority := func(s model.FoundSource) int {
+		if s.RepoName == "internal" {
+			return 10
+		}
+		return 0
+	}
+	versions := []model.FoundVersion{v("2.0.0", "mirror"), v("1.0.0", "internal"), v("1.1.0", "internal"), v("1.1.0", "mirror")}
+
+	sortFoundVersionsDesc(versions, priority)
+
+	// the curated repo wins, even over newer versions in the mirror
+	assert.Equal(t, []string{"internal-1.1.0", "internal-1.0.0", "mirror-2.0.0", "mirror-1.1.0"},
+		[]string{versions[0].TMID, versions[1].TMID, versions[2].TMID, versions[3].TMID})
+
+	id, _, err := findMostRecentMatchingVersion(slices.Clone(versions), "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "mirror-2.0.0", id, "a version found only in the mirror is resolved there")
+}
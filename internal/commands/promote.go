@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/buger/jsonparser"
+	"github.com/wot-oss/tmc/internal/audit"
+	"github.com/wot-oss/tmc/internal/commands/validate"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	// PromoteValidationSchema validates the TM against the JSON schemas, as done on push
+	PromoteValidationSchema = "schema"
+	// PromoteValidationDigest checks that the digest in the TM's id matches the TM's content
+	PromoteValidationDigest = "digest"
+	// PromoteValidationId checks that the id stored in the TM's content is the same as the id it is promoted under
+	PromoteValidationId = "id"
+)
+
+var (
+	SupportedPromoteValidations = []string{PromoteValidationSchema, PromoteValidationDigest, PromoteValidationId}
+	DefaultPromoteValidations   = []string{PromoteValidationSchema, PromoteValidationDigest, PromoteValidationId}
+
+	ErrPromotionValidation = errors.New("promotion validation failed")
+	ErrPromoteSameRepo     = errors.New("source and target of promotion must be different repos")
+	ErrApproverMissing     = errors.New("approver of promotion must not be empty")
+)
+
+type PromoteOptions struct {
+	// Approver identifies the person or system that approved the promotion
+	Approver string
+	// Validations lists the checks to run on the TM before promoting it. See SupportedPromoteValidations
+	Validations []string
+}
+
+type PromoteCommand struct {
+}
+
+func NewPromoteCommand() *PromoteCommand {
+	return &PromoteCommand{}
+}
+
+// Promote copies the TM with given id from repo 'from' to repo 'to', keeping its id.
+// Runs the validations given in opts before promoting and records the promotion in the audit log afterwards.
+// Returns audit.ErrLogDisabled if the audit log is disabled, as promotions must not happen without being recorded.
+// Returns the id the TM has been promoted under. Returns an instance of repos.ErrTMIDConflict if the target repo already
+// contains the same TM or a TM with a conflicting id
+func (c *PromoteCommand) Promote(ctx context.Context, from, to model.RepoSpec, id string, opts PromoteOptions) (string, error) {
+	log := utils.Logger(ctx)
+	if from == to {
+		return "", ErrPromoteSameRepo
+	}
+	if opts.Approver == "" {
+		return "", ErrApproverMissing
+	}
+	for _, v := range opts.Validations {
+		if !slices.Contains(SupportedPromoteValidations, v) {
+			return "", fmt.Errorf("unknown promotion validation: %s. Supported validations are %v", v, SupportedPromoteValidations)
+		}
+	}
+	tmid, err := model.ParseTMID(id)
+	if err != nil {
+		return "", err
+	}
+
+	src, err := repos.Get(from)
+	if err != nil {
+		return "", err
+	}
+	target, err := repos.Get(to)
+	if err != nil {
+		return "", err
+	}
+
+	actualId, raw, err := src.Fetch(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if actualId != id {
+		// the source only has the same content under a different timestamp. we promote exactly what is stored
+		tmid, err = model.ParseTMID(actualId)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = validateForPromotion(tmid, raw, opts.Validations)
+	if err != nil {
+		log.Error("promotion validation failed", "id", actualId, "error", err)
+		return "", err
+	}
+
+	// pushing the exact same id again would silently overwrite it, so refuse that here.
+	// any other conflicts are detected by the target repo on push
+	if existingId, _, err := target.Fetch(ctx, actualId); err == nil {
+		return "", &repos.ErrTMIDConflict{Type: repos.IdConflictSameContent, ExistingId: existingId}
+	}
+
+	// check the audit log before touching the target repo, so that we never promote anything without recording it
+	auditLog := audit.Default()
+	if auditLog == nil {
+		return "", audit.ErrLogDisabled
+	}
+
+	err = target.Push(ctx, tmid, raw)
+	if err != nil {
+		log.Error("could not promote TM", "id", actualId, "to", to, "error", err)
+		return "", err
+	}
+	err = target.Index(ctx, actualId)
+	if err != nil {
+		return "", err
+	}
+
+	err = auditLog.Add(ctx, audit.Record{
+		Operation: audit.OpPromote,
+		TMID:      actualId,
+		Digest:    tmid.Version.Hash,
+		Repo:      audit.RepoName(to),
+		Detail:    fmt.Sprintf("from %s, approved by %s", audit.RepoName(from), opts.Approver),
+	})
+	if err != nil {
+		log.Error("TM promoted, but could not write audit record", "id", actualId, "error", err)
+		return actualId, err
+	}
+	log.Info("promoted successfully", "id", actualId, "from", from, "to", to, "approver", opts.Approver)
+	return actualId, nil
+}
+
+func validateForPromotion(id model.TMID, raw []byte, validations []string) error {
+	for _, v := range validations {
+		switch v {
+		case PromoteValidationSchema:
+			_, err := validate.ValidateThingModel(raw)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrPromotionValidation, err)
+			}
+		case PromoteValidationDigest:
+			digest, _, err := CalculateFileDigest(raw)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrPromotionValidation, err)
+			}
+			if digest != id.Version.Hash {
+				return fmt.Errorf("%w: digest of content %s does not match id %s", ErrPromotionValidation, digest, id)
+			}
+		case PromoteValidationId:
+			value, dataType, _, err := jsonparser.Get(raw, "id")
+			if err != nil || dataType != jsonparser.String {
+				return fmt.Errorf("%w: TM does not contain a string id", ErrPromotionValidation)
+			}
+			if string(value) != id.String() {
+				return fmt.Errorf("%w: id in content %s does not match id %s", ErrPromotionValidation, string(value), id)
+			}
+		}
+	}
+	return nil
+}
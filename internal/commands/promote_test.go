@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/audit"
+	"github.com/wot-oss/tmc/internal/commands/validate"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos"
+	rMocks "github.com/wot-oss/tmc/internal/testutils/reposmocks"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+func TestPromoteCommand_Promote(t *testing.T) {
+	root := t.TempDir()
+	srcSpec := model.NewRepoSpec("staging")
+	targetSpec := model.NewRepoSpec("production")
+	src, err := repos.NewFileRepo(map[string]any{"type": "file", "loc": filepath.Join(root, "staging")}, srcSpec)
+	assert.NoError(t, err)
+	target, err := repos.NewFileRepo(map[string]any{"type": "file", "loc": filepath.Join(root, "production")}, targetSpec)
+	assert.NoError(t, err)
+	rMocks.MockReposGet(t, func(s model.RepoSpec) (repos.Repo, error) {
+		switch s {
+		case srcSpec:
+			return src, nil
+		case targetSpec:
+			return target, nil
+		}
+		return nil, repos.ErrRepoNotFound
+	})
+
+	_, raw, err := utils.ReadRequiredFile("../../test/data/push/omnilamp-versioned.json")
+	assert.NoError(t, err)
+	id, err := NewPushCommand(time.Now).PushFile(context.Background(), raw, src, "")
+	assert.NoError(t, err)
+
+	c := NewPromoteCommand()
+	auditFile := filepath.Join(root, "audit", "audit.log")
+	viper.Set(config.KeyAuditLogFile, auditFile)
+	defer viper.Set(config.KeyAuditLogFile, "")
+	opts := PromoteOptions{
+		Approver:    "alice",
+		Validations: DefaultPromoteValidations,
+	}
+
+	t.Run("same repo", func(t *testing.T) {
+		_, err := c.Promote(context.Background(), srcSpec, srcSpec, id, opts)
+		assert.ErrorIs(t, err, ErrPromoteSameRepo)
+	})
+	t.Run("missing approver", func(t *testing.T) {
+		_, err := c.Promote(context.Background(), srcSpec, targetSpec, id, PromoteOptions{})
+		assert.ErrorIs(t, err, ErrApproverMissing)
+	})
+	t.Run("unknown validation", func(t *testing.T) {
+		_, err := c.Promote(context.Background(), srcSpec, targetSpec, id, PromoteOptions{Approver: "alice", Validations: []string{"magic"}})
+		assert.ErrorContains(t, err, "unknown promotion validation")
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.Promote(context.Background(), srcSpec, targetSpec, "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-000000000000.tm.json", opts)
+		assert.ErrorIs(t, err, repos.ErrTmNotFound)
+		_, err = os.Stat(auditFile)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("audit log disabled", func(t *testing.T) {
+		viper.Set(config.KeyAuditLogFile, "")
+		defer viper.Set(config.KeyAuditLogFile, auditFile)
+		_, err := c.Promote(context.Background(), srcSpec, targetSpec, id, opts)
+		assert.ErrorIs(t, err, audit.ErrLogDisabled)
+	})
+	t.Run("success", func(t *testing.T) {
+		promotedId, err := c.Promote(context.Background(), srcSpec, targetSpec, id, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, id, promotedId)
+
+		fetchedId, fetched, err := target.Fetch(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, id, fetchedId)
+		_, srcRaw, _ := src.Fetch(context.Background(), id)
+		assert.Equal(t, srcRaw, fetched)
+
+		recs, err := audit.Default().Query(audit.Filter{})
+		assert.NoError(t, err)
+		if assert.Len(t, recs, 1) {
+			assert.Equal(t, audit.OpPromote, recs[0].Operation)
+			assert.Equal(t, id, recs[0].TMID)
+			assert.Equal(t, "production", recs[0].Repo)
+			assert.Equal(t, "from staging, approved by alice", recs[0].Detail)
+		}
+	})
+	t.Run("conflict", func(t *testing.T) {
+		_, err := c.Promote(context.Background(), srcSpec, targetSpec, id, opts)
+		var errConflict *repos.ErrTMIDConflict
+		if assert.True(t, errors.As(err, &errConflict)) {
+			assert.EqualValues(t, repos.IdConflictSameContent, errConflict.Type)
+			assert.Equal(t, id, errConflict.ExistingId)
+		}
+		recs, _ := audit.Default().Query(audit.Filter{})
+		assert.Len(t, recs, 1)
+	})
+}
+
+func TestValidateForPromotion(t *testing.T) {
+	_, raw, err := utils.ReadRequiredFile("../../test/data/push/omnilamp-versioned.json")
+	assert.NoError(t, err)
+	tm, err := validate.ValidateThingModel(raw)
+	assert.NoError(t, err)
+	prepared, id, err := prepareToImport(time.Now, tm, raw, "")
+	assert.NoError(t, err)
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, validateForPromotion(id, prepared, DefaultPromoteValidations))
+	})
+	t.Run("digest mismatch", func(t *testing.T) {
+		changed := bytes.Replace(prepared, []byte("Lamp Thing Model"), []byte("Lamp Thing"), 1)
+		err := validateForPromotion(id, changed, []string{PromoteValidationDigest})
+		assert.ErrorIs(t, err, ErrPromotionValidation)
+		assert.NoError(t, validateForPromotion(id, changed, []string{PromoteValidationSchema}))
+	})
+	t.Run("id mismatch", func(t *testing.T) {
+		otherId := id
+		otherId.Mpn = "otherlamp"
+		otherId.Name = "omnicorp-tm-department/omnicorp/otherlamp"
+		err := validateForPromotion(otherId, prepared, []string{PromoteValidationId})
+		assert.ErrorIs(t, err, ErrPromotionValidation)
+	})
+	t.Run("schema", func(t *testing.T) {
+		err := validateForPromotion(id, []byte(`{"@type": 5}`), []string{PromoteValidationSchema})
+		assert.ErrorIs(t, err, ErrPromotionValidation)
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/buger/jsonparser"
+	"github.com/wot-oss/tmc/internal/audit"
 	"github.com/wot-oss/tmc/internal/commands/validate"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
@@ -23,6 +24,7 @@ const (
 )
 
 var ErrTMNameTooLong = fmt.Errorf("TM name too long (max %d allowed)", maxNameLength)
+var ErrAtomicPushAborted = errors.New("atomic push aborted. No files have been pushed")
 
 type Now func() time.Time
 type PushCommand struct {
@@ -39,12 +41,180 @@ func NewPushCommand(now Now) *PushCommand {
 // Returns the ID that the TM has been stored under, and error.
 // If the repo already contains the same TM, returns the id of the existing TM and an instance of repos.ErrTMIDConflict
 func (c *PushCommand) PushFile(ctx context.Context, raw []byte, repo repos.Repo, optPath string) (string, error) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	tm, err := validate.ValidateThingModel(raw)
 	if err != nil {
 		log.Error("validation failed", "error", err)
 		return "", err
 	}
+	return c.pushValidated(ctx, tm, raw, repo, optPath)
+}
+
+// PushFiles validates all files first and then pushes the valid ones to repo. Does not update the repo's index.
+// Returns a result for each file. optTree makes the directory part of each file's name be used as optPath
+func (c *PushCommand) PushFiles(ctx context.Context, files []repos.BulkPushFile, repo repos.Repo, optPath string, optTree bool) []repos.BulkPushResult {
+	log := utils.Logger(ctx)
+	results := make([]repos.BulkPushResult, len(files))
+	tms := make([]*model.ThingModel, len(files))
+	for i, f := range files {
+		results[i].Name = f.Name
+		tm, err := validate.ValidateThingModel(f.Raw)
+		if err != nil {
+			log.Error("validation failed", "file", f.Name, "error", err)
+			results[i].Type = repos.BulkPushError
+			results[i].Message = err.Error()
+			continue
+		}
+		tms[i] = tm
+	}
+
+	for i, f := range files {
+		if tms[i] == nil {
+			continue
+		}
+		p := optPath
+		if optTree {
+			p = path.Dir("/" + strings.ReplaceAll(f.Name, "\\", "/"))
+		}
+		id, err := c.pushValidated(ctx, tms[i], f.Raw, repo, p)
+		results[i].TMID = id
+		if err != nil {
+			var errConflict *repos.ErrTMIDConflict
+			if errors.As(err, &errConflict) {
+				results[i].Type = repos.BulkPushExists
+			} else {
+				results[i].Type = repos.BulkPushError
+			}
+			results[i].Message = err.Error()
+			continue
+		}
+		results[i].Type = repos.BulkPushOK
+	}
+	return results
+}
+
+// PushFilesAtomic validates and prepares all files, and then pushes them to repo with all-or-nothing semantics,
+// including the index update. Nothing is pushed if any file is invalid. Requires repo to implement repos.AtomicPusher.
+// Returns a result for each file and ErrAtomicPushAborted if nothing has been pushed
+func (c *PushCommand) PushFilesAtomic(ctx context.Context, files []repos.BulkPushFile, repo repos.Repo, optPath string, optTree bool) ([]repos.BulkPushResult, error) {
+	ap, ok := repo.(repos.AtomicPusher)
+	if !ok {
+		return nil, repos.ErrAtomicPushNotSupported
+	}
+	results := make([]repos.BulkPushResult, len(files))
+	items := make([]repos.AtomicPushItem, len(files))
+	// duplicates maps name, version and digest of prepared TMs to their index, to detect files with identical content
+	duplicates := map[string]int{}
+	// timestamps holds name, version and timestamp of prepared TMs, to detect id clashes between files
+	timestamps := map[string]bool{}
+	dupOf := make([]int, len(files))
+	failed := false
+	for i, f := range files {
+		results[i].Name = f.Name
+		dupOf[i] = -1
+		tm, err := validate.ValidateThingModel(f.Raw)
+		if err != nil {
+			results[i].Type = repos.BulkPushError
+			results[i].Message = err.Error()
+			failed = true
+			continue
+		}
+		p := optPath
+		if optTree {
+			p = path.Dir("/" + strings.ReplaceAll(f.Name, "\\", "/"))
+		}
+		prepared, id, err := c.prepareUnique(tm, f.Raw, p, timestamps)
+		if err != nil {
+			results[i].Type = repos.BulkPushError
+			results[i].Message = err.Error()
+			failed = true
+			continue
+		}
+		contentKey := id.Name + "/" + id.Version.BaseString() + "-" + id.Version.Hash
+		if j, ok := duplicates[contentKey]; ok {
+			results[i].Type = repos.BulkPushExists
+			dupOf[i] = j
+			continue
+		}
+		duplicates[contentKey] = i
+		items[i] = repos.AtomicPushItem{ID: id, Raw: prepared}
+	}
+	if failed {
+		markNotPushed(results)
+		return results, ErrAtomicPushAborted
+	}
+
+	var toPush []repos.AtomicPushItem
+	var idx []int
+	for i := range items {
+		if items[i].Raw != nil {
+			toPush = append(toPush, items[i])
+			idx = append(idx, i)
+		}
+	}
+	existing, err := ap.PushAtomic(ctx, toPush)
+	if err != nil {
+		for i := range results {
+			results[i].Type = repos.BulkPushError
+			results[i].Message = err.Error()
+		}
+		return results, fmt.Errorf("%w: %w", ErrAtomicPushAborted, err)
+	}
+	for k, i := range idx {
+		if existing[k] != "" {
+			results[i].Type = repos.BulkPushExists
+			results[i].TMID = existing[k]
+			continue
+		}
+		id := items[i].ID
+		results[i].Type = repos.BulkPushOK
+		results[i].TMID = id.String()
+		audit.Write(ctx, audit.Record{
+			Operation: audit.OpPush,
+			TMID:      id.String(),
+			Digest:    id.Version.Hash,
+			Repo:      audit.RepoName(repo.Spec()),
+		})
+	}
+	// files with the same content as another file in the batch refer to that file's final id
+	for i, j := range dupOf {
+		if j >= 0 {
+			results[i].TMID = results[j].TMID
+		}
+	}
+	return results, nil
+}
+
+// prepareUnique prepares tm for import like prepareToImport, but moves the timestamp of the generated id into the future
+// until name, version and timestamp differ from all ids in timestamps. Adds the final id to timestamps
+func (c *PushCommand) prepareUnique(tm *model.ThingModel, raw []byte, optPath string, timestamps map[string]bool) ([]byte, model.TMID, error) {
+	base := c.now()
+	for offset := time.Duration(0); ; offset += time.Second {
+		now := func() time.Time { return base.Add(offset) }
+		prepared, id, err := prepareToImport(now, tm, raw, optPath)
+		if err != nil {
+			return nil, model.TMID{}, err
+		}
+		key := id.Name + "/" + id.Version.BaseString() + "-" + id.Version.Timestamp
+		if !timestamps[key] {
+			timestamps[key] = true
+			return prepared, id, nil
+		}
+	}
+}
+
+// markNotPushed turns all results which are not errors into errors, because an atomic push has been aborted
+func markNotPushed(results []repos.BulkPushResult) {
+	for i := range results {
+		if results[i].Type != repos.BulkPushError {
+			results[i].Type = repos.BulkPushError
+			results[i].Message = "not pushed, because atomic push has been aborted"
+		}
+	}
+}
+
+func (c *PushCommand) pushValidated(ctx context.Context, tm *model.ThingModel, raw []byte, repo repos.Repo, optPath string) (string, error) {
+	log := utils.Logger(ctx)
 	retriesLeft := maxPushRetries
 RETRY:
 	retriesLeft--
@@ -71,6 +241,12 @@ RETRY:
 		return id.String(), err
 	}
 	log.Info("pushed successfully")
+	audit.Write(ctx, audit.Record{
+		Operation: audit.OpPush,
+		TMID:      id.String(),
+		Digest:    id.Version.Hash,
+		Repo:      audit.RepoName(repo.Spec()),
+	})
 	return id.String(), nil
 }
 
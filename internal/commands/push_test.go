@@ -15,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/repos"
+	"github.com/wot-oss/tmc/internal/repos/mocks"
 	"github.com/wot-oss/tmc/internal/testutils"
 	"github.com/wot-oss/tmc/internal/utils"
 )
@@ -331,6 +332,111 @@ func TestPushToRepoVersioned(t *testing.T) {
 
 }
 
+func TestPushCommand_PushFiles(t *testing.T) {
+	root := t.TempDir()
+	repo, err := repos.NewFileRepo(map[string]any{
+		"type": "file",
+		"loc":  root,
+	}, model.EmptySpec)
+	assert.NoError(t, err)
+	_, omnilamp, err := utils.ReadRequiredFile("../../test/data/push/omnilamp.json")
+	assert.NoError(t, err)
+	_, versioned, err := utils.ReadRequiredFile("../../test/data/push/omnilamp-versioned.json")
+	assert.NoError(t, err)
+	earlier := func() time.Time { return time.Now().Add(-time.Hour) }
+	existingId, err := NewPushCommand(earlier).PushFile(context.Background(), versioned, repo, "a/b")
+	assert.NoError(t, err)
+
+	files := []repos.BulkPushFile{
+		{Name: "lamps/omnilamp.json", Raw: omnilamp},
+		{Name: "invalid.json", Raw: []byte("{}")},
+		{Name: "omnilamp-versioned.json", Raw: versioned},
+	}
+
+	t.Run("with opt path", func(t *testing.T) {
+		res := NewPushCommand(time.Now).PushFiles(context.Background(), files, repo, "a/b", false)
+		if assert.Len(t, res, 3) {
+			assert.Equal(t, "lamps/omnilamp.json", res[0].Name)
+			assert.Equal(t, repos.BulkPushOK, res[0].Type)
+			assert.True(t, strings.HasPrefix(res[0].TMID, "omnicorp-tm-department/omnicorp/omnilamp/a/b/"))
+			assert.Equal(t, repos.BulkPushError, res[1].Type)
+			assert.NotEmpty(t, res[1].Message)
+			assert.Equal(t, repos.BulkPushExists, res[2].Type)
+			assert.Equal(t, existingId, res[2].TMID)
+		}
+	})
+	t.Run("with opt tree", func(t *testing.T) {
+		res := NewPushCommand(time.Now).PushFiles(context.Background(), files[:1], repo, "a/b", true)
+		if assert.Len(t, res, 1) {
+			assert.Equal(t, repos.BulkPushOK, res[0].Type)
+			assert.True(t, strings.HasPrefix(res[0].TMID, "omnicorp-tm-department/omnicorp/omnilamp/lamps/"))
+		}
+	})
+}
+
+func TestPushCommand_PushFilesAtomic(t *testing.T) {
+	_, omnilamp, err := utils.ReadRequiredFile("../../test/data/push/omnilamp.json")
+	assert.NoError(t, err)
+	_, versioned, err := utils.ReadRequiredFile("../../test/data/push/omnilamp-versioned.json")
+	assert.NoError(t, err)
+	newRepo := func(t *testing.T) (repos.Repo, string) {
+		root := t.TempDir()
+		repo, err := repos.NewFileRepo(map[string]any{
+			"type": "file",
+			"loc":  root,
+		}, model.EmptySpec)
+		assert.NoError(t, err)
+		return repo, root
+	}
+
+	t.Run("invalid file aborts push", func(t *testing.T) {
+		repo, root := newRepo(t)
+		files := []repos.BulkPushFile{
+			{Name: "omnilamp.json", Raw: omnilamp},
+			{Name: "invalid.json", Raw: []byte("{}")},
+		}
+		res, err := NewPushCommand(time.Now).PushFilesAtomic(context.Background(), files, repo, "", false)
+		assert.ErrorIs(t, err, ErrAtomicPushAborted)
+		if assert.Len(t, res, 2) {
+			assert.Equal(t, repos.BulkPushError, res[0].Type)
+			assert.Equal(t, repos.BulkPushError, res[1].Type)
+			assert.NotEmpty(t, res[1].Message)
+		}
+		assert.NoDirExists(t, filepath.Join(root, "omnicorp-tm-department"))
+	})
+	t.Run("pushes all files", func(t *testing.T) {
+		repo, root := newRepo(t)
+		files := []repos.BulkPushFile{
+			{Name: "omnilamp.json", Raw: omnilamp},
+			{Name: "omnilamp-versioned.json", Raw: versioned},
+			{Name: "copy/omnilamp.json", Raw: omnilamp},
+		}
+		res, err := NewPushCommand(time.Now).PushFilesAtomic(context.Background(), files, repo, "", false)
+		assert.NoError(t, err)
+		if assert.Len(t, res, 3) {
+			assert.Equal(t, repos.BulkPushOK, res[0].Type)
+			assert.Equal(t, repos.BulkPushOK, res[1].Type)
+			assert.NotEqual(t, res[0].TMID, res[1].TMID)
+			assert.Equal(t, repos.BulkPushExists, res[2].Type)
+			assert.Equal(t, res[0].TMID, res[2].TMID)
+			assert.FileExists(t, filepath.Join(root, res[0].TMID))
+			assert.FileExists(t, filepath.Join(root, res[1].TMID))
+		}
+
+		// and: pushing the same files again reports them as existing
+		res, err = NewPushCommand(time.Now).PushFilesAtomic(context.Background(), files[:1], repo, "", false)
+		assert.NoError(t, err)
+		if assert.Len(t, res, 1) {
+			assert.Equal(t, repos.BulkPushExists, res[0].Type)
+		}
+	})
+	t.Run("not supported", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		_, err := NewPushCommand(time.Now).PushFilesAtomic(context.Background(), nil, r, "", false)
+		assert.ErrorIs(t, err, repos.ErrAtomicPushNotSupported)
+	})
+}
+
 func TestSanitizePath(t *testing.T) {
 	tests := []struct {
 		in  string
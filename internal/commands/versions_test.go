@@ -62,6 +62,7 @@ func TestVersionsCommand_ListVersions(t *testing.T) {
 			{
 				IndexVersion: model.IndexVersion{TMID: "murphy/omnicorp/senseall/v0.35.0-20231230173548-243d1b462bbb.tm.json"},
 				FoundIn:      model.FoundSource{RepoName: "r2"},
+				Shadows:      []model.FoundSource{{RepoName: "r1"}},
 			},
 			{
 				IndexVersion: model.IndexVersion{TMID: "murphy/omnicorp/senseall/v0.36.0-20231231153548-243d1b462ccc.tm.json"},
@@ -1,9 +1,17 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/wot-oss/tmc/internal/utils"
 
@@ -20,16 +28,91 @@ const (
 	KeyJWTValidation        = "jwtValidation"
 	KeyJWTServiceID         = "jwtServiceID"
 	KeyJWKSURL              = "jwksURL"
+	KeyAPIKeyValidation     = "apiKeyValidation"
+	KeyAPIKeysFile          = "apiKeysFile"
+	KeyPromotionValidations = "promotionValidations"
+	KeyPromotionRepos       = "promotionRepos"
+	KeyAuditLogFile         = "auditLogFile"
+	KeyAuditLogMaxSize      = "auditLogMaxSize"
+	KeyAuditLogMaxBackups   = "auditLogMaxBackups"
+	KeyTLSCert              = "tlsCert"
+	KeyTLSKey               = "tlsKey"
+	KeyTLSClientCA          = "tlsClientCA"
+	KeyTLSClientPermissions = "tlsClientPermissions"
+	KeyReadTimeout          = "readTimeout"
+	KeyWriteTimeout         = "writeTimeout"
+	KeyIdleTimeout          = "idleTimeout"
+	KeyShutdownTimeout      = "shutdownTimeout"
+	KeyShutdownDelay        = "shutdownDelay"
+	KeyMaxPushBodySize      = "maxPushBodySize"
+	KeyMaxBulkPushBodySize  = "maxBulkPushBodySize"
+	KeyWatchRepos           = "watchRepos"
+	KeyIndexLockTimeout     = "indexLockTimeout"
+	KeySecretsFile          = "secretsFile"
+	KeySecretsPassphrase    = "secretsPassphrase"
+	KeyHealthTimeout        = "healthTimeout"
+	KeyHealthMaxIndexAge    = "healthMaxIndexAge"
+	KeyHealthTolerance      = "healthTolerance"
+	KeyTracingExporter      = "tracingExporter"
+	KeyTracingEndpoint      = "tracingEndpoint"
+	KeyAccessLogFormat      = "accessLogFormat"
+	KeyAccessLogFile        = "accessLogFile"
+	KeyConfig               = "config"
+	KeyProfile              = "profile"
+	keyProfiles             = "profiles"
+	ProjectConfigDir        = ".tmc"
+	TrustedConfigsFilename  = "trusted-configs.json"
 	EnvPrefix               = "tmc"
 	LogLevelOff             = "off"
 
+	// HealthToleranceNone makes the service unavailable if any repo is not healthy
+	HealthToleranceNone = "none"
+	// HealthToleranceRemote makes the service unavailable if a local repo is down, but only degraded if a remote repo is
+	HealthToleranceRemote = "remote"
+	// HealthToleranceAll makes the service unavailable only if all repos are down
+	HealthToleranceAll = "all"
+
 	modSet int = iota
 	modDel
 )
 
+var ErrProfileNotFound = errors.New("profile not found in config file")
+
+// HealthTolerances are the valid values of KeyHealthTolerance
+var HealthTolerances = []string{HealthToleranceNone, HealthToleranceRemote, HealthToleranceAll}
+
+// DurationKeys are the keys from SettableKeys whose values are durations, e.g. "30s"
+var DurationKeys = []string{KeyReadTimeout, KeyWriteTimeout, KeyIdleTimeout, KeyShutdownTimeout, KeyShutdownDelay,
+	KeyIndexLockTimeout, KeyHealthTimeout, KeyHealthMaxIndexAge}
+
+// SettableKeys are the keys which can be read and written with 'config get/set'. Repos are configured with 'repo'
+var SettableKeys = []string{KeyLogLevel, KeyUrlContextRoot, KeyCorsAllowedOrigins, KeyCorsAllowedHeaders,
+	KeyCorsAllowCredentials, KeyCorsMaxAge, KeyJWTValidation, KeyJWTServiceID, KeyJWKSURL, KeyAPIKeyValidation,
+	KeyAPIKeysFile, KeyPromotionValidations, KeyPromotionRepos, KeyAuditLogFile,
+	KeyAuditLogMaxSize, KeyAuditLogMaxBackups, KeyTLSCert, KeyTLSKey, KeyTLSClientCA, KeyTLSClientPermissions,
+	KeyReadTimeout, KeyWriteTimeout, KeyIdleTimeout, KeyShutdownTimeout, KeyShutdownDelay, KeyMaxPushBodySize, KeyMaxBulkPushBodySize,
+	KeyWatchRepos, KeyIndexLockTimeout, KeySecretsFile, KeyHealthTimeout, KeyHealthMaxIndexAge, KeyHealthTolerance,
+	KeyTracingExporter, KeyTracingEndpoint, KeyAccessLogFormat, KeyAccessLogFile}
+
+// SettableKey returns the key from SettableKeys which equals key ignoring case
+func SettableKey(key string) (string, bool) {
+	for _, k := range SettableKeys {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
 var HomeDir string
 var DefaultConfigDir string
 
+// activeProfile is the name of the profile applied to the config, if any
+var activeProfile string
+
+// untrustedConfig is the project config file found, but ignored by LoadConfigFile because it has not been trusted
+var untrustedConfig string
+
 func InitConfig() {
 	var err error
 	HomeDir, err = os.UserHomeDir()
@@ -42,18 +125,26 @@ func InitConfig() {
 func InitViper() {
 	viper.SetDefault(KeyLogLevel, LogLevelOff)
 	viper.SetDefault(KeyJWTValidation, false)
+	viper.SetDefault(KeyAPIKeyValidation, false)
+	viper.SetDefault(KeyAPIKeysFile, filepath.Join(DefaultConfigDir, "apikeys.json"))
+	viper.SetDefault(KeyAuditLogFile, filepath.Join(DefaultConfigDir, "audit.log"))
+	viper.SetDefault(KeyAuditLogMaxSize, 0)
+	viper.SetDefault(KeyReadTimeout, 60*time.Second)
+	viper.SetDefault(KeyWriteTimeout, 60*time.Second)
+	viper.SetDefault(KeyIdleTimeout, 120*time.Second)
+	viper.SetDefault(KeyShutdownTimeout, 30*time.Second)
+	viper.SetDefault(KeyShutdownDelay, 0)
+	viper.SetDefault(KeyMaxPushBodySize, 10*1024*1024)
+	viper.SetDefault(KeyMaxBulkPushBodySize, 100*1024*1024)
+	viper.SetDefault(KeyWatchRepos, true)
+	viper.SetDefault(KeyIndexLockTimeout, 5*time.Second)
+	viper.SetDefault(KeyAuditLogMaxBackups, 5)
+	viper.SetDefault(KeySecretsFile, filepath.Join(DefaultConfigDir, "secrets.enc"))
+	viper.SetDefault(KeyHealthTimeout, 5*time.Second)
+	viper.SetDefault(KeyHealthMaxIndexAge, 0)
+	viper.SetDefault(KeyHealthTolerance, HealthToleranceRemote)
+	viper.SetDefault(KeyAccessLogFormat, "none")
 
-	viper.SetConfigType("json")
-	viper.SetConfigName("config")
-	viper.AddConfigPath(DefaultConfigDir)
-	viper.AddConfigPath(".")
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Config file not found; do nothing and rely on defaults
-		} else {
-			panic("cannot read config: " + err.Error())
-		}
-	}
 	// set prefix "tmc" for environment variables
 	// the environment variables then have to match pattern "tmc_<viper variable>", lower or uppercase
 	viper.SetEnvPrefix(EnvPrefix)
@@ -68,6 +159,211 @@ func InitViper() {
 	_ = viper.BindEnv(KeyJWTValidation)        // env variable name = tmc_jwtvalidation
 	_ = viper.BindEnv(KeyJWTServiceID)         // env variable name = tmc_jwtvalidation
 	_ = viper.BindEnv(KeyJWKSURL)              // env variable name = tmc_jwksurl
+	_ = viper.BindEnv(KeyAPIKeyValidation)     // env variable name = tmc_apikeyvalidation
+	_ = viper.BindEnv(KeyAPIKeysFile)          // env variable name = tmc_apikeysfile
+	_ = viper.BindEnv(KeyPromotionValidations) // env variable name = tmc_promotionvalidations
+	_ = viper.BindEnv(KeyPromotionRepos)       // env variable name = tmc_promotionrepos
+	_ = viper.BindEnv(KeyAuditLogFile)         // env variable name = tmc_auditlogfile
+	_ = viper.BindEnv(KeyAuditLogMaxSize)      // env variable name = tmc_auditlogmaxsize
+	_ = viper.BindEnv(KeyAuditLogMaxBackups)   // env variable name = tmc_auditlogmaxbackups
+	_ = viper.BindEnv(KeyTLSCert)              // env variable name = tmc_tlscert
+	_ = viper.BindEnv(KeyTLSKey)               // env variable name = tmc_tlskey
+	_ = viper.BindEnv(KeyTLSClientCA)          // env variable name = tmc_tlsclientca
+	_ = viper.BindEnv(KeyTLSClientPermissions) // env variable name = tmc_tlsclientpermissions
+	_ = viper.BindEnv(KeyReadTimeout)          // env variable name = tmc_readtimeout
+	_ = viper.BindEnv(KeyWriteTimeout)         // env variable name = tmc_writetimeout
+	_ = viper.BindEnv(KeyIdleTimeout)          // env variable name = tmc_idletimeout
+	_ = viper.BindEnv(KeyShutdownTimeout)      // env variable name = tmc_shutdowntimeout
+	_ = viper.BindEnv(KeyShutdownDelay)        // env variable name = tmc_shutdowndelay
+	_ = viper.BindEnv(KeyMaxPushBodySize)      // env variable name = tmc_maxpushbodysize
+	_ = viper.BindEnv(KeyMaxBulkPushBodySize)  // env variable name = tmc_maxbulkpushbodysize
+	_ = viper.BindEnv(KeyWatchRepos)           // env variable name = tmc_watchrepos
+	_ = viper.BindEnv(KeyIndexLockTimeout)     // env variable name = tmc_indexlocktimeout
+	_ = viper.BindEnv(KeySecretsFile)          // env variable name = tmc_secretsfile
+	_ = viper.BindEnv(KeySecretsPassphrase)    // env variable name = tmc_secretspassphrase
+	_ = viper.BindEnv(KeyHealthTimeout)        // env variable name = tmc_healthtimeout
+	_ = viper.BindEnv(KeyHealthMaxIndexAge)    // env variable name = tmc_healthmaxindexage
+	_ = viper.BindEnv(KeyHealthTolerance)      // env variable name = tmc_healthtolerance
+	_ = viper.BindEnv(KeyTracingExporter)      // env variable name = tmc_tracingexporter
+	_ = viper.BindEnv(KeyTracingEndpoint)      // env variable name = tmc_tracingendpoint
+	_ = viper.BindEnv(KeyAccessLogFormat)      // env variable name = tmc_accesslogformat
+	_ = viper.BindEnv(KeyAccessLogFile)        // env variable name = tmc_accesslogfile
+	_ = viper.BindEnv(KeyConfig)               // env variable name = tmc_config
+	_ = viper.BindEnv(KeyProfile)              // env variable name = tmc_profile
+
+	err := LoadConfigFile()
+	if err != nil && !errors.Is(err, ErrProfileNotFound) {
+		panic("cannot read config: " + err.Error())
+	}
+}
+
+// LoadConfigFile reads the config file and applies the profile given by KeyProfile, if any.
+// The config file is the one given by KeyConfig or, if not set, the first one found of
+// .tmc/config.json in the working directory or any of its parents, config.json in DefaultConfigDir and config.json
+// in the working directory.
+// A project config found in .tmc is used only if it has been trusted with TrustConfigFile, because it can run
+// commands and read secrets through the repo configs, like any other config file. Otherwise, it is skipped and
+// reported by UntrustedConfigFile.
+// The keys of a profile, which is found under "profiles" in the config file, replace the top-level keys with the same
+// name. Returns ErrProfileNotFound if the config file has no such profile
+func LoadConfigFile() error {
+	viper.SetConfigType("json")
+	untrustedConfig = ""
+	file := findConfigFile()
+	data := map[string]any{}
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			err = json.Unmarshal(b, &data)
+			if err != nil {
+				return fmt.Errorf("invalid config file %s: %w", file, err)
+			}
+		}
+		viper.SetConfigFile(file)
+	}
+	activeProfile = viper.GetString(KeyProfile)
+	if activeProfile != "" {
+		profiles, _ := data[keyProfiles].(map[string]any)
+		p, ok := profiles[activeProfile].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, activeProfile)
+		}
+		for k, v := range p {
+			data[k] = v
+		}
+	}
+	delete(data, keyProfiles)
+	b, _ := json.Marshal(data)
+	return viper.ReadConfig(bytes.NewReader(b))
+}
+
+// ActiveProfile returns the name of the profile applied by LoadConfigFile or an empty string, if none is
+func ActiveProfile() string {
+	return activeProfile
+}
+
+// Profiles returns the names of the profiles in the config file
+func Profiles() ([]string, error) {
+	j, err := readConfigFile(configFileName())
+	if err != nil {
+		return nil, err
+	}
+	profiles, _ := j[keyProfiles].(map[string]any)
+	var names []string
+	for n := range profiles {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// UntrustedConfigFile returns the project config file skipped by LoadConfigFile because it has not been trusted, or
+// an empty string, if there is none
+func UntrustedConfigFile() string {
+	return untrustedConfig
+}
+
+func findConfigFile() string {
+	if f := viper.GetString(KeyConfig); f != "" {
+		return f
+	}
+	if f := FindProjectConfigFile(); f != "" {
+		if IsTrustedConfigFile(f) {
+			return f
+		}
+		untrustedConfig = f
+	}
+	for _, dir := range []string{DefaultConfigDir, "."} {
+		f := filepath.Join(dir, "config.json")
+		if isFile(f) {
+			return f
+		}
+	}
+	return ""
+}
+
+// FindProjectConfigFile returns the .tmc/config.json in the working directory or the nearest of its parents, or an
+// empty string, if there is none
+func FindProjectConfigFile() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		f := filepath.Join(dir, ProjectConfigDir, "config.json")
+		if isFile(f) {
+			return f
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// TrustConfigFile records the current contents of the config file as trusted in TrustedConfigsFilename in
+// DefaultConfigDir. Changes to the file made other than with Save or Delete revoke the trust
+func TrustConfigFile(file string) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	h, err := hashFile(abs)
+	if err != nil {
+		return err
+	}
+	trusted, err := readTrustedConfigs()
+	if err != nil {
+		return err
+	}
+	trusted[abs] = h
+	err = os.MkdirAll(DefaultConfigDir, 0770)
+	if err != nil {
+		return err
+	}
+	w, _ := json.MarshalIndent(trusted, "", "  ")
+	return utils.AtomicWriteFile(filepath.Join(DefaultConfigDir, TrustedConfigsFilename), w, 0660)
+}
+
+// IsTrustedConfigFile returns true if the config file has been trusted with TrustConfigFile and not changed since
+func IsTrustedConfigFile(file string) bool {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	trusted, err := readTrustedConfigs()
+	if err != nil {
+		return false
+	}
+	h, err := hashFile(abs)
+	return err == nil && trusted[abs] == h
+}
+
+// readTrustedConfigs reads the hashes of the trusted config files by their absolute paths
+func readTrustedConfigs() (map[string]string, error) {
+	b, err := os.ReadFile(filepath.Join(DefaultConfigDir, TrustedConfigsFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	trusted := map[string]string{}
+	if len(bytes.TrimSpace(b)) > 0 {
+		err = json.Unmarshal(b, &trusted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", TrustedConfigsFilename, err)
+		}
+	}
+	return trusted, nil
+}
+
+func hashFile(file string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 func Save(key string, data any) error {
@@ -80,37 +376,69 @@ func Delete(key string) error {
 }
 
 func updateConfigFile(mod int, key string, data any) error {
+	configFile := configFileName()
+	err := os.MkdirAll(filepath.Dir(configFile), 0770)
+	if err != nil {
+		return err
+	}
+	j, err := readConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+	// with an active profile, the profile's keys are modified instead of the top-level ones
+	target := j
+	if activeProfile != "" {
+		profiles, _ := j[keyProfiles].(map[string]any)
+		target, _ = profiles[activeProfile].(map[string]any)
+		if target == nil {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, activeProfile)
+		}
+	}
+	if mod == modSet {
+		target[key] = data
+	} else if mod == modDel {
+		delete(target, key)
+	}
+
+	w, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	// our own changes must not revoke the trust in the file
+	trusted := IsTrustedConfigFile(configFile)
+	err = utils.AtomicWriteFile(configFile, w, 0660)
+	if err != nil || !trusted {
+		return err
+	}
+	return TrustConfigFile(configFile)
+}
+
+func isFile(name string) bool {
+	stat, err := os.Stat(name)
+	return err == nil && !stat.IsDir()
+}
 
+// configFileName returns the name of the config file in use, or the default one, if there is none
+func configFileName() string {
 	configFile := viper.ConfigFileUsed()
 	if configFile == "" {
 		configFile = filepath.Join(DefaultConfigDir, "config.json")
 	}
-	err := os.MkdirAll(DefaultConfigDir, 0770)
-	if err != nil {
-		return err
-	}
+	return configFile
+}
 
+func readConfigFile(configFile string) (map[string]any, error) {
 	b, err := os.ReadFile(configFile)
 	if err != nil && !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
-	if len(b) == 0 {
+	if len(bytes.TrimSpace(b)) == 0 {
 		b = []byte("{}")
 	}
 	var j map[string]any
 	err = json.Unmarshal(b, &j)
 	if err != nil {
-		return err
-	}
-	if mod == modSet {
-		j[key] = data
-	} else if mod == modDel {
-		delete(j, key)
-	}
-
-	w, err := json.MarshalIndent(j, "", "  ")
-	if err != nil {
-		return err
+		return nil, err
 	}
-	return utils.AtomicWriteFile(configFile, w, 0660)
+	return j, nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
@@ -117,3 +118,95 @@ func TestDeleteConfigRemovesOnlyKeyValue(t *testing.T) {
 	jsa := jsonassert.New(t)
 	jsa.Assertf(string(file), `{ "loglevel": "debug" }`)
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	defer setupDefaultConfigDir()()
+	defer viper.Reset()
+	wd, _ := os.Getwd()
+	defer func() { _ = os.Chdir(wd) }()
+
+	home := filepath.Join(DefaultConfigDir, "config.json")
+	assert.NoError(t, os.WriteFile(home, []byte(`{"logLevel": "error"}`), 0660))
+	project := t.TempDir()
+	projectFile := filepath.Join(project, ProjectConfigDir, "config.json")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(projectFile), 0770))
+	assert.NoError(t, os.WriteFile(projectFile, []byte(`{
+  "logLevel": "info",
+  "profiles": {
+    "prod": { "logLevel": "warn", "corsMaxAge": 120 }
+  }
+}`), 0660))
+	sub := filepath.Join(project, "tms", "omnicorp")
+	assert.NoError(t, os.MkdirAll(sub, 0770))
+
+	t.Run("user config", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(t.TempDir()))
+		assert.NoError(t, LoadConfigFile())
+		assert.Equal(t, home, viper.ConfigFileUsed())
+		assert.Equal(t, "error", viper.GetString(KeyLogLevel))
+	})
+	t.Run("untrusted project config", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		assert.NoError(t, LoadConfigFile())
+		assert.Equal(t, home, viper.ConfigFileUsed())
+		assert.Equal(t, projectFile, UntrustedConfigFile())
+		assert.Equal(t, "error", viper.GetString(KeyLogLevel))
+	})
+	t.Run("project config found in parent directory", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		assert.NoError(t, TrustConfigFile(FindProjectConfigFile()))
+		assert.NoError(t, LoadConfigFile())
+		assert.Empty(t, UntrustedConfigFile())
+		assert.Equal(t, "info", viper.GetString(KeyLogLevel))
+		assert.Nil(t, viper.Get(keyProfiles))
+	})
+	t.Run("changed project config", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		org, err := os.ReadFile(projectFile)
+		assert.NoError(t, err)
+		defer func() { _ = os.WriteFile(projectFile, org, 0660) }()
+		assert.NoError(t, os.WriteFile(projectFile, bytes.Replace(org, []byte("info"), []byte("debug"), 1), 0660))
+
+		assert.NoError(t, LoadConfigFile())
+		assert.Equal(t, projectFile, UntrustedConfigFile())
+		assert.Equal(t, "error", viper.GetString(KeyLogLevel))
+	})
+	t.Run("explicit config file", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		viper.Set(KeyConfig, home)
+		defer viper.Set(KeyConfig, "")
+		assert.NoError(t, LoadConfigFile())
+		assert.Equal(t, "error", viper.GetString(KeyLogLevel))
+	})
+	t.Run("profile", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		viper.Set(KeyProfile, "prod")
+		defer viper.Set(KeyProfile, "")
+		assert.NoError(t, LoadConfigFile())
+		assert.Equal(t, "prod", ActiveProfile())
+		assert.Equal(t, "warn", viper.GetString(KeyLogLevel))
+		assert.Equal(t, 120, viper.GetInt(KeyCorsMaxAge))
+
+		// changes go to the profile
+		assert.NoError(t, Save(KeyCorsMaxAge, 60))
+		file, err := os.ReadFile(projectFile)
+		assert.NoError(t, err)
+		jsonassert.New(t).Assertf(string(file), `{
+  "logLevel": "info",
+  "profiles": {
+    "prod": { "logLevel": "warn", "corsMaxAge": 60 }
+  }
+}`)
+		profiles, err := Profiles()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"prod"}, profiles)
+		// and keep the file trusted
+		assert.True(t, IsTrustedConfigFile(projectFile))
+	})
+	t.Run("unknown profile", func(t *testing.T) {
+		assert.NoError(t, os.Chdir(sub))
+		viper.Set(KeyProfile, "staging")
+		defer viper.Set(KeyProfile, "")
+		assert.ErrorIs(t, LoadConfigFile(), ErrProfileNotFound)
+	})
+}
@@ -23,6 +23,8 @@ type FoundEntry struct {
 type FoundVersion struct {
 	IndexVersion
 	FoundIn FoundSource
+	// Shadows are the other sources where the same TM has been found, but which have a lower priority than FoundIn
+	Shadows []FoundSource
 }
 
 type FoundSource struct {
@@ -37,24 +39,83 @@ func (s FoundSource) String() string {
 	return "<" + s.RepoName + ">"
 }
 
-func MergeFoundVersions(vs1, vs2 []FoundVersion) []FoundVersion {
+// PriorityFunc returns the priority of a source. Higher values take precedence
+type PriorityFunc func(FoundSource) int
+
+// MergeFoundVersions merges two lists of found versions. If the same TM has been found in several sources, only the
+// version from the source with the highest priority, or with the most recent timestamp for equal priorities, is kept.
+// It records the other sources as shadowed by it. A nil priority gives all sources equal priority
+func MergeFoundVersions(vs1, vs2 []FoundVersion, priority PriorityFunc) []FoundVersion {
+	if priority == nil {
+		priority = func(FoundSource) int { return 0 }
+	}
 	vs1 = append(vs1, vs2...)
 	slices.SortStableFunc(vs1, func(a, b FoundVersion) int {
-		tmid1, _ := ParseTMID(a.TMID)
-		tmid2, _ := ParseTMID(b.TMID)
-		if tmid1.Equals(tmid2) {
-			return -strings.Compare(tmid1.Version.Timestamp, tmid2.Version.Timestamp) // sort in reverse chronological order within the same TMID
+		if c := strings.Compare(sameTMKey(a), sameTMKey(b)); c != 0 {
+			return c
 		}
-		return strings.Compare(a.TMID, b.TMID)
-	})
-	return slices.CompactFunc(vs1, func(v1, v2 FoundVersion) bool {
-		tmid1, _ := ParseTMID(v1.TMID)
-		tmid2, _ := ParseTMID(v2.TMID)
-		return tmid1.Equals(tmid2)
+		if c := priority(b.FoundIn) - priority(a.FoundIn); c != 0 {
+			return c
+		}
+		return -strings.Compare(tmTimestamp(a), tmTimestamp(b)) // sort in reverse chronological order within the same TM
 	})
+	res := vs1[:0]
+	for _, v := range vs1 {
+		if len(res) > 0 && sameTMKey(res[len(res)-1]) == sameTMKey(v) {
+			kept := &res[len(res)-1]
+			kept.Shadows = addSources(kept.Shadows, kept.FoundIn, append([]FoundSource{v.FoundIn}, v.Shadows...)...)
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// sameTMKey returns a key which is equal for versions of the same TM, regardless of their timestamps
+func sameTMKey(v FoundVersion) string {
+	tmid, err := ParseTMID(v.TMID)
+	if err != nil {
+		return v.TMID
+	}
+	return tmid.Name + "/" + tmid.Version.BaseString() + "-" + tmid.Version.Hash
+}
+
+func tmTimestamp(v FoundVersion) string {
+	tmid, err := ParseTMID(v.TMID)
+	if err != nil {
+		return v.TimeStamp
+	}
+	return tmid.Version.Timestamp
+}
+
+// addSources appends those of srcs to list, which are neither except nor in list already
+func addSources(list []FoundSource, except FoundSource, srcs ...FoundSource) []FoundSource {
+	list = slices.Clip(list)
+	for _, s := range srcs {
+		if s != except && !slices.Contains(list, s) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// Sources returns the sources where versions of r have been found and the sources which are shadowed by them.
+// A source is shadowed if all the versions it holds have been found in sources with higher priority
+func (r FoundEntry) Sources() (found []FoundSource, shadowed []FoundSource) {
+	for _, v := range r.Versions {
+		found = addSources(found, FoundSource{}, v.FoundIn)
+	}
+	for _, v := range r.Versions {
+		for _, s := range v.Shadows {
+			if !slices.Contains(found, s) {
+				shadowed = addSources(shadowed, FoundSource{}, s)
+			}
+		}
+	}
+	return found, shadowed
 }
 
-func (r FoundEntry) Merge(other FoundEntry) FoundEntry {
+func (r FoundEntry) Merge(other FoundEntry, priority PriorityFunc) FoundEntry {
 	if r.Name == "" {
 		return FoundEntry{
 			Name:         other.Name,
@@ -64,15 +125,16 @@ func (r FoundEntry) Merge(other FoundEntry) FoundEntry {
 			Versions:     other.Versions,
 		}
 	}
-	r.Versions = MergeFoundVersions(r.Versions, other.Versions)
+	r.Versions = MergeFoundVersions(r.Versions, other.Versions, priority)
 	return r
 }
 
-func (sr *SearchResult) Merge(other *SearchResult) {
-	sr.Entries = mergeFoundEntries(sr.Entries, other.Entries)
+// Merge merges other into sr. See MergeFoundVersions for how priority is used
+func (sr *SearchResult) Merge(other *SearchResult, priority PriorityFunc) {
+	sr.Entries = mergeFoundEntries(sr.Entries, other.Entries, priority)
 }
 
-func mergeFoundEntries(e1, e2 []FoundEntry) []FoundEntry {
+func mergeFoundEntries(e1, e2 []FoundEntry, priority PriorityFunc) []FoundEntry {
 	e1 = append(e1, e2...)
 	slices.SortStableFunc(e1, func(a, b FoundEntry) int {
 		return strings.Compare(a.Name, b.Name)
@@ -88,7 +150,7 @@ func mergeFoundEntries(e1, e2 []FoundEntry) []FoundEntry {
 			}
 			i++
 		} else {
-			e1[k-1] = e1[k-1].Merge(e1[k])
+			e1[i-1] = e1[i-1].Merge(e1[k], priority)
 		}
 	}
 	return e1[:i]
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeFoundVersions_Shadows(t *testing.T) {
+	const (
+		id1Old = "author/omnicorp/senseall/v1.0.0-20231130153548-243d1b462aaa.tm.json"
+		id1New = "author/omnicorp/senseall/v1.0.0-20240101000000-243d1b462aaa.tm.json"
+		id2    = "author/omnicorp/senseall/v2.0.0-20240101000000-243d1b462bbb.tm.json"
+	)
+	internal := FoundSource{RepoName: "internal"}
+	mirror := FoundSource{RepoName: "mirror"}
+	local := FoundSource{Directory: "local"}
+	priority := func(s FoundSource) int {
+		if s == internal {
+			return 10
+		}
+		return 0
+	}
+	vs1 := []FoundVersion{{IndexVersion: IndexVersion{TMID: id1New}, FoundIn: mirror}, {IndexVersion: IndexVersion{TMID: id2}, FoundIn: mirror}}
+	vs2 := []FoundVersion{{IndexVersion: IndexVersion{TMID: id1Old}, FoundIn: internal}}
+	vs3 := []FoundVersion{{IndexVersion: IndexVersion{TMID: id1New}, FoundIn: local}}
+
+	t.Run("with priorities", func(t *testing.T) {
+		res := MergeFoundVersions(MergeFoundVersions(slices.Clone(vs1), slices.Clone(vs2), priority), slices.Clone(vs3), priority)
+		assert.Equal(t, []FoundVersion{
+			{IndexVersion: IndexVersion{TMID: id1Old}, FoundIn: internal, Shadows: []FoundSource{mirror, local}},
+			{IndexVersion: IndexVersion{TMID: id2}, FoundIn: mirror},
+		}, res)
+
+		e := FoundEntry{Name: "author/omnicorp/senseall", Versions: res}
+		found, shadowed := e.Sources()
+		assert.Equal(t, []FoundSource{internal, mirror}, found)
+		assert.Equal(t, []FoundSource{local}, shadowed)
+	})
+	t.Run("without priorities", func(t *testing.T) {
+		res := MergeFoundVersions(slices.Clone(vs1), slices.Clone(vs2), nil)
+		assert.Equal(t, []FoundVersion{
+			{IndexVersion: IndexVersion{TMID: id1New}, FoundIn: mirror, Shadows: []FoundSource{internal}},
+			{IndexVersion: IndexVersion{TMID: id2}, FoundIn: mirror},
+		}, res)
+	})
+}
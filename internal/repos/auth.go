@@ -0,0 +1,263 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	AuthKindBearer           = "bearer"
+	AuthKindOAuth2           = "oauth2"
+	AuthKindBasic            = "basic"
+	AuthKindHeaders          = "headers"
+	AuthKindCredentialHelper = "credentialHelper"
+
+	KeyBasicUsername = "username"
+	KeyBasicPassword = "password"
+)
+
+// httpAuth authenticates the requests of a repo accessed over http
+type httpAuth interface {
+	// authorize adds the credentials to req
+	authorize(req *http.Request) error
+	// renew is called after the server has rejected req with 401. Returns true if the credentials have been renewed
+	// and the request should be sent once more
+	renew(req *http.Request) bool
+}
+
+// newHttpAuth creates the httpAuth for the "auth" section of the repo config. Returns nil if the config has no auth
+// section for any of the kinds supported over http
+func newHttpAuth(config map[string]any, client *http.Client) (httpAuth, error) {
+	auth := utils.JsGetMap(config, KeyRepoAuth)
+	if auth == nil {
+		return nil, nil
+	}
+	if token := utils.JsGetString(auth, AuthKindBearer); token != nil {
+		return bearerAuth(*token), nil
+	}
+	if bc := utils.JsGetMap(auth, AuthKindBasic); bc != nil {
+		c, err := parseBasicAuthConfig(bc)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if oc := utils.JsGetMap(auth, AuthKindOAuth2); oc != nil {
+		src, err := newOAuth2TokenSource(oc, client)
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2Auth{src: src}, nil
+	}
+	if _, ok := auth[AuthKindCredentialHelper]; ok {
+		h, err := newCredentialHelperAuth(auth[AuthKindCredentialHelper])
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	if hc := utils.JsGetMap(auth, AuthKindHeaders); hc != nil {
+		h, err := parseHeadersAuthConfig(hc)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	return nil, nil
+}
+
+// authHeaderNames returns the names of the headers which carry the credentials of the "auth" section of the repo
+// config, including the Authorization header
+func authHeaderNames(config map[string]any) []string {
+	names := []string{"Authorization"}
+	auth := utils.JsGetMap(config, KeyRepoAuth)
+	if auth == nil {
+		return names
+	}
+	if hc := utils.JsGetMap(auth, AuthKindHeaders); hc != nil {
+		for name := range hc {
+			names = append(names, name)
+		}
+	}
+	if v, ok := auth[AuthKindCredentialHelper]; ok {
+		if c, err := parseCredentialHelperConfig(v); err == nil && c.header != "" {
+			names = append(names, c.header)
+		}
+	}
+	return names
+}
+
+// stripAuthOnRedirect returns an http.Client.CheckRedirect function which removes the headers with given names from
+// requests redirected to a host other than the one of the original request, so that credentials are not disclosed
+// to other hosts
+func stripAuthOnRedirect(names []string) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		// same limit as http.Client's default policy
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.URL.Host != via[0].URL.Host {
+			for _, name := range names {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// validateAuthConfig checks that the "auth" section of a repo config, if present, is valid
+func validateAuthConfig(rc map[string]any) error {
+	v, ok := rc[KeyRepoAuth]
+	if !ok {
+		return nil
+	}
+	auth, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid json config. %s must be a map", KeyRepoAuth)
+	}
+	if v, ok := auth[AuthKindBearer]; ok {
+		if _, isStr := v.(string); !isStr {
+			return fmt.Errorf("invalid auth config. %s must be a string", AuthKindBearer)
+		}
+	}
+	if v, ok := auth[AuthKindOAuth2]; ok {
+		oc, isMap := v.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("invalid auth config. %s must be a map", AuthKindOAuth2)
+		}
+		if _, err := parseOAuth2Config(oc); err != nil {
+			return err
+		}
+	}
+	if v, ok := auth[AuthKindBasic]; ok {
+		bc, isMap := v.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("invalid auth config. %s must be a map", AuthKindBasic)
+		}
+		if _, err := parseBasicAuthConfig(bc); err != nil {
+			return err
+		}
+	}
+	if v, ok := auth[AuthKindHeaders]; ok {
+		hc, isMap := v.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("invalid auth config. %s must be a map", AuthKindHeaders)
+		}
+		if _, err := parseHeadersAuthConfig(hc); err != nil {
+			return err
+		}
+	}
+	if v, ok := auth[AuthKindCredentialHelper]; ok {
+		if _, err := parseCredentialHelperConfig(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canResend returns true if the body of req can be sent once more
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// resend sends req once more, with credentials renewed by auth
+func resend(client *http.Client, auth httpAuth, req *http.Request) (*http.Response, error) {
+	retry, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Del("Authorization")
+	err = auth.authorize(retry)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(retry)
+}
+
+// bearerAuth authenticates requests with a static bearer token
+type bearerAuth string
+
+func (b bearerAuth) authorize(req *http.Request) error {
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", string(b)))
+	return nil
+}
+
+func (b bearerAuth) renew(*http.Request) bool {
+	return false
+}
+
+// basicAuth authenticates requests with a username and password
+type basicAuth struct {
+	username string
+	password string
+}
+
+func parseBasicAuthConfig(conf map[string]any) (basicAuth, error) {
+	u := utils.JsGetString(conf, KeyBasicUsername)
+	p := utils.JsGetString(conf, KeyBasicPassword)
+	if u == nil || *u == "" || p == nil {
+		return basicAuth{}, fmt.Errorf("invalid basic auth config. must have strings %q and %q", KeyBasicUsername, KeyBasicPassword)
+	}
+	return basicAuth{username: *u, password: *p}, nil
+}
+
+func (b basicAuth) authorize(req *http.Request) error {
+	req.SetBasicAuth(b.username, b.password)
+	return nil
+}
+
+func (b basicAuth) renew(*http.Request) bool {
+	return false
+}
+
+// headersAuth authenticates requests by adding fixed headers, like X-API-Key or GitLab's PRIVATE-TOKEN
+type headersAuth map[string]string
+
+func parseHeadersAuthConfig(conf map[string]any) (headersAuth, error) {
+	if len(conf) == 0 {
+		return nil, fmt.Errorf("invalid auth config. %s must not be empty", AuthKindHeaders)
+	}
+	h := headersAuth{}
+	for name, v := range conf {
+		value, ok := v.(string)
+		if !ok || !validHeader(name, value) {
+			return nil, fmt.Errorf("invalid auth config. %s must map valid header names to string values", AuthKindHeaders)
+		}
+		h[name] = value
+	}
+	return h, nil
+}
+
+func (h headersAuth) authorize(req *http.Request) error {
+	for name, value := range h {
+		req.Header.Set(name, value)
+	}
+	return nil
+}
+
+func (h headersAuth) renew(*http.Request) bool {
+	return false
+}
+
+// validHeader returns true if name is a header field token and value does not contain control characters, which
+// could be used to inject further headers
+func validHeader(name, value string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	for _, c := range value {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
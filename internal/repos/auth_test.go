@@ -0,0 +1,236 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+func TestValidateAuthConfig(t *testing.T) {
+	tests := []struct {
+		json   string
+		expErr string
+	}{
+		{`{}`, ""},
+		{`{"auth":{"bearer":"token"}}`, ""},
+		{`{"auth":{"bearer":1}}`, "must be a string"},
+		{`{"auth":"token"}`, "must be a map"},
+		{`{"auth":{"oauth2":{"tokenUrl":"https://auth.example.com/token","clientId":"id","clientSecret":"secret"}}}`, ""},
+		{`{"auth":{"oauth2":{"tokenUrl":"https://auth.example.com/token","clientId":"id","clientSecret":"secret","scopes":"a b","audience":"x"}}}`, ""},
+		{`{"auth":{"oauth2":{"tokenUrl":"https://auth.example.com/token","clientId":"id","clientSecret":"secret","scopes":[1]}}}`, "list of strings"},
+		{`{"auth":{"oauth2":{"tokenUrl":"auth.example.com/token","clientId":"id","clientSecret":"secret"}}}`, "http or https URL"},
+		{`{"auth":{"oauth2":{"tokenUrl":"https://auth.example.com/token","clientId":"id"}}}`, "must have strings"},
+		{`{"auth":{"oauth2":"secret"}}`, "must be a map"},
+		{`{"auth":{"basic":{"username":"user","password":"secret"}}}`, ""},
+		{`{"auth":{"basic":{"username":"user","password":""}}}`, ""},
+		{`{"auth":{"basic":{"username":"","password":"secret"}}}`, "must have strings"},
+		{`{"auth":{"basic":"user:secret"}}`, "must be a map"},
+		{`{"auth":{"headers":{"X-API-Key":"secret","PRIVATE-TOKEN":"glpat"}}}`, ""},
+		{`{"auth":{"headers":{}}}`, "must not be empty"},
+		{`{"auth":{"headers":{"X-API-Key":1}}}`, "valid header names"},
+		{`{"auth":{"headers":{"X API Key":"secret"}}}`, "valid header names"},
+		{`{"auth":{"headers":{"X-API-Key":"secret\r\nX-Injected: 1"}}}`, "valid header names"},
+		{`{"auth":{"credentialHelper":"git credential fill"}}`, ""},
+		{`{"auth":{"credentialHelper":{"command":"pass show token","header":"PRIVATE-TOKEN"}}}`, ""},
+		{`{"auth":{"credentialHelper":""}}`, "non-empty string"},
+		{`{"auth":{"credentialHelper":{"header":"PRIVATE-TOKEN"}}}`, "non-empty string"},
+		{`{"auth":{"credentialHelper":{"command":"pass show token","header":"PRIVATE:TOKEN"}}}`, "must be a header name"},
+		{`{"auth":{"credentialHelper":["pass"]}}`, "string or a map"},
+	}
+	for i, test := range tests {
+		var rc map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(test.json), &rc))
+		err := validateAuthConfig(rc)
+		if test.expErr == "" {
+			assert.NoError(t, err, "test %d", i)
+		} else {
+			assert.ErrorContains(t, err, test.expErr, "test %d", i)
+		}
+	}
+}
+
+// newAuthTestServer starts a server which answers with a TM if check accepts the request and with 401 otherwise
+func newAuthTestServer(t *testing.T, check func(r *http.Request) bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !check(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": sqliteTestId1})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newAuthTestRepo(t *testing.T, loc string, auth map[string]any) *HttpRepo {
+	r, err := NewHttpRepo(map[string]any{"type": "http", "loc": loc, "auth": auth}, model.NewRepoSpec("http"))
+	assert.NoError(t, err)
+	return r
+}
+
+func TestHttpRepo_BasicAuth(t *testing.T) {
+	srv := newAuthTestServer(t, func(r *http.Request) bool {
+		u, p, ok := r.BasicAuth()
+		return ok && u == "reader" && p == "s3:cr3t"
+	})
+
+	r := newAuthTestRepo(t, srv.URL, map[string]any{"basic": map[string]any{"username": "reader", "password": "s3:cr3t"}})
+	_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+	assert.NoError(t, err)
+
+	r = newAuthTestRepo(t, srv.URL, map[string]any{"basic": map[string]any{"username": "reader", "password": "wrong"}})
+	_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+	assert.Error(t, err)
+}
+
+func TestHttpRepo_HeadersAuth(t *testing.T) {
+	srv := newAuthTestServer(t, func(r *http.Request) bool {
+		return r.Header.Get("PRIVATE-TOKEN") == "glpat-123" && r.Header.Get("X-Tenant") == "acme" && r.Header.Get("Authorization") == ""
+	})
+
+	r := newAuthTestRepo(t, srv.URL, map[string]any{"headers": map[string]any{"PRIVATE-TOKEN": "glpat-123", "X-Tenant": "acme"}})
+	_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+	assert.NoError(t, err)
+}
+
+func TestHttpRepo_AuthNotSentOnCrossHostRedirect(t *testing.T) {
+	var got http.Header
+	other := newAuthTestServer(t, func(r *http.Request) bool {
+		got = r.Header.Clone()
+		return true
+	})
+	// the same server under a different host name
+	otherLoc := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cross/" + sqliteTestId1:
+			http.Redirect(w, r, otherLoc+"/"+sqliteTestId1, http.StatusFound)
+		case "/same/" + sqliteTestId1:
+			http.Redirect(w, r, "/"+sqliteTestId1, http.StatusFound)
+		default:
+			got = r.Header.Clone()
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": sqliteTestId1})
+		}
+	}))
+	defer srv.Close()
+	auth := map[string]any{"headers": map[string]any{"PRIVATE-TOKEN": "glpat-123", "X-Tenant": "acme"}}
+
+	t.Run("cross host", func(t *testing.T) {
+		r := newAuthTestRepo(t, srv.URL+"/cross", auth)
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Empty(t, got.Get("PRIVATE-TOKEN"))
+		assert.Empty(t, got.Get("X-Tenant"))
+	})
+	t.Run("cross host with bearer", func(t *testing.T) {
+		r := newAuthTestRepo(t, srv.URL+"/cross", map[string]any{"bearer": "token123"})
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Empty(t, got.Get("Authorization"))
+	})
+	t.Run("same host", func(t *testing.T) {
+		r := newAuthTestRepo(t, srv.URL+"/same", auth)
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Equal(t, "glpat-123", got.Get("PRIVATE-TOKEN"))
+		assert.Equal(t, "acme", got.Get("X-Tenant"))
+	})
+}
+
+func TestHttpRepo_CredentialHelperAuth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test helpers are shell scripts")
+	}
+	// writeHelper writes a helper script which logs its input and counts its runs in dir. out is printed by the helper,
+	// with %d replaced by the number of the run
+	writeHelper := func(t *testing.T, out string) (string, string) {
+		dir := t.TempDir()
+		script := filepath.Join(dir, "helper.sh")
+		content := fmt.Sprintf(`#!/bin/sh
+cat > %[1]s/input
+echo run >> %[1]s/runs
+n=$(wc -l < %[1]s/runs | tr -d ' ')
+printf '%[2]s\n' "$n"
+`, dir, out)
+		assert.NoError(t, os.WriteFile(script, []byte(content), 0700))
+		return script, dir
+	}
+	runs := func(dir string) int {
+		b, _ := os.ReadFile(filepath.Join(dir, "runs"))
+		return strings.Count(string(b), "\n")
+	}
+
+	t.Run("bearer token is cached", func(t *testing.T) {
+		helper, dir := writeHelper(t, "token-%s")
+		srv := newAuthTestServer(t, func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer token-1" })
+		for i := 0; i < 2; i++ {
+			r := newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": helper})
+			_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 1, runs(dir))
+		input, _ := os.ReadFile(filepath.Join(dir, "input"))
+		assert.Equal(t, fmt.Sprintf("protocol=http\nhost=%s\n\n", srv.Listener.Addr().String()), string(input))
+	})
+	t.Run("secret in header", func(t *testing.T) {
+		helper, _ := writeHelper(t, "glpat-%s")
+		srv := newAuthTestServer(t, func(r *http.Request) bool { return r.Header.Get("PRIVATE-TOKEN") == "glpat-1" })
+		r := newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": map[string]any{"command": helper, "header": "PRIVATE-TOKEN"}})
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+	})
+	t.Run("git credential format", func(t *testing.T) {
+		helper, _ := writeHelper(t, "protocol=http\\nusername=reader\\npassword=secret-%s")
+		srv := newAuthTestServer(t, func(r *http.Request) bool {
+			u, p, ok := r.BasicAuth()
+			return ok && u == "reader" && p == "secret-1"
+		})
+		r := newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": helper})
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+	})
+	t.Run("asked again on 401", func(t *testing.T) {
+		helper, dir := writeHelper(t, "token-%s")
+		srv := newAuthTestServer(t, func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer token-2" })
+		r := newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": helper})
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs(dir))
+	})
+	t.Run("failing helper", func(t *testing.T) {
+		srv := newAuthTestServer(t, func(r *http.Request) bool { return true })
+		r := newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": "echo 'no credentials for you' >&2; exit 1"})
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.ErrorContains(t, err, "no credentials for you")
+
+		r = newAuthTestRepo(t, srv.URL, map[string]any{"credentialHelper": "true"})
+		_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+		assert.ErrorContains(t, err, "no credentials in output")
+	})
+}
+
+func TestParseHelperOutput(t *testing.T) {
+	tests := []struct {
+		out string
+		exp helperCredentials
+	}{
+		{"secret\n", helperCredentials{secret: "secret"}},
+		{"\n  c2VjcmV0== \r\nignored\n", helperCredentials{secret: "c2VjcmV0=="}},
+		{"protocol=https\nhost=example.com\nusername=user\npassword=pass=word\n", helperCredentials{username: "user", secret: "pass=word"}},
+		{"password=token\n", helperCredentials{secret: "token"}},
+		{"", helperCredentials{}},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.exp, *parseHelperOutput([]byte(test.out)), "test %d", i)
+	}
+}
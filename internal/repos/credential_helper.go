@@ -0,0 +1,204 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	KeyCredentialHelperCommand = "command"
+	KeyCredentialHelperHeader  = "header"
+
+	// credentialHelperTimeout is how long a credential helper may take to answer
+	credentialHelperTimeout = 30 * time.Second
+)
+
+var (
+	credentialHelperCacheMu sync.Mutex
+	// credentialHelperCache holds the credentials supplied by credential helpers per helper and host. The helper is
+	// run once per process and host, because repos are created anew for every operation
+	credentialHelperCache = map[credentialHelperKey]*credentialHelperEntry{}
+)
+
+// credentialHelperConfig is the config of an external command which supplies the credentials for a repo
+type credentialHelperConfig struct {
+	command string
+	// header is the name of the header to send the secret in. If empty, the secret is sent as bearer token
+	header string
+}
+
+type credentialHelperKey struct {
+	conf     credentialHelperConfig
+	protocol string
+	host     string
+}
+
+type credentialHelperEntry struct {
+	mu          sync.Mutex
+	credentials *helperCredentials
+}
+
+// helperCredentials are the credentials printed by a credential helper. If username is not empty, they are used for
+// basic auth
+type helperCredentials struct {
+	username string
+	secret   string
+}
+
+// parseCredentialHelperConfig reads the "credentialHelper" section of a repo's auth config, which is either the
+// command or a map with "command" and optionally "header"
+func parseCredentialHelperConfig(v any) (credentialHelperConfig, error) {
+	var c credentialHelperConfig
+	switch conf := v.(type) {
+	case string:
+		c.command = conf
+	case map[string]any:
+		if cmd := utils.JsGetString(conf, KeyCredentialHelperCommand); cmd != nil {
+			c.command = *cmd
+		}
+		if h, ok := conf[KeyCredentialHelperHeader]; ok {
+			hs, isStr := h.(string)
+			if !isStr || !validHeader(hs, "") {
+				return c, fmt.Errorf("invalid credential helper config. %q must be a header name", KeyCredentialHelperHeader)
+			}
+			c.header = hs
+		}
+	default:
+		return c, fmt.Errorf("invalid auth config. %s must be a string or a map", AuthKindCredentialHelper)
+	}
+	if strings.TrimSpace(c.command) == "" {
+		return c, fmt.Errorf("invalid credential helper config. must have non-empty string %q", KeyCredentialHelperCommand)
+	}
+	return c, nil
+}
+
+// credentialHelperAuth authenticates requests with the credentials printed by an external command, similar to git
+// credential helpers.
+// The command is run by the shell and receives the protocol and host of the request on stdin in the format of
+// git credential helpers, so that e.g. 'git credential fill' can be used as the command. It prints either just the
+// secret or 'username=...' and 'password=...' lines. With a username, the credentials are used for basic auth.
+// Otherwise, the secret is sent in the configured header, or as bearer token if there is none
+type credentialHelperAuth struct {
+	conf credentialHelperConfig
+}
+
+func newCredentialHelperAuth(v any) (*credentialHelperAuth, error) {
+	c, err := parseCredentialHelperConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialHelperAuth{conf: c}, nil
+}
+
+func (c *credentialHelperAuth) authorize(req *http.Request) error {
+	e := c.entry(req.URL)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.credentials == nil {
+		creds, err := c.run(req.Context(), req.URL)
+		if err != nil {
+			return err
+		}
+		e.credentials = creds
+	}
+	switch {
+	case e.credentials.username != "":
+		req.SetBasicAuth(e.credentials.username, e.credentials.secret)
+	case c.conf.header != "":
+		req.Header.Set(c.conf.header, e.credentials.secret)
+	default:
+		req.Header.Set("Authorization", "Bearer "+e.credentials.secret)
+	}
+	return nil
+}
+
+// renew drops the cached credentials, so that the helper is asked once more
+func (c *credentialHelperAuth) renew(req *http.Request) bool {
+	e := c.entry(req.URL)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.credentials = nil
+	return true
+}
+
+func (c *credentialHelperAuth) entry(u *url.URL) *credentialHelperEntry {
+	key := credentialHelperKey{conf: c.conf, protocol: u.Scheme, host: u.Host}
+	credentialHelperCacheMu.Lock()
+	defer credentialHelperCacheMu.Unlock()
+	e, ok := credentialHelperCache[key]
+	if !ok {
+		e = &credentialHelperEntry{}
+		credentialHelperCache[key] = e
+	}
+	return e
+}
+
+// run runs the credential helper for the host of u and parses its output
+func (c *credentialHelperAuth) run(ctx context.Context, u *url.URL) (*helperCredentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.conf.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.conf.command)
+	}
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", u.Scheme, u.Host))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("credential helper failed: %w", err)
+	}
+	creds := parseHelperOutput(stdout.Bytes())
+	if creds.secret == "" {
+		return nil, errors.New("credential helper failed: no credentials in output")
+	}
+	return creds, nil
+}
+
+// parseHelperOutput reads the credentials from the output of a credential helper, which is either in the format of git
+// credential helpers or just the secret on the first non-empty line
+func parseHelperOutput(out []byte) *helperCredentials {
+	var creds helperCredentials
+	var first string
+	isKeyValue := false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if first == "" {
+			first = strings.TrimSpace(line)
+		}
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch k {
+		case "username":
+			creds.username = v
+		case "password":
+			creds.secret = v
+			isKeyValue = true
+		}
+	}
+	if !isKeyValue {
+		return &helperCredentials{secret: first}
+	}
+	return &creds
+}
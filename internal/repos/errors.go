@@ -15,6 +15,8 @@ var (
 	ErrTmNotFound              = errors.New("TM not found")
 	ErrInvalidErrorCode        = errors.New("invalid error code")
 	ErrInvalidCompletionParams = errors.New("invalid completion parameters")
+	ErrBulkPushNotSupported    = errors.New("repo does not support pushing in bulk")
+	ErrAtomicPushNotSupported  = errors.New("repo does not support atomic push")
 )
 
 type ErrTMIDConflict struct {
@@ -7,15 +7,17 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/gofrs/flock"
 	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/tracing"
 	"github.com/wot-oss/tmc/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -24,6 +26,7 @@ const (
 	indexLockTimeout       = 5 * time.Second
 	indexLocRetryDelay     = 13 * time.Millisecond
 	errTmExistsPrefix      = "Thing Model already exists under id: "
+	stagingDirPrefix       = "staging-"
 
 	TMExt = ".tm.json"
 )
@@ -37,6 +40,8 @@ var osReadFile = os.ReadFile // mockable for testing
 type FileRepo struct {
 	root string
 	spec model.RepoSpec
+	// locker is the locker configured for the repo. nil means the default flock is used
+	locker IndexLocker
 }
 
 func NewFileRepo(config map[string]any, spec model.RepoSpec) (*FileRepo, error) {
@@ -48,9 +53,17 @@ func NewFileRepo(config map[string]any, spec model.RepoSpec) (*FileRepo, error)
 	if err != nil {
 		return nil, err
 	}
+	var locker IndexLocker
+	if _, ok := config[KeyRepoLock]; ok {
+		locker, err = newIndexLocker(config, filepath.Join(rootPath, RepoConfDir, IndexFilename))
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &FileRepo{
-		root: rootPath,
-		spec: spec,
+		root:   rootPath,
+		spec:   spec,
+		locker: locker,
 	}, nil
 }
 
@@ -68,10 +81,10 @@ func (f *FileRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
 	match, existingId := f.getExistingID(idS)
 	switch match {
 	case idMatchDigest:
-		slog.Default().Info(fmt.Sprintf("Same TM content already exists under ID %v", existingId))
+		utils.Logger(ctx).Info(fmt.Sprintf("Same TM content already exists under ID %v", existingId))
 		return &ErrTMIDConflict{Type: IdConflictSameContent, ExistingId: existingId}
 	case idMatchTimestamp:
-		slog.Default().Info(fmt.Sprintf("Version and timestamp clash with existing %v", existingId))
+		utils.Logger(ctx).Info(fmt.Sprintf("Version and timestamp clash with existing %v", existingId))
 		return &ErrTMIDConflict{Type: IdConflictSameTimestamp, ExistingId: existingId}
 	}
 
@@ -79,11 +92,93 @@ func (f *FileRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
 	if err != nil {
 		return fmt.Errorf("could not write TM to catalog: %v", err)
 	}
-	slog.Default().Info("saved Thing Model file", "filename", fullPath)
+	utils.Logger(ctx).Info("saved Thing Model file", "filename", fullPath)
 
 	return nil
 }
 
+// PushAtomic writes all TMs to a staging directory below the repo's config directory first, then moves them into
+// place and updates the index, while holding the index lock. If any step fails, all TMs already moved are removed again
+func (f *FileRepo) PushAtomic(ctx context.Context, tms []AtomicPushItem) ([]string, error) {
+	unlock, err := f.lockIndex(ctx)
+	defer unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]string, len(tms))
+	for i, tm := range tms {
+		if len(tm.Raw) == 0 {
+			return nil, fmt.Errorf("nothing to write for %s", tm.ID.String())
+		}
+		match, existingId := f.getExistingID(tm.ID.String())
+		switch match {
+		case idMatchFull, idMatchDigest:
+			existing[i] = existingId
+		case idMatchTimestamp:
+			return nil, &ErrTMIDConflict{Type: IdConflictSameTimestamp, ExistingId: existingId}
+		}
+	}
+
+	stagingDir, err := os.MkdirTemp(filepath.Join(f.root, RepoConfDir), stagingDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	for i, tm := range tms {
+		if existing[i] != "" {
+			continue
+		}
+		staged := filepath.Join(stagingDir, tm.ID.String())
+		err := os.MkdirAll(filepath.Dir(staged), defaultDirPermissions)
+		if err != nil {
+			return nil, fmt.Errorf("could not stage %s: %w", tm.ID.String(), err)
+		}
+		err = os.WriteFile(staged, tm.Raw, defaultFilePermissions)
+		if err != nil {
+			return nil, fmt.Errorf("could not stage %s: %w", tm.ID.String(), err)
+		}
+	}
+
+	var committed []string
+	rollback := func() {
+		for _, id := range committed {
+			fullPath, dir, _ := f.filenames(id)
+			_ = os.Remove(fullPath)
+			_ = rmEmptyDirs(dir, f.root)
+		}
+	}
+	for i, tm := range tms {
+		if existing[i] != "" {
+			continue
+		}
+		id := tm.ID.String()
+		fullPath, dir, _ := f.filenames(id)
+		err := os.MkdirAll(dir, defaultDirPermissions)
+		if err == nil {
+			err = os.Rename(filepath.Join(stagingDir, id), fullPath)
+		}
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("could not commit %s, rolled back all TMs: %w", id, err)
+		}
+		committed = append(committed, id)
+	}
+
+	if len(committed) > 0 {
+		err = f.updateIndexLocked(ctx, committed)
+		if err != nil {
+			rollback()
+			// remove rolled back TMs from index, in case the index has been written before the error occurred
+			_ = f.updateIndexLocked(context.Background(), committed)
+			return nil, fmt.Errorf("could not update index, rolled back all TMs: %w", err)
+		}
+	}
+	utils.Logger(ctx).Info("saved Thing Model files atomically", "count", len(committed))
+	return existing, nil
+}
+
 func (f *FileRepo) Delete(ctx context.Context, id string) error {
 	err := f.checkRootValid()
 	if err != nil {
@@ -154,7 +249,7 @@ const (
 )
 
 func (f *FileRepo) getExistingID(ids string) (idMatch, string) {
-	fullName, dir, base := f.filenames(ids)
+	fullName, dir, _ := f.filenames(ids)
 	// try full repoName as given
 	if _, err := os.Stat(fullName); err == nil {
 		return idMatchFull, ids
@@ -164,12 +259,25 @@ func (f *FileRepo) getExistingID(ids string) (idMatch, string) {
 	if err != nil {
 		return idMatchNone, ""
 	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return matchExistingVersion(ids, names)
+}
+
+// matchExistingVersion determines how the TM id ids matches one of the TM files in its directory, given by their base names.
+// The full id is expected to have been checked for existence already
+func matchExistingVersion(ids string, names []string) (idMatch, string) {
+	base := path.Base(ids)
 	version, err := model.ParseTMVersion(strings.TrimSuffix(base, TMExt))
 	if err != nil {
 		slog.Default().Error("invalid TM version in TM id", "id", ids, "error", err)
 		return idMatchNone, ""
 	}
-	existingTMVersions := findTMFileEntriesByBaseVersion(entries, version)
+	existingTMVersions := findTMFileEntriesByBaseVersion(names, version)
 	if len(existingTMVersions) > 0 {
 		if existingTMVersions[0].Hash == version.Hash {
 			return idMatchDigest,
@@ -186,18 +294,14 @@ func (f *FileRepo) getExistingID(ids string) (idMatch, string) {
 	return idMatchNone, ""
 }
 
-// findTMFileEntriesByBaseVersion finds directory entries that correspond to TM file names, converts those to TMVersions,
+// findTMFileEntriesByBaseVersion finds file names that correspond to TM file names, converts those to TMVersions,
 // filters out those that have a differing base version from the one given as argument, and sorts the remaining in
 // descending order
-func findTMFileEntriesByBaseVersion(entries []os.DirEntry, version model.TMVersion) []model.TMVersion {
+func findTMFileEntriesByBaseVersion(names []string, version model.TMVersion) []model.TMVersion {
 	baseString := version.BaseString()
 	var res []model.TMVersion
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-
-		ver, err := model.ParseTMVersion(strings.TrimSuffix(e.Name(), TMExt))
+	for _, n := range names {
+		ver, err := model.ParseTMVersion(strings.TrimSuffix(n, TMExt))
 		if err != nil {
 			continue
 		}
@@ -248,7 +352,7 @@ func (f *FileRepo) Spec() model.RepoSpec {
 }
 
 func (f *FileRepo) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, error) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	log.Debug(fmt.Sprintf("Creating list with filter '%v'", search))
 
 	err := f.checkRootValid()
@@ -270,7 +374,7 @@ func (f *FileRepo) List(ctx context.Context, search *model.SearchParams) (model.
 	return model.NewIndexToFoundMapper(f.Spec().ToFoundSource()).ToSearchResult(idx), nil
 }
 
-// readIndex reads the contents of the index file. Must be called after the lock is acquired with lockIndex()
+// readIndex reads the contents of the index file and applies the index journal. Must be called after the lock is acquired with lockIndex()
 func (f *FileRepo) readIndex() (model.Index, error) {
 	data, err := os.ReadFile(f.indexFilename())
 	if err != nil {
@@ -279,7 +383,15 @@ func (f *FileRepo) readIndex() (model.Index, error) {
 
 	var index model.Index
 	err = json.Unmarshal(data, &index)
-	return index, err
+	if err != nil {
+		return index, err
+	}
+	journal, err := f.readJournal()
+	if err != nil {
+		return index, err
+	}
+	applyIndexJournal(&index, journal)
+	return index, nil
 }
 
 func (f *FileRepo) indexFilename() string {
@@ -287,7 +399,7 @@ func (f *FileRepo) indexFilename() string {
 }
 
 func (f *FileRepo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	name = strings.TrimSpace(name)
 	res, err := f.List(ctx, &model.SearchParams{Name: name})
 	if err != nil {
@@ -341,6 +453,10 @@ func createFileRepoConfig(dirName string, bytes []byte) (map[string]any, error)
 			return nil, err
 		}
 		rc[KeyRepoLoc] = la
+		err = validateLockConfig(rc, LockKindFlock, LockKindLease, LockKindDB)
+		if err != nil {
+			return nil, err
+		}
 		return rc, nil
 	}
 }
@@ -361,32 +477,67 @@ func makeAbs(dir string) (string, error) {
 }
 
 func (f *FileRepo) updateIndex(ctx context.Context, ids []string) error {
+	cancel, err := f.lockIndex(ctx)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return f.updateIndexLocked(ctx, ids)
+}
+
+// updateIndexLocked updates the index. Must be called after the lock is acquired with lockIndex().
+// A full rebuild rewrites the index file. A partial update only appends the changes to the index journal, so that its
+// cost does not grow with the size of the catalog, unless there is no index file yet
+func (f *FileRepo) updateIndexLocked(ctx context.Context, ids []string) (err error) {
 	// Prepare data collection for logging stats
-	var log = slog.Default()
-	fileCount := 0
+	var log = utils.Logger(ctx)
 	start := time.Now()
 
-	cancel, err := f.lockIndex(ctx)
-	defer cancel()
+	var fileCount int
+	if _, statErr := os.Stat(f.indexFilename()); len(ids) > 0 && statErr == nil {
+		ctx, span := tracing.Start(ctx, "FileRepo.journalIndexUpdates", tracing.AttrRepo.String(repoName(f)))
+		fileCount, err = f.journalIndexUpdates(ctx, ids)
+		span.SetAttributes(attribute.Int("tmc.files", fileCount))
+		tracing.End(span, err)
+	} else {
+		ctx, span := tracing.Start(ctx, "FileRepo.writeNewIndex", tracing.AttrRepo.String(repoName(f)),
+			attribute.Bool("tmc.full", len(ids) == 0))
+		fileCount, err = f.writeNewIndex(ctx, ids)
+		span.SetAttributes(attribute.Int("tmc.files", fileCount))
+		tracing.End(span, err)
+	}
 	if err != nil {
 		return err
 	}
+	duration := time.Now().Sub(start)
+	msg := "Updated index with %d entries in %s "
+	msg = fmt.Sprintf(msg, fileCount, duration.String())
+	log.Info(msg)
+	return nil
+}
 
-	var newIndex *model.Index
-	names := f.readNamesFile()
+// writeNewIndex creates a new index from all TM files in the repo, or from the TM files with given ids only,
+// and writes it to the index file. Returns the number of TM files indexed
+func (f *FileRepo) writeNewIndex(ctx context.Context, ids []string) (int, error) {
+	var log = utils.Logger(ctx)
+	fileCount := 0
+	newIndex := &model.Index{
+		Meta: model.IndexMeta{Created: time.Now()},
+		Data: []*model.IndexEntry{},
+	}
+	var names []string
 
 	if len(ids) == 0 { // full rebuild
-		newIndex = &model.Index{
-			Meta: model.IndexMeta{Created: time.Now()},
-			Data: []*model.IndexEntry{},
-		}
-		names = nil
 		err := filepath.Walk(f.root, func(path string, info os.FileInfo, err error) error {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
 			default:
 			}
+			if err == nil && info.IsDir() && path == filepath.Join(f.root, RepoConfDir) {
+				// skip repo's own files, including staged TMs
+				return filepath.SkipDir
+			}
 			upd, name, _, err := f.updateIndexWithFile(newIndex, path, info, log, err)
 			if err != nil {
 				return err
@@ -398,30 +549,21 @@ func (f *FileRepo) updateIndex(ctx context.Context, ids []string) error {
 			return nil
 		})
 		if err != nil {
-			return err
-		}
-
-	} else { // partial update
-		index, err := f.readIndex()
-		if err != nil {
-			newIndex = &model.Index{
-				Meta: model.IndexMeta{Created: time.Now()},
-				Data: []*model.IndexEntry{},
-			}
-		} else {
-			newIndex = &index
+			return 0, err
 		}
+	} else { // partial update without an existing index
+		names = f.readNamesFile()
 		for _, id := range ids {
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return 0, ctx.Err()
 			default:
 			}
 			path := filepath.Join(f.root, id)
 			info, statErr := osStat(path)
 			upd, name, nameDeleted, err := f.updateIndexWithFile(newIndex, path, info, log, statErr)
 			if err != nil {
-				return err
+				return 0, err
 			}
 			if upd {
 				fileCount++
@@ -435,22 +577,104 @@ func (f *FileRepo) updateIndex(ctx context.Context, ids []string) error {
 			}
 		}
 	}
-	duration := time.Now().Sub(start)
-	// Ignore error as we are sure our struct does not contain channel,
-	// complex or function values that would throw an error.
-	newIndexJson, _ := json.MarshalIndent(newIndex, "", "  ")
-	err = utils.AtomicWriteFile(f.indexFilename(), newIndexJson, defaultFilePermissions)
+	err := f.writeIndex(newIndex)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	return fileCount, f.writeNamesFile(names)
+}
+
+// journalIndexUpdates appends the changes of the TM files with given ids to the index journal, without reading or
+// rewriting the index file. The journal is merged into the index file once it has grown beyond
+// indexJournalCompactSize or the index file has not been written for indexJournalCompactAge. Returns the number of
+// changes recorded
+func (f *FileRepo) journalIndexUpdates(ctx context.Context, ids []string) (int, error) {
+	var log = utils.Logger(ctx)
+	names := f.readNamesFile()
+	namesChanged := false
+	var recs []indexJournalRecord
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+		}
+		path := filepath.Join(f.root, id)
+		info, statErr := osStat(path)
+		if os.IsNotExist(statErr) {
+			name, found := strings.CutSuffix(id, "/"+filepath.Base(id))
+			if !found {
+				return 0, model.ErrInvalidId
+			}
+			recs = append(recs, indexJournalRecord{Op: journalOpDelete, ID: id})
+			if !f.hasTMFiles(name) && slices.Contains(names, name) {
+				names = slices.DeleteFunc(names, func(s string) bool {
+					return s == name
+				})
+				namesChanged = true
+			}
+			continue
+		}
+		if statErr != nil {
+			return 0, statErr
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), TMExt) {
+			continue
+		}
+		thingMeta, ok := readIndexableMetadata(path, log)
+		if !ok {
+			continue
+		}
+		tmid, err := model.ParseTMID(thingMeta.ID)
+		if err != nil {
+			log.Error(fmt.Sprintf("Failed to insert %s into index:", path))
+			log.Error(err.Error())
+			log.Error("The file will be excluded from index")
+			continue
+		}
+		recs = append(recs, indexJournalRecord{Op: journalOpInsert, TM: &thingMeta})
+		if !slices.Contains(names, tmid.Name) {
+			names = append(names, tmid.Name)
+			namesChanged = true
+		}
 	}
-	err = f.writeNamesFile(names)
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	size, err := f.appendJournal(recs)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	msg := "Updated index with %d entries in %s "
-	msg = fmt.Sprintf(msg, fileCount, duration.String())
-	log.Info(msg)
-	return nil
+	if namesChanged {
+		err = f.writeNamesFile(names)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if size > indexJournalCompactSize || f.indexOlderThan(indexJournalCompactAge) {
+		err = f.compactIndex()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(recs), nil
+}
+
+// indexOlderThan returns true if the index file has not been written for longer than d
+func (f *FileRepo) indexOlderThan(d time.Duration) bool {
+	stat, err := os.Stat(f.indexFilename())
+	return err == nil && time.Since(stat.ModTime()) > d
+}
+
+// hasTMFiles returns true if the directory of the TM name contains any TM files
+func (f *FileRepo) hasTMFiles(name string) bool {
+	entries, err := os.ReadDir(filepath.Join(f.root, name))
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(entries, func(e os.DirEntry) bool {
+		return !e.IsDir() && strings.HasSuffix(e.Name(), TMExt)
+	})
 }
 
 func (f *FileRepo) updateIndexWithFile(idx *model.Index, path string, info os.FileInfo, log *slog.Logger, err error) (updated bool, addedName string, deletedName string, errr error) {
@@ -469,13 +693,8 @@ func (f *FileRepo) updateIndexWithFile(idx *model.Index, path string, info os.Fi
 	if info.IsDir() || !strings.HasSuffix(info.Name(), TMExt) {
 		return false, "", "", nil
 	}
-	thingMeta, err := getThingMetadata(path)
-	if err != nil {
-		msg := "Failed to extract metadata from file %s with error:"
-		msg = fmt.Sprintf(msg, path)
-		log.Error(msg)
-		log.Error(err.Error())
-		log.Error("The file will be excluded from the table of contents.")
+	thingMeta, ok := readIndexableMetadata(path, log)
+	if !ok {
 		return false, "", "", nil
 	}
 	tmid, err := idx.Insert(&thingMeta)
@@ -490,7 +709,10 @@ func (f *FileRepo) updateIndexWithFile(idx *model.Index, path string, info os.Fi
 
 type unlockFunc func()
 
-func (f *FileRepo) lockIndex(ctx context.Context) (unlockFunc, error) {
+func (f *FileRepo) lockIndex(ctx context.Context) (_ unlockFunc, err error) {
+	_, span := tracing.Start(ctx, "FileRepo.lockIndex", tracing.AttrRepo.String(repoName(f)))
+	defer func() { tracing.End(span, err) }()
+
 	rd := filepath.Join(f.root, RepoConfDir)
 	stat, err := os.Stat(rd)
 	if err != nil || !stat.IsDir() {
@@ -501,19 +723,14 @@ func (f *FileRepo) lockIndex(ctx context.Context) (unlockFunc, error) {
 	}
 	idxFile := f.indexFilename()
 
-	fl := flock.New(idxFile + ".lock")
-	ctx, cancel := context.WithTimeout(ctx, indexLockTimeout)
-	unlock := func() {
-		cancel()
-		_ = fl.Unlock()
+	locker := f.locker
+	if locker == nil {
+		locker = &flockLocker{file: idxFile + ".lock", timeout: lockTimeout(nil)}
 	}
-	locked, err := fl.TryLockContext(ctx, indexLocRetryDelay)
+	unlock, err := locker.Lock(ctx)
 	if err != nil {
 		return unlock, err
 	}
-	if !locked {
-		return unlock, ErrIndexLocked
-	}
 
 	f.moveOldIndex(idxFile)
 
@@ -542,6 +759,21 @@ func (f *FileRepo) writeNamesFile(names []string) error {
 	return utils.WriteFileLines(names, filepath.Join(f.root, RepoConfDir, TmNamesFile), defaultFilePermissions)
 }
 
+// readIndexableMetadata reads the metadata needed for the index from the TM file at path. Returns false, if the
+// metadata cannot be read and the file must be excluded from the index
+func readIndexableMetadata(path string, log *slog.Logger) (model.ThingModel, bool) {
+	thingMeta, err := getThingMetadata(path)
+	if err != nil {
+		msg := "Failed to extract metadata from file %s with error:"
+		msg = fmt.Sprintf(msg, path)
+		log.Error(msg)
+		log.Error(err.Error())
+		log.Error("The file will be excluded from the table of contents.")
+		return model.ThingModel{}, false
+	}
+	return thingMeta, true
+}
+
 func getThingMetadata(path string) (model.ThingModel, error) {
 	data, err := osReadFile(path)
 	if err != nil {
@@ -0,0 +1,161 @@
+package repos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	journalOpInsert = "insert"
+	journalOpDelete = "delete"
+)
+
+var (
+	// indexJournalCompactSize is the size in bytes above which the index journal is merged into the index file
+	indexJournalCompactSize int64 = 1 << 20
+	// indexJournalCompactAge is the time since the index file has last been written after which the index journal is
+	// merged into it by the next update, so that clients reading only the index file do not miss TMs for long
+	indexJournalCompactAge = 5 * time.Minute
+)
+
+// indexJournalRecord is a line of the index journal. It records either the insertion of a TM into the index, with the
+// metadata needed for the index, or the deletion of a TM id from the index.
+// Replaying the records is idempotent, so that records which have been merged into the index already do no harm
+type indexJournalRecord struct {
+	Op string            `json:"op"`
+	ID string            `json:"id,omitempty"`
+	TM *model.ThingModel `json:"tm,omitempty"`
+}
+
+// applyIndexJournal replays the records of the index journal in data onto idx. Records which cannot be read, like a
+// last line left incomplete by a crashed writer, are skipped
+func applyIndexJournal(idx *model.Index, data []byte) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec indexJournalRecord
+		err := json.Unmarshal(line, &rec)
+		if err == nil {
+			switch {
+			case rec.Op == journalOpInsert && rec.TM != nil:
+				_, err = idx.Insert(rec.TM)
+			case rec.Op == journalOpDelete:
+				_, _, err = idx.Delete(rec.ID)
+			default:
+				err = fmt.Errorf("unknown operation %q", rec.Op)
+			}
+		}
+		if err != nil {
+			slog.Default().Warn("skipping unreadable index journal record", "error", err)
+		}
+	}
+}
+
+func (f *FileRepo) journalFilename() string {
+	return filepath.Join(f.root, RepoConfDir, IndexJournalFilename)
+}
+
+// readJournal returns the contents of the index journal, or nil if there is none
+func (f *FileRepo) readJournal() ([]byte, error) {
+	data, err := os.ReadFile(f.journalFilename())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// appendJournal appends recs to the index journal and returns the new size of the journal.
+// Must be called after the lock is acquired with lockIndex()
+func (f *FileRepo) appendJournal(recs []indexJournalRecord) (int64, error) {
+	buf := bytes.NewBuffer(nil)
+	for _, rec := range recs {
+		// Ignore error as we are sure our struct does not contain channel,
+		// complex or function values that would throw an error.
+		b, _ := json.Marshal(rec)
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	file, err := os.OpenFile(f.journalFilename(), os.O_RDWR|os.O_CREATE|os.O_APPEND, defaultFilePermissions)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if stat.Size() > 0 {
+		// a writer which crashed may have left an incomplete last line. Terminate it, so that it is skipped on replay
+		// instead of corrupting the first of our records
+		last := make([]byte, 1)
+		_, err = file.ReadAt(last, stat.Size()-1)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if last[0] != '\n' {
+			buf = bytes.NewBuffer(append([]byte("\n"), buf.Bytes()...))
+		}
+	}
+	_, err = file.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	err = file.Sync()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size() + int64(buf.Len()), nil
+}
+
+// writeIndex writes idx to the index file and removes the journal, whose records are contained in idx.
+// Must be called after the lock is acquired with lockIndex()
+func (f *FileRepo) writeIndex(idx *model.Index) error {
+	// Ignore error as we are sure our struct does not contain channel,
+	// complex or function values that would throw an error.
+	idxJson, _ := json.MarshalIndent(idx, "", "  ")
+	err := utils.AtomicWriteFile(f.indexFilename(), idxJson, defaultFilePermissions)
+	if err != nil {
+		return err
+	}
+	// if removing the journal fails, its records are replayed once more onto the new index, which is harmless
+	err = os.Remove(f.journalFilename())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// compactIndex merges the index journal into the index file and rewrites the names file from the merged index.
+// Must be called after the lock is acquired with lockIndex()
+func (f *FileRepo) compactIndex() error {
+	idx, err := f.readIndex()
+	if err != nil {
+		return err
+	}
+	err = f.writeIndex(&idx)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range idx.Data {
+		names = append(names, e.Name)
+	}
+	err = f.writeNamesFile(names)
+	if err != nil {
+		return err
+	}
+	slog.Default().Info("Compacted index journal", "repo", f.spec.String())
+	return nil
+}
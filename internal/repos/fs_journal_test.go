@@ -0,0 +1,156 @@
+package repos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/testutils"
+)
+
+const (
+	journalTestId1 = "omnicorp-tm-department/omnicorp/omnilamp/v0.0.0-20240409155220-80424c65e4e6.tm.json"
+	journalTestId2 = "omnicorp-tm-department/omnicorp/omnilamp/subfolder/v0.0.0-20240409155220-80424c65e4e6.tm.json"
+)
+
+func newTestJournalRepo(t *testing.T) *FileRepo {
+	temp := t.TempDir()
+	assert.NoError(t, testutils.CopyDir("../../test/data/index", temp))
+	return &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+}
+
+func TestFileRepo_IndexJournal(t *testing.T) {
+	ctx := context.Background()
+	r := newTestJournalRepo(t)
+	// given: an index with one TM
+	assert.NoError(t, r.Index(ctx, journalTestId1))
+	assert.NoFileExists(t, r.journalFilename())
+	before, err := os.ReadFile(r.indexFilename())
+	assert.NoError(t, err)
+
+	t.Run("partial update appends to journal", func(t *testing.T) {
+		assert.NoError(t, r.Index(ctx, journalTestId2))
+		after, err := os.ReadFile(r.indexFilename())
+		assert.NoError(t, err)
+		assert.Equal(t, before, after, "index file must not be rewritten")
+		assert.FileExists(t, r.journalFilename())
+
+		idx, err := r.readIndex()
+		assert.NoError(t, err)
+		assert.Len(t, idx.Data, 2)
+		assert.Equal(t, []string{
+			"omnicorp-tm-department/omnicorp/omnilamp",
+			"omnicorp-tm-department/omnicorp/omnilamp/subfolder",
+		}, r.readNamesFile())
+	})
+	t.Run("deletion is journaled", func(t *testing.T) {
+		// given: the last TM file of a name is removed
+		assert.NoError(t, os.Remove(filepath.Join(r.root, journalTestId2)))
+		assert.NoError(t, os.Remove(filepath.Join(r.root, "omnicorp-tm-department/omnicorp/omnilamp/subfolder/v3.2.1-20240409155220-3f779458e453.tm.json")))
+		assert.NoError(t, r.Index(ctx, journalTestId2))
+		idx, err := r.readIndex()
+		assert.NoError(t, err)
+		assert.Len(t, idx.Data, 1)
+		assert.Equal(t, []string{"omnicorp-tm-department/omnicorp/omnilamp"}, r.readNamesFile())
+	})
+	t.Run("incomplete record is skipped", func(t *testing.T) {
+		f, err := os.OpenFile(r.journalFilename(), os.O_APPEND|os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, _ = f.WriteString(`{"op":"insert","tm":{"id":"omni`)
+		_ = f.Close()
+
+		// the next append must not be corrupted by the incomplete record
+		assert.NoError(t, r.Index(ctx, "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"))
+		idx, err := r.readIndex()
+		assert.NoError(t, err)
+		if assert.Len(t, idx.Data, 1) {
+			assert.Len(t, idx.Data[0].Versions, 2)
+		}
+	})
+	t.Run("full rebuild removes journal", func(t *testing.T) {
+		assert.NoError(t, r.Index(ctx))
+		assert.NoFileExists(t, r.journalFilename())
+		idx, err := r.readIndex()
+		assert.NoError(t, err)
+		if assert.Len(t, idx.Data, 1) {
+			assert.Len(t, idx.Data[0].Versions, 2)
+		}
+	})
+}
+
+func TestFileRepo_IndexJournal_Compaction(t *testing.T) {
+	defer func(s int64) { indexJournalCompactSize = s }(indexJournalCompactSize)
+	indexJournalCompactSize = 1
+	ctx := context.Background()
+	r := newTestJournalRepo(t)
+	assert.NoError(t, r.Index(ctx, journalTestId1))
+
+	// when: the journal grows beyond the compaction size
+	assert.NoError(t, r.Index(ctx, journalTestId2))
+
+	// then: the journal is merged into the index file
+	assert.NoFileExists(t, r.journalFilename())
+	idx, err := r.readIndex()
+	assert.NoError(t, err)
+	assert.Len(t, idx.Data, 2)
+}
+
+func TestFileRepo_IndexJournal_CompactionByAge(t *testing.T) {
+	ctx := context.Background()
+	r := newTestJournalRepo(t)
+	assert.NoError(t, r.Index(ctx, journalTestId1))
+
+	// given: an index file which has not been written for longer than the compaction age
+	old := time.Now().Add(-indexJournalCompactAge - time.Minute)
+	assert.NoError(t, os.Chtimes(r.indexFilename(), old, old))
+
+	// when: a TM is added
+	assert.NoError(t, r.Index(ctx, journalTestId2))
+
+	// then: the journal is merged into the index file
+	assert.NoFileExists(t, r.journalFilename())
+	idx, err := r.readIndex()
+	assert.NoError(t, err)
+	assert.Len(t, idx.Data, 2)
+}
+
+func TestFileRepo_IndexJournal_ReplayIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	r := newTestJournalRepo(t)
+	assert.NoError(t, r.Index(ctx, journalTestId1))
+	assert.NoError(t, r.Index(ctx, journalTestId2))
+	journal, err := os.ReadFile(r.journalFilename())
+	assert.NoError(t, err)
+
+	// given: the journal has been merged, but not removed, as by a process crashing during compaction
+	assert.NoError(t, r.compactIndex())
+	assert.NoError(t, os.WriteFile(r.journalFilename(), journal, defaultFilePermissions))
+
+	// then: replaying the journal once more does not change the index
+	idx, err := r.readIndex()
+	assert.NoError(t, err)
+	if assert.Len(t, idx.Data, 2) {
+		assert.Len(t, idx.Data[0].Versions, 1)
+		assert.Len(t, idx.Data[1].Versions, 1)
+	}
+}
+
+func TestFileRepo_IndexJournal_Migration(t *testing.T) {
+	ctx := context.Background()
+	r := newTestJournalRepo(t)
+	// given: an index file in the format written by previous versions, without journal
+	assert.NoError(t, os.MkdirAll(filepath.Join(r.root, RepoConfDir), defaultDirPermissions))
+	assert.NoError(t, testutils.CopyFile("../../test/data/list/tm-catalog.toc.json", r.indexFilename()))
+
+	// when: a TM is added
+	assert.NoError(t, r.Index(ctx, journalTestId2))
+
+	// then: the existing index is used as base for the journal
+	res, err := r.List(ctx, &model.SearchParams{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 4)
+}
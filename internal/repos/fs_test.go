@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"text/template"
@@ -102,6 +103,9 @@ func TestCreateFileRepoConfig(t *testing.T) {
 		{"", `{"loc":"dir/repoName"}`, filepath.Join(wd, "dir/repoName"), false},
 		{"", `{"loc":"/dir/repoName"}`, filepath.Join(filepath.VolumeName(wd), "/dir/repoName"), false},
 		{"", `{"loc":"dir/repoName", "type":"http"}`, "", true},
+		{"", `{"loc":"dir/repoName", "lock":{"kind":"lease","timeout":"10s","lease":"1m"}}`, filepath.Join(wd, "dir/repoName"), false},
+		{"", `{"loc":"dir/repoName", "lock":{"kind":"db"}}`, "", true},
+		{"", `{"loc":"dir/repoName", "lock":{"kind":"advisory"}}`, "", true},
 	}
 
 	for i, test := range tests {
@@ -215,6 +219,86 @@ func TestFileRepo_Push(t *testing.T) {
 
 }
 
+func TestFileRepo_PushAtomic(t *testing.T) {
+	ids := []string{
+		"omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json",
+		"omnicorp-tm-department/omnicorp/omnilamp/subfolder/v0.0.0-20240409155220-80424c65e4e6.tm.json",
+	}
+	var items []AtomicPushItem
+	for _, id := range ids {
+		raw, err := os.ReadFile(filepath.Join("../../test/data/index", id))
+		assert.NoError(t, err)
+		items = append(items, AtomicPushItem{ID: model.MustParseTMID(id), Raw: raw})
+	}
+	stagingLeftovers := func(t *testing.T, root string) []string {
+		m, _ := filepath.Glob(filepath.Join(root, RepoConfDir, stagingDirPrefix+"*"))
+		return m
+	}
+
+	t.Run("success", func(t *testing.T) {
+		temp := t.TempDir()
+		r := &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+		existing, err := r.PushAtomic(context.Background(), items)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"", ""}, existing)
+		for _, id := range ids {
+			assert.FileExists(t, filepath.Join(temp, id))
+		}
+		idx, err := r.readIndex()
+		assert.NoError(t, err)
+		assert.Len(t, idx.Data, 2)
+		assert.Empty(t, stagingLeftovers(t, temp))
+
+		// and: pushing the same TMs with different timestamps again skips them
+		again := slices.Clone(items)
+		again[0].ID.Version.Timestamp = "20240410155220"
+		existing, err = r.PushAtomic(context.Background(), again)
+		assert.NoError(t, err)
+		assert.Equal(t, ids, existing)
+		assert.NoFileExists(t, filepath.Join(temp, again[0].ID.String()))
+	})
+	t.Run("timestamp conflict", func(t *testing.T) {
+		temp := t.TempDir()
+		r := &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+		conflicting := filepath.Join(temp, "omnicorp-tm-department/omnicorp/omnilamp/subfolder/v0.0.0-20240409155220-00000000e4e6.tm.json")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(conflicting), defaultDirPermissions))
+		assert.NoError(t, os.WriteFile(conflicting, []byte("{}"), defaultFilePermissions))
+
+		_, err := r.PushAtomic(context.Background(), items)
+		var cErr *ErrTMIDConflict
+		assert.ErrorAs(t, err, &cErr)
+		assert.NoFileExists(t, filepath.Join(temp, ids[0]))
+		assert.Empty(t, stagingLeftovers(t, temp))
+	})
+	t.Run("rollback", func(t *testing.T) {
+		temp := t.TempDir()
+		r := &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+		// given: the target directory of the second TM is blocked by a file
+		blocker := filepath.Dir(filepath.Join(temp, ids[1]))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(blocker), defaultDirPermissions))
+		assert.NoError(t, os.WriteFile(blocker, []byte("blocker"), defaultFilePermissions))
+
+		_, err := r.PushAtomic(context.Background(), items)
+		assert.ErrorContains(t, err, "rolled back")
+		assert.NoFileExists(t, filepath.Join(temp, ids[0]))
+		_, err = r.readIndex()
+		assert.Error(t, err)
+		assert.Empty(t, stagingLeftovers(t, temp))
+	})
+}
+
+func TestFileRepo_Index_SkipsRepoConfDir(t *testing.T) {
+	temp := t.TempDir()
+	assert.NoError(t, testutils.CopyDir("../../test/data/index", filepath.Join(temp, RepoConfDir, stagingDirPrefix+"1")))
+	r := &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+
+	err := r.Index(context.Background())
+	assert.NoError(t, err)
+	idx, err := r.readIndex()
+	assert.NoError(t, err)
+	assert.Empty(t, idx.Data)
+}
+
 func TestFileRepo_List(t *testing.T) {
 	temp, _ := os.MkdirTemp("", "fr")
 	defer os.RemoveAll(temp)
@@ -0,0 +1,186 @@
+package repos
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// indexWatchDebounce is the time to wait for further changes after a change has been detected before updating the index.
+// Bursts of changes, e.g. by a git pull, result in a single index update
+var indexWatchDebounce = 500 * time.Millisecond
+
+// WatchIndex watches the repository's directory tree for TM files being added, modified, or removed by other programs
+// than tmc, e.g. git or rsync, and updates the index with the changed ids until ctx is done.
+// The index lock is respected: if the index is locked, the update is retried after the next debounce interval
+func (f *FileRepo) WatchIndex(ctx context.Context) error {
+	err := f.checkRootValid()
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	err = f.addIndexWatches(watcher, f.root, nil)
+	if err != nil {
+		return err
+	}
+	log := slog.Default().With("repo", f.spec.String())
+	log.Info("watching repository for changes", "root", f.root)
+
+	changed := map[string]struct{}{}
+	// removed holds the prefixes of the ids of removed or renamed paths, which are resolved against the index once the
+	// debounce interval has elapsed
+	removed := map[string]struct{}{}
+	timer := time.NewTimer(indexWatchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Error("error watching repository", "error", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !f.handleIndexWatchEvent(watcher, ev, changed, removed) {
+				continue
+			}
+			timer.Reset(indexWatchDebounce)
+		case <-timer.C:
+			f.addRemovedIDs(removed, changed)
+			ids := make([]string, 0, len(changed))
+			for id := range changed {
+				ids = append(ids, id)
+			}
+			if len(ids) == 0 {
+				// an empty list of ids would trigger a full rebuild
+				continue
+			}
+			slices.Sort(ids)
+			err := f.updateIndex(ctx, ids)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Warn("could not update index after changes in repository. Will retry", "error", err)
+				timer.Reset(indexWatchDebounce)
+				continue
+			}
+			clear(changed)
+		}
+	}
+}
+
+// handleIndexWatchEvent adds the ids of TM files affected by ev to changed, the id prefixes of removed paths to removed,
+// and adds watches to new directories. Returns true if ev is relevant for the index
+func (f *FileRepo) handleIndexWatchEvent(watcher *fsnotify.Watcher, ev fsnotify.Event, changed, removed map[string]struct{}) bool {
+	if f.isIgnoredPath(ev.Name) {
+		return false
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		// a removed or renamed away directory does not report its contents as removed, so they're taken from the index
+		removed[f.relativeID(ev.Name)+"/"] = struct{}{}
+		if strings.HasSuffix(ev.Name, TMExt) {
+			changed[f.relativeID(ev.Name)] = struct{}{}
+		}
+		return true
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return false
+	}
+	info, err := os.Stat(ev.Name)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		// a directory moved into the repository does not report its contents as created
+		err = f.addIndexWatches(watcher, ev.Name, changed)
+		if err != nil {
+			slog.Default().Error("could not watch new directory", "dir", ev.Name, "error", err)
+		}
+		return true
+	}
+	if !strings.HasSuffix(info.Name(), TMExt) {
+		return false
+	}
+	changed[f.relativeID(ev.Name)] = struct{}{}
+	return true
+}
+
+// addRemovedIDs adds the ids in the index which start with any of the prefixes in removed to changed, and clears removed
+func (f *FileRepo) addRemovedIDs(removed, changed map[string]struct{}) {
+	if len(removed) == 0 {
+		return
+	}
+	idx, err := f.readIndex()
+	if err == nil {
+		for _, e := range idx.Data {
+			for _, v := range e.Versions {
+				for prefix := range removed {
+					if strings.HasPrefix(v.TMID, prefix) {
+						changed[v.TMID] = struct{}{}
+						break
+					}
+				}
+			}
+		}
+	}
+	clear(removed)
+}
+
+// addIndexWatches adds watches to dir and all its subdirectories. If changed is not nil, the ids of all TM files found
+// are added to it
+func (f *FileRepo) addIndexWatches(watcher *fsnotify.Watcher, dir string, changed map[string]struct{}) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.isIgnoredPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		if changed != nil && strings.HasSuffix(d.Name(), TMExt) {
+			changed[f.relativeID(path)] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// isIgnoredPath reports whether path is irrelevant for the index: the repo's own files and hidden files,
+// e.g. temporary files of atomic writes or a .git directory
+func (f *FileRepo) isIgnoredPath(path string) bool {
+	if filepath.Clean(path) == filepath.Clean(f.root) {
+		return false
+	}
+	if path == filepath.Join(f.root, RepoConfDir) {
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+func (f *FileRepo) relativeID(path string) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,76 @@
+package repos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+func TestFileRepo_WatchIndex(t *testing.T) {
+	oldDebounce := indexWatchDebounce
+	indexWatchDebounce = 20 * time.Millisecond
+	defer func() { indexWatchDebounce = oldDebounce }()
+
+	id1 := "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"
+	id2 := "omnicorp-tm-department/omnicorp/omnilamp/subfolder/v0.0.0-20240409155220-80424c65e4e6.tm.json"
+	raw1, err := os.ReadFile(filepath.Join("../../test/data/index", id1))
+	assert.NoError(t, err)
+	raw2, err := os.ReadFile(filepath.Join("../../test/data/index", id2))
+	assert.NoError(t, err)
+
+	temp := t.TempDir()
+	r := &FileRepo{root: temp, spec: model.NewRepoSpec("fr")}
+	write := func(id string, raw []byte) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(temp, id)), defaultDirPermissions))
+		assert.NoError(t, os.WriteFile(filepath.Join(temp, id), raw, defaultFilePermissions))
+	}
+	indexedIds := func() []string {
+		idx, err := r.readIndex()
+		if err != nil {
+			return nil
+		}
+		var ids []string
+		for _, e := range idx.Data {
+			for _, v := range e.Versions {
+				ids = append(ids, v.TMID)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	write(id1, raw1)
+	assert.NoError(t, r.Index(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.WatchIndex(ctx) }()
+	// give the watcher time to add its watches
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("added file in new directory", func(t *testing.T) {
+		write(id2, raw2)
+		assert.Eventually(t, func() bool { return slices.Equal([]string{id2, id1}, indexedIds()) }, 2*time.Second, 10*time.Millisecond)
+	})
+	t.Run("removed directory", func(t *testing.T) {
+		assert.NoError(t, os.RemoveAll(filepath.Join(temp, "omnicorp-tm-department/omnicorp/omnilamp/subfolder")))
+		assert.Eventually(t, func() bool { return slices.Equal([]string{id1}, indexedIds()) }, 2*time.Second, 10*time.Millisecond)
+	})
+	t.Run("waits for index lock", func(t *testing.T) {
+		unlock, err := r.lockIndex(context.Background())
+		assert.NoError(t, err)
+		write(id2, raw2)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, []string{id1}, indexedIds())
+		unlock()
+		assert.Eventually(t, func() bool { return slices.Equal([]string{id2, id1}, indexedIds()) }, 2*time.Second, 10*time.Millisecond)
+	})
+
+	cancel()
+	assert.NoError(t, <-done)
+}
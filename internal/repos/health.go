@@ -0,0 +1,288 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+type HealthStatus string
+
+const (
+	HealthUp       = HealthStatus("up")
+	HealthDegraded = HealthStatus("degraded")
+	HealthDown     = HealthStatus("down")
+
+	// healthProbeName is searched for by the generic health probe. It is not expected to match any TM
+	healthProbeName = "tmc-health-probe/"
+)
+
+var (
+	// remoteHealthCacheTTL is the time for which the result of probing a remote repo is reused, so that frequent probes
+	// of the service do not send a request to every remote repo each time
+	remoteHealthCacheTTL = 10 * time.Second
+
+	healthCacheMu sync.Mutex
+	// healthCache holds the results of probing remote repos by repo name
+	healthCache = map[string]cachedHealth{}
+
+	// newestTMCacheTTL is the time for which the time of a repo's newest TM is reused. Finding it may require walking
+	// the whole repo, which is too expensive to do on every probe
+	newestTMCacheTTL = time.Minute
+
+	newestTMsMu sync.Mutex
+	// newestTMs holds the searches for the newest TM by repo name, both finished and running
+	newestTMs = map[string]*newestTMSearch{}
+)
+
+type cachedHealth struct {
+	res     RepoHealth
+	expires time.Time
+}
+
+// HealthChecker is implemented by repos which can probe whether they are able to serve requests in a cheaper or more
+// thorough way than by listing their contents
+type HealthChecker interface {
+	// CheckHealth probes the repo. Returns the time its index has last been updated, or the zero time if it is not known,
+	// and an error if the repo cannot serve requests
+	CheckHealth(ctx context.Context) (time.Time, error)
+}
+
+// RepoHealth is the result of probing a repo
+type RepoHealth struct {
+	Repo   string
+	Status HealthStatus
+	// Remote tells whether the repo is accessed over the network
+	Remote  bool
+	Latency time.Duration
+	// IndexUpdated is the time the repo's index has last been updated. Zero if not known
+	IndexUpdated time.Time
+	Message      string
+}
+
+type newestTMSearch struct {
+	done    chan struct{}
+	newest  time.Time
+	err     error
+	expires time.Time
+}
+
+// newestTMFinder is implemented by repos which can tell when the most recently changed TM file has been changed, to
+// detect an index which is missing TMs
+type newestTMFinder interface {
+	newestTM(ctx context.Context) (time.Time, error)
+}
+
+// HealthReport is the overall health of a service together with the health of each repo it serves
+type HealthReport struct {
+	Status HealthStatus
+	Repos  []RepoHealth
+}
+
+// CheckHealth probes r and reports its health. The repo is down if it does not answer within timeout or fails to
+// serve requests. It is degraded if it has a TM which has been changed more than maxIndexAge after its index has last
+// been updated, unless maxIndexAge is 0. Only repos which can find their newest TM, like file repos, are checked for
+// this, and the time of their newest TM is reused for newestTMCacheTTL. Repos which do not implement HealthChecker are
+// probed with a List which is not expected to find anything.
+// The results for remote repos are reused for remoteHealthCacheTTL
+func CheckHealth(ctx context.Context, r Repo, timeout, maxIndexAge time.Duration) RepoHealth {
+	res := RepoHealth{
+		Repo:   repoName(r),
+		Status: HealthUp,
+		Remote: IsRemote(r),
+	}
+	if !res.Remote {
+		return checkHealth(ctx, r, res, timeout, maxIndexAge)
+	}
+	healthCacheMu.Lock()
+	c, ok := healthCache[res.Repo]
+	healthCacheMu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.res
+	}
+	res = checkHealth(ctx, r, res, timeout, maxIndexAge)
+	healthCacheMu.Lock()
+	healthCache[res.Repo] = cachedHealth{res: res, expires: time.Now().Add(remoteHealthCacheTTL)}
+	healthCacheMu.Unlock()
+	return res
+}
+
+func checkHealth(ctx context.Context, r Repo, res RepoHealth, timeout, maxIndexAge time.Duration) RepoHealth {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	var err error
+	if hc, ok := r.(HealthChecker); ok {
+		res.IndexUpdated, err = hc.CheckHealth(ctx)
+	} else {
+		_, err = r.List(ctx, &model.SearchParams{Name: healthProbeName, Options: model.SearchOptions{NameFilterType: model.PrefixMatch}})
+		if errors.Is(err, ErrTmNotFound) {
+			err = nil
+		}
+	}
+	res.Latency = time.Since(start)
+	if err != nil {
+		res.Status = HealthDown
+		res.Message = err.Error()
+		if ctx.Err() != nil {
+			res.Message = fmt.Sprintf("no answer within %v: %v", timeout, err)
+		}
+		return res
+	}
+	if f, ok := r.(newestTMFinder); ok && maxIndexAge > 0 && !res.IndexUpdated.IsZero() {
+		newest, found, err := findNewestTM(ctx, res.Repo, f)
+		switch {
+		case !found:
+			// the search continues in the background and its result is used by a later probe
+		case err != nil:
+			res.Status = HealthDegraded
+			res.Message = fmt.Sprintf("cannot check the age of the index: %v", err)
+		case newest.Sub(res.IndexUpdated) > maxIndexAge:
+			res.Status = HealthDegraded
+			res.Message = fmt.Sprintf("index has not been updated for more than %v after a TM has been changed", maxIndexAge)
+		}
+	}
+	return res
+}
+
+// findNewestTM returns the time of the newest TM in the repo with given name, reusing a result which is not older than
+// newestTMCacheTTL. The search is not bound to ctx, so that a search which takes longer than a probe may wait is not
+// aborted, but finishes for a later probe. found is false if ctx is done before the search has finished
+func findNewestTM(ctx context.Context, name string, f newestTMFinder) (newest time.Time, found bool, err error) {
+	newestTMsMu.Lock()
+	s, ok := newestTMs[name]
+	if !ok || s.expired() {
+		s = &newestTMSearch{done: make(chan struct{})}
+		newestTMs[name] = s
+		go func() {
+			s.newest, s.err = f.newestTM(context.Background())
+			s.expires = time.Now().Add(newestTMCacheTTL)
+			close(s.done)
+		}()
+	}
+	newestTMsMu.Unlock()
+	select {
+	case <-s.done:
+		return s.newest, true, s.err
+	case <-ctx.Done():
+		return time.Time{}, false, nil
+	}
+}
+
+// expired reports whether the search has finished and its result is too old to be reused
+func (s *newestTMSearch) expired() bool {
+	select {
+	case <-s.done:
+		return !time.Now().Before(s.expires)
+	default:
+		return false
+	}
+}
+
+// IsRemote reports whether r is accessed over the network
+func IsRemote(r Repo) bool {
+	switch r.(type) {
+	case *HttpRepo, *TmcRepo, TmcRepo, *S3Repo, *OCIRepo:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckHealth checks the accessibility of the repo's root and index. It does not take the index lock, so that probes
+// neither wait for nor delay index updates
+func (f *FileRepo) CheckHealth(ctx context.Context) (time.Time, error) {
+	err := f.checkRootValid()
+	if err != nil {
+		return time.Time{}, err
+	}
+	idx, err := os.Open(f.indexFilename())
+	if err != nil {
+		return time.Time{}, errors.New("no table of contents found. Run `index` for this repo")
+	}
+	defer idx.Close()
+	stat, err := idx.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	updated := stat.ModTime()
+	if js, err := os.Stat(f.journalFilename()); err == nil && js.ModTime().After(updated) {
+		updated = js.ModTime()
+	}
+	return updated, nil
+}
+
+// newestTM returns the time the most recently changed TM file in the repo has been changed, or the zero time if there
+// are no TM files
+func (f *FileRepo) newestTM(ctx context.Context) (time.Time, error) {
+	var newest time.Time
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path == filepath.Join(f.root, RepoConfDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), TMExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
+
+// CheckHealth sends a HEAD request for the index file and takes the time of its last update from the Last-Modified
+// header. Falls back to reading the index if the server does not support HEAD requests
+func (h *HttpRepo) CheckHealth(ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, h.buildUrl(fmt.Sprintf("%s/%s", RepoConfDir, IndexFilename)), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := h.doHttp(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		updated, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return updated, nil
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		_, err := h.List(ctx, &model.SearchParams{Name: healthProbeName, Options: model.SearchOptions{NameFilterType: model.PrefixMatch}})
+		return time.Time{}, err
+	default:
+		return time.Time{}, fmt.Errorf("received unexpected HTTP response from remote server: %s", resp.Status)
+	}
+}
+
+// CheckHealth probes all repos in u concurrently. The results are in the order of the repos in u
+func (u *Union) CheckHealth(ctx context.Context, timeout, maxIndexAge time.Duration) []RepoHealth {
+	mapper := func(ctx context.Context, r Repo) mapResult[[]RepoHealth] {
+		return mapResult[[]RepoHealth]{res: []RepoHealth{CheckHealth(ctx, r, timeout, maxIndexAge)}}
+	}
+	reducer := func(h1, h2 []RepoHealth) []RepoHealth { return append(h1, h2...) }
+	res, _ := reduce(mapConcurrent(ctx, "CheckHealth", u.rs, mapper), nil, reducer)
+	return res
+}
@@ -0,0 +1,178 @@
+package repos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+func TestCheckHealth_FileRepo(t *testing.T) {
+	defer func(ttl time.Duration) { newestTMCacheTTL = ttl }(newestTMCacheTTL)
+	newestTMCacheTTL = 0
+	root := t.TempDir()
+	r, err := NewFileRepo(map[string]any{"type": "file", "loc": root}, model.NewRepoSpec("local"))
+	assert.NoError(t, err)
+
+	t.Run("without index", func(t *testing.T) {
+		h := CheckHealth(context.Background(), r, time.Second, 0)
+		assert.Equal(t, "local", h.Repo)
+		assert.Equal(t, HealthDown, h.Status)
+		assert.False(t, h.Remote)
+		assert.Contains(t, h.Message, "no table of contents found")
+	})
+
+	idxFile := filepath.Join(root, RepoConfDir, IndexFilename)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(idxFile), defaultDirPermissions))
+	assert.NoError(t, os.WriteFile(idxFile, []byte("{}"), defaultFilePermissions))
+	updated := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.Chtimes(idxFile, updated, updated))
+
+	t.Run("with index", func(t *testing.T) {
+		h := CheckHealth(context.Background(), r, time.Second, 0)
+		assert.Equal(t, HealthUp, h.Status)
+		assert.Empty(t, h.Message)
+		assert.True(t, updated.Equal(h.IndexUpdated))
+	})
+	t.Run("with old, but complete index", func(t *testing.T) {
+		tmFile := filepath.Join(root, "omnicorp/lamp/v1.0.0-20240101000000-c49617d2e4fc.tm.json")
+		assert.NoError(t, os.MkdirAll(filepath.Dir(tmFile), defaultDirPermissions))
+		assert.NoError(t, os.WriteFile(tmFile, []byte("{}"), defaultFilePermissions))
+		tmUpdated := updated.Add(-time.Hour)
+		assert.NoError(t, os.Chtimes(tmFile, tmUpdated, tmUpdated))
+
+		h := CheckHealth(context.Background(), r, time.Second, time.Minute)
+		assert.Equal(t, HealthUp, h.Status)
+	})
+	t.Run("with stale index", func(t *testing.T) {
+		tmFile := filepath.Join(root, "omnicorp/lamp/v1.0.1-20240101000000-c49617d2e4fc.tm.json")
+		assert.NoError(t, os.WriteFile(tmFile, []byte("{}"), defaultFilePermissions))
+		defer os.Remove(tmFile)
+
+		h := CheckHealth(context.Background(), r, time.Second, time.Hour)
+		assert.Equal(t, HealthDegraded, h.Status)
+		assert.Contains(t, h.Message, "index has not been updated")
+	})
+	t.Run("with locked index", func(t *testing.T) {
+		unlock, err := r.lockIndex(context.Background())
+		assert.NoError(t, err)
+		defer unlock()
+		h := CheckHealth(context.Background(), r, 100*time.Millisecond, 0)
+		assert.Equal(t, HealthUp, h.Status)
+	})
+	t.Run("with invalid root", func(t *testing.T) {
+		r, _ := NewFileRepo(map[string]any{"type": "file", "loc": filepath.Join(root, "does-not-exist")}, model.NewRepoSpec("local"))
+		h := CheckHealth(context.Background(), r, time.Second, 0)
+		assert.Equal(t, HealthDown, h.Status)
+	})
+}
+
+type slowNewestTMFinder struct {
+	searches atomic.Int32
+	delay    time.Duration
+	newest   time.Time
+}
+
+func (f *slowNewestTMFinder) newestTM(ctx context.Context) (time.Time, error) {
+	f.searches.Add(1)
+	time.Sleep(f.delay)
+	return f.newest, nil
+}
+
+func TestFindNewestTM(t *testing.T) {
+	newest := time.Now().Truncate(time.Second)
+
+	t.Run("result is reused", func(t *testing.T) {
+		f := &slowNewestTMFinder{newest: newest}
+		for i := 0; i < 3; i++ {
+			n, found, err := findNewestTM(context.Background(), "reused", f)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.True(t, newest.Equal(n))
+		}
+		assert.Equal(t, int32(1), f.searches.Load())
+	})
+	t.Run("slow search is not aborted", func(t *testing.T) {
+		f := &slowNewestTMFinder{newest: newest, delay: 200 * time.Millisecond}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, found, err := findNewestTM(ctx, "slow", f)
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		n, found, err := findNewestTM(context.Background(), "slow", f)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.True(t, newest.Equal(n))
+		assert.Equal(t, int32(1), f.searches.Load())
+	})
+}
+
+func TestCheckHealth_HttpRepo(t *testing.T) {
+	defer func(ttl time.Duration) { remoteHealthCacheTTL = ttl }(remoteHealthCacheTTL)
+	remoteHealthCacheTTL = 0
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	newRepo := func(t *testing.T, handler http.HandlerFunc) *HttpRepo {
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		config, err := createHttpRepoConfig("", []byte(`{"loc":"`+srv.URL+`", "type":"http"}`))
+		assert.NoError(t, err)
+		r, err := NewHttpRepo(config, model.NewRepoSpec("remote"))
+		assert.NoError(t, err)
+		return r
+	}
+
+	t.Run("up", func(t *testing.T) {
+		r := newRepo(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodHead, r.Method)
+			assert.Equal(t, "/"+RepoConfDir+"/"+IndexFilename, r.URL.Path)
+			w.Header().Set("Last-Modified", updated.Format(http.TimeFormat))
+		})
+		h := CheckHealth(context.Background(), r, time.Second, 0)
+		assert.Equal(t, HealthUp, h.Status)
+		assert.True(t, h.Remote)
+		assert.True(t, updated.Equal(h.IndexUpdated))
+	})
+	t.Run("down", func(t *testing.T) {
+		r := newRepo(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		h := CheckHealth(context.Background(), r, time.Second, 0)
+		assert.Equal(t, HealthDown, h.Status)
+		assert.Contains(t, h.Message, "502")
+	})
+	t.Run("timeout", func(t *testing.T) {
+		r := newRepo(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+		h := CheckHealth(context.Background(), r, 50*time.Millisecond, 0)
+		assert.Equal(t, HealthDown, h.Status)
+		assert.Contains(t, h.Message, "no answer within 50ms")
+		assert.Less(t, h.Latency, 5*time.Second)
+	})
+}
+
+func TestCheckHealth_RemoteResultsAreCached(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+	}))
+	defer srv.Close()
+	r, err := NewHttpRepo(map[string]any{"type": "http", "loc": srv.URL}, model.NewRepoSpec("cached-remote"))
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, HealthUp, CheckHealth(context.Background(), r, time.Second, 0).Status)
+	}
+	assert.Equal(t, int32(1), probes.Load())
+}
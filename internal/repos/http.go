@@ -2,6 +2,8 @@ package repos
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,23 +11,54 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/buger/jsonparser"
 	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/tracing"
 	"github.com/wot-oss/tmc/internal/utils"
 )
 
 var ErrNotSupported = errors.New("method not supported")
 
-const RelFileUriPlaceholder = "{{ID}}"
+var (
+	insecureWarnedMu sync.Mutex
+	// insecureWarned holds the locations of the repos for which disabled certificate verification has been warned about,
+	// so that the warning is logged once per repo and not for every operation creating the repo anew
+	insecureWarned = map[string]bool{}
+
+	httpClientsMu sync.Mutex
+	// httpClients holds the http clients by the parts of the repo config they are created from. A client is created once
+	// per process and shared by all instances of repos with equal configs, so that their connections are reused
+	httpClients = map[string]*http.Client{}
+)
+
+const (
+	RelFileUriPlaceholder = "{{ID}}"
+
+	KeyRepoTLS               = "tls"
+	KeyTLSCAFile             = "caFile"
+	KeyTLSCertFile           = "certFile"
+	KeyTLSKeyFile            = "keyFile"
+	KeyTLSInsecureSkipVerify = "insecureSkipVerify"
+
+	// KeyRepoProxy is the URL of the proxy to connect to the repo through, or ProxyNone to connect directly
+	KeyRepoProxy = "proxy"
+	ProxyNone    = "none"
+
+	headerRequestID = "X-Request-ID"
+)
 
 type baseHttpRepo struct {
 	root       string
 	parsedRoot *url.URL
 	spec       model.RepoSpec
-	auth       map[string]any
+	auth       httpAuth
+	client     *http.Client
+	policy     requestPolicy
 }
 
 // HttpRepo implements a Repo backed by a http server. It does not allow writing to the repository
@@ -70,12 +103,21 @@ func newBaseHttpRepo(config map[string]any, spec model.RepoSpec) (baseHttpRepo,
 	if err != nil {
 		return baseHttpRepo{}, err
 	}
-	auth := utils.JsGetMap(config, KeyRepoAuth)
+	client, err := newHttpClient(config)
+	if err != nil {
+		return baseHttpRepo{}, err
+	}
+	auth, err := newHttpAuth(config, client)
+	if err != nil {
+		return baseHttpRepo{}, err
+	}
 	base := baseHttpRepo{
 		root:       *loc,
 		spec:       spec,
 		auth:       auth,
 		parsedRoot: u,
+		client:     client,
+		policy:     newRequestPolicy(config, spec.String(), *loc),
 	}
 	return base, nil
 }
@@ -89,11 +131,11 @@ func (h *HttpRepo) Delete(ctx context.Context, id string) error {
 
 func (h *HttpRepo) Fetch(ctx context.Context, id string) (string, []byte, error) {
 	reqUrl := h.buildUrl(id)
-	return fetchTM(ctx, reqUrl, h.auth)
+	return h.fetchTM(ctx, reqUrl)
 }
 
-func fetchTM(ctx context.Context, tmUrl string, auth map[string]any) (string, []byte, error) {
-	resp, err := doGet(ctx, tmUrl, auth)
+func (r baseHttpRepo) fetchTM(ctx context.Context, tmUrl string) (string, []byte, error) {
+	resp, err := r.doGet(ctx, tmUrl)
 	if err != nil {
 		return "", nil, err
 	}
@@ -141,7 +183,7 @@ func (h *HttpRepo) Spec() model.RepoSpec {
 
 func (h *HttpRepo) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, error) {
 	reqUrl := h.buildUrl(fmt.Sprintf("%s/%s", RepoConfDir, IndexFilename))
-	resp, err := doGet(ctx, reqUrl, h.auth)
+	resp, err := h.doGet(ctx, reqUrl)
 	if err != nil {
 		return model.SearchResult{}, err
 	}
@@ -154,37 +196,76 @@ func (h *HttpRepo) List(ctx context.Context, search *model.SearchParams) (model.
 	case http.StatusOK:
 		var idx model.Index
 		err = json.Unmarshal(data, &idx)
-		idx.Filter(search)
 		if err != nil {
 			return model.SearchResult{}, err
 		}
+		err = h.applyJournal(ctx, &idx)
+		if err != nil {
+			return model.SearchResult{}, err
+		}
+		idx.Filter(search)
 		return model.NewIndexToFoundMapper(h.Spec().ToFoundSource()).ToSearchResult(idx), nil
 	default:
 		return model.SearchResult{}, errors.New(fmt.Sprintf("received unexpected HTTP response from remote server: %s", resp.Status))
 	}
 }
 
-func doGet(ctx context.Context, reqUrl string, auth map[string]any) (*http.Response, error) {
+// applyJournal applies the index journal of a file repo served over HTTP to idx. A missing journal is not an error,
+// as the journal exists only while there are index updates not yet merged into the index file
+func (h *HttpRepo) applyJournal(ctx context.Context, idx *model.Index) error {
+	resp, err := h.doGet(ctx, h.buildUrl(fmt.Sprintf("%s/%s", RepoConfDir, IndexJournalFilename)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	applyIndexJournal(idx, data)
+	return nil
+}
+
+func (r baseHttpRepo) doGet(ctx context.Context, reqUrl string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
 	if err != nil {
 		return nil, err
 	}
-	return doHttp(req, auth)
+	return r.doHttp(req)
 }
 
-func doHttp(req *http.Request, auth map[string]any) (*http.Response, error) {
-	if auth != nil {
-		bearerToken := utils.JsGetString(auth, "bearer")
-		if bearerToken != nil {
-			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", *bearerToken))
-		}
+// doHttp sends req with the repo's credentials, applying the repo's retry and circuit breaker policy. The id of the
+// request handled within req's context, if any, is passed on to the server
+func (r baseHttpRepo) doHttp(req *http.Request) (*http.Response, error) {
+	if id := utils.RequestIDFromContext(req.Context()); id != "" && req.Header.Get(headerRequestID) == "" {
+		req.Header.Set(headerRequestID, id)
 	}
-	resp, err := http.DefaultClient.Do(req)
-	return resp, err
+	return r.policy.do(req, r.doHttpOnce)
+}
+
+// doHttpOnce sends req with the repo's credentials. If the server rejects the credentials with 401 and they can be
+// renewed, like an expired oauth2 access token, the request is sent once more with renewed credentials
+func (r baseHttpRepo) doHttpOnce(req *http.Request) (*http.Response, error) {
+	if r.auth == nil {
+		return r.client.Do(req)
+	}
+	err := r.auth.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !canResend(req) || !r.auth.renew(req) {
+		return resp, err
+	}
+	_ = resp.Body.Close()
+	return resend(r.client, r.auth, req)
 }
 
 func (h *HttpRepo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	if len(name) == 0 {
 		log.Error("Please specify a repoName to show the TM.")
 		return nil, errors.New("please specify a repoName to show the TM")
@@ -288,6 +369,192 @@ func createHttpRepoConfig(loc string, bytes []byte) (map[string]any, error) {
 			return nil, fmt.Errorf("invalid json config. must have string \"loc\"")
 		}
 		rc[KeyRepoLoc] = *l
+		err = validateTLSConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateProxyConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateRequestsConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateAuthConfig(rc)
+		if err != nil {
+			return nil, err
+		}
 		return rc, nil
 	}
 }
+
+// newHttpClient returns the dedicated http.Client to be used for a repo with given config. The client waits for the
+// response headers at most for the responseHeaderTimeout from the "requests" section and times out whole requests only
+// if the section has a timeout. It uses a copy of the default transport, which takes the proxy from the environment
+// variables HTTP_PROXY, HTTPS_PROXY and NO_PROXY, unless the config has a "proxy" section.
+// "proxy" is the URL of the proxy to use for the repo regardless of the environment, or "none" to use no proxy at all.
+// "tls" may specify a CA certificate file to trust in addition to the system's CAs, a client certificate and key to
+// present to the server, and whether to skip verifying the server's certificate.
+// Credentials of the "auth" section are not sent along when a request is redirected to another host.
+// Clients are cached, so files referenced by "tls" are read only once per process
+func newHttpClient(config map[string]any) (*http.Client, error) {
+	if skip := utils.JsGetBool(utils.JsGetMap(config, KeyRepoTLS), KeyTLSInsecureSkipVerify); skip != nil && *skip {
+		warnInsecureSkipVerify(utils.JsGetString(config, KeyRepoLoc))
+	}
+	key := httpClientKey(config)
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if c, ok := httpClients[key]; ok {
+		return c, nil
+	}
+	c, err := createHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+	httpClients[key] = c
+	return c, nil
+}
+
+// httpClientKey returns the key under which the client for a repo with given config is cached. It consists of the
+// config sections which the client is created from
+func httpClientKey(config map[string]any) string {
+	names := authHeaderNames(config)
+	slices.Sort(names)
+	b, _ := json.Marshal(map[string]any{
+		KeyRepoTLS:      config[KeyRepoTLS],
+		KeyRepoProxy:    config[KeyRepoProxy],
+		KeyRepoRequests: config[KeyRepoRequests],
+		"authHeaders":   names,
+	})
+	return string(b)
+}
+
+func createHttpClient(config map[string]any) (*http.Client, error) {
+	timeout := requestTimeout(config)
+	checkRedirect := stripAuthOnRedirect(authHeaderNames(config))
+	tlsConf := utils.JsGetMap(config, KeyRepoTLS)
+	proxy := utils.JsGetString(config, KeyRepoProxy)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = responseHeaderTimeout(config)
+	if tlsConf != nil {
+		tc, err := createTLSConfig(tlsConf)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tc
+	}
+	if proxy != nil {
+		p, err := proxyFunc(*proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = p
+	}
+	return &http.Client{Transport: tracing.Transport(transport), Timeout: timeout, CheckRedirect: checkRedirect}, nil
+}
+
+// proxyFunc returns the function to use as http.Transport.Proxy for given proxy config
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == ProxyNone {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" || !slices.Contains([]string{"http", "https", "socks5"}, u.Scheme) {
+		return nil, fmt.Errorf("invalid json config. %s must be \"%s\" or a URL with scheme http, https or socks5", KeyRepoProxy, ProxyNone)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// validateProxyConfig checks that the proxy of a repo config, if present, is valid
+func validateProxyConfig(rc map[string]any) error {
+	v, ok := rc[KeyRepoProxy]
+	if !ok {
+		return nil
+	}
+	p, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid json config. %s must be a string", KeyRepoProxy)
+	}
+	_, err := proxyFunc(p)
+	return err
+}
+
+// warnInsecureSkipVerify logs a warning that the server certificate of the repo at loc is not verified, once per repo
+func warnInsecureSkipVerify(loc *string) {
+	l := ""
+	if loc != nil {
+		l = *loc
+	}
+	insecureWarnedMu.Lock()
+	defer insecureWarnedMu.Unlock()
+	if insecureWarned[l] {
+		return
+	}
+	insecureWarned[l] = true
+	slog.Default().Warn("server certificate verification is disabled with "+KeyTLSInsecureSkipVerify, "loc", l)
+}
+
+func createTLSConfig(conf map[string]any) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile := utils.JsGetString(conf, KeyTLSCAFile); caFile != nil {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls config. cannot read %s: %w", KeyTLSCAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid tls config. no certificates found in %s", *caFile)
+		}
+		tc.RootCAs = pool
+	}
+	if skip := utils.JsGetBool(conf, KeyTLSInsecureSkipVerify); skip != nil && *skip {
+		tc.InsecureSkipVerify = true
+	}
+	certFile := utils.JsGetString(conf, KeyTLSCertFile)
+	keyFile := utils.JsGetString(conf, KeyTLSKeyFile)
+	if (certFile == nil) != (keyFile == nil) {
+		return nil, fmt.Errorf("invalid tls config. %s and %s must be given together", KeyTLSCertFile, KeyTLSKeyFile)
+	}
+	if certFile != nil {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls config. cannot load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// validateTLSConfig checks that the "tls" section of a repo config, if present, is valid and refers to loadable files
+func validateTLSConfig(rc map[string]any) error {
+	v, ok := rc[KeyRepoTLS]
+	if !ok {
+		return nil
+	}
+	conf, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid json config. %s must be a map", KeyRepoTLS)
+	}
+	for k, v := range conf {
+		switch k {
+		case KeyTLSCAFile, KeyTLSCertFile, KeyTLSKeyFile:
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("invalid tls config. %s must be a string", k)
+			}
+		case KeyTLSInsecureSkipVerify:
+			if _, ok := v.(bool); !ok {
+				return fmt.Errorf("invalid tls config. %s must be a boolean", k)
+			}
+		default:
+			return fmt.Errorf("invalid tls config. unknown key %s", k)
+		}
+	}
+	_, err := createTLSConfig(conf)
+	return err
+}
@@ -1,12 +1,19 @@
 package repos
 
 import (
+	"bytes"
 	"context"
+	"encoding/pem"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wot-oss/tmc/internal/model"
@@ -77,11 +84,149 @@ func TestHttpRepo_Fetch(t *testing.T) {
 	assert.Equal(t, []byte(tm), b)
 }
 
+func TestHttpRepo_TLS(t *testing.T) {
+	const tmid = "manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json"
+	const tm = "{\"id\":\"manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json\"}"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(tm))
+	}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	assert.NoError(t, err)
+
+	t.Run("untrusted server certificate", func(t *testing.T) {
+		r, err := NewHttpRepo(map[string]any{"type": "http", "loc": srv.URL}, model.NewRepoSpec("nameless"))
+		assert.NoError(t, err)
+		_, _, err = r.Fetch(context.Background(), tmid)
+		assert.Error(t, err)
+	})
+	t.Run("trusted ca file", func(t *testing.T) {
+		config, err := createHttpRepoConfig("", []byte(`{"loc":"`+srv.URL+`", "type":"http", "tls":{"caFile":"`+filepath.ToSlash(caFile)+`"}}`))
+		assert.NoError(t, err)
+		r, err := NewHttpRepo(config, model.NewRepoSpec("nameless"))
+		assert.NoError(t, err)
+		_, b, err := r.Fetch(context.Background(), tmid)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(tm), b)
+	})
+}
+
+func TestHttpRepo_InsecureSkipVerify(t *testing.T) {
+	const tmid = "manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json"
+	const tm = "{\"id\":\"manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json\"}"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(tm))
+	}))
+	defer srv.Close()
+	logs := bytes.NewBuffer(nil)
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	config, err := createHttpRepoConfig("", []byte(`{"loc":"`+srv.URL+`", "type":"http", "tls":{"insecureSkipVerify":true}}`))
+	assert.NoError(t, err)
+	r, err := NewHttpRepo(config, model.NewRepoSpec("nameless"))
+	assert.NoError(t, err)
+	_, b, err := r.Fetch(context.Background(), tmid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(tm), b)
+
+	// the warning is logged once per repo, although the repo is created anew for every operation
+	_, err = NewHttpRepo(config, model.NewRepoSpec("nameless"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(logs.String(), "level=WARN"))
+	assert.Contains(t, logs.String(), srv.URL)
+}
+
+func TestHttpRepo_Proxy(t *testing.T) {
+	const tmid = "manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json"
+	const tm = "{\"id\":\"manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json\"}"
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy receives the absolute URL of the requested resource
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte(tm))
+	}))
+	defer proxy.Close()
+
+	t.Run("with proxy", func(t *testing.T) {
+		config, err := createHttpRepoConfig("", []byte(`{"loc":"http://repo.example.com/", "type":"http", "proxy":"`+proxy.URL+`"}`))
+		assert.NoError(t, err)
+		r, err := NewHttpRepo(config, model.NewRepoSpec("nameless"))
+		assert.NoError(t, err)
+		_, b, err := r.Fetch(context.Background(), tmid)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(tm), b)
+		assert.Equal(t, []string{"http://repo.example.com/" + tmid}, proxied)
+	})
+	t.Run("without proxy", func(t *testing.T) {
+		r, err := NewHttpRepo(map[string]any{"type": "http", "loc": proxy.URL, "proxy": "none"}, model.NewRepoSpec("nameless"))
+		assert.NoError(t, err)
+		if assert.IsType(t, &http.Transport{}, r.client.Transport) {
+			assert.Nil(t, r.client.Transport.(*http.Transport).Proxy)
+		}
+	})
+	t.Run("invalid proxy", func(t *testing.T) {
+		for _, p := range []string{`"proxy.example.com:3128"`, `"ftp://proxy.example.com"`, `"http://"`, `3128`} {
+			_, err := createHttpRepoConfig("", []byte(`{"loc":"http://repo.example.com/", "type":"http", "proxy":`+p+`}`))
+			assert.ErrorContains(t, err, "proxy must be", p)
+		}
+	})
+}
+
+func TestNewHttpClient_Cached(t *testing.T) {
+	c1, err := newHttpClient(map[string]any{"loc": "http://one.example.com", "requests": map[string]any{"timeout": "7s"}})
+	assert.NoError(t, err)
+	c2, err := newHttpClient(map[string]any{"loc": "http://two.example.com", "requests": map[string]any{"timeout": "7s"}})
+	assert.NoError(t, err)
+	c3, err := newHttpClient(map[string]any{"loc": "http://one.example.com", "requests": map[string]any{"timeout": "8s"}})
+	assert.NoError(t, err)
+	// repos with equal client configs share the client and thereby its connection pool
+	assert.Same(t, c1, c2)
+	assert.NotSame(t, c1, c3)
+	assert.Equal(t, 8*time.Second, c3.Timeout)
+}
+
+func TestValidateTLSConfig(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	srv.Close()
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+
+	tests := []struct {
+		conf   map[string]any
+		expErr string
+	}{
+		{map[string]any{}, ""},
+		{map[string]any{"tls": map[string]any{"caFile": caFile}}, ""},
+		{map[string]any{"tls": "ca.pem"}, "must be a map"},
+		{map[string]any{"tls": map[string]any{"caFile": 5}}, "must be a string"},
+		{map[string]any{"tls": map[string]any{"cafile": caFile}}, "unknown key"},
+		{map[string]any{"tls": map[string]any{"caFile": filepath.Join(t.TempDir(), "missing.pem")}}, "cannot read caFile"},
+		{map[string]any{"tls": map[string]any{"certFile": caFile}}, "must be given together"},
+		{map[string]any{"tls": map[string]any{"certFile": caFile, "keyFile": caFile}}, "cannot load client certificate"},
+		{map[string]any{"tls": map[string]any{"insecureSkipVerify": true}}, ""},
+		{map[string]any{"tls": map[string]any{"insecureSkipVerify": "true"}}, "must be a boolean"},
+	}
+	for i, test := range tests {
+		err := validateTLSConfig(test.conf)
+		if test.expErr == "" {
+			assert.NoError(t, err, "test %d", i)
+		} else {
+			assert.ErrorContains(t, err, test.expErr, "test %d", i)
+		}
+	}
+}
+
 func TestHttpRepo_ListCompletions(t *testing.T) {
 	_, idx, err := utils.ReadRequiredFile("../../test/data/list/tm-catalog.toc.json")
 	assert.NoError(t, err)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.tmc/"+IndexJournalFilename {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		assert.Equal(t, "/.tmc/"+IndexFilename, r.URL.Path)
 		_, _ = w.Write(idx)
 	}))
@@ -153,3 +298,33 @@ func TestHttpRepo_ListCompletions(t *testing.T) {
 		assert.Equal(t, []string{"omnicorp-r-d-research/omnicorp-gmbh-co-kg/senseall:1.0.1"}, completions)
 	})
 }
+
+func TestHttpRepo_List_AppliesJournal(t *testing.T) {
+	_, idx, err := utils.ReadRequiredFile("../../test/data/list/tm-catalog.toc.json")
+	assert.NoError(t, err)
+	journal := `{"op":"delete","id":"omnicorp-r-d-research/omnicorp-gmbh-co-kg/senseall/subpath/v1.0.1-20231201110829-c49617d2e4fc.tm.json"}
+{"op":"insert","tm":{"id":"omnicorp-r-d-research/omnicorp-gmbh-co-kg/senseall/v1.0.2-20240101000000-c49617d2e4fc.tm.json","description":"new","schema:manufacturer":{"schema:name":"omnicorp-gmbh-co-kg"},"schema:mpn":"senseall","schema:author":{"schema:name":"omnicorp-r-d-research"},"version":{"model":"1.0.2"}}}
+{"op":"ins`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.tmc/" + IndexFilename:
+			_, _ = w.Write(idx)
+		case "/.tmc/" + IndexJournalFilename:
+			_, _ = w.Write([]byte(journal))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	r, err := NewHttpRepo(map[string]any{"type": "http", "loc": srv.URL}, model.NewRepoSpec("nameless"))
+	assert.NoError(t, err)
+
+	res, err := r.List(context.Background(), &model.SearchParams{})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Entries, 2) {
+		vs, err := r.Versions(context.Background(), "omnicorp-r-d-research/omnicorp-gmbh-co-kg/senseall")
+		assert.NoError(t, err)
+		assert.Len(t, vs, 2)
+	}
+}
@@ -0,0 +1,417 @@
+package repos
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/utils"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	KeyRepoLock    = "lock"
+	KeyLockKind    = "kind"
+	KeyLockTimeout = "timeout"
+	KeyLockLease   = "lease"
+	KeyLockDriver  = "driver"
+	KeyLockDSN     = "dsn"
+	KeyLockName    = "name"
+
+	LockKindFlock = "flock"
+	LockKindLease = "lease"
+	LockKindDB    = "db"
+
+	LockDriverPostgres = "postgres"
+	LockDriverSqlite   = "sqlite"
+
+	defaultLockLease = 30 * time.Second
+	minLockLease     = time.Second
+	lockRetryDelay   = 100 * time.Millisecond
+)
+
+// IndexLocker guards updates of a repo's index against concurrent updates by other goroutines or processes
+type IndexLocker interface {
+	// Lock blocks until the lock is acquired, the locker's timeout has elapsed, or ctx is done.
+	// Returns ErrIndexLocked if the timeout has elapsed. The returned unlockFunc must be called in any case
+	Lock(ctx context.Context) (unlockFunc, error)
+}
+
+// newIndexLocker creates the IndexLocker configured in the "lock" section of the repo config. The file based lockers
+// derive their file names from lockFile. The database locker uses the configured lock name, or else lockFile, as the
+// name of the lock. Without configuration, a flock is used
+func newIndexLocker(conf map[string]any, lockFile string) (IndexLocker, error) {
+	if err := validateLockConfig(conf, LockKindFlock, LockKindLease, LockKindDB); err != nil {
+		return nil, err
+	}
+	timeout := lockTimeout(conf)
+	lc := utils.JsGetMap(conf, KeyRepoLock)
+	kind := LockKindFlock
+	if k := utils.JsGetString(lc, KeyLockKind); k != nil {
+		kind = *k
+	}
+	switch kind {
+	case LockKindLease:
+		return &leaseLocker{file: lockFile + ".lease", timeout: timeout, lease: lockLease(conf)}, nil
+	case LockKindDB:
+		key := lockFile
+		if n := utils.JsGetString(lc, KeyLockName); n != nil {
+			key = *n
+		}
+		return &dbLocker{
+			driver:  *utils.JsGetString(lc, KeyLockDriver),
+			dsn:     *utils.JsGetString(lc, KeyLockDSN),
+			key:     key,
+			timeout: timeout,
+		}, nil
+	default:
+		return &flockLocker{file: lockFile + ".lock", timeout: timeout}, nil
+	}
+}
+
+// lockTimeout returns the timeout for acquiring the index lock: the timeout from the repo's "lock" section,
+// or else the configured global index lock timeout
+func lockTimeout(conf map[string]any) time.Duration {
+	if t, ok := lockDuration(conf, KeyLockTimeout); ok {
+		return t
+	}
+	if t := viper.GetDuration(config.KeyIndexLockTimeout); t > 0 {
+		return t
+	}
+	return indexLockTimeout
+}
+
+// lockLease returns the lease duration from the repo's "lock" section, or defaultLockLease
+func lockLease(conf map[string]any) time.Duration {
+	if l, ok := lockDuration(conf, KeyLockLease); ok {
+		return l
+	}
+	return defaultLockLease
+}
+
+func lockDuration(conf map[string]any, key string) (time.Duration, bool) {
+	s := utils.JsGetString(utils.JsGetMap(conf, KeyRepoLock), key)
+	if s == nil {
+		return 0, false
+	}
+	d, err := time.ParseDuration(*s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// validateLockConfig checks that the "lock" section of a repo config, if present, is valid. kinds are the lock kinds
+// supported by the repo type. When empty, the repo type does not allow to choose a lock kind
+func validateLockConfig(rc map[string]any, kinds ...string) error {
+	v, ok := rc[KeyRepoLock]
+	if !ok {
+		return nil
+	}
+	conf, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid json config. %s must be a map", KeyRepoLock)
+	}
+	for k, v := range conf {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("invalid lock config. %s must be a string", k)
+		}
+		switch k {
+		case KeyLockKind:
+			if !slices.Contains(kinds, s) {
+				if len(kinds) == 0 {
+					return fmt.Errorf("invalid lock config. %s is not supported for this repo type", KeyLockKind)
+				}
+				return fmt.Errorf("invalid lock config. %s must be one of %v", KeyLockKind, kinds)
+			}
+		case KeyLockTimeout:
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid lock config. %s must be a positive duration, e.g. \"10s\"", k)
+			}
+		case KeyLockLease:
+			d, err := time.ParseDuration(s)
+			if err != nil || d < minLockLease {
+				return fmt.Errorf("invalid lock config. %s must be a duration of at least %v, e.g. \"30s\"", k, minLockLease)
+			}
+		case KeyLockName:
+			if s == "" {
+				return fmt.Errorf("invalid lock config. %s must not be empty", k)
+			}
+		case KeyLockDriver:
+			if s != LockDriverPostgres && s != LockDriverSqlite {
+				return fmt.Errorf("invalid lock config. %s must be one of %v", KeyLockDriver, []string{LockDriverPostgres, LockDriverSqlite})
+			}
+		case KeyLockDSN:
+		default:
+			return fmt.Errorf("invalid lock config. unknown key %s", k)
+		}
+	}
+	if conf[KeyLockKind] == LockKindDB && (conf[KeyLockDriver] == nil || conf[KeyLockDSN] == nil) {
+		return fmt.Errorf("invalid lock config. lock kind %s requires %s and %s", LockKindDB, KeyLockDriver, KeyLockDSN)
+	}
+	return nil
+}
+
+// newLockOwner creates a unique identifier of a lock owner
+func newLockOwner() string {
+	host, _ := os.Hostname()
+	r := make([]byte, 8)
+	_, _ = rand.Read(r)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(r))
+}
+
+// waitRetry waits for delay before the next attempt to acquire a lock. Returns ErrIndexLocked if ctx's deadline
+// has been exceeded and ctx's error if ctx is canceled otherwise
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrIndexLocked
+		}
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// flockLocker locks with an advisory file lock. Suitable for local file systems
+type flockLocker struct {
+	file    string
+	timeout time.Duration
+}
+
+func (l *flockLocker) Lock(ctx context.Context) (unlockFunc, error) {
+	fl := flock.New(l.file)
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	unlock := func() {
+		cancel()
+		_ = fl.Unlock()
+	}
+	locked, err := fl.TryLockContext(ctx, indexLocRetryDelay)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return unlock, ErrIndexLocked
+	}
+	if err != nil {
+		return unlock, err
+	}
+	if !locked {
+		return unlock, ErrIndexLocked
+	}
+	return unlock, nil
+}
+
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// leaseLocker locks by creating a lease file with an expiry time, which is renewed by a heartbeat while the lock is
+// held. A lease left behind by a crashed process expires and is taken over. Suitable for network file systems,
+// on which flock is unreliable.
+// Taking over an expired lease is not atomic: two processes seeing the same expired lease at the same time may
+// both believe to have acquired the lock. Choose a lease long enough that this does not happen in practice
+type leaseLocker struct {
+	file    string
+	timeout time.Duration
+	lease   time.Duration
+}
+
+func (l *leaseLocker) Lock(ctx context.Context) (unlockFunc, error) {
+	owner := newLockOwner()
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	for {
+		err := l.create(owner)
+		if err == nil {
+			return l.keepAlive(owner), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return func() {}, err
+		}
+		l.removeExpired()
+		if err := waitRetry(ctx, indexLocRetryDelay); err != nil {
+			return func() {}, err
+		}
+	}
+}
+
+// create creates the lease file, if it does not exist yet. The lease is written to a temporary file first and then
+// linked to the lease file, so that other processes never see an incomplete lease
+func (l *leaseLocker) create(owner string) error {
+	b, _ := json.Marshal(lease{Owner: owner, Expires: time.Now().Add(l.lease)})
+	tmp := l.file + "." + owner
+	err := os.WriteFile(tmp, b, defaultFilePermissions)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Link(tmp, l.file)
+}
+
+func (l *leaseLocker) read() (lease, error) {
+	var ls lease
+	b, err := os.ReadFile(l.file)
+	if err != nil {
+		return ls, err
+	}
+	err = json.Unmarshal(b, &ls)
+	return ls, err
+}
+
+// removeExpired removes the lease file if the lease has expired or the file is unreadable
+func (l *leaseLocker) removeExpired() {
+	ls, err := l.read()
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && time.Now().Before(ls.Expires)) {
+		return
+	}
+	slog.Default().Warn("removing expired index lease", "file", l.file, "owner", ls.Owner)
+	_ = os.Remove(l.file)
+}
+
+// keepAlive starts the heartbeat renewing the lease of owner and returns the function which stops it and releases
+// the lease
+func (l *leaseLocker) keepAlive(owner string) unlockFunc {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(l.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !l.renew(owner) {
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+			if ls, err := l.read(); err == nil && ls.Owner == owner {
+				_ = os.Remove(l.file)
+			}
+		})
+	}
+}
+
+// renew extends the lease of owner. Returns false if the lease is not held by owner anymore
+func (l *leaseLocker) renew(owner string) bool {
+	ls, err := l.read()
+	if err != nil || ls.Owner != owner {
+		slog.Default().Warn("index lease has been lost", "file", l.file, "owner", owner)
+		return false
+	}
+	b, _ := json.Marshal(lease{Owner: owner, Expires: time.Now().Add(l.lease)})
+	err = utils.AtomicWriteFile(l.file, b, defaultFilePermissions)
+	if err != nil {
+		slog.Default().Warn("could not renew index lease", "file", l.file, "error", err)
+	}
+	return true
+}
+
+// dbLocker locks with a lock held in a database, so that processes on different hosts can share a repo.
+// With PostgreSQL, a session level advisory lock is used, with a key derived from the lock's key.
+// With SQLite, which has no advisory locks, the lock is a write transaction held open on the database
+type dbLocker struct {
+	driver  string
+	dsn     string
+	key     string
+	timeout time.Duration
+}
+
+func (l *dbLocker) Lock(ctx context.Context) (unlockFunc, error) {
+	driverName := "pgx"
+	if l.driver == LockDriverSqlite {
+		driverName = sqliteDriverName
+	}
+	db, err := sql.Open(driverName, l.dsn)
+	if err != nil {
+		return func() {}, fmt.Errorf("could not open lock database: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+		return func() {}, fmt.Errorf("could not connect to lock database: %w", err)
+	}
+	release := func() {
+		_ = conn.Close()
+		_ = db.Close()
+	}
+	for {
+		locked, err := l.tryLock(ctx, conn)
+		if err != nil && ctx.Err() == nil {
+			release()
+			return func() {}, fmt.Errorf("could not acquire database lock: %w", err)
+		}
+		if locked {
+			return func() {
+				l.unlock(conn)
+				release()
+			}, nil
+		}
+		if err := waitRetry(ctx, lockRetryDelay); err != nil {
+			release()
+			return func() {}, err
+		}
+	}
+}
+
+func (l *dbLocker) tryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	if l.driver == LockDriverSqlite {
+		_, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+		var sErr *sqlite.Error
+		if errors.As(err, &sErr) && sErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	var locked bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.advisoryKey()).Scan(&locked)
+	return locked, err
+}
+
+func (l *dbLocker) unlock(conn *sql.Conn) {
+	var err error
+	if l.driver == LockDriverSqlite {
+		_, err = conn.ExecContext(context.Background(), "ROLLBACK")
+	} else {
+		_, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.advisoryKey())
+	}
+	if err != nil {
+		slog.Default().Warn("could not release database lock", "key", l.key, "error", err)
+	}
+}
+
+// advisoryKey maps the lock's key to a PostgreSQL advisory lock key
+func (l *dbLocker) advisoryKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.key))
+	return int64(h.Sum64())
+}
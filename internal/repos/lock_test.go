@@ -0,0 +1,208 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+func TestNewIndexLocker(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), IndexFilename)
+
+	t.Run("default", func(t *testing.T) {
+		l, err := newIndexLocker(map[string]any{}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, &flockLocker{file: lockFile + ".lock", timeout: indexLockTimeout}, l)
+	})
+	t.Run("global timeout", func(t *testing.T) {
+		viper.Set(config.KeyIndexLockTimeout, 2*time.Second)
+		defer viper.Set(config.KeyIndexLockTimeout, nil)
+		l, err := newIndexLocker(map[string]any{}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, &flockLocker{file: lockFile + ".lock", timeout: 2 * time.Second}, l)
+	})
+	t.Run("lease", func(t *testing.T) {
+		l, err := newIndexLocker(map[string]any{"lock": map[string]any{"kind": "lease", "timeout": "1s"}}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, &leaseLocker{file: lockFile + ".lease", timeout: time.Second, lease: defaultLockLease}, l)
+	})
+	t.Run("db", func(t *testing.T) {
+		l, err := newIndexLocker(map[string]any{"lock": map[string]any{"kind": "db", "driver": "postgres", "dsn": "postgres://localhost/tmc"}}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, &dbLocker{driver: "postgres", dsn: "postgres://localhost/tmc", key: lockFile, timeout: indexLockTimeout}, l)
+	})
+	t.Run("db with name", func(t *testing.T) {
+		l, err := newIndexLocker(map[string]any{"lock": map[string]any{"kind": "db", "driver": "postgres", "dsn": "postgres://localhost/tmc", "name": "catalog"}}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, &dbLocker{driver: "postgres", dsn: "postgres://localhost/tmc", key: "catalog", timeout: indexLockTimeout}, l)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newIndexLocker(map[string]any{"lock": map[string]any{"kind": "lease", "lease": "forever"}}, lockFile)
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateLockConfig(t *testing.T) {
+	tests := []struct {
+		json   string
+		kinds  []string
+		expErr bool
+	}{
+		{`{}`, nil, false},
+		{`{"lock":{"timeout":"3s"}}`, nil, false},
+		{`{"lock":{"kind":"lease"}}`, nil, true},
+		{`{"lock":{"kind":"lease","lease":"1m"}}`, []string{LockKindFlock, LockKindLease}, false},
+		{`{"lock":{"kind":"db","driver":"sqlite","dsn":"lock.db"}}`, []string{LockKindDB}, false},
+		{`{"lock":{"kind":"db","driver":"mysql","dsn":"lock.db"}}`, []string{LockKindDB}, true},
+		{`{"lock":{"kind":"db","driver":"sqlite"}}`, []string{LockKindDB}, true},
+		{`{"lock":{"kind":"db","driver":"sqlite","dsn":"lock.db","name":"catalog"}}`, []string{LockKindDB}, false},
+		{`{"lock":{"kind":"db","driver":"sqlite","dsn":"lock.db","name":""}}`, []string{LockKindDB}, true},
+		{`{"lock":{"timeout":"-3s"}}`, nil, true},
+		{`{"lock":{"kind":"lease","lease":"1ns"}}`, []string{LockKindLease}, true},
+		{`{"lock":{"kind":"lease","lease":"999ms"}}`, []string{LockKindLease}, true},
+		{`{"lock":{"timeout":3}}`, nil, true},
+		{`{"lock":{"heartbeat":"3s"}}`, nil, true},
+		{`{"lock":"flock"}`, nil, true},
+	}
+	for i, test := range tests {
+		var rc map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(test.json), &rc))
+		err := validateLockConfig(rc, test.kinds...)
+		if test.expErr {
+			assert.Errorf(t, err, "error expected in test %d", i)
+		} else {
+			assert.NoErrorf(t, err, "no error expected in test %d", i)
+		}
+	}
+}
+
+func TestFlockLocker(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "index.lock")
+	l := &flockLocker{file: file, timeout: 100 * time.Millisecond}
+
+	unlock, err := l.Lock(context.Background())
+	assert.NoError(t, err)
+	_, err = l.Lock(context.Background())
+	assert.ErrorIs(t, err, ErrIndexLocked)
+	unlock()
+
+	unlock, err = l.Lock(context.Background())
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestLeaseLocker(t *testing.T) {
+	t.Run("lock and unlock", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		l := &leaseLocker{file: file, timeout: 100 * time.Millisecond, lease: time.Minute}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		assert.FileExists(t, file)
+
+		_, err = l.Lock(context.Background())
+		assert.ErrorIs(t, err, ErrIndexLocked)
+
+		unlock()
+		assert.NoFileExists(t, file)
+		unlock, err = l.Lock(context.Background())
+		assert.NoError(t, err)
+		unlock()
+		entries, _ := os.ReadDir(filepath.Dir(file))
+		assert.Empty(t, entries)
+	})
+	t.Run("expired lease is taken over", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		b, _ := json.Marshal(lease{Owner: "crashed", Expires: time.Now().Add(-time.Second)})
+		assert.NoError(t, os.WriteFile(file, b, defaultFilePermissions))
+		l := &leaseLocker{file: file, timeout: time.Second, lease: time.Minute}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		ls, err := l.read()
+		assert.NoError(t, err)
+		assert.NotEqual(t, "crashed", ls.Owner)
+		unlock()
+	})
+	t.Run("unreadable lease is taken over", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		assert.NoError(t, os.WriteFile(file, []byte("{"), defaultFilePermissions))
+		l := &leaseLocker{file: file, timeout: time.Second, lease: time.Minute}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		unlock()
+	})
+	t.Run("heartbeat renews lease", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		l := &leaseLocker{file: file, timeout: 100 * time.Millisecond, lease: 150 * time.Millisecond}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		defer unlock()
+		first, _ := l.read()
+		time.Sleep(400 * time.Millisecond)
+		// the lease would have expired without the heartbeat
+		_, err = l.Lock(context.Background())
+		assert.ErrorIs(t, err, ErrIndexLocked)
+		renewed, _ := l.read()
+		assert.Equal(t, first.Owner, renewed.Owner)
+		assert.True(t, renewed.Expires.After(first.Expires))
+	})
+	t.Run("lease of other owner is kept on unlock", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		l := &leaseLocker{file: file, timeout: 100 * time.Millisecond, lease: time.Minute}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		b, _ := json.Marshal(lease{Owner: "other", Expires: time.Now().Add(time.Minute)})
+		assert.NoError(t, os.WriteFile(file, b, defaultFilePermissions))
+		unlock()
+		assert.FileExists(t, file)
+	})
+	t.Run("canceled context", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "index.lease")
+		l := &leaseLocker{file: file, timeout: time.Second, lease: time.Minute}
+		unlock, err := l.Lock(context.Background())
+		assert.NoError(t, err)
+		defer unlock()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = l.Lock(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestDBLocker_Sqlite(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "lock.db")
+	l := &dbLocker{driver: LockDriverSqlite, dsn: dsn, key: "index", timeout: 200 * time.Millisecond}
+
+	unlock, err := l.Lock(context.Background())
+	assert.NoError(t, err)
+	_, err = l.Lock(context.Background())
+	assert.ErrorIs(t, err, ErrIndexLocked)
+	unlock()
+
+	unlock, err = l.Lock(context.Background())
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestFileRepo_LockKinds(t *testing.T) {
+	for _, lc := range []map[string]any{
+		{"kind": "flock"},
+		{"kind": "lease"},
+		{"kind": "db", "driver": "sqlite", "dsn": filepath.Join(t.TempDir(), "lock.db")},
+	} {
+		t.Run(lc["kind"].(string), func(t *testing.T) {
+			r, err := NewFileRepo(map[string]any{"loc": t.TempDir(), "lock": lc}, model.NewRepoSpec("fr"))
+			assert.NoError(t, err)
+			unlock, err := r.lockIndex(context.Background())
+			assert.NoError(t, err)
+			unlock()
+		})
+	}
+}
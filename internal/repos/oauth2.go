@@ -0,0 +1,215 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	KeyOAuth2TokenURL     = "tokenUrl"
+	KeyOAuth2ClientID     = "clientId"
+	KeyOAuth2ClientSecret = "clientSecret"
+	KeyOAuth2Scopes       = "scopes"
+	KeyOAuth2Audience     = "audience"
+
+	// oauth2RefreshMargin is how long before its expiry an access token is replaced by a new one
+	oauth2RefreshMargin = 30 * time.Second
+)
+
+var (
+	oauth2SourcesMu sync.Mutex
+	// oauth2Sources holds the token sources by their config. A token source is created once per process and shared by
+	// all repos with the same config, because repos are created anew for every operation
+	oauth2Sources = map[oauth2Config]*oauth2TokenSource{}
+)
+
+// oauth2Config is the config of an oauth2 client using the client credentials grant
+type oauth2Config struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	// scopes is the space separated list of scopes to request
+	scopes   string
+	audience string
+}
+
+// parseOAuth2Config reads and validates the "oauth2" section of a repo's auth config. "scopes" may be given as list
+// of strings or as a space separated string
+func parseOAuth2Config(conf map[string]any) (oauth2Config, error) {
+	var c oauth2Config
+	tu := utils.JsGetString(conf, KeyOAuth2TokenURL)
+	if tu == nil {
+		return c, fmt.Errorf("invalid oauth2 config. must have string %q", KeyOAuth2TokenURL)
+	}
+	u, err := url.Parse(*tu)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return c, fmt.Errorf("invalid oauth2 config. %q must be a http or https URL", KeyOAuth2TokenURL)
+	}
+	c.tokenURL = *tu
+	id := utils.JsGetString(conf, KeyOAuth2ClientID)
+	secret := utils.JsGetString(conf, KeyOAuth2ClientSecret)
+	if id == nil || *id == "" || secret == nil {
+		return c, fmt.Errorf("invalid oauth2 config. must have strings %q and %q", KeyOAuth2ClientID, KeyOAuth2ClientSecret)
+	}
+	c.clientID, c.clientSecret = *id, *secret
+	switch s := conf[KeyOAuth2Scopes].(type) {
+	case nil:
+	case string:
+		c.scopes = strings.Join(strings.Fields(s), " ")
+	case []any:
+		var scopes []string
+		for _, v := range s {
+			scope, ok := v.(string)
+			if !ok {
+				return c, fmt.Errorf("invalid oauth2 config. %q must be a list of strings", KeyOAuth2Scopes)
+			}
+			scopes = append(scopes, scope)
+		}
+		c.scopes = strings.Join(scopes, " ")
+	default:
+		return c, fmt.Errorf("invalid oauth2 config. %q must be a list of strings", KeyOAuth2Scopes)
+	}
+	if a, ok := conf[KeyOAuth2Audience]; ok {
+		as, isStr := a.(string)
+		if !isStr {
+			return c, fmt.Errorf("invalid oauth2 config. %q must be a string", KeyOAuth2Audience)
+		}
+		c.audience = as
+	}
+	return c, nil
+}
+
+// oauth2TokenSource fetches access tokens with the client credentials grant and caches them until shortly
+// before they expire
+type oauth2TokenSource struct {
+	conf   oauth2Config
+	client *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	// refreshAt is the time after which the access token is replaced. Zero, if the token does not expire
+	refreshAt time.Time
+}
+
+// newOAuth2TokenSource returns the shared token source for the oauth2 config conf
+func newOAuth2TokenSource(conf map[string]any, client *http.Client) (*oauth2TokenSource, error) {
+	c, err := parseOAuth2Config(conf)
+	if err != nil {
+		return nil, err
+	}
+	oauth2SourcesMu.Lock()
+	defer oauth2SourcesMu.Unlock()
+	if src, ok := oauth2Sources[c]; ok {
+		return src, nil
+	}
+	src := &oauth2TokenSource{conf: c, client: client}
+	oauth2Sources[c] = src
+	return src, nil
+}
+
+// token returns the cached access token, or fetches a new one if there is none or it is about to expire
+func (s *oauth2TokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && (s.refreshAt.IsZero() || time.Now().Before(s.refreshAt)) {
+		return s.accessToken, nil
+	}
+	return s.fetch(ctx)
+}
+
+// invalidate drops the cached access token, if it is the rejected one. Another goroutine may have replaced it already
+func (s *oauth2TokenSource) invalidate(rejected string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken == rejected {
+		s.accessToken = ""
+	}
+}
+
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// fetch requests a new access token from the token endpoint. Must be called with s.mu held
+func (s *oauth2TokenSource) fetch(ctx context.Context) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if s.conf.scopes != "" {
+		form.Set("scope", s.conf.scopes)
+	}
+	if s.conf.audience != "" {
+		form.Set("audience", s.conf.audience)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.conf.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", mimeJSON)
+	req.SetBasicAuth(url.QueryEscape(s.conf.clientID), url.QueryEscape(s.conf.clientSecret))
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not obtain oauth2 access token: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not obtain oauth2 access token: %w", err)
+	}
+	var tr oauth2TokenResponse
+	jErr := json.Unmarshal(b, &tr)
+	if resp.StatusCode != http.StatusOK {
+		msg := resp.Status
+		if jErr == nil && tr.Error != "" {
+			msg = fmt.Sprintf("%s: %s %s", msg, tr.Error, tr.ErrorDescription)
+		}
+		return "", fmt.Errorf("could not obtain oauth2 access token: token endpoint returned %s", strings.TrimSpace(msg))
+	}
+	if jErr != nil || tr.AccessToken == "" {
+		return "", errors.New("could not obtain oauth2 access token: invalid token response")
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return "", fmt.Errorf("could not obtain oauth2 access token: unsupported token type %s", tr.TokenType)
+	}
+	s.accessToken = tr.AccessToken
+	s.refreshAt = time.Time{}
+	if tr.ExpiresIn > 0 {
+		lifetime := time.Duration(tr.ExpiresIn) * time.Second
+		s.refreshAt = start.Add(lifetime - min(oauth2RefreshMargin, lifetime/2))
+	}
+	return s.accessToken, nil
+}
+
+// oauth2Auth authenticates requests with access tokens obtained with the oauth2 client credentials grant
+type oauth2Auth struct {
+	src *oauth2TokenSource
+}
+
+func (o *oauth2Auth) authorize(req *http.Request) error {
+	tok, err := o.src.token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return nil
+}
+
+func (o *oauth2Auth) renew(req *http.Request) bool {
+	rejected, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	o.src.invalidate(rejected)
+	return true
+}
@@ -0,0 +1,151 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/testutils/oauth2fake"
+)
+
+// newOAuth2TestServer starts a tmc API stand-in accepting pushes authenticated with tokens issued by authSrv.
+// It counts the requests it receives and records the bodies of accepted pushes
+func newOAuth2TestServer(t *testing.T, authSrv *oauth2fake.Server) (*httptest.Server, *atomic.Int32, *[]string) {
+	var requests atomic.Int32
+	var pushed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !authSrv.Valid(r.Header.Get("Authorization")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		pushed = append(pushed, string(b))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &pushed
+}
+
+func newOAuth2TestRepo(t *testing.T, loc string, authSrv *oauth2fake.Server, secret string) *TmcRepo {
+	r, err := NewTmcRepo(map[string]any{
+		"type": "tmc",
+		"loc":  loc,
+		"auth": map[string]any{"oauth2": map[string]any{
+			"tokenUrl":     authSrv.TokenURL(),
+			"clientId":     authSrv.ClientID,
+			"clientSecret": secret,
+			"scopes":       []any{"tmc.read", "tmc.push"},
+			"audience":     "https://tmc.example.com",
+		}},
+	}, model.NewRepoSpec("tmc"))
+	assert.NoError(t, err)
+	return r
+}
+
+func TestOAuth2_TokenIsCached(t *testing.T) {
+	authSrv := oauth2fake.NewServer("ci", "s3cr3t")
+	defer authSrv.Close()
+	srv, _, pushed := newOAuth2TestServer(t, authSrv)
+	id := model.MustParseTMID(sqliteTestId1)
+
+	// repos are created anew for every operation, but share the token
+	for i := 0; i < 3; i++ {
+		r := newOAuth2TestRepo(t, srv.URL, authSrv, "s3cr3t")
+		assert.NoError(t, r.Push(context.Background(), id, []byte("{}")))
+	}
+	assert.Len(t, *pushed, 3)
+	assert.Equal(t, 1, authSrv.Issued())
+	assert.Equal(t, "tmc.read tmc.push", authSrv.LastForm.Get("scope"))
+	assert.Equal(t, "https://tmc.example.com", authSrv.LastForm.Get("audience"))
+}
+
+func TestOAuth2_TokenIsRefreshedBeforeExpiry(t *testing.T) {
+	authSrv := oauth2fake.NewServer("ci", "s3cr3t")
+	defer authSrv.Close()
+	authSrv.ExpiresIn = time.Second
+	srv, requests, _ := newOAuth2TestServer(t, authSrv)
+	r := newOAuth2TestRepo(t, srv.URL, authSrv, "s3cr3t")
+	id := model.MustParseTMID(sqliteTestId1)
+
+	assert.NoError(t, r.Push(context.Background(), id, []byte("{}")))
+	time.Sleep(600 * time.Millisecond)
+	assert.NoError(t, r.Push(context.Background(), id, []byte("{}")))
+
+	assert.Equal(t, 2, authSrv.Issued())
+	assert.Equal(t, int32(2), requests.Load(), "the token must be replaced before it is rejected")
+}
+
+func TestOAuth2_RetryOnceOn401(t *testing.T) {
+	authSrv := oauth2fake.NewServer("ci", "s3cr3t")
+	defer authSrv.Close()
+	srv, requests, pushed := newOAuth2TestServer(t, authSrv)
+	r := newOAuth2TestRepo(t, srv.URL, authSrv, "s3cr3t")
+	id := model.MustParseTMID(sqliteTestId1)
+	assert.NoError(t, r.Push(context.Background(), id, []byte(`{"n":1}`)))
+
+	t.Run("rotated token", func(t *testing.T) {
+		authSrv.RevokeAll()
+		requests.Store(0)
+		assert.NoError(t, r.Push(context.Background(), id, []byte(`{"n":2}`)))
+		assert.Equal(t, int32(2), requests.Load())
+		assert.Equal(t, 2, authSrv.Issued())
+		assert.Equal(t, []string{`{"n":1}`, `{"n":2}`}, *pushed, "the request body must be sent again")
+	})
+	t.Run("rejected token", func(t *testing.T) {
+		rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer rejecting.Close()
+		r := newOAuth2TestRepo(t, rejecting.URL, authSrv, "s3cr3t")
+		requests.Store(0)
+		_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+}
+
+func TestOAuth2_InvalidClient(t *testing.T) {
+	authSrv := oauth2fake.NewServer("ci", "s3cr3t")
+	defer authSrv.Close()
+	srv, requests, _ := newOAuth2TestServer(t, authSrv)
+	r := newOAuth2TestRepo(t, srv.URL, authSrv, "wrong")
+
+	err := r.Push(context.Background(), model.MustParseTMID(sqliteTestId1), []byte("{}"))
+	assert.ErrorContains(t, err, "invalid_client")
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestOAuth2_HttpRepo(t *testing.T) {
+	authSrv := oauth2fake.NewServer("reader", "s3cr3t")
+	defer authSrv.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authSrv.Valid(r.Header.Get("Authorization")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": sqliteTestId1})
+	}))
+	defer srv.Close()
+	r, err := NewHttpRepo(map[string]any{
+		"type": "http",
+		"loc":  srv.URL,
+		"auth": map[string]any{"oauth2": map[string]any{"tokenUrl": authSrv.TokenURL(), "clientId": "reader", "clientSecret": "s3cr3t"}},
+	}, model.NewRepoSpec("http"))
+	assert.NoError(t, err)
+
+	_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+	assert.NoError(t, err)
+	authSrv.RevokeAll()
+	_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, authSrv.Issued())
+}
@@ -0,0 +1,548 @@
+package repos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	ociTMMediaType    = "application/tm+json"
+	ociIndexMediaType = "application/vnd.wot-oss.tmc.index.v1+json"
+	// ociIndexRepository is the repository below the repo's namespace holding the index. It cannot clash with a TM name,
+	// because those consist of at least three path segments
+	ociIndexRepository = "tmc-index"
+	ociIndexTag        = "latest"
+
+	ociAnnotationTitle   = "org.opencontainers.image.title"
+	ociAnnotationCreated = "org.opencontainers.image.created"
+	ociAnnotationTMID    = "com.github.wot-oss.tmc.tmid"
+	ociAnnotationDigest  = "com.github.wot-oss.tmc.digest"
+)
+
+var ociRepositoryComponentRegex = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*$`)
+
+// OCIRepo implements a Repo TM repository backed by an OCI distribution registry.
+// Each TM name maps to a repository below the namespace given by the path of the repo's location, each TM version to a
+// tag of that repository, and each TM file to an artifact with a single layer holding the file. As artifacts of
+// different TMs differ by their annotations, a TM's content is identified by its manifest digest.
+// The index is stored as an artifact in the repository tmc-index. Registries offer no conditional writes to lock the
+// index with, so updates of the index are guarded by a file lock in the local config dir, which coordinates writers
+// on the same host. Writers on different hosts must share a database lock configured in the repo's "lock" section
+type OCIRepo struct {
+	registry  *ociRegistry
+	namespace string
+	spec      model.RepoSpec
+	locker    IndexLocker
+	lockFile  string
+}
+
+func NewOCIRepo(config map[string]any, spec model.RepoSpec) (*OCIRepo, error) {
+	base, err := newBaseHttpRepo(config, spec)
+	if err != nil {
+		return nil, err
+	}
+	if base.parsedRoot.Scheme != "http" && base.parsedRoot.Scheme != "https" || base.parsedRoot.Host == "" {
+		return nil, fmt.Errorf("invalid oci repo config. loc must be of the form https://<registry-host>[/<namespace>]")
+	}
+	err = validateLockConfig(config, LockKindFlock, LockKindDB)
+	if err != nil {
+		return nil, err
+	}
+	lockFile := ociLockFile(base.root)
+	locker, err := newIndexLocker(config, lockFile)
+	if err != nil {
+		return nil, err
+	}
+	if dl, ok := locker.(*dbLocker); ok && dl.key == lockFile {
+		// the lock file's path differs between hosts, while the location is the same for all writers
+		dl.key = base.root
+	}
+	return &OCIRepo{
+		registry: &ociRegistry{
+			baseHttpRepo: base,
+			base:         &url.URL{Scheme: base.parsedRoot.Scheme, Host: base.parsedRoot.Host},
+		},
+		namespace: strings.Trim(base.parsedRoot.Path, "/"),
+		spec:      spec,
+		locker:    locker,
+		lockFile:  lockFile,
+	}, nil
+}
+
+// ociLockFile returns the name of the local file locking the index of the OCI repo at loc
+func ociLockFile(loc string) string {
+	sum := sha256.Sum256([]byte(loc))
+	return filepath.Join(config.DefaultConfigDir, "locks", "oci-"+hex.EncodeToString(sum[:8]))
+}
+
+// lockIndex acquires the lock guarding updates of the index
+func (o *OCIRepo) lockIndex(ctx context.Context) (unlockFunc, error) {
+	err := os.MkdirAll(filepath.Dir(o.lockFile), defaultDirPermissions)
+	if err != nil {
+		return func() {}, err
+	}
+	return o.locker.Lock(ctx)
+}
+
+// repository returns the name of the repository holding TMs with given name
+func (o *OCIRepo) repository(name string) (string, error) {
+	for _, c := range strings.Split(name, "/") {
+		if !ociRepositoryComponentRegex.MatchString(c) {
+			return "", fmt.Errorf("TM name %s cannot be used as OCI repository name", name)
+		}
+	}
+	if o.namespace == "" {
+		return name, nil
+	}
+	return o.namespace + "/" + name, nil
+}
+
+// ociTag returns the tag for a TM version. Semantic versions may contain build metadata separated by '+', which is not
+// allowed in tags and replaced with '_', following the convention of other tools storing versioned artifacts in registries
+func ociTag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+func ociVersion(tag string) string {
+	return strings.ReplaceAll(tag, "_", "+")
+}
+
+// locate returns the repository and tag of the TM with given id
+func (o *OCIRepo) locate(id string) (string, string, error) {
+	tmid, err := model.ParseTMID(id)
+	if err != nil {
+		return "", "", err
+	}
+	repository, err := o.repository(tmid.Name)
+	if err != nil {
+		return "", "", err
+	}
+	return repository, ociTag(tmid.Version.String()), nil
+}
+
+func (o *OCIRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
+	if len(raw) == 0 {
+		return errors.New("nothing to write")
+	}
+	idS := id.String()
+	match, existingId, err := o.getExistingID(ctx, idS)
+	if err != nil {
+		return err
+	}
+	switch match {
+	case idMatchDigest:
+		utils.Logger(ctx).Info(fmt.Sprintf("Same TM content already exists under ID %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameContent, ExistingId: existingId}
+	case idMatchTimestamp:
+		utils.Logger(ctx).Info(fmt.Sprintf("Version and timestamp clash with existing %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameTimestamp, ExistingId: existingId}
+	}
+
+	repository, tag, err := o.locate(idS)
+	if err != nil {
+		return err
+	}
+	err = o.pushArtifact(ctx, repository, tag, ociTMMediaType, path.Base(idS), raw, map[string]string{
+		ociAnnotationTMID:   idS,
+		ociAnnotationDigest: id.Version.Hash,
+	})
+	if err != nil {
+		return fmt.Errorf("could not write TM to catalog: %w", err)
+	}
+	utils.Logger(ctx).Info("saved Thing Model artifact", "repository", repository, "tag", tag)
+	return nil
+}
+
+// pushArtifact uploads content as the single layer of an artifact and tags the artifact's manifest
+func (o *OCIRepo) pushArtifact(ctx context.Context, repository, tag, mediaType, title string, content []byte, annotations map[string]string) error {
+	config, err := o.registry.pushBlob(ctx, repository, ociEmptyMediaType, ociEmptyConfig)
+	if err != nil {
+		return err
+	}
+	layer, err := o.registry.pushBlob(ctx, repository, mediaType, content)
+	if err != nil {
+		return err
+	}
+	layer.Annotations = map[string]string{ociAnnotationTitle: title}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ociAnnotationCreated] = time.Now().UTC().Format(time.RFC3339)
+	return o.registry.putManifest(ctx, repository, tag, ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  mediaType,
+		Config:        config,
+		Layers:        []ociDescriptor{layer},
+		Annotations:   annotations,
+	})
+}
+
+// fetchArtifact returns the content of the single layer with given media type of the artifact at repository:ref
+func (o *OCIRepo) fetchArtifact(ctx context.Context, repository, ref, mediaType string) ([]byte, error) {
+	m, _, err := o.registry.getManifest(ctx, repository, ref)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(m.Layers, func(d ociDescriptor) bool { return d.MediaType == mediaType })
+	if i < 0 {
+		return nil, fmt.Errorf("artifact %s:%s has no layer of type %s", repository, ref, mediaType)
+	}
+	return o.registry.getBlob(ctx, repository, m.Layers[i].Digest)
+}
+
+// getExistingID works like FileRepo.getExistingID, with the tags of the TM name's repository in place of the
+// files in the id's directory
+func (o *OCIRepo) getExistingID(ctx context.Context, id string) (idMatch, string, error) {
+	repository, tag, err := o.locate(id)
+	if err != nil {
+		return idMatchNone, "", err
+	}
+	tags, err := o.registry.listTags(ctx, repository)
+	if err != nil {
+		return idMatchNone, "", err
+	}
+	if slices.Contains(tags, tag) {
+		return idMatchFull, id, nil
+	}
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = ociVersion(t) + TMExt
+	}
+	match, existingId := matchExistingVersion(id, names)
+	return match, existingId, nil
+}
+
+func (o *OCIRepo) Fetch(ctx context.Context, id string) (string, []byte, error) {
+	err := checkIdValid(id)
+	if err != nil {
+		return "", nil, err
+	}
+	match, actualId, err := o.getExistingID(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if match != idMatchFull && match != idMatchDigest {
+		return "", nil, ErrTmNotFound
+	}
+	repository, tag, err := o.locate(actualId)
+	if err != nil {
+		return "", nil, err
+	}
+	b, err := o.fetchArtifact(ctx, repository, tag, ociTMMediaType)
+	if errors.Is(err, errOCINotFound) {
+		return "", nil, ErrTmNotFound
+	}
+	return actualId, b, err
+}
+
+// Delete deletes the manifest of the TM's artifact. Whether the registry allows deleting manifests depends on its configuration
+func (o *OCIRepo) Delete(ctx context.Context, id string) error {
+	repository, tag, err := o.locate(id)
+	if err != nil {
+		return err
+	}
+	_, digest, err := o.registry.getManifest(ctx, repository, tag)
+	if errors.Is(err, errOCINotFound) {
+		return ErrTmNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return o.registry.deleteManifest(ctx, repository, digest)
+}
+
+// Index updates the index artifact. A full rebuild needs the registry to support listing its repositories. If it does
+// not, only the TM names already in the index are searched for new and deleted versions
+func (o *OCIRepo) Index(ctx context.Context, ids ...string) error {
+	log := utils.Logger(ctx)
+	start := time.Now()
+	fileCount := 0
+
+	unlock, err := o.lockIndex(ctx)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	idx, err := o.readIndex(ctx)
+	if errors.Is(err, errOCINotFound) {
+		idx = nil
+	} else if err != nil {
+		// starting from an empty index would drop all TMs not listed in ids from the index
+		return err
+	}
+	if len(ids) == 0 { // full rebuild
+		names, err := o.listNames(ctx, idx)
+		if err != nil {
+			return err
+		}
+		idx = &model.Index{
+			Meta: model.IndexMeta{Created: time.Now()},
+			Data: []*model.IndexEntry{},
+		}
+		for _, name := range names {
+			repository, err := o.repository(name)
+			if err != nil {
+				continue
+			}
+			tags, err := o.registry.listTags(ctx, repository)
+			if err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				id := name + "/" + ociVersion(tag) + TMExt
+				if checkIdValid(id) != nil {
+					continue
+				}
+				upd, err := o.updateIndexWithArtifact(ctx, idx, id, log)
+				if err != nil {
+					return err
+				}
+				if upd {
+					fileCount++
+				}
+			}
+		}
+	} else { // partial update
+		if idx == nil {
+			idx = &model.Index{
+				Meta: model.IndexMeta{Created: time.Now()},
+				Data: []*model.IndexEntry{},
+			}
+		}
+		for _, id := range ids {
+			upd, err := o.updateIndexWithArtifact(ctx, idx, id, log)
+			if err != nil {
+				return err
+			}
+			if upd {
+				fileCount++
+			}
+		}
+	}
+
+	idxJson, _ := json.MarshalIndent(idx, "", "  ")
+	err = o.pushArtifact(ctx, o.indexRepository(), ociIndexTag, ociIndexMediaType, IndexFilename, idxJson, nil)
+	if err != nil {
+		return fmt.Errorf("could not write index: %w", err)
+	}
+	log.Info(fmt.Sprintf("Updated index with %d entries in %s ", fileCount, time.Since(start).String()))
+	return nil
+}
+
+// listNames returns the TM names in the registry, taken from the registry's catalog or, if the registry does not
+// support listing repositories, from oldIdx
+func (o *OCIRepo) listNames(ctx context.Context, oldIdx *model.Index) ([]string, error) {
+	repositories, err := o.registry.catalog(ctx)
+	if err != nil {
+		if oldIdx == nil {
+			return nil, fmt.Errorf("cannot list repositories of registry for a full index rebuild: %w", err)
+		}
+		utils.Logger(ctx).Warn("cannot list repositories of registry. Updating index for known TM names only", "error", err)
+		var names []string
+		for _, e := range oldIdx.Data {
+			names = append(names, e.Name)
+		}
+		return names, nil
+	}
+	prefix := ""
+	if o.namespace != "" {
+		prefix = o.namespace + "/"
+	}
+	var names []string
+	for _, r := range repositories {
+		name, found := strings.CutPrefix(r, prefix)
+		if found && r != o.indexRepository() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// updateIndexWithArtifact inserts the TM with given id into idx, or removes id from idx if there is no such TM
+func (o *OCIRepo) updateIndexWithArtifact(ctx context.Context, idx *model.Index, id string, log *slog.Logger) (bool, error) {
+	repository, tag, err := o.locate(id)
+	if err != nil {
+		return false, err
+	}
+	b, err := o.fetchArtifact(ctx, repository, tag, ociTMMediaType)
+	if errors.Is(err, errOCINotFound) {
+		upd, _, err := idx.Delete(id)
+		return upd, err
+	}
+	if err != nil {
+		return false, err
+	}
+	var tm model.ThingModel
+	err = json.Unmarshal(b, &tm)
+	if err == nil {
+		_, err = idx.Insert(&tm)
+	}
+	if err != nil {
+		log.Error("Failed to extract metadata from TM. The TM will be excluded from index", "id", id, "error", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (o *OCIRepo) indexRepository() string {
+	if o.namespace == "" {
+		return ociIndexRepository
+	}
+	return o.namespace + "/" + ociIndexRepository
+}
+
+func (o *OCIRepo) readIndex(ctx context.Context) (*model.Index, error) {
+	b, err := o.fetchArtifact(ctx, o.indexRepository(), ociIndexTag, ociIndexMediaType)
+	if errors.Is(err, errOCINotFound) {
+		return nil, fmt.Errorf("%w: no table of contents found. Run `index` for this repo", errOCINotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx model.Index
+	err = json.Unmarshal(b, &idx)
+	return &idx, err
+}
+
+func (o *OCIRepo) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, error) {
+	utils.Logger(ctx).Debug(fmt.Sprintf("Creating list with filter '%v'", search))
+	idx, err := o.readIndex(ctx)
+	if err != nil {
+		return model.SearchResult{}, err
+	}
+	idx.Filter(search)
+	return model.NewIndexToFoundMapper(o.Spec().ToFoundSource()).ToSearchResult(*idx), nil
+}
+
+func (o *OCIRepo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
+	name = strings.TrimSpace(name)
+	res, err := o.List(ctx, &model.SearchParams{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		err := fmt.Errorf("%w: %s", ErrTmNotFound, name)
+		utils.Logger(ctx).Error(err.Error())
+		return nil, err
+	}
+	return res.Entries[0].Versions, nil
+}
+
+func (o *OCIRepo) Spec() model.RepoSpec {
+	return o.spec
+}
+
+func (o *OCIRepo) ListCompletions(ctx context.Context, kind string, toComplete string) ([]string, error) {
+	switch kind {
+	case CompletionKindNames:
+		namePrefix, seg := longestPath(toComplete)
+		sr, err := o.List(ctx, &model.SearchParams{Name: namePrefix, Options: model.SearchOptions{NameFilterType: model.PrefixMatch}})
+		if err != nil {
+			return nil, err
+		}
+		var ns []string
+		for _, e := range sr.Entries {
+			ns = append(ns, e.Name)
+		}
+		return namesToCompletions(ns, toComplete, seg+1), nil
+	case CompletionKindFetchNames:
+		if strings.Contains(toComplete, "..") {
+			return nil, fmt.Errorf("%w :no completions for name containing '..'", ErrInvalidCompletionParams)
+		}
+		name, _, _ := strings.Cut(toComplete, ":")
+		versions, err := o.Versions(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		var vs []string
+		for _, fv := range versions {
+			vs = append(vs, fmt.Sprintf("%s:%s", name, fv.Version.Model))
+		}
+		return vs, nil
+	default:
+		return nil, ErrInvalidCompletionParams
+	}
+}
+
+func createOCIRepoConfig(loc string, bytes []byte) (map[string]any, error) {
+	if loc != "" {
+		err := validateOCILoc(loc)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			KeyRepoType: RepoTypeOCI,
+			KeyRepoLoc:  loc,
+		}, nil
+	}
+	rc, err := AsRepoConfig(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rType := utils.JsGetString(rc, KeyRepoType); rType != nil {
+		if *rType != RepoTypeOCI {
+			return nil, fmt.Errorf("invalid json config. type must be \"oci\" or absent")
+		}
+	}
+	rc[KeyRepoType] = RepoTypeOCI
+	l := utils.JsGetString(rc, KeyRepoLoc)
+	if l == nil {
+		return nil, fmt.Errorf("invalid json config. must have string \"loc\"")
+	}
+	err = validateOCILoc(*l)
+	if err != nil {
+		return nil, err
+	}
+	err = validateTLSConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateProxyConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateRequestsConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateAuthConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLockConfig(rc, LockKindFlock, LockKindDB)
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func validateOCILoc(loc string) error {
+	u, err := url.Parse(loc)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid oci repo location %s. must be of the form https://<registry-host>[/<namespace>]", loc)
+	}
+	for _, c := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if c != "" && !ociRepositoryComponentRegex.MatchString(c) {
+			return fmt.Errorf("invalid oci repo location %s. namespace must be a valid repository name", loc)
+		}
+	}
+	return nil
+}
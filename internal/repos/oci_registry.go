@@ -0,0 +1,444 @@
+package repos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+	ociPageSize          = 1000
+)
+
+var (
+	errOCINotFound = errors.New("not found in registry")
+	// ociEmptyConfig is the content of the empty config blob of artifacts, which carry no configuration
+	ociEmptyConfig = []byte("{}")
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociRegistry is a minimal client for the OCI distribution API, covering the operations needed by OCIRepo.
+// Requests are authenticated with the repo's auth config, if present. When a request is challenged for a bearer token,
+// the token is requested from the registry's token service, with the credentials of the repo's auth config or
+// anonymously if there are none
+type ociRegistry struct {
+	baseHttpRepo
+	// base is the registry's URL without path, e.g. https://registry.example.com
+	base *url.URL
+
+	mu     sync.Mutex
+	tokens map[string]string // by challenge scope
+}
+
+func ociDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (r *ociRegistry) url(path string) string {
+	return r.base.JoinPath(path).String()
+}
+
+// listTags returns all tags of repository. Returns no tags and no error if the repository does not exist
+func (r *ociRegistry) listTags(ctx context.Context, repository string) ([]string, error) {
+	var res []string
+	next := r.url("/v2/"+repository+"/tags/list") + fmt.Sprintf("?n=%d", ociPageSize)
+	for next != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		var err error
+		next, err = r.getPage(ctx, next, &page)
+		if errors.Is(err, errOCINotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page.Tags...)
+	}
+	return res, nil
+}
+
+// catalog returns the names of all repositories in the registry. Not all registries support listing repositories
+func (r *ociRegistry) catalog(ctx context.Context) ([]string, error) {
+	var res []string
+	next := r.url("/v2/_catalog") + fmt.Sprintf("?n=%d", ociPageSize)
+	for next != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		var err error
+		next, err = r.getPage(ctx, next, &page)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page.Repositories...)
+	}
+	return res, nil
+}
+
+// getPage gets one page of a paginated list into v and returns the URL of the next page from the Link header,
+// or an empty string if there is none
+func (r *ociRegistry) getPage(ctx context.Context, pageUrl string, v any) (string, error) {
+	resp, err := r.do(ctx, http.MethodGet, pageUrl, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", ociResponseError(resp, b)
+	}
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return "", err
+	}
+	link := resp.Header.Get("Link")
+	if link == "" {
+		return "", nil
+	}
+	// Link: </v2/_catalog?last=x&n=1000>; rel="next"
+	target, _, _ := strings.Cut(strings.TrimPrefix(link, "<"), ">")
+	u, err := resp.Request.URL.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// getManifest returns the manifest of repository referenced by a tag or a digest, and the manifest's digest
+func (r *ociRegistry) getManifest(ctx context.Context, repository, ref string) (ociManifest, string, error) {
+	h := http.Header{}
+	h.Set("Accept", ociManifestMediaType)
+	resp, err := r.do(ctx, http.MethodGet, r.url("/v2/"+repository+"/manifests/"+ref), h, nil)
+	if err != nil {
+		return ociManifest{}, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ociManifest{}, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ociManifest{}, "", ociResponseError(resp, b)
+	}
+	var m ociManifest
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return ociManifest{}, "", fmt.Errorf("invalid manifest %s:%s: %w", repository, ref, err)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = ociDigest(b)
+	}
+	return m, digest, nil
+}
+
+// putManifest uploads manifest m and tags it with tag. The blobs referenced by m must have been uploaded before
+func (r *ociRegistry) putManifest(ctx context.Context, repository, tag string, m ociManifest) error {
+	b, _ := json.Marshal(m)
+	h := http.Header{}
+	h.Set("Content-Type", ociManifestMediaType)
+	resp, err := r.do(ctx, http.MethodPut, r.url("/v2/"+repository+"/manifests/"+tag), h, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rb, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return ociResponseError(resp, rb)
+	}
+	return nil
+}
+
+// deleteManifest deletes the manifest with given digest, including all tags referring to it
+func (r *ociRegistry) deleteManifest(ctx context.Context, repository, digest string) error {
+	resp, err := r.do(ctx, http.MethodDelete, r.url("/v2/"+repository+"/manifests/"+digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return ociResponseError(resp, b)
+	}
+	return nil
+}
+
+// getBlob downloads the blob with given digest and verifies its content
+func (r *ociRegistry) getBlob(ctx context.Context, repository, digest string) ([]byte, error) {
+	resp, err := r.do(ctx, http.MethodGet, r.url("/v2/"+repository+"/blobs/"+digest), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ociResponseError(resp, b)
+	}
+	if ociDigest(b) != digest {
+		return nil, fmt.Errorf("content of blob %s in %s does not match its digest", digest, repository)
+	}
+	return b, nil
+}
+
+// pushBlob uploads data as a blob, unless the repository already contains it, and returns its descriptor
+func (r *ociRegistry) pushBlob(ctx context.Context, repository, mediaType string, data []byte) (ociDescriptor, error) {
+	desc := ociDescriptor{MediaType: mediaType, Digest: ociDigest(data), Size: int64(len(data))}
+	resp, err := r.do(ctx, http.MethodHead, r.url("/v2/"+repository+"/blobs/"+desc.Digest), nil, nil)
+	if err != nil {
+		return desc, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+
+	resp, err = r.do(ctx, http.MethodPost, r.url("/v2/"+repository+"/blobs/uploads/"), nil, nil)
+	if err != nil {
+		return desc, err
+	}
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return desc, ociResponseError(resp, b)
+	}
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return desc, fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := loc.Query()
+	q.Set("digest", desc.Digest)
+	loc.RawQuery = q.Encode()
+
+	h := http.Header{}
+	h.Set("Content-Type", "application/octet-stream")
+	resp, err = r.do(ctx, http.MethodPut, loc.String(), h, data)
+	if err != nil {
+		return desc, err
+	}
+	defer resp.Body.Close()
+	b, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return desc, ociResponseError(resp, b)
+	}
+	return desc, nil
+}
+
+// do sends a request. If the registry challenges the request for a bearer token, a token is requested from the
+// registry's token service and the request is sent again with the token
+func (r *ociRegistry) do(ctx context.Context, method, reqUrl string, header http.Header, body []byte) (*http.Response, error) {
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, reqUrl, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			req.Body = http.NoBody
+		}
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		return req, nil
+	}
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	if tok := r.cachedToken(reqUrl); tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+		resp, err = r.client.Do(req)
+	} else if r.auth != nil {
+		// registries without a token service accept the configured credentials directly
+		resp, err = r.doHttp(req)
+	} else {
+		resp, err = r.client.Do(req)
+	}
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	tok, err := r.fetchToken(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	req, err = newReq()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return r.client.Do(req)
+}
+
+func (r *ociRegistry) cachedToken(reqUrl string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens[ociTokenCacheKey(reqUrl)]
+}
+
+// fetchToken requests a token as described by a 'Bearer realm="...",service="...",scope="..."' challenge, presenting
+// the credentials of the repo's auth config, if any
+func (r *ociRegistry) fetchToken(ctx context.Context, challenge string) (string, error) {
+	params := parseAuthParams(challenge[len("bearer "):])
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("registry requested authentication without a token realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %s: %w", realm, err)
+	}
+	q := u.Query()
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	if s := params["scope"]; s != "" {
+		q.Set("scope", s)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	var resp *http.Response
+	if r.auth != nil {
+		resp, err = r.doHttp(req)
+	} else {
+		resp, err = r.client.Do(req)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get token from %s: %s", realm, resp.Status)
+	}
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.Unmarshal(b, &tr)
+	if err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %w", realm, err)
+	}
+	tok := tr.Token
+	if tok == "" {
+		tok = tr.AccessToken
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = map[string]string{}
+	}
+	if scope := params["scope"]; scope != "" {
+		r.tokens[ociTokenScopeKey(scope)] = tok
+	}
+	return tok, nil
+}
+
+// ociTokenCacheKey returns the repository a request URL refers to, which is the part of a token scope tokens are cached by
+func ociTokenCacheKey(reqUrl string) string {
+	u, err := url.Parse(reqUrl)
+	if err != nil {
+		return ""
+	}
+	p := strings.TrimPrefix(u.Path, "/v2/")
+	for _, sep := range []string{"/manifests/", "/blobs/", "/tags/list"} {
+		if i := strings.LastIndex(p, sep); i >= 0 {
+			return p[:i]
+		}
+	}
+	return p
+}
+
+// ociTokenScopeKey returns the repository of a scope of the form "repository:name:pull,push"
+func ociTokenScopeKey(scope string) string {
+	parts := strings.Split(scope, ":")
+	if len(parts) == 3 && parts[0] == "repository" {
+		return parts[1]
+	}
+	return scope
+}
+
+// parseAuthParams parses the comma-separated key="value" pairs of a WWW-Authenticate header
+func parseAuthParams(s string) map[string]string {
+	res := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, s = rest[1:], ""
+			} else {
+				val, s = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, s, _ = strings.Cut(rest, ",")
+		}
+		res[strings.ToLower(strings.TrimSpace(key))] = val
+	}
+	return res
+}
+
+func ociResponseError(resp *http.Response, body []byte) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return errOCINotFound
+	}
+	var e struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &e) == nil && len(e.Errors) > 0 {
+		return fmt.Errorf("registry request failed: %s: %s: %s", resp.Status, e.Errors[0].Code, e.Errors[0].Message)
+	}
+	return fmt.Errorf("registry request failed: %s", resp.Status)
+}
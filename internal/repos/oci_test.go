@@ -0,0 +1,284 @@
+package repos
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/config"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/testutils/ocifake"
+)
+
+func newTestOCIRepo(t *testing.T) (*OCIRepo, *ocifake.Server) {
+	t.Helper()
+	srv := ocifake.NewServer()
+	t.Cleanup(srv.Close)
+	orgConfigDir := config.DefaultConfigDir
+	config.DefaultConfigDir = t.TempDir()
+	t.Cleanup(func() { config.DefaultConfigDir = orgConfigDir })
+	r, err := NewOCIRepo(map[string]any{"type": "oci", "loc": srv.URL + "/tmc"}, model.NewRepoSpec("reg"))
+	assert.NoError(t, err)
+	return r, srv
+}
+
+func TestNewOCIRepo(t *testing.T) {
+	r, err := NewOCIRepo(map[string]any{"type": "oci", "loc": "https://registry.example.com/org/tms/"}, model.NewRepoSpec("reg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "org/tms", r.namespace)
+	assert.Equal(t, "https://registry.example.com", r.registry.base.String())
+	repository, tag, err := r.locate(sqliteTestId2)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/tms/omnicorp-tm-department/omnicorp/omnilamp/subfolder", repository)
+	assert.Equal(t, "v0.0.0-20240409155220-80424c65e4e6", tag)
+
+	_, err = NewOCIRepo(map[string]any{"type": "oci", "loc": "registry.example.com/org"}, model.NewRepoSpec("reg"))
+	assert.Error(t, err)
+}
+
+func TestOCITag(t *testing.T) {
+	assert.Equal(t, "v1.0.0-20240409155220-80424c65e4e6", ociTag("v1.0.0-20240409155220-80424c65e4e6"))
+	assert.Equal(t, "v1.0.0_build.1", ociTag("v1.0.0+build.1"))
+	assert.Equal(t, "v1.0.0+build.1", ociVersion(ociTag("v1.0.0+build.1")))
+}
+
+func TestOCIRepo_PushAndFetch(t *testing.T) {
+	r, srv := newTestOCIRepo(t)
+	ctx := context.Background()
+	raw, err := os.ReadFile(filepath.Join("../../test/data/index", sqliteTestId1))
+	assert.NoError(t, err)
+	id := model.MustParseTMID(sqliteTestId1)
+
+	assert.NoError(t, r.Push(ctx, id, raw))
+	assert.Equal(t, []string{"v3.2.1-20240409155220-3f779458e453"}, srv.Tags("tmc/omnicorp-tm-department/omnicorp/omnilamp"))
+
+	t.Run("fetch by full id", func(t *testing.T) {
+		actualId, b, err := r.Fetch(ctx, sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+		assert.Equal(t, raw, b)
+	})
+	t.Run("fetch by id with different timestamp", func(t *testing.T) {
+		actualId, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "20240409155220", "20240101000000", 1))
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+	})
+	t.Run("fetch non-existing", func(t *testing.T) {
+		_, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "3f779458e453", "000000000000", 1))
+		assert.ErrorIs(t, err, ErrTmNotFound)
+		_, _, err = r.Fetch(ctx, sqliteTestId2)
+		assert.ErrorIs(t, err, ErrTmNotFound)
+	})
+	t.Run("push same id again", func(t *testing.T) {
+		assert.NoError(t, r.Push(ctx, id, raw))
+	})
+	t.Run("push same content with different timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Timestamp = "20240501000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameContent, cErr.Type)
+			assert.Equal(t, sqliteTestId1, cErr.ExistingId)
+		}
+	})
+	t.Run("push different content with same timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Hash = "000000000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameTimestamp, cErr.Type)
+		}
+	})
+	t.Run("push nothing", func(t *testing.T) {
+		assert.Error(t, r.Push(ctx, id, nil))
+	})
+}
+
+func TestOCIRepo_IndexAndList(t *testing.T) {
+	r, srv := newTestOCIRepo(t)
+	ctx := context.Background()
+	srv.PageSize = 1
+	pushTestTMs(t, r, sqliteTestId1, sqliteTestId2)
+	assert.Equal(t, []string{"latest"}, srv.Tags("tmc/tmc-index"))
+
+	res, err := r.List(ctx, &model.SearchParams{})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Entries, 2) {
+		assert.Equal(t, "omnicorp-tm-department/omnicorp/omnilamp", res.Entries[0].Name)
+		assert.Equal(t, model.FoundSource{RepoName: "reg"}, res.Entries[0].Versions[0].FoundIn)
+	}
+
+	vs, err := r.Versions(ctx, "omnicorp-tm-department/omnicorp/omnilamp/subfolder")
+	assert.NoError(t, err)
+	assert.Len(t, vs, 1)
+
+	cs, err := r.ListCompletions(ctx, CompletionKindFetchNames, "omnicorp-tm-department/omnicorp/omnilamp:")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"omnicorp-tm-department/omnicorp/omnilamp:3.2.1"}, cs)
+
+	t.Run("full rebuild from catalog", func(t *testing.T) {
+		// push a second version of a TM without updating the index
+		_, raw, err := r.Fetch(ctx, sqliteTestId1)
+		assert.NoError(t, err)
+		newId := strings.Replace(sqliteTestId1, "v3.2.1-20240409155220", "v3.3.0-20240501000000", 1)
+		var tm map[string]any
+		assert.NoError(t, json.Unmarshal(raw, &tm))
+		tm["id"] = newId
+		raw, _ = json.Marshal(tm)
+		assert.NoError(t, r.Push(ctx, model.MustParseTMID(newId), raw))
+
+		assert.NoError(t, r.Index(ctx))
+		vs, err := r.Versions(ctx, "omnicorp-tm-department/omnicorp/omnilamp")
+		assert.NoError(t, err)
+		assert.Len(t, vs, 2)
+	})
+	t.Run("partial update removes deleted", func(t *testing.T) {
+		assert.NoError(t, r.Delete(ctx, sqliteTestId2))
+		assert.Empty(t, srv.Tags("tmc/omnicorp-tm-department/omnicorp/omnilamp/subfolder"))
+		assert.NoError(t, r.Index(ctx, sqliteTestId2))
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 1)
+	})
+	t.Run("full rebuild without catalog", func(t *testing.T) {
+		srv.DisableCatalog = true
+		defer func() { srv.DisableCatalog = false }()
+		assert.NoError(t, r.Index(ctx))
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 1)
+	})
+}
+
+func TestOCIRepo_List_NoIndex(t *testing.T) {
+	r, _ := newTestOCIRepo(t)
+	_, err := r.List(context.Background(), &model.SearchParams{})
+	assert.ErrorContains(t, err, "no table of contents found")
+}
+
+func TestOCIRepo_Delete(t *testing.T) {
+	r, _ := newTestOCIRepo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1)
+
+	err := r.Delete(ctx, strings.Replace(sqliteTestId1, "20240409155220", "20240101000000", 1))
+	assert.ErrorIs(t, err, ErrTmNotFound)
+	assert.Error(t, r.Delete(ctx, "invalid-id"))
+
+	assert.NoError(t, r.Delete(ctx, sqliteTestId1))
+	_, _, err = r.Fetch(ctx, sqliteTestId1)
+	assert.ErrorIs(t, err, ErrTmNotFound)
+	assert.ErrorIs(t, r.Delete(ctx, sqliteTestId1), ErrTmNotFound)
+}
+
+func TestOCIRepo_TokenAuth(t *testing.T) {
+	r, srv := newTestOCIRepo(t)
+	srv.Token = "anonymous-token"
+	pushTestTMs(t, r, sqliteTestId1)
+	_, _, err := r.Fetch(context.Background(), sqliteTestId1)
+	assert.NoError(t, err)
+
+	t.Run("credentials exchanged for token", func(t *testing.T) {
+		srv.TokenAuthorization = "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+		defer func() { srv.TokenAuthorization = "" }()
+
+		anonymous, err := NewOCIRepo(map[string]any{"type": "oci", "loc": srv.URL + "/tmc"}, model.NewRepoSpec("reg"))
+		assert.NoError(t, err)
+		_, _, err = anonymous.Fetch(context.Background(), sqliteTestId1)
+		assert.ErrorContains(t, err, "401")
+
+		basic := map[string]any{"basic": map[string]any{"username": "alice", "password": "secret"}}
+		r, err := NewOCIRepo(map[string]any{"type": "oci", "loc": srv.URL + "/tmc", "auth": basic}, model.NewRepoSpec("reg"))
+		assert.NoError(t, err)
+		_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+		assert.NoError(t, err)
+
+		r, err = NewOCIRepo(map[string]any{"type": "oci", "loc": srv.URL + "/tmc", "auth": map[string]any{"bearer": "wrong"}}, model.NewRepoSpec("reg"))
+		assert.NoError(t, err)
+		_, _, err = r.Fetch(context.Background(), sqliteTestId1)
+		assert.ErrorContains(t, err, "401")
+	})
+}
+
+func TestOCIRepo_Index_UnreadableIndex(t *testing.T) {
+	r, srv := newTestOCIRepo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1)
+	before := srv.Tags("tmc/tmc-index")
+	srv.Token = "token"
+	srv.TokenAuthorization = "Basic nobody"
+
+	// a partial update must not replace an index it cannot read with one containing only the given ids
+	assert.Error(t, r.Index(ctx, sqliteTestId2))
+	srv.Token, srv.TokenAuthorization = "", ""
+	assert.Equal(t, before, srv.Tags("tmc/tmc-index"))
+	res, err := r.List(ctx, &model.SearchParams{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 1)
+}
+
+func TestOCIRepo_IndexLock(t *testing.T) {
+	r, _ := newTestOCIRepo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1)
+
+	// given: another writer holding the index lock
+	other, err := NewOCIRepo(map[string]any{"type": "oci", "loc": r.registry.root, "lock": map[string]any{"timeout": "100ms"}}, model.NewRepoSpec("other"))
+	assert.NoError(t, err)
+	unlock, err := other.lockIndex(ctx)
+	assert.NoError(t, err)
+	// when: updating the index
+	err = r.Index(ctx, sqliteTestId1)
+	// then: the update waits for the lock and fails
+	assert.ErrorIs(t, err, ErrIndexLocked)
+	unlock()
+	assert.NoError(t, r.Index(ctx, sqliteTestId1))
+
+	_, err = NewOCIRepo(map[string]any{"type": "oci", "loc": r.registry.root, "lock": map[string]any{"kind": "lease"}}, model.NewRepoSpec("other"))
+	assert.Error(t, err)
+}
+
+func TestParseAuthParams(t *testing.T) {
+	p := parseAuthParams(`realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}, p)
+}
+
+func TestCreateOCIRepoConfig(t *testing.T) {
+	tests := []struct {
+		loc    string
+		json   string
+		expErr bool
+		expLoc string
+	}{
+		{"https://registry.example.com/tms", "", false, "https://registry.example.com/tms"},
+		{"http://localhost:5000", "", false, "http://localhost:5000"},
+		{"registry.example.com/tms", "", true, ""},
+		{"https://registry.example.com/TMs", "", true, ""},
+		{"", `{"loc":"https://registry.example.com"}`, false, "https://registry.example.com"},
+		{"", `{"type":"http","loc":"https://registry.example.com"}`, true, ""},
+		{"", `{"loc":"https://registry.example.com","tls":{"caFile":"/does/not/exist.pem"}}`, true, ""},
+		{"", `{}`, true, ""},
+	}
+	for i, test := range tests {
+		rc, err := createOCIRepoConfig(test.loc, []byte(test.json))
+		if test.expErr {
+			assert.Errorf(t, err, "error expected in test %d", i)
+			continue
+		}
+		if assert.NoErrorf(t, err, "no error expected in test %d", i) {
+			assert.Equal(t, RepoTypeOCI, rc[KeyRepoType])
+			assert.Equal(t, test.expLoc, rc[KeyRepoLoc])
+		}
+	}
+}
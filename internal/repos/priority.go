@@ -0,0 +1,96 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+var ErrInvalidPriority = errors.New("invalid priority. must be an integer")
+
+// RepoPriority returns the priority from repo config rc, or 0 if it has none
+func RepoPriority(rc map[string]any) int {
+	p, _ := parsePriority(rc[KeyRepoPriority])
+	return p
+}
+
+func parsePriority(v any) (int, error) {
+	switch p := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return p, nil
+	case int64:
+		return int(p), nil
+	case float64: // numbers read from json config files
+		if p != math.Trunc(p) || math.Abs(p) > math.MaxInt32 {
+			return 0, ErrInvalidPriority
+		}
+		return int(p), nil
+	default:
+		return 0, ErrInvalidPriority
+	}
+}
+
+func validatePriority(rc map[string]any) error {
+	_, err := parsePriority(rc[KeyRepoPriority])
+	return err
+}
+
+// SortedNames returns the names of the repos in conf in resolution order: by priority in descending order, and by
+// name for equal priorities
+func SortedNames(conf Config) []string {
+	names := make([]string, 0, len(conf))
+	for n := range conf {
+		names = append(names, n)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c := RepoPriority(conf[b]) - RepoPriority(conf[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
+// Priorities returns a function giving the configured priority of the source a TM has been found in.
+// Directories and unknown repos have priority 0
+func Priorities() model.PriorityFunc {
+	// read the config directly instead of using ReadConfig, which may rewrite an obsolete config
+	conf, _ := viper.Get(KeyRepos).(map[string]any)
+	ps := make(map[string]int)
+	for n, rc := range conf {
+		if m, ok := rc.(map[string]any); ok {
+			ps[n] = RepoPriority(m)
+		}
+	}
+	return func(s model.FoundSource) int {
+		if s.Directory != "" {
+			return 0
+		}
+		return ps[s.RepoName]
+	}
+}
+
+// SetPriority sets the priority of the named repo
+func SetPriority(name string, priority int) error {
+	conf, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	rc, ok := conf[name]
+	if !ok {
+		return ErrRepoNotFound
+	}
+	if priority == 0 {
+		delete(rc, KeyRepoPriority)
+	} else {
+		rc[KeyRepoPriority] = priority
+	}
+	return saveConfigAudited(conf, name, fmt.Sprintf("set priority %d", priority))
+}
@@ -0,0 +1,119 @@
+package repos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/repos/mocks"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		v       any
+		exp     int
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{5, 5, false},
+		{int64(-3), -3, false},
+		{float64(10), 10, false},
+		{1.5, 0, true},
+		{"10", 0, true},
+		{true, 0, true},
+	}
+	for _, test := range tests {
+		p, err := parsePriority(test.v)
+		assert.Equal(t, test.exp, p, "%v", test.v)
+		assert.Equal(t, test.wantErr, err != nil, "%v", test.v)
+	}
+}
+
+func TestSortedNames(t *testing.T) {
+	conf := Config{
+		"mirror":   {KeyRepoType: RepoTypeHttp},
+		"internal": {KeyRepoType: RepoTypeHttp, KeyRepoPriority: float64(10)},
+		"archive":  {KeyRepoType: RepoTypeFile, KeyRepoPriority: -1},
+		"local":    {KeyRepoType: RepoTypeFile},
+	}
+	assert.Equal(t, []string{"internal", "local", "mirror", "archive"}, SortedNames(conf))
+}
+
+func TestAll_SortedByPriority(t *testing.T) {
+	defer viper.Reset()
+	viper.Set(KeyRepos, map[string]any{
+		"mirror":   map[string]any{"type": "file", "loc": "mirror"},
+		"internal": map[string]any{"type": "file", "loc": "internal", "priority": float64(10)},
+		"archive":  map[string]any{"type": "file", "loc": "archive"},
+	})
+	all, err := All()
+	assert.NoError(t, err)
+	var names []string
+	for _, r := range all {
+		names = append(names, r.Spec().RepoName())
+	}
+	assert.Equal(t, []string{"internal", "archive", "mirror"}, names)
+
+	p := Priorities()
+	assert.Equal(t, 10, p(model.FoundSource{RepoName: "internal"}))
+	assert.Equal(t, 0, p(model.FoundSource{RepoName: "mirror"}))
+	assert.Equal(t, 0, p(model.FoundSource{RepoName: "unknown"}))
+	assert.Equal(t, 0, p(model.FoundSource{Directory: "internal"}))
+}
+
+func TestUnion_PrefersHigherPriority(t *testing.T) {
+	defer viper.Reset()
+	viper.Set(KeyRepos, map[string]any{
+		"internal": map[string]any{"type": "file", "loc": "internal", "priority": float64(10)},
+		"mirror":   map[string]any{"type": "file", "loc": "mirror"},
+	})
+	const (
+		idOld = "author/omnicorp/senseall/v1.0.0-20231130153548-243d1b462aaa.tm.json"
+		idNew = "author/omnicorp/senseall/v1.0.0-20240101000000-243d1b462aaa.tm.json"
+	)
+
+	t.Run("fetch", func(t *testing.T) {
+		internal := mocks.NewRepo(t)
+		mirror := mocks.NewRepo(t)
+		internal.On("Fetch", mock.Anything, idOld).Return(idOld, []byte("internal"), nil)
+		mirror.On("Fetch", mock.Anything, idOld).Return(idNew, []byte("mirror"), nil).Maybe()
+		id, b, err, errs := NewUnion(internal, mirror).Fetch(context.Background(), idOld)
+		assert.NoError(t, err)
+		assert.Empty(t, errs)
+		assert.Equal(t, idOld, id)
+		assert.Equal(t, []byte("internal"), b)
+	})
+	t.Run("fetch falls back to lower priority", func(t *testing.T) {
+		internal := mocks.NewRepo(t)
+		mirror := mocks.NewRepo(t)
+		internal.On("Fetch", mock.Anything, idOld).Return("", nil, ErrTmNotFound)
+		mirror.On("Fetch", mock.Anything, idOld).Return(idNew, []byte("mirror"), nil)
+		id, b, err, _ := NewUnion(internal, mirror).Fetch(context.Background(), idOld)
+		assert.NoError(t, err)
+		assert.Equal(t, idNew, id)
+		assert.Equal(t, []byte("mirror"), b)
+	})
+	t.Run("versions", func(t *testing.T) {
+		internal := mocks.NewRepo(t)
+		mirror := mocks.NewRepo(t)
+		internal.On("Versions", mock.Anything, "author/omnicorp/senseall").Return([]model.FoundVersion{
+			{IndexVersion: model.IndexVersion{TMID: idOld}, FoundIn: model.FoundSource{RepoName: "internal"}},
+		}, nil)
+		mirror.On("Versions", mock.Anything, "author/omnicorp/senseall").Return([]model.FoundVersion{
+			{IndexVersion: model.IndexVersion{TMID: idNew}, FoundIn: model.FoundSource{RepoName: "mirror"}},
+		}, nil)
+		// the order of repos in the union must not matter
+		vs, errs := NewUnion(mirror, internal).Versions(context.Background(), "author/omnicorp/senseall")
+		assert.Empty(t, errs)
+		assert.Equal(t, []model.FoundVersion{
+			{
+				IndexVersion: model.IndexVersion{TMID: idOld},
+				FoundIn:      model.FoundSource{RepoName: "internal"},
+				Shadows:      []model.FoundSource{{RepoName: "mirror"}},
+			},
+		}, vs)
+	})
+}
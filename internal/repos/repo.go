@@ -8,6 +8,7 @@ import (
 	"regexp"
 
 	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/audit"
 	"github.com/wot-oss/tmc/internal/config"
 	"github.com/wot-oss/tmc/internal/model"
 	"github.com/wot-oss/tmc/internal/utils"
@@ -20,14 +21,21 @@ const (
 	KeyRepoLoc     = "loc"
 	KeyRepoAuth    = "auth"
 	KeyRepoEnabled = "enabled"
+	// KeyRepoPriority is an integer giving the rank of a repo among all repos. Higher priority repos take precedence
+	// when the same TM is found in several repos. Defaults to 0
+	KeyRepoPriority = "priority"
 
 	RepoTypeFile             = "file"
 	RepoTypeHttp             = "http"
 	RepoTypeTmc              = "tmc"
+	RepoTypeSqlite           = "sqlite"
+	RepoTypeS3               = "s3"
+	RepoTypeOCI              = "oci"
 	CompletionKindNames      = "names"
 	CompletionKindFetchNames = "fetchNames"
 	RepoConfDir              = ".tmc"
 	IndexFilename            = "tm-catalog.toc.json"
+	IndexJournalFilename     = "tm-catalog.journal"
 	TmNamesFile              = "tmnames.txt"
 )
 
@@ -35,7 +43,7 @@ var ValidRepoNameRegex = regexp.MustCompile("^[a-zA-Z0-9][\\w\\-_:]*$")
 
 type Config map[string]map[string]any
 
-var SupportedTypes = []string{RepoTypeFile, RepoTypeHttp, RepoTypeTmc}
+var SupportedTypes = []string{RepoTypeFile, RepoTypeHttp, RepoTypeTmc, RepoTypeSqlite, RepoTypeS3, RepoTypeOCI}
 
 //go:generate mockery --name Repo --outpkg mocks --output mocks
 type Repo interface {
@@ -61,6 +69,58 @@ type Repo interface {
 	ListCompletions(ctx context.Context, kind string, toComplete string) ([]string, error)
 }
 
+// BulkPusher is implemented by repos which can push many Thing Models in one go, updating the index only once
+type BulkPusher interface {
+	// PushBulk pushes files to the repo and updates its index. optPath and optTree have the same meaning as for
+	// single files, with optTree taking the directory part of each file's name as optional path.
+	// Returns a result for each file. Returns ErrBulkPushNotSupported if the repo cannot push files in bulk after all
+	PushBulk(ctx context.Context, files []BulkPushFile, optPath string, optTree bool) ([]BulkPushResult, error)
+}
+
+// AtomicPusher is implemented by repos which can push several Thing Models with all-or-nothing semantics
+type AtomicPusher interface {
+	// PushAtomic stores all tms and updates the index for them, or, if anything fails, none of them.
+	// TMs whose content is already stored in the repo are skipped. Returns a slice holding the id of the existing TM
+	// for each skipped TM and an empty string for each pushed one
+	PushAtomic(ctx context.Context, tms []AtomicPushItem) ([]string, error)
+}
+
+// IndexWatcher is implemented by repos which can detect changes made to them by other programs and keep their index up to date
+type IndexWatcher interface {
+	// WatchIndex updates the index on changes to the repo until ctx is done
+	WatchIndex(ctx context.Context) error
+}
+
+// AtomicPushItem is a single prepared Thing Model to be pushed with AtomicPusher
+type AtomicPushItem struct {
+	ID  model.TMID
+	Raw []byte
+}
+
+// BulkPushFile is a single Thing Model file to be pushed with BulkPusher
+type BulkPushFile struct {
+	// Name identifies the file in the results. It is the slash-separated file name relative to the pushed directory
+	Name string
+	Raw  []byte
+}
+
+type BulkPushResultType string
+
+const (
+	BulkPushOK     = BulkPushResultType("ok")
+	BulkPushExists = BulkPushResultType("exists")
+	BulkPushError  = BulkPushResultType("error")
+)
+
+// BulkPushResult is the result of pushing a single file with BulkPusher
+type BulkPushResult struct {
+	Name string
+	Type BulkPushResultType
+	// TMID is the id the file has been pushed as, or the id of the existing TM if Type is BulkPushExists
+	TMID    string
+	Message string
+}
+
 var Get = func(spec model.RepoSpec) (Repo, error) {
 	if spec.Dir() != "" {
 		if spec.RepoName() != "" {
@@ -107,6 +167,10 @@ func filterEnabled(repos Config) Config {
 }
 
 func createRepo(rc map[string]any, spec model.RepoSpec) (Repo, error) {
+	rc, err := resolveSecretRefs(rc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of %s: %w", spec, err)
+	}
 	switch t := rc[KeyRepoType]; t {
 	case RepoTypeFile:
 		return NewFileRepo(rc, spec)
@@ -114,6 +178,12 @@ func createRepo(rc map[string]any, spec model.RepoSpec) (Repo, error) {
 		return NewHttpRepo(rc, spec)
 	case RepoTypeTmc:
 		return NewTmcRepo(rc, spec)
+	case RepoTypeSqlite:
+		return NewSqliteRepo(rc, spec)
+	case RepoTypeS3:
+		return NewS3Repo(rc, spec)
+	case RepoTypeOCI:
+		return NewOCIRepo(rc, spec)
 	default:
 		return nil, fmt.Errorf("unsupported repo type: %v. Supported types are %v", t, SupportedTypes)
 	}
@@ -126,7 +196,8 @@ var All = func() ([]Repo, error) {
 	}
 	var rs []Repo
 
-	for n, rc := range conf {
+	for _, n := range SortedNames(conf) {
+		rc := conf[n]
 		en := utils.JsGetBool(rc, KeyRepoEnabled)
 		if en != nil && !*en {
 			continue
@@ -194,7 +265,11 @@ func ToggleEnabled(name string) error {
 		c[KeyRepoEnabled] = false
 	}
 	conf[name] = c
-	return saveConfig(conf)
+	detail := "enable"
+	if _, disabled := c[KeyRepoEnabled]; disabled {
+		detail = "disable"
+	}
+	return saveConfigAudited(conf, name, detail)
 }
 
 func Remove(name string) error {
@@ -206,7 +281,7 @@ func Remove(name string) error {
 		return ErrRepoNotFound
 	}
 	delete(conf, name)
-	return saveConfig(conf)
+	return saveConfigAudited(conf, name, "remove")
 }
 
 func Add(name, typ, confStr string, confFile []byte) error {
@@ -215,7 +290,7 @@ func Add(name, typ, confStr string, confFile []byte) error {
 		return ErrRepoExists
 	}
 
-	return setRepoConfig(name, typ, confStr, confFile, err)
+	return setRepoConfig(name, typ, confStr, confFile, "add")
 }
 
 func SetConfig(name, typ, confStr string, confFile []byte) error {
@@ -224,11 +299,12 @@ func SetConfig(name, typ, confStr string, confFile []byte) error {
 		return ErrRepoNotFound
 	}
 
-	return setRepoConfig(name, typ, confStr, confFile, err)
+	return setRepoConfig(name, typ, confStr, confFile, "set config")
 }
 
-func setRepoConfig(name string, typ string, confStr string, confFile []byte, err error) error {
+func setRepoConfig(name string, typ string, confStr string, confFile []byte, auditDetail string) error {
 	var rc map[string]any
+	var err error
 	switch typ {
 	case RepoTypeFile:
 		rc, err = createFileRepoConfig(confStr, confFile)
@@ -245,9 +321,28 @@ func setRepoConfig(name string, typ string, confStr string, confFile []byte, err
 		if err != nil {
 			return err
 		}
+	case RepoTypeSqlite:
+		rc, err = createSqliteRepoConfig(confStr, confFile)
+		if err != nil {
+			return err
+		}
+	case RepoTypeS3:
+		rc, err = createS3RepoConfig(confStr, confFile)
+		if err != nil {
+			return err
+		}
+	case RepoTypeOCI:
+		rc, err = createOCIRepoConfig(confStr, confFile)
+		if err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("unsupported repo type: %v. Supported types are %v", typ, SupportedTypes)
 	}
+	err = validatePriority(rc)
+	if err != nil {
+		return err
+	}
 
 	conf, err := ReadConfig()
 	if err != nil {
@@ -256,7 +351,7 @@ func setRepoConfig(name string, typ string, confStr string, confFile []byte, err
 
 	conf[name] = rc
 
-	return saveConfig(conf)
+	return saveConfigAudited(conf, name, auditDetail)
 }
 
 func Rename(oldName, newName string) error {
@@ -270,7 +365,7 @@ func Rename(oldName, newName string) error {
 	if rc, ok := conf[oldName]; ok {
 		conf[newName] = rc
 		delete(conf, oldName)
-		return saveConfig(conf)
+		return saveConfigAudited(conf, oldName, "rename to "+newName)
 	} else {
 		return ErrRepoNotFound
 	}
@@ -280,6 +375,20 @@ func saveConfig(conf Config) error {
 	return config.Save(KeyRepos, conf)
 }
 
+// saveConfigAudited saves conf and records the change to repo with given name in the audit log
+func saveConfigAudited(conf Config, name, detail string) error {
+	err := saveConfig(conf)
+	if err != nil {
+		return err
+	}
+	audit.Write(context.Background(), audit.Record{
+		Operation: audit.OpRepoConfig,
+		Repo:      name,
+		Detail:    detail,
+	})
+	return nil
+}
+
 func AsRepoConfig(bytes []byte) (map[string]any, error) {
 	var js any
 	err := json.Unmarshal(bytes, &js)
@@ -1,6 +1,7 @@
 package repos
 
 import (
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -159,6 +160,16 @@ func TestRepoManager_All_And_Get(t *testing.T) {
 		t.Run("http repo", func(t *testing.T) {
 			hr, err := Get(model.NewRepoSpec("r2"))
 			assert.NoError(t, err)
+			if assert.IsType(t, &HttpRepo{}, hr) {
+				c := hr.(*HttpRepo).client
+				assert.Zero(t, c.Timeout)
+				assert.NotNil(t, c.CheckRedirect)
+				if assert.IsType(t, &http.Transport{}, c.Transport) {
+					assert.Equal(t, defaultHeaderTimeout, c.Transport.(*http.Transport).ResponseHeaderTimeout)
+				}
+				// the client holds functions, which cannot be compared
+				hr.(*HttpRepo).client = nil
+			}
 			u, _ := url.Parse(ur)
 			assert.Equal(t, &HttpRepo{
 				templatedPath:  true,
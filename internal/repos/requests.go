@@ -0,0 +1,280 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	KeyRepoRequests            = "requests"
+	KeyRequestsTimeout         = "timeout"
+	KeyRequestsHeaderTimeout   = "responseHeaderTimeout"
+	KeyRequestsRetries         = "retries"
+	KeyRequestsBackoff         = "backoff"
+	KeyRequestsBreakerFailures = "breakerFailures"
+	KeyRequestsBreakerCooldown = "breakerCooldown"
+
+	defaultHeaderTimeout   = 60 * time.Second
+	defaultRetryBackoff    = 500 * time.Millisecond
+	maxRetryBackoff        = 30 * time.Second
+	defaultBreakerCooldown = time.Minute
+)
+
+var ErrCircuitOpen = errors.New("repo skipped after repeated failures")
+
+var (
+	breakersMu sync.Mutex
+	// breakers holds the circuit breakers by repo. A breaker is created once per process and shared by all instances of
+	// a repo, because repos are created anew for every operation
+	breakers = map[breakerKey]*circuitBreaker{}
+)
+
+type breakerKey struct {
+	repo string
+	loc  string
+}
+
+// requestPolicy retries failed requests to a remote repo and stops sending requests to it after repeated failures.
+// The zero value sends every request once
+type requestPolicy struct {
+	retries int
+	backoff time.Duration
+	breaker *circuitBreaker
+}
+
+// circuitBreaker counts consecutive failures of requests to a repo. Once the count reaches threshold, it rejects all
+// requests until cooldown has elapsed. After that, requests are let through again, but a single failure opens it again
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// newRequestPolicy creates the requestPolicy configured in the "requests" section of the repo config. repo and loc
+// identify the circuit breaker of the repo
+func newRequestPolicy(conf map[string]any, repo, loc string) requestPolicy {
+	rc := utils.JsGetMap(conf, KeyRepoRequests)
+	p := requestPolicy{}
+	if r, ok := requestsInt(rc, KeyRequestsRetries); ok {
+		p.retries = r
+	}
+	if b, ok := requestsDuration(rc, KeyRequestsBackoff); ok {
+		p.backoff = b
+	}
+	if f, ok := requestsInt(rc, KeyRequestsBreakerFailures); ok && f > 0 {
+		cooldown := defaultBreakerCooldown
+		if c, ok := requestsDuration(rc, KeyRequestsBreakerCooldown); ok {
+			cooldown = c
+		}
+		p.breaker = getBreaker(breakerKey{repo: repo, loc: loc}, f, cooldown)
+	}
+	return p
+}
+
+// requestTimeout returns the timeout for a single request to the repo, including reading the response body, or 0 if
+// there is none. It is not set by default, because transferring large TMs or indexes may take arbitrarily long
+func requestTimeout(conf map[string]any) time.Duration {
+	if t, ok := requestsDuration(utils.JsGetMap(conf, KeyRepoRequests), KeyRequestsTimeout); ok {
+		return t
+	}
+	return 0
+}
+
+// responseHeaderTimeout returns the time to wait for the response headers of a request to the repo after the request
+// has been sent
+func responseHeaderTimeout(conf map[string]any) time.Duration {
+	if t, ok := requestsDuration(utils.JsGetMap(conf, KeyRepoRequests), KeyRequestsHeaderTimeout); ok {
+		return t
+	}
+	return defaultHeaderTimeout
+}
+
+func getBreaker(key breakerKey, threshold int, cooldown time.Duration) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[key]
+	if !ok {
+		b = &circuitBreaker{now: time.Now}
+		breakers[key] = b
+	}
+	// the config may have changed since the breaker has been created
+	b.mu.Lock()
+	b.threshold, b.cooldown = threshold, cooldown
+	b.mu.Unlock()
+	return b
+}
+
+// do sends req with send, retrying it with exponential backoff on network errors and server errors if req can be sent
+// again safely. Returns an error wrapping ErrCircuitOpen without sending req if the repo's circuit breaker is open
+func (p requestPolicy) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
+	}
+	retries := p.retries
+	if !canRetry(req) {
+		retries = 0
+	}
+	backoff := p.backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 {
+			var err error
+			r, err = cloneRequest(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err := send(r)
+		if req.Context().Err() != nil {
+			// cancelled by the caller, which is no failure of the repo
+			return resp, err
+		}
+		failed := isFailure(resp, err)
+		if !failed || attempt >= retries {
+			p.breaker.record(failed)
+			return resp, err
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		wait := retryWait(backoff, attempt)
+		utils.Logger(req.Context()).Debug("retrying request", "url", req.URL.Redacted(), "attempt", attempt+1, "wait", wait, "error", err)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryWait returns the time to wait before the retry following given attempt: backoff doubled with each attempt,
+// but at most maxRetryBackoff
+func retryWait(backoff time.Duration, attempt int) time.Duration {
+	for i := 0; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// isFailure reports whether the result of a request indicates a failure of the remote, which might go away on retry
+func isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented
+}
+
+// canRetry reports whether req may be sent more than once, i.e. its method is idempotent and its body can be re-read
+func canRetry(req *http.Request) bool {
+	idempotent := []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+	return slices.Contains(idempotent, req.Method) && canResend(req)
+}
+
+// cloneRequest returns a copy of req with a fresh body, which can be sent once more
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	c := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		c.Body = body
+	}
+	return c, nil
+}
+
+// allow returns an error wrapping ErrCircuitOpen if b is open. A nil breaker allows all requests
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.now().Before(b.openUntil) {
+		return fmt.Errorf("%w: %d consecutive failures, next attempt after %s", ErrCircuitOpen, b.failures, b.openUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+func requestsInt(conf map[string]any, key string) (int, bool) {
+	switch v := conf[key].(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxInt32 {
+			return 0, false
+		}
+		return int(v), true
+	case int:
+		return v, v >= 0
+	default:
+		return 0, false
+	}
+}
+
+func requestsDuration(conf map[string]any, key string) (time.Duration, bool) {
+	s := utils.JsGetString(conf, key)
+	if s == nil {
+		return 0, false
+	}
+	d, err := time.ParseDuration(*s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// validateRequestsConfig checks that the "requests" section of a repo config, if present, is valid
+func validateRequestsConfig(rc map[string]any) error {
+	v, ok := rc[KeyRepoRequests]
+	if !ok {
+		return nil
+	}
+	conf, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid json config. %s must be a map", KeyRepoRequests)
+	}
+	for k := range conf {
+		switch k {
+		case KeyRequestsTimeout, KeyRequestsHeaderTimeout, KeyRequestsBackoff, KeyRequestsBreakerCooldown:
+			if _, ok := requestsDuration(conf, k); !ok {
+				return fmt.Errorf("invalid requests config. %s must be a positive duration, e.g. \"10s\"", k)
+			}
+		case KeyRequestsRetries, KeyRequestsBreakerFailures:
+			if _, ok := requestsInt(conf, k); !ok {
+				return fmt.Errorf("invalid requests config. %s must be a non-negative integer", k)
+			}
+		default:
+			return fmt.Errorf("invalid requests config. unknown key %s", k)
+		}
+	}
+	return nil
+}
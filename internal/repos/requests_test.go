@@ -0,0 +1,159 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+func TestValidateRequestsConfig(t *testing.T) {
+	tests := []struct {
+		conf   map[string]any
+		expErr string
+	}{
+		{map[string]any{}, ""},
+		{map[string]any{"requests": map[string]any{"timeout": "10s", "retries": float64(3), "backoff": "100ms", "breakerFailures": float64(5), "breakerCooldown": "1m"}}, ""},
+		{map[string]any{"requests": "10s"}, "must be a map"},
+		{map[string]any{"requests": map[string]any{"timeout": "soon"}}, "must be a positive duration"},
+		{map[string]any{"requests": map[string]any{"responseHeaderTimeout": "0s"}}, "must be a positive duration"},
+		{map[string]any{"requests": map[string]any{"backoff": "-1s"}}, "must be a positive duration"},
+		{map[string]any{"requests": map[string]any{"retries": 1.5}}, "must be a non-negative integer"},
+		{map[string]any{"requests": map[string]any{"breakerFailures": "5"}}, "must be a non-negative integer"},
+		{map[string]any{"requests": map[string]any{"retry": float64(3)}}, "unknown key"},
+	}
+	for i, test := range tests {
+		err := validateRequestsConfig(test.conf)
+		if test.expErr == "" {
+			assert.NoError(t, err, "test %d", i)
+		} else {
+			assert.ErrorContains(t, err, test.expErr, "test %d", i)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	assert.Equal(t, 100*time.Millisecond, retryWait(100*time.Millisecond, 0))
+	assert.Equal(t, 400*time.Millisecond, retryWait(100*time.Millisecond, 2))
+	assert.Equal(t, maxRetryBackoff, retryWait(100*time.Millisecond, 100))
+}
+
+func TestHttpRepo_Retries(t *testing.T) {
+	const tmid = "manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json"
+	const tm = "{\"id\":\"manufacturer/mpn/v1.0.0-20231205123243-c49617d2e4fc.tm.json\"}"
+	newServer := func(failures int32) (*httptest.Server, *atomic.Int32) {
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) <= failures {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(tm))
+		}))
+		return srv, &requests
+	}
+	newRepo := func(t *testing.T, loc string, requests string) *HttpRepo {
+		config, err := createHttpRepoConfig("", []byte(`{"loc":"`+loc+`", "type":"http", "requests":`+requests+`}`))
+		assert.NoError(t, err)
+		r, err := NewHttpRepo(config, model.NewRepoSpec(t.Name()))
+		assert.NoError(t, err)
+		return r
+	}
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		srv, requests := newServer(2)
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"retries":2, "backoff":"1ms"}`)
+		_, b, err := r.Fetch(context.Background(), tmid)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(tm), b)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+	t.Run("gives up after retries", func(t *testing.T) {
+		srv, requests := newServer(10)
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"retries":2, "backoff":"1ms"}`)
+		_, _, err := r.Fetch(context.Background(), tmid)
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+	t.Run("does not retry non-idempotent requests", func(t *testing.T) {
+		srv, requests := newServer(10)
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"retries":2, "backoff":"1ms"}`)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+		resp, err := r.doHttp(req)
+		if assert.NoError(t, err) {
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		}
+		assert.Equal(t, int32(1), requests.Load())
+	})
+	t.Run("times out", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"timeout":"50ms"}`)
+		start := time.Now()
+		_, _, err := r.Fetch(context.Background(), tmid)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+
+		r = newRepo(t, srv.URL, `{"responseHeaderTimeout":"50ms"}`)
+		start = time.Now()
+		_, _, err = r.Fetch(context.Background(), tmid)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+	t.Run("slow body does not time out by default", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"id":"` + tmid + `"}`))
+		}))
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"responseHeaderTimeout":"50ms"}`)
+		_, _, err := r.Fetch(context.Background(), tmid)
+		assert.NoError(t, err)
+	})
+	t.Run("circuit breaker", func(t *testing.T) {
+		srv, requests := newServer(2)
+		defer srv.Close()
+		r := newRepo(t, srv.URL, `{"breakerFailures":2, "breakerCooldown":"1h"}`)
+		now := time.Now()
+		r.policy.breaker.now = func() time.Time { return now }
+		for i := 0; i < 2; i++ {
+			_, _, err := r.Fetch(context.Background(), tmid)
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, ErrCircuitOpen))
+		}
+
+		// the breaker is shared by all instances of the repo
+		r = newRepo(t, srv.URL, `{"breakerFailures":2, "breakerCooldown":"1h"}`)
+		_, _, err, errs := NewUnion(r).Fetch(context.Background(), tmid)
+		assert.ErrorIs(t, err, ErrTmNotFound)
+		if assert.Len(t, errs, 1) {
+			assert.ErrorIs(t, errs[0], ErrCircuitOpen)
+		}
+		assert.Equal(t, int32(2), requests.Load())
+
+		// after cooldown, requests are let through again
+		now = now.Add(time.Hour)
+		_, b, err := r.Fetch(context.Background(), tmid)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(tm), b)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+}
@@ -0,0 +1,555 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+)
+
+const (
+	KeyS3Region   = "region"
+	KeyS3Endpoint = "endpoint"
+
+	AuthKindS3           = "s3"
+	KeyS3AccessKeyID     = "accessKeyId"
+	KeyS3SecretAccessKey = "secretAccessKey"
+	KeyS3SessionToken    = "sessionToken"
+	s3Scheme             = "s3"
+)
+
+// S3Repo implements a Repo TM repository backed by a bucket of Amazon S3 or an S3-compatible object store.
+// The TM files are stored as objects with keys equal to their ids, below an optional key prefix. The index is stored
+// as an object, too, and is guarded by a lock object, which is created with a conditional put and expires after
+// the configured lease in case its owner fails to remove it
+type S3Repo struct {
+	client      *s3Client
+	prefix      string
+	spec        model.RepoSpec
+	lockTimeout time.Duration
+	lockLease   time.Duration
+}
+
+func NewS3Repo(config map[string]any, spec model.RepoSpec) (*S3Repo, error) {
+	loc := utils.JsGetString(config, KeyRepoLoc)
+	if loc == nil {
+		return nil, fmt.Errorf("invalid s3 repo config. loc is either not found or not a string")
+	}
+	bucket, prefix, err := parseS3Loc(*loc)
+	if err != nil {
+		return nil, err
+	}
+	region := s3Region(config)
+	endpoint := "https://s3." + region + ".amazonaws.com"
+	if ep := utils.JsGetString(config, KeyS3Endpoint); ep != nil && *ep != "" {
+		endpoint = *ep
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 repo config. invalid endpoint: %w", err)
+	}
+	u = u.JoinPath(bucket)
+	client, err := newHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Repo{
+		client: &s3Client{
+			endpoint: u,
+			region:   region,
+			creds:    s3CredentialsFromConfig(config),
+			client:   client,
+			policy:   newRequestPolicy(config, spec.String(), *loc),
+		},
+		prefix:      prefix,
+		spec:        spec,
+		lockTimeout: lockTimeout(config),
+		lockLease:   lockLease(config),
+	}, nil
+}
+
+// parseS3Loc splits a location of the form s3://bucket/prefix into the bucket and the key prefix.
+// The returned prefix is either empty or ends with a slash
+func parseS3Loc(loc string) (string, string, error) {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid s3 repo location %s: %w", loc, err)
+	}
+	if u.Scheme != s3Scheme || u.Host == "" {
+		return "", "", fmt.Errorf("invalid s3 repo location %s. must be of the form s3://<bucket>[/<prefix>]", loc)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix = prefix + "/"
+	}
+	return u.Host, prefix, nil
+}
+
+// s3Region returns the region from the repo config or from the environment variables used by AWS tools
+func s3Region(config map[string]any) string {
+	if r := utils.JsGetString(config, KeyS3Region); r != nil && *r != "" {
+		return *r
+	}
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(env); r != "" {
+			return r
+		}
+	}
+	return s3DefaultRegion
+}
+
+// s3CredentialsFromConfig returns the credentials set with 'repo set-auth' or, if there are none, the credentials
+// from the environment variables used by AWS tools
+func s3CredentialsFromConfig(config map[string]any) s3Credentials {
+	if auth := utils.JsGetMap(config, KeyRepoAuth); auth != nil {
+		if s3Auth := utils.JsGetMap(auth, AuthKindS3); s3Auth != nil {
+			var c s3Credentials
+			if v := utils.JsGetString(s3Auth, KeyS3AccessKeyID); v != nil {
+				c.AccessKeyID = *v
+			}
+			if v := utils.JsGetString(s3Auth, KeyS3SecretAccessKey); v != nil {
+				c.SecretAccessKey = *v
+			}
+			if v := utils.JsGetString(s3Auth, KeyS3SessionToken); v != nil {
+				c.SessionToken = *v
+			}
+			return c
+		}
+	}
+	return s3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (s *S3Repo) key(id string) string {
+	return s.prefix + id
+}
+
+func (s *S3Repo) indexKey() string {
+	return s.key(RepoConfDir + "/" + IndexFilename)
+}
+
+func (s *S3Repo) Push(ctx context.Context, id model.TMID, raw []byte) error {
+	if len(raw) == 0 {
+		return errors.New("nothing to write")
+	}
+	idS := id.String()
+	match, existingId, err := s.getExistingID(ctx, idS)
+	if err != nil {
+		return err
+	}
+	switch match {
+	case idMatchDigest:
+		utils.Logger(ctx).Info(fmt.Sprintf("Same TM content already exists under ID %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameContent, ExistingId: existingId}
+	case idMatchTimestamp:
+		utils.Logger(ctx).Info(fmt.Sprintf("Version and timestamp clash with existing %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameTimestamp, ExistingId: existingId}
+	}
+
+	_, err = s.client.putObject(ctx, s.key(idS), raw, "application/json", s3PutCondition{})
+	if err != nil {
+		return fmt.Errorf("could not write TM to catalog: %w", err)
+	}
+	utils.Logger(ctx).Info("saved Thing Model object", "key", s.key(idS))
+	return nil
+}
+
+// getExistingID works like FileRepo.getExistingID, with the objects sharing the id's key prefix in place of the
+// files in the id's directory
+func (s *S3Repo) getExistingID(ctx context.Context, id string) (idMatch, string, error) {
+	exists, err := s.client.headObject(ctx, s.key(id))
+	if err != nil {
+		return idMatchNone, "", err
+	}
+	if exists {
+		return idMatchFull, id, nil
+	}
+	dirKey := s.key(path.Dir(id)) + "/"
+	keys, err := s.client.listObjects(ctx, dirKey)
+	if err != nil {
+		return idMatchNone, "", err
+	}
+	var names []string
+	for _, k := range keys {
+		n := strings.TrimPrefix(k, dirKey)
+		if !strings.Contains(n, "/") {
+			names = append(names, n)
+		}
+	}
+	match, existingId := matchExistingVersion(id, names)
+	return match, existingId, nil
+}
+
+func (s *S3Repo) Fetch(ctx context.Context, id string) (string, []byte, error) {
+	err := checkIdValid(id)
+	if err != nil {
+		return "", nil, err
+	}
+	b, _, err := s.client.getObject(ctx, s.key(id))
+	if err == nil {
+		return id, b, nil
+	}
+	if !errors.Is(err, errS3NotFound) {
+		return "", nil, err
+	}
+	match, actualId, err := s.getExistingID(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if match != idMatchFull && match != idMatchDigest {
+		return "", nil, ErrTmNotFound
+	}
+	b, _, err = s.client.getObject(ctx, s.key(actualId))
+	if errors.Is(err, errS3NotFound) {
+		return "", nil, ErrTmNotFound
+	}
+	return actualId, b, err
+}
+
+func (s *S3Repo) Delete(ctx context.Context, id string) error {
+	err := checkIdValid(id)
+	if err != nil {
+		return err
+	}
+	exists, err := s.client.headObject(ctx, s.key(id))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTmNotFound
+	}
+	return s.client.deleteObject(ctx, s.key(id), "")
+}
+
+// Index updates the index object while holding the index lock. The index object is replaced only if it has not been
+// modified since it was read, in case the lock has been lost in the meantime
+func (s *S3Repo) Index(ctx context.Context, ids ...string) error {
+	unlock, err := s.lockIndex(ctx)
+	defer unlock()
+	if err != nil {
+		return err
+	}
+	log := utils.Logger(ctx)
+	start := time.Now()
+	fileCount := 0
+
+	idx, etag, err := s.readIndexObject(ctx)
+	// a full rebuild may replace an unreadable index, but starting a partial update from an empty index would drop
+	// all TMs not listed in ids from the index
+	if err != nil && !errors.Is(err, errS3NotFound) && (len(ids) > 0 || etag == "") {
+		return err
+	}
+	if len(ids) == 0 { // full rebuild
+		idx = &model.Index{
+			Meta: model.IndexMeta{Created: time.Now()},
+			Data: []*model.IndexEntry{},
+		}
+		keys, err := s.client.listObjects(ctx, s.prefix)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			id := strings.TrimPrefix(k, s.prefix)
+			if strings.HasPrefix(id, RepoConfDir+"/") || !strings.HasSuffix(id, TMExt) {
+				continue
+			}
+			upd, err := s.updateIndexWithObject(ctx, idx, id, log)
+			if err != nil {
+				return err
+			}
+			if upd {
+				fileCount++
+			}
+		}
+	} else { // partial update
+		if idx == nil {
+			idx = &model.Index{
+				Meta: model.IndexMeta{Created: time.Now()},
+				Data: []*model.IndexEntry{},
+			}
+		}
+		for _, id := range ids {
+			upd, err := s.updateIndexWithObject(ctx, idx, id, log)
+			if err != nil {
+				return err
+			}
+			if upd {
+				fileCount++
+			}
+		}
+	}
+
+	err = s.writeIndex(ctx, idx, etag)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Updated index with %d entries in %s ", fileCount, time.Since(start).String()))
+	return nil
+}
+
+// updateIndexWithObject inserts the TM stored under id into idx, or removes id from idx if there is no such TM
+func (s *S3Repo) updateIndexWithObject(ctx context.Context, idx *model.Index, id string, log *slog.Logger) (bool, error) {
+	b, _, err := s.client.getObject(ctx, s.key(id))
+	if errors.Is(err, errS3NotFound) {
+		upd, _, err := idx.Delete(id)
+		return upd, err
+	}
+	if err != nil {
+		return false, err
+	}
+	var tm model.ThingModel
+	err = json.Unmarshal(b, &tm)
+	if err == nil {
+		_, err = idx.Insert(&tm)
+	}
+	if err != nil {
+		log.Error("Failed to extract metadata from TM. The TM will be excluded from index", "id", id, "error", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// writeIndex stores idx as the index object, if the index object's ETag is still etag, or, if etag is empty, if there is
+// no index object yet. Returns ErrIndexLocked if the index object has been modified by another writer
+func (s *S3Repo) writeIndex(ctx context.Context, idx *model.Index, etag string) error {
+	cond := s3PutCondition{IfMatch: etag, IfNoneMatch: etag == ""}
+	idxJson, _ := json.MarshalIndent(idx, "", "  ")
+	_, err := s.client.putObject(ctx, s.indexKey(), idxJson, "application/json", cond)
+	if errors.Is(err, errS3PreconditionFailed) {
+		return fmt.Errorf("%w: the index has been modified concurrently", ErrIndexLocked)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write index: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Repo) readIndex(ctx context.Context) (*model.Index, error) {
+	idx, _, err := s.readIndexObject(ctx)
+	return idx, err
+}
+
+// readIndexObject returns the index and the ETag of the index object
+func (s *S3Repo) readIndexObject(ctx context.Context) (*model.Index, string, error) {
+	b, etag, err := s.client.getObject(ctx, s.indexKey())
+	if errors.Is(err, errS3NotFound) {
+		return nil, "", fmt.Errorf("%w: no table of contents found. Run `index` for this repo", errS3NotFound)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var idx model.Index
+	err = json.Unmarshal(b, &idx)
+	return &idx, etag, err
+}
+
+// lockIndex creates the index lock object, if it does not exist yet, and renews its lease while the lock is held.
+// An expired lock left behind by a failed process is removed.
+// Returns ErrIndexLocked if the lock cannot be acquired within the configured lock timeout
+func (s *S3Repo) lockIndex(ctx context.Context) (unlockFunc, error) {
+	lockKey := s.indexKey() + ".lock"
+	owner := newLockOwner()
+	ctx, cancel := context.WithTimeout(ctx, s.lockTimeout)
+	defer cancel()
+	for {
+		lock, _ := json.Marshal(lease{Owner: owner, Expires: time.Now().Add(s.lockLease)})
+		etag, err := s.client.putObject(ctx, lockKey, lock, "application/json", s3PutCondition{IfNoneMatch: true})
+		if err == nil {
+			return s.keepLockAlive(lockKey, owner, etag), nil
+		}
+		if errors.Is(err, errS3PreconditionFailed) {
+			s.removeExpiredLock(ctx, lockKey)
+		} else if ctx.Err() == nil {
+			return func() {}, err
+		}
+		if err := waitRetry(ctx, lockRetryDelay); err != nil {
+			return func() {}, err
+		}
+	}
+}
+
+// keepLockAlive starts the heartbeat renewing the lease of the lock object at lockKey and returns the function which
+// stops it and removes the lock. Renewals are conditional on etag, so that a lock taken over by another process after
+// a failed renewal is left alone
+func (s *S3Repo) keepLockAlive(lockKey, owner, etag string) unlockFunc {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.lockLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				lock, _ := json.Marshal(lease{Owner: owner, Expires: time.Now().Add(s.lockLease)})
+				newEtag, err := s.client.putObject(context.Background(), lockKey, lock, "application/json", s3PutCondition{IfMatch: etag})
+				if err != nil {
+					slog.Default().Warn("could not renew index lock", "key", lockKey, "error", err)
+					if errors.Is(err, errS3PreconditionFailed) {
+						return
+					}
+					continue
+				}
+				etag = newEtag
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+			err := s.client.deleteObject(context.Background(), lockKey, etag)
+			if err != nil {
+				slog.Default().Warn("could not remove index lock", "key", lockKey, "error", err)
+			}
+		})
+	}
+}
+
+// removeExpiredLock removes the lock object at lockKey if it has expired. The removal is conditional, so that a lock
+// which has been replaced in the meantime by another process is not removed
+func (s *S3Repo) removeExpiredLock(ctx context.Context, lockKey string) {
+	b, etag, err := s.client.getObject(ctx, lockKey)
+	if err != nil {
+		return
+	}
+	var lock lease
+	err = json.Unmarshal(b, &lock)
+	if err == nil && time.Now().Before(lock.Expires) {
+		return
+	}
+	utils.Logger(ctx).Warn("removing expired index lock", "key", lockKey, "owner", lock.Owner)
+	_ = s.client.deleteObject(ctx, lockKey, etag)
+}
+
+func (s *S3Repo) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, error) {
+	utils.Logger(ctx).Debug(fmt.Sprintf("Creating list with filter '%v'", search))
+	idx, err := s.readIndex(ctx)
+	if err != nil {
+		return model.SearchResult{}, err
+	}
+	idx.Filter(search)
+	return model.NewIndexToFoundMapper(s.Spec().ToFoundSource()).ToSearchResult(*idx), nil
+}
+
+func (s *S3Repo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
+	name = strings.TrimSpace(name)
+	res, err := s.List(ctx, &model.SearchParams{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		err := fmt.Errorf("%w: %s", ErrTmNotFound, name)
+		utils.Logger(ctx).Error(err.Error())
+		return nil, err
+	}
+	return res.Entries[0].Versions, nil
+}
+
+func (s *S3Repo) Spec() model.RepoSpec {
+	return s.spec
+}
+
+func (s *S3Repo) ListCompletions(ctx context.Context, kind string, toComplete string) ([]string, error) {
+	switch kind {
+	case CompletionKindNames:
+		namePrefix, seg := longestPath(toComplete)
+		sr, err := s.List(ctx, &model.SearchParams{Name: namePrefix, Options: model.SearchOptions{NameFilterType: model.PrefixMatch}})
+		if err != nil {
+			return nil, err
+		}
+		var ns []string
+		for _, e := range sr.Entries {
+			ns = append(ns, e.Name)
+		}
+		return namesToCompletions(ns, toComplete, seg+1), nil
+	case CompletionKindFetchNames:
+		if strings.Contains(toComplete, "..") {
+			return nil, fmt.Errorf("%w :no completions for name containing '..'", ErrInvalidCompletionParams)
+		}
+		name, _, _ := strings.Cut(toComplete, ":")
+		versions, err := s.Versions(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		var vs []string
+		for _, fv := range versions {
+			vs = append(vs, fmt.Sprintf("%s:%s", name, fv.Version.Model))
+		}
+		return vs, nil
+	default:
+		return nil, ErrInvalidCompletionParams
+	}
+}
+
+func createS3RepoConfig(loc string, bytes []byte) (map[string]any, error) {
+	if loc != "" {
+		_, _, err := parseS3Loc(loc)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			KeyRepoType: RepoTypeS3,
+			KeyRepoLoc:  loc,
+		}, nil
+	}
+	rc, err := AsRepoConfig(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rType := utils.JsGetString(rc, KeyRepoType); rType != nil {
+		if *rType != RepoTypeS3 {
+			return nil, fmt.Errorf("invalid json config. type must be \"s3\" or absent")
+		}
+	}
+	rc[KeyRepoType] = RepoTypeS3
+	l := utils.JsGetString(rc, KeyRepoLoc)
+	if l == nil {
+		return nil, fmt.Errorf("invalid json config. must have string \"loc\"")
+	}
+	_, _, err = parseS3Loc(*l)
+	if err != nil {
+		return nil, err
+	}
+	if ep, ok := rc[KeyS3Endpoint]; ok {
+		eps, isStr := ep.(string)
+		u, err := url.Parse(eps)
+		if !isStr || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid json config. \"endpoint\" must be a http or https URL")
+		}
+	}
+	err = validateTLSConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateProxyConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateRequestsConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLockConfig(rc)
+	if err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
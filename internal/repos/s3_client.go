@@ -0,0 +1,336 @@
+package repos
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3DateFormat       = "20060102T150405Z"
+	s3ShortDate        = "20060102"
+	s3Service          = "s3"
+	s3DefaultRegion    = "us-east-1"
+	s3ContentSHAHeader = "x-amz-content-sha256"
+)
+
+var (
+	errS3NotFound           = errors.New("object not found")
+	errS3PreconditionFailed = errors.New("precondition failed")
+)
+
+// s3Credentials are the AWS credentials used to sign requests. Requests are sent unsigned if AccessKeyID is empty
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// s3Client is a minimal client for the S3 REST API, covering the object operations needed by S3Repo.
+// It addresses buckets path-style, which is supported by AWS as well as S3-compatible stores like MinIO
+type s3Client struct {
+	// endpoint is the URL of the bucket, e.g. https://s3.eu-central-1.amazonaws.com/bucket
+	endpoint *url.URL
+	region   string
+	creds    s3Credentials
+	client   *http.Client
+	policy   requestPolicy
+	now      func() time.Time
+}
+
+// s3PutCondition makes a put conditional. IfNoneMatch creates the object only if it does not exist.
+// IfMatch overwrites the object only if its current ETag is equal
+type s3PutCondition struct {
+	IfNoneMatch bool
+	IfMatch     string
+}
+
+type s3ErrorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// getObject returns the contents and the ETag of the object with given key. Returns errS3NotFound if there is no such object
+func (c *s3Client) getObject(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", s3ResponseError(resp, b)
+	}
+	return b, resp.Header.Get("ETag"), nil
+}
+
+// headObject reports whether an object with given key exists
+func (c *s3Client) headObject(ctx context.Context, key string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3ResponseError(resp, nil)
+	}
+}
+
+// putObject stores body under key and returns the new ETag. Returns errS3PreconditionFailed if cond is not met
+func (c *s3Client) putObject(ctx context.Context, key string, body []byte, contentType string, cond s3PutCondition) (string, error) {
+	h := http.Header{}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	if cond.IfNoneMatch {
+		h.Set("If-None-Match", "*")
+	}
+	if cond.IfMatch != "" {
+		h.Set("If-Match", cond.IfMatch)
+	}
+	resp, err := c.do(ctx, http.MethodPut, key, nil, h, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", s3ResponseError(resp, b)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// deleteObject deletes the object with given key, if its ETag equals ifMatch or ifMatch is empty.
+// Deleting a non-existing object is not an error
+func (c *s3Client) deleteObject(ctx context.Context, key string, ifMatch string) error {
+	h := http.Header{}
+	if ifMatch != "" {
+		h.Set("If-Match", ifMatch)
+	}
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, h, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp, b)
+	}
+	return nil
+}
+
+// listObjects returns the keys of all objects starting with prefix
+func (c *s3Client) listObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s3ResponseError(resp, b)
+		}
+		var res s3ListBucketResult
+		err = xml.Unmarshal(b, &res)
+		if err != nil {
+			return nil, fmt.Errorf("invalid list objects response: %w", err)
+		}
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	if key != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+		u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + s3URIEncode(key, false)
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	c.sign(req, body)
+	return c.policy.do(req, c.client.Do)
+}
+
+func s3ResponseError(resp *http.Response, body []byte) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return errS3NotFound
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 is returned by S3 when a conditional write races with another one
+		return errS3PreconditionFailed
+	}
+	var e s3ErrorResponse
+	if len(body) > 0 && xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 request failed: %s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("s3 request failed: %s", resp.Status)
+}
+
+// sign adds the headers of AWS Signature Version 4 to req. Does nothing if no credentials are set
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	if c.creds.AccessKeyID == "" {
+		return
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	t := now().UTC()
+	amzDate := t.Format(s3DateFormat)
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set(s3ContentSHAHeader, payloadHash)
+	if c.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.creds.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{t.Format(s3ShortDate), c.region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.creds.SecretAccessKey), t.Format(s3ShortDate))
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3CanonicalHeaders returns the signed header names and the canonical headers. The host, the content type,
+// the range and conditional headers, and all x-amz-* headers are signed
+func s3CanonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		values["host"] = req.Host
+	}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		switch {
+		case lk == "content-type", lk == "range", lk == "if-match", lk == "if-none-match", strings.HasPrefix(lk, "x-amz-"):
+			trimmed := make([]string, len(vs))
+			for i, v := range vs {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			values[lk] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var sb strings.Builder
+	for _, n := range names {
+		sb.WriteString(n + ":" + values[n] + "\n")
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := slices.Clone(q[k])
+		slices.Sort(vs)
+		for _, v := range vs {
+			parts = append(parts, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode percent-encodes s as required by AWS Signature Version 4: all bytes except unreserved characters,
+// and the slash unless encodeSlash is true
+func s3URIEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
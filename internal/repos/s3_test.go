@@ -0,0 +1,328 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/testutils/s3fake"
+)
+
+const s3TestBucket = "tmc-bucket"
+
+func newTestS3Repo(t *testing.T) (*S3Repo, *s3fake.Server) {
+	t.Helper()
+	srv := s3fake.NewServer()
+	t.Cleanup(srv.Close)
+	r, err := NewS3Repo(map[string]any{
+		"type":     "s3",
+		"loc":      "s3://" + s3TestBucket + "/catalog",
+		"endpoint": srv.URL,
+		"auth":     map[string]any{"s3": map[string]any{"accessKeyId": "id", "secretAccessKey": "secret"}},
+	}, model.NewRepoSpec("s3r"))
+	assert.NoError(t, err)
+	return r, srv
+}
+
+func TestNewS3Repo(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	t.Run("defaults from environment", func(t *testing.T) {
+		r, err := NewS3Repo(map[string]any{"type": "s3", "loc": "s3://bucket/some/prefix/"}, model.NewRepoSpec("s3r"))
+		assert.NoError(t, err)
+		assert.Equal(t, "https://s3.eu-west-1.amazonaws.com/bucket", r.client.endpoint.String())
+		assert.Equal(t, "eu-west-1", r.client.region)
+		assert.Equal(t, "some/prefix/", r.prefix)
+		assert.Equal(t, s3Credentials{AccessKeyID: "env-id", SecretAccessKey: "env-secret"}, r.client.creds)
+	})
+	t.Run("explicit config", func(t *testing.T) {
+		r, err := NewS3Repo(map[string]any{
+			"type":     "s3",
+			"loc":      "s3://bucket",
+			"region":   "us-west-2",
+			"endpoint": "http://localhost:9000",
+			"auth":     map[string]any{"s3": map[string]any{"accessKeyId": "id", "secretAccessKey": "secret", "sessionToken": "token"}},
+		}, model.NewRepoSpec("s3r"))
+		assert.NoError(t, err)
+		assert.Equal(t, "http://localhost:9000/bucket", r.client.endpoint.String())
+		assert.Equal(t, "us-west-2", r.client.region)
+		assert.Equal(t, "", r.prefix)
+		assert.Equal(t, s3Credentials{AccessKeyID: "id", SecretAccessKey: "secret", SessionToken: "token"}, r.client.creds)
+	})
+	t.Run("invalid loc", func(t *testing.T) {
+		_, err := NewS3Repo(map[string]any{"type": "s3", "loc": "https://bucket"}, model.NewRepoSpec("s3r"))
+		assert.Error(t, err)
+		_, err = NewS3Repo(map[string]any{"type": "s3"}, model.NewRepoSpec("s3r"))
+		assert.Error(t, err)
+	})
+}
+
+func TestS3Repo_PushAndFetch(t *testing.T) {
+	r, srv := newTestS3Repo(t)
+	ctx := context.Background()
+	raw, err := os.ReadFile(filepath.Join("../../test/data/index", sqliteTestId1))
+	assert.NoError(t, err)
+	id := model.MustParseTMID(sqliteTestId1)
+
+	assert.NoError(t, r.Push(ctx, id, raw))
+	stored, ok := srv.Object(s3TestBucket, "catalog/"+sqliteTestId1)
+	assert.True(t, ok)
+	assert.Equal(t, raw, stored)
+
+	t.Run("fetch by full id", func(t *testing.T) {
+		actualId, b, err := r.Fetch(ctx, sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+		assert.Equal(t, raw, b)
+	})
+	t.Run("fetch by id with different timestamp", func(t *testing.T) {
+		actualId, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "20240409155220", "20240101000000", 1))
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+	})
+	t.Run("fetch non-existing", func(t *testing.T) {
+		_, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "3f779458e453", "000000000000", 1))
+		assert.ErrorIs(t, err, ErrTmNotFound)
+	})
+	t.Run("push same id again", func(t *testing.T) {
+		assert.NoError(t, r.Push(ctx, id, raw))
+	})
+	t.Run("push same content with different timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Timestamp = "20240501000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameContent, cErr.Type)
+			assert.Equal(t, sqliteTestId1, cErr.ExistingId)
+		}
+	})
+	t.Run("push different content with same timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Hash = "000000000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameTimestamp, cErr.Type)
+		}
+	})
+	t.Run("push nothing", func(t *testing.T) {
+		assert.Error(t, r.Push(ctx, id, nil))
+	})
+}
+
+func TestS3Repo_IndexAndList(t *testing.T) {
+	r, srv := newTestS3Repo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1, sqliteTestId2)
+
+	_, ok := srv.Object(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json")
+	assert.True(t, ok)
+	_, ok = srv.Object(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json.lock")
+	assert.False(t, ok)
+
+	res, err := r.List(ctx, &model.SearchParams{})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Entries, 2) {
+		assert.Equal(t, "omnicorp-tm-department/omnicorp/omnilamp", res.Entries[0].Name)
+		assert.Equal(t, model.FoundSource{RepoName: "s3r"}, res.Entries[0].Versions[0].FoundIn)
+	}
+
+	res, err = r.List(ctx, &model.SearchParams{Query: "subfolder"})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 1)
+
+	vs, err := r.Versions(ctx, "omnicorp-tm-department/omnicorp/omnilamp")
+	assert.NoError(t, err)
+	assert.Len(t, vs, 1)
+
+	cs, err := r.ListCompletions(ctx, CompletionKindNames, "omnicorp-tm-department/omnicorp/omnilamp/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"omnicorp-tm-department/omnicorp/omnilamp/subfolder"}, cs)
+
+	t.Run("full rebuild with paged listing", func(t *testing.T) {
+		srv.MaxKeys = 1
+		defer func() { srv.MaxKeys = 1000 }()
+		// a TM copied into the bucket by other means is found by a full rebuild
+		raw, _ := srv.Object(s3TestBucket, "catalog/"+sqliteTestId1)
+		copyId := strings.Replace(sqliteTestId1, "omnilamp/", "omnilamp/copy/", 1)
+		var tm map[string]any
+		assert.NoError(t, json.Unmarshal(raw, &tm))
+		tm["id"] = copyId
+		copied, _ := json.Marshal(tm)
+		srv.PutObject(s3TestBucket, "catalog/"+copyId, copied)
+
+		assert.NoError(t, r.Index(ctx))
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 3)
+	})
+	t.Run("partial update removes deleted", func(t *testing.T) {
+		assert.NoError(t, r.Delete(ctx, sqliteTestId2))
+		assert.NoError(t, r.Index(ctx, sqliteTestId2))
+		res, err := r.List(ctx, &model.SearchParams{Query: "subfolder"})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 0)
+	})
+}
+
+func TestS3Repo_Index_UnreadableIndex(t *testing.T) {
+	r, srv := newTestS3Repo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1)
+	srv.PutObject(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json", []byte("{not json"))
+
+	// a partial update must not replace an index it cannot read with one containing only the given ids
+	assert.Error(t, r.Index(ctx, sqliteTestId1))
+	idx, _ := srv.Object(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json")
+	assert.Equal(t, "{not json", string(idx))
+}
+
+func TestS3Repo_List_NoIndex(t *testing.T) {
+	r, _ := newTestS3Repo(t)
+	_, err := r.List(context.Background(), &model.SearchParams{})
+	assert.ErrorContains(t, err, "no table of contents found")
+}
+
+func TestS3Repo_Delete(t *testing.T) {
+	r, srv := newTestS3Repo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1)
+
+	err := r.Delete(ctx, strings.Replace(sqliteTestId1, "20240409155220", "20240101000000", 1))
+	assert.ErrorIs(t, err, ErrTmNotFound)
+	err = r.Delete(ctx, "invalid-id")
+	assert.Error(t, err)
+
+	assert.NoError(t, r.Delete(ctx, sqliteTestId1))
+	_, ok := srv.Object(s3TestBucket, "catalog/"+sqliteTestId1)
+	assert.False(t, ok)
+	assert.ErrorIs(t, r.Delete(ctx, sqliteTestId1), ErrTmNotFound)
+}
+
+func TestS3Repo_IndexLock(t *testing.T) {
+	lockKey := "catalog/.tmc/tm-catalog.toc.json.lock"
+
+	t.Run("locked by other", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		lock, _ := json.Marshal(lease{Owner: "other", Expires: time.Now().Add(time.Minute)})
+		srv.PutObject(s3TestBucket, lockKey, lock)
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		err := r.Index(ctx)
+		assert.ErrorIs(t, err, ErrIndexLocked)
+		_, ok := srv.Object(s3TestBucket, lockKey)
+		assert.True(t, ok, "the lock of another owner must not be removed")
+	})
+	t.Run("configured lock timeout", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		r.lockTimeout = 200 * time.Millisecond
+		lock, _ := json.Marshal(lease{Owner: "other", Expires: time.Now().Add(time.Minute)})
+		srv.PutObject(s3TestBucket, lockKey, lock)
+		start := time.Now()
+		err := r.Index(context.Background())
+		assert.ErrorIs(t, err, ErrIndexLocked)
+		assert.Less(t, time.Since(start), indexLockTimeout)
+	})
+	t.Run("expired lock is removed", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		lock, _ := json.Marshal(lease{Owner: "other", Expires: time.Now().Add(-time.Second)})
+		srv.PutObject(s3TestBucket, lockKey, lock)
+		assert.NoError(t, r.Index(context.Background()))
+		_, ok := srv.Object(s3TestBucket, lockKey)
+		assert.False(t, ok)
+	})
+	t.Run("lease is renewed while locked", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		r.lockLease = 300 * time.Millisecond
+		unlock, err := r.lockIndex(context.Background())
+		assert.NoError(t, err)
+		time.Sleep(500 * time.Millisecond)
+		b, ok := srv.Object(s3TestBucket, lockKey)
+		if assert.True(t, ok) {
+			var ls lease
+			assert.NoError(t, json.Unmarshal(b, &ls))
+			assert.True(t, ls.Expires.After(time.Now()), "the lease must have been renewed")
+		}
+		unlock()
+		_, ok = srv.Object(s3TestBucket, lockKey)
+		assert.False(t, ok)
+	})
+	t.Run("index modified by other writer", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		ctx := context.Background()
+		pushTestTMs(t, r, sqliteTestId1)
+		assert.NoError(t, r.Index(ctx))
+		idx, etag, err := r.readIndexObject(ctx)
+		assert.NoError(t, err)
+		srv.PutObject(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json", []byte(`{"meta":{},"data":[]}`))
+		assert.ErrorIs(t, r.writeIndex(ctx, idx, etag), ErrIndexLocked)
+		assert.ErrorIs(t, r.writeIndex(ctx, idx, ""), ErrIndexLocked)
+		b, _ := srv.Object(s3TestBucket, "catalog/.tmc/tm-catalog.toc.json")
+		assert.Equal(t, `{"meta":{},"data":[]}`, string(b))
+	})
+	t.Run("concurrent updates are serialized", func(t *testing.T) {
+		r, srv := newTestS3Repo(t)
+		ctx := context.Background()
+		pushTestTMs(t, r, sqliteTestId1, sqliteTestId2)
+		assert.NoError(t, r.Index(ctx))
+
+		var wg sync.WaitGroup
+		for _, id := range []string{sqliteTestId1, sqliteTestId2} {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				assert.NoError(t, r.Delete(ctx, id))
+				assert.NoError(t, r.Index(ctx, id))
+			}(id)
+		}
+		wg.Wait()
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 0)
+		_, ok := srv.Object(s3TestBucket, lockKey)
+		assert.False(t, ok)
+	})
+}
+
+func TestCreateS3RepoConfig(t *testing.T) {
+	tests := []struct {
+		loc    string
+		json   string
+		expErr bool
+		expLoc string
+	}{
+		{"s3://bucket/prefix", "", false, "s3://bucket/prefix"},
+		{"https://bucket/prefix", "", true, ""},
+		{"", `{"loc":"s3://bucket"}`, false, "s3://bucket"},
+		{"", `{"type":"s3","loc":"s3://bucket","endpoint":"http://localhost:9000","region":"eu-central-1"}`, false, "s3://bucket"},
+		{"", `{"type":"file","loc":"s3://bucket"}`, true, ""},
+		{"", `{"loc":"s3://bucket","endpoint":"localhost:9000"}`, true, ""},
+		{"", `{"loc":"s3://bucket","tls":{"caFile":"/does/not/exist.pem"}}`, true, ""},
+		{"", `{"loc":"s3://bucket","lock":{"timeout":"10s","lease":"1m"}}`, false, "s3://bucket"},
+		{"", `{"loc":"s3://bucket","lock":{"kind":"flock"}}`, true, ""},
+		{"", `{}`, true, ""},
+	}
+	for i, test := range tests {
+		rc, err := createS3RepoConfig(test.loc, []byte(test.json))
+		if test.expErr {
+			assert.Errorf(t, err, "error expected in test %d", i)
+			continue
+		}
+		if assert.NoErrorf(t, err, "no error expected in test %d", i) {
+			assert.Equal(t, RepoTypeS3, rc[KeyRepoType])
+			assert.Equal(t, test.expLoc, rc[KeyRepoLoc])
+		}
+	}
+}
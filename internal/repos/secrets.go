@@ -0,0 +1,124 @@
+package repos
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/wot-oss/tmc/internal/secrets"
+)
+
+// MaskedSecret replaces secrets in repo configs which are shown to the user
+const MaskedSecret = "****"
+
+// secretAuthKeys are the keys in the auth section of a repo config whose values are secrets. All values in the
+// AuthKindHeaders section are secrets, too
+var secretAuthKeys = []string{AuthKindBearer, KeyBasicPassword, KeyOAuth2ClientSecret, KeyS3SecretAccessKey, KeyS3SessionToken}
+
+// resolveSecretRefs returns a copy of rc with all references to secrets, env variables and files in its string values
+// replaced by the values they refer to
+func resolveSecretRefs(rc map[string]any) (map[string]any, error) {
+	res, err := mapStrings(rc, nil, func(_ []string, s string) (string, error) {
+		if !secrets.HasReference(s) {
+			return s, nil
+		}
+		return secrets.Resolve(s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(map[string]any), nil
+}
+
+// MaskSecrets returns a copy of rc which is safe to show to the user. Secret values in the auth section and passwords
+// in URLs are replaced by MaskedSecret. References to secrets are kept, as they do not reveal them
+func MaskSecrets(rc map[string]any) map[string]any {
+	res, _ := mapStrings(rc, nil, func(path []string, s string) (string, error) {
+		if secrets.HasReference(s) {
+			return s, nil
+		}
+		if isSecretPath(path) {
+			return MaskedSecret, nil
+		}
+		return maskURLPassword(s), nil
+	})
+	return res.(map[string]any)
+}
+
+// StoreSecrets moves the secret values in the auth section of rc to store and returns a copy of rc which references
+// them instead. The secrets are named after the repo and their path in the auth section, e.g. 'my-repo.bearer'
+func StoreSecrets(repoName string, rc map[string]any, store secrets.Store) (map[string]any, error) {
+	res, err := mapStrings(rc, nil, func(path []string, s string) (string, error) {
+		if !isSecretPath(path) || secrets.HasReference(s) {
+			return s, nil
+		}
+		name := repoName + "." + strings.Join(path[1:], ".")
+		err := store.Set(name, s)
+		if err != nil {
+			return "", fmt.Errorf("could not store secret %s: %w", name, err)
+		}
+		return secrets.Reference(secrets.RefKindSecret, name), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(map[string]any), nil
+}
+
+// isSecretPath reports whether the value at path in a repo config is a secret
+func isSecretPath(path []string) bool {
+	if len(path) < 2 || path[0] != KeyRepoAuth {
+		return false
+	}
+	if len(path) > 2 && path[len(path)-2] == AuthKindHeaders {
+		return true
+	}
+	return slices.Contains(secretAuthKeys, path[len(path)-1])
+}
+
+// maskURLPassword replaces the password in s with MaskedSecret, if s is a URL with a password
+func maskURLPassword(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return s
+	}
+	// Redacted replaces the password with "xxxxx", which might be mistaken for the actual password
+	return strings.Replace(u.Redacted(), ":xxxxx@", ":"+MaskedSecret+"@", 1)
+}
+
+// mapStrings returns a deep copy of v with fn applied to all strings. path is the list of map keys leading to v
+func mapStrings(v any, path []string, fn func(path []string, s string) (string, error)) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return fn(path, t)
+	case map[string]any:
+		res := make(map[string]any, len(t))
+		for k, e := range t {
+			m, err := mapStrings(e, append(slices.Clip(path), k), fn)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = m
+		}
+		return res, nil
+	case []any:
+		res := make([]any, len(t))
+		for i, e := range t {
+			m, err := mapStrings(e, path, fn)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = m
+		}
+		return res, nil
+	default:
+		return v, nil
+	}
+}
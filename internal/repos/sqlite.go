@@ -0,0 +1,530 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/utils"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteDriverName = "sqlite"
+
+// sqliteSchema creates the tables of a sqlite repo. tm_files holds the TM files with the parts of their ids needed to
+// detect conflicts. tm_index holds the metadata of the indexed TMs, which List, Versions and completions query
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tm_files (
+	id        TEXT PRIMARY KEY,
+	name      TEXT NOT NULL,
+	version   TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	digest    TEXT NOT NULL,
+	content   BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tm_files_name_version ON tm_files (name, version);
+CREATE TABLE IF NOT EXISTS tm_index (
+	id           TEXT PRIMARY KEY REFERENCES tm_files (id) ON DELETE CASCADE,
+	name         TEXT NOT NULL,
+	author       TEXT NOT NULL,
+	manufacturer TEXT NOT NULL,
+	mpn          TEXT NOT NULL,
+	version      TEXT NOT NULL,
+	timestamp    TEXT NOT NULL,
+	digest       TEXT NOT NULL,
+	description  TEXT NOT NULL,
+	external_id  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tm_index_name ON tm_index (name);
+CREATE INDEX IF NOT EXISTS tm_index_author ON tm_index (author);
+CREATE INDEX IF NOT EXISTS tm_index_manufacturer ON tm_index (manufacturer);
+CREATE INDEX IF NOT EXISTS tm_index_mpn ON tm_index (mpn);
+`
+
+var (
+	sqliteDBsMu sync.Mutex
+	// sqliteDBs holds the open databases by file name. A database is opened once per process and shared by all
+	// SqliteRepo instances, because repos are created anew for every operation
+	sqliteDBs = map[string]*sql.DB{}
+)
+
+// SqliteRepo implements a Repo TM repository backed by a SQLite database file. The TM files and their metadata are
+// stored in tables, so that searching a large catalog does not require reading a complete index
+type SqliteRepo struct {
+	file string
+	spec model.RepoSpec
+}
+
+func NewSqliteRepo(config map[string]any, spec model.RepoSpec) (*SqliteRepo, error) {
+	loc := utils.JsGetString(config, KeyRepoLoc)
+	if loc == nil {
+		return nil, fmt.Errorf("invalid sqlite repo config. loc is either not found or not a string")
+	}
+	file, err := utils.ExpandHome(*loc)
+	if err != nil {
+		return nil, err
+	}
+	return &SqliteRepo{
+		file: file,
+		spec: spec,
+	}, nil
+}
+
+// db returns the shared database for the repo's file, creating the file and the schema if necessary
+func (s *SqliteRepo) db() (*sql.DB, error) {
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+	if db, ok := sqliteDBs[s.file]; ok {
+		return db, nil
+	}
+	// all transactions take the write lock immediately, so that concurrent writers wait for each other
+	// instead of failing to upgrade a read transaction
+	dsn := "file:" + (&url.URL{Path: s.file}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite repo %s: %w", s.file, err)
+	}
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not initialize sqlite repo %s: %w", s.file, err)
+	}
+	sqliteDBs[s.file] = db
+	return db, nil
+}
+
+func (s *SqliteRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
+	if len(raw) == 0 {
+		return errors.New("nothing to write")
+	}
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	idS := id.String()
+	match, existingId, err := s.getExistingID(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	switch match {
+	case idMatchDigest:
+		utils.Logger(ctx).Info(fmt.Sprintf("Same TM content already exists under ID %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameContent, ExistingId: existingId}
+	case idMatchTimestamp:
+		utils.Logger(ctx).Info(fmt.Sprintf("Version and timestamp clash with existing %v", existingId))
+		return &ErrTMIDConflict{Type: IdConflictSameTimestamp, ExistingId: existingId}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO tm_files (id, name, version, timestamp, digest, content) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET content = excluded.content`,
+		idS, id.Name, id.Version.BaseString(), id.Version.Timestamp, id.Version.Hash, raw)
+	if err != nil {
+		return fmt.Errorf("could not write TM to catalog: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not write TM to catalog: %w", err)
+	}
+	utils.Logger(ctx).Info("saved Thing Model", "id", idS)
+	return nil
+}
+
+// getExistingID finds a stored TM that matches id fully, or has the same name and version and either the same digest
+// or the same timestamp. The semantics are the same as FileRepo.getExistingID
+func (s *SqliteRepo) getExistingID(ctx context.Context, tx *sql.Tx, id model.TMID) (idMatch, string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, timestamp, digest FROM tm_files WHERE name = ? AND version = ? ORDER BY id DESC`,
+		id.Name, id.Version.BaseString())
+	if err != nil {
+		return idMatchNone, "", err
+	}
+	defer rows.Close()
+	type existing struct{ id, timestamp, digest string }
+	var es []existing
+	for rows.Next() {
+		var e existing
+		if err := rows.Scan(&e.id, &e.timestamp, &e.digest); err != nil {
+			return idMatchNone, "", err
+		}
+		if e.id == id.String() {
+			return idMatchFull, e.id, nil
+		}
+		es = append(es, e)
+	}
+	if err := rows.Err(); err != nil {
+		return idMatchNone, "", err
+	}
+	if len(es) == 0 {
+		return idMatchNone, "", nil
+	}
+	if es[0].digest == id.Version.Hash {
+		return idMatchDigest, es[0].id, nil
+	}
+	for _, e := range es {
+		if e.timestamp == id.Version.Timestamp {
+			return idMatchTimestamp, e.id, nil
+		}
+	}
+	return idMatchNone, "", nil
+}
+
+func (s *SqliteRepo) Fetch(ctx context.Context, id string) (string, []byte, error) {
+	tmid, err := model.ParseTMID(id)
+	if err != nil {
+		return "", nil, err
+	}
+	db, err := s.db()
+	if err != nil {
+		return "", nil, err
+	}
+	var actualId string
+	var content []byte
+	// the full id, or else the same content with a different timestamp
+	err = db.QueryRowContext(ctx, `SELECT id, content FROM tm_files WHERE id = ?
+		UNION ALL SELECT * FROM (SELECT id, content FROM tm_files WHERE name = ? AND version = ? AND digest = ? ORDER BY id DESC)
+		LIMIT 1`,
+		id, tmid.Name, tmid.Version.BaseString(), tmid.Version.Hash).Scan(&actualId, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrTmNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return actualId, content, nil
+}
+
+// Index updates the metadata of the TMs with given ids from the stored TM files, or of all TMs if no ids are given.
+// The update is done in a single transaction
+func (s *SqliteRepo) Index(ctx context.Context, ids ...string) error {
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rows *sql.Rows
+	if len(ids) == 0 { // full rebuild
+		_, err = tx.ExecContext(ctx, `DELETE FROM tm_index`)
+		if err != nil {
+			return err
+		}
+		rows, err = tx.QueryContext(ctx, `SELECT id, content FROM tm_files`)
+	} else {
+		args := make([]any, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		in := placeholders(len(ids))
+		// ids of deleted files are removed from the index
+		_, err = tx.ExecContext(ctx, `DELETE FROM tm_index WHERE id IN (`+in+`)`, args...)
+		if err != nil {
+			return err
+		}
+		rows, err = tx.QueryContext(ctx, `SELECT id, content FROM tm_files WHERE id IN (`+in+`)`, args...)
+	}
+	if err != nil {
+		return err
+	}
+	var versions []sqliteIndexRow
+	for rows.Next() {
+		var id string
+		var content []byte
+		if err := rows.Scan(&id, &content); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		row, err := toSqliteIndexRow(content)
+		if err != nil {
+			utils.Logger(ctx).Error("Failed to extract metadata from TM. The TM will be excluded from index", "id", id, "error", err)
+			continue
+		}
+		versions = append(versions, row)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO tm_index
+		(id, name, author, manufacturer, mpn, version, timestamp, digest, description, external_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, v := range versions {
+		_, err := stmt.ExecContext(ctx, v.TMID, v.name, v.author, v.manufacturer, v.mpn, v.Version.Model, v.TimeStamp, v.Digest, v.Description, v.ExternalID)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	utils.Logger(ctx).Info(fmt.Sprintf("Updated index with %d entries", len(versions)))
+	return nil
+}
+
+type sqliteIndexRow struct {
+	name, author, manufacturer, mpn string
+	model.IndexVersion
+}
+
+// toSqliteIndexRow extracts the indexed metadata from a TM file the same way a FileRepo's index is built
+func toSqliteIndexRow(content []byte) (sqliteIndexRow, error) {
+	var tm model.ThingModel
+	err := json.Unmarshal(content, &tm)
+	if err != nil {
+		return sqliteIndexRow{}, err
+	}
+	var idx model.Index
+	_, err = idx.Insert(&tm)
+	if err != nil {
+		return sqliteIndexRow{}, err
+	}
+	e := idx.Data[0]
+	return sqliteIndexRow{
+		name:         e.Name,
+		author:       e.Author.Name,
+		manufacturer: e.Manufacturer.Name,
+		mpn:          e.Mpn,
+		IndexVersion: e.Versions[0],
+	}, nil
+}
+
+func (s *SqliteRepo) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, error) {
+	log := utils.Logger(ctx)
+	log.Debug(fmt.Sprintf("Creating list with filter '%v'", search))
+	db, err := s.db()
+	if err != nil {
+		return model.SearchResult{}, err
+	}
+
+	query, args := sqliteListQuery(search)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return model.SearchResult{}, err
+	}
+	defer rows.Close()
+
+	var idx model.Index
+	var last *model.IndexEntry
+	for rows.Next() {
+		var r sqliteIndexRow
+		err := rows.Scan(&r.TMID, &r.name, &r.author, &r.manufacturer, &r.mpn, &r.Version.Model, &r.TimeStamp, &r.Digest, &r.Description, &r.ExternalID)
+		if err != nil {
+			return model.SearchResult{}, err
+		}
+		// rows are ordered by name, so all versions of an entry are adjacent
+		if last == nil || last.Name != r.name {
+			last = &model.IndexEntry{
+				Name:         r.name,
+				Manufacturer: model.SchemaManufacturer{Name: r.manufacturer},
+				Mpn:          r.mpn,
+				Author:       model.SchemaAuthor{Name: r.author},
+			}
+			idx.Data = append(idx.Data, last)
+		}
+		r.Links = map[string]string{model.TMLinkRel: r.TMID}
+		last.Versions = append(last.Versions, r.IndexVersion)
+	}
+	if err := rows.Err(); err != nil {
+		return model.SearchResult{}, err
+	}
+	return model.NewIndexToFoundMapper(s.Spec().ToFoundSource()).ToSearchResult(idx), nil
+}
+
+// sqliteListQuery builds the query for the index rows matching search, with the same semantics as model.Index.Filter
+func sqliteListQuery(search *model.SearchParams) (string, []any) {
+	query := `SELECT id, name, author, manufacturer, mpn, version, timestamp, digest, description, external_id FROM tm_index`
+	var conds []string
+	var args []any
+	in := func(col string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		conds = append(conds, col+" IN ("+placeholders(len(values))+")")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if search != nil {
+		if search.Name != "" {
+			switch search.Options.NameFilterType {
+			case model.FullMatch:
+				conds = append(conds, "name = ?")
+				args = append(args, search.Name)
+			default:
+				prefix := strings.Trim(search.Name, "/")
+				conds = append(conds, `(name = ? OR name LIKE ? ESCAPE '\')`)
+				args = append(args, prefix, escapeLike(prefix)+"/%")
+			}
+		}
+		in("author", search.Author)
+		in("manufacturer", search.Manufacturer)
+		in("mpn", search.Mpn)
+		if q := utils.ToTrimmedLower(search.Query); q != "" {
+			// an entry matches if any of its versions matches
+			conds = append(conds, `name IN (SELECT name FROM tm_index WHERE instr(lower(name), ?) > 0 OR instr(lower(manufacturer), ?) > 0
+				OR instr(lower(mpn), ?) > 0 OR instr(lower(description), ?) > 0 OR instr(lower(external_id), ?) > 0)`)
+			args = append(args, q, q, q, q, q)
+		}
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return query + " ORDER BY name, id", args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+func (s *SqliteRepo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
+	name = strings.TrimSpace(name)
+	res, err := s.List(ctx, &model.SearchParams{Name: name, Options: model.SearchOptions{NameFilterType: model.FullMatch}})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		err := fmt.Errorf("%w: %s", ErrTmNotFound, name)
+		utils.Logger(ctx).Error(err.Error())
+		return nil, err
+	}
+	return res.Entries[0].Versions, nil
+}
+
+func (s *SqliteRepo) Spec() model.RepoSpec {
+	return s.spec
+}
+
+// Delete deletes the TM with given id together with its index entry in a single transaction
+func (s *SqliteRepo) Delete(ctx context.Context, id string) error {
+	err := checkIdValid(id)
+	if err != nil {
+		return err
+	}
+	db, err := s.db()
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM tm_files WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTmNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *SqliteRepo) ListCompletions(ctx context.Context, kind string, toComplete string) ([]string, error) {
+	db, err := s.db()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case CompletionKindNames:
+		ns, err := queryStrings(ctx, db, `SELECT DISTINCT name FROM tm_index WHERE name LIKE ? ESCAPE '\'`, escapeLike(toComplete)+"%")
+		if err != nil {
+			return nil, err
+		}
+		_, seg := longestPath(toComplete)
+		return namesToCompletions(ns, toComplete, seg+1), nil
+	case CompletionKindFetchNames:
+		name, _, _ := strings.Cut(toComplete, ":")
+		vs, err := queryStrings(ctx, db, `SELECT DISTINCT version FROM tm_files WHERE name = ?`, name)
+		if err != nil {
+			return nil, err
+		}
+		var res []string
+		for _, v := range vs {
+			res = append(res, fmt.Sprintf("%s:%s", name, v))
+		}
+		slices.Sort(res)
+		return res, nil
+	default:
+		return nil, ErrInvalidCompletionParams
+	}
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+func createSqliteRepoConfig(fileName string, bytes []byte) (map[string]any, error) {
+	if fileName != "" {
+		absFile, err := makeAbs(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			KeyRepoType: RepoTypeSqlite,
+			KeyRepoLoc:  absFile,
+		}, nil
+	}
+	rc, err := AsRepoConfig(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rType := utils.JsGetString(rc, KeyRepoType); rType != nil {
+		if *rType != RepoTypeSqlite {
+			return nil, fmt.Errorf("invalid json config. type must be \"sqlite\" or absent")
+		}
+	}
+	rc[KeyRepoType] = RepoTypeSqlite
+	l := utils.JsGetString(rc, KeyRepoLoc)
+	if l == nil {
+		return nil, fmt.Errorf("invalid json config. must have string \"loc\"")
+	}
+	la, err := makeAbs(*l)
+	if err != nil {
+		return nil, err
+	}
+	rc[KeyRepoLoc] = la
+	return rc, nil
+}
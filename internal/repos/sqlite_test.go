@@ -0,0 +1,210 @@
+package repos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wot-oss/tmc/internal/model"
+)
+
+const (
+	sqliteTestId1 = "omnicorp-tm-department/omnicorp/omnilamp/v3.2.1-20240409155220-3f779458e453.tm.json"
+	sqliteTestId2 = "omnicorp-tm-department/omnicorp/omnilamp/subfolder/v0.0.0-20240409155220-80424c65e4e6.tm.json"
+)
+
+func newTestSqliteRepo(t *testing.T) *SqliteRepo {
+	t.Helper()
+	r, err := NewSqliteRepo(map[string]any{"type": "sqlite", "loc": filepath.Join(t.TempDir(), "catalog.db")}, model.NewRepoSpec("sq"))
+	assert.NoError(t, err)
+	return r
+}
+
+func pushTestTMs(t *testing.T, r Repo, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		raw, err := os.ReadFile(filepath.Join("../../test/data/index", id))
+		assert.NoError(t, err)
+		assert.NoError(t, r.Push(context.Background(), model.MustParseTMID(id), raw))
+	}
+	assert.NoError(t, r.Index(context.Background(), ids...))
+}
+
+func TestNewSqliteRepo(t *testing.T) {
+	r, err := NewSqliteRepo(map[string]any{"type": "sqlite", "loc": "/tmp/catalog.db"}, model.NewRepoSpec("sq"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/catalog.db", r.file)
+
+	_, err = NewSqliteRepo(map[string]any{"type": "sqlite"}, model.NewRepoSpec("sq"))
+	assert.Error(t, err)
+}
+
+func TestSqliteRepo_PushAndFetch(t *testing.T) {
+	r := newTestSqliteRepo(t)
+	ctx := context.Background()
+	raw, err := os.ReadFile(filepath.Join("../../test/data/index", sqliteTestId1))
+	assert.NoError(t, err)
+	id := model.MustParseTMID(sqliteTestId1)
+
+	assert.NoError(t, r.Push(ctx, id, raw))
+
+	t.Run("fetch by full id", func(t *testing.T) {
+		actualId, b, err := r.Fetch(ctx, sqliteTestId1)
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+		assert.Equal(t, raw, b)
+	})
+	t.Run("fetch by id with different timestamp", func(t *testing.T) {
+		actualId, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "20240409155220", "20240101000000", 1))
+		assert.NoError(t, err)
+		assert.Equal(t, sqliteTestId1, actualId)
+	})
+	t.Run("fetch non-existing", func(t *testing.T) {
+		_, _, err := r.Fetch(ctx, strings.Replace(sqliteTestId1, "3f779458e453", "000000000000", 1))
+		assert.ErrorIs(t, err, ErrTmNotFound)
+	})
+	t.Run("push same id again", func(t *testing.T) {
+		assert.NoError(t, r.Push(ctx, id, raw))
+	})
+	t.Run("push same content with different timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Timestamp = "20240501000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameContent, cErr.Type)
+			assert.Equal(t, sqliteTestId1, cErr.ExistingId)
+		}
+	})
+	t.Run("push different content with same timestamp", func(t *testing.T) {
+		other := id
+		other.Version.Hash = "000000000000"
+		err := r.Push(ctx, other, raw)
+		var cErr *ErrTMIDConflict
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.EqualValues(t, IdConflictSameTimestamp, cErr.Type)
+		}
+	})
+	t.Run("push nothing", func(t *testing.T) {
+		assert.Error(t, r.Push(ctx, id, nil))
+	})
+}
+
+func TestSqliteRepo_IndexAndList(t *testing.T) {
+	r := newTestSqliteRepo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1, sqliteTestId2)
+
+	t.Run("list all", func(t *testing.T) {
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		if assert.Len(t, res.Entries, 2) {
+			assert.Equal(t, "omnicorp-tm-department/omnicorp/omnilamp", res.Entries[0].Name)
+			assert.Equal(t, "omnicorp", res.Entries[0].Manufacturer.Name)
+			assert.Equal(t, "omnilamp", res.Entries[0].Mpn)
+			assert.Equal(t, "omnicorp-tm-department", res.Entries[0].Author.Name)
+			if assert.Len(t, res.Entries[0].Versions, 1) {
+				v := res.Entries[0].Versions[0]
+				assert.Equal(t, sqliteTestId1, v.TMID)
+				assert.Equal(t, "3.2.1", v.Version.Model)
+				assert.Equal(t, "3f779458e453", v.Digest)
+				assert.Equal(t, "20240409155220", v.TimeStamp)
+				assert.Equal(t, sqliteTestId1, v.Links["content"])
+				assert.Equal(t, model.FoundSource{RepoName: "sq"}, v.FoundIn)
+			}
+			assert.Equal(t, "omnicorp-tm-department/omnicorp/omnilamp/subfolder", res.Entries[1].Name)
+		}
+	})
+	t.Run("list with filters", func(t *testing.T) {
+		tests := []struct {
+			search *model.SearchParams
+			exp    int
+		}{
+			{&model.SearchParams{Name: "omnicorp-tm-department/omnicorp/omnilamp"}, 1},
+			{&model.SearchParams{Name: "omnicorp-tm-department/omnicorp", Options: model.SearchOptions{NameFilterType: model.PrefixMatch}}, 2},
+			{&model.SearchParams{Name: "omnicorp-tm-department/omni", Options: model.SearchOptions{NameFilterType: model.PrefixMatch}}, 0},
+			{&model.SearchParams{Author: []string{"omnicorp-tm-department"}}, 2},
+			{&model.SearchParams{Manufacturer: []string{"other", "omnicorp"}}, 2},
+			{&model.SearchParams{Mpn: []string{"other"}}, 0},
+			{&model.SearchParams{Query: "SUBFOLDER"}, 1},
+			{&model.SearchParams{Query: "nothing like this"}, 0},
+		}
+		for i, test := range tests {
+			res, err := r.List(ctx, test.search)
+			assert.NoError(t, err)
+			assert.Lenf(t, res.Entries, test.exp, "in test %d", i)
+		}
+	})
+	t.Run("versions", func(t *testing.T) {
+		vs, err := r.Versions(ctx, "omnicorp-tm-department/omnicorp/omnilamp")
+		assert.NoError(t, err)
+		assert.Len(t, vs, 1)
+		_, err = r.Versions(ctx, "omnicorp-tm-department/omnicorp")
+		assert.ErrorIs(t, err, ErrTmNotFound)
+	})
+	t.Run("completions", func(t *testing.T) {
+		names, err := r.ListCompletions(ctx, CompletionKindNames, "omnicorp-tm-department/omnicorp/")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"omnicorp-tm-department/omnicorp/omnilamp", "omnicorp-tm-department/omnicorp/omnilamp/"}, names)
+		fns, err := r.ListCompletions(ctx, CompletionKindFetchNames, "omnicorp-tm-department/omnicorp/omnilamp:")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"omnicorp-tm-department/omnicorp/omnilamp:v3.2.1"}, fns)
+		_, err = r.ListCompletions(ctx, "unknown", "")
+		assert.ErrorIs(t, err, ErrInvalidCompletionParams)
+	})
+	t.Run("full rebuild", func(t *testing.T) {
+		assert.NoError(t, r.Index(ctx))
+		res, err := r.List(ctx, &model.SearchParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Entries, 2)
+	})
+}
+
+func TestSqliteRepo_Delete(t *testing.T) {
+	r := newTestSqliteRepo(t)
+	ctx := context.Background()
+	pushTestTMs(t, r, sqliteTestId1, sqliteTestId2)
+
+	assert.NoError(t, r.Delete(ctx, sqliteTestId2))
+	_, _, err := r.Fetch(ctx, sqliteTestId2)
+	assert.ErrorIs(t, err, ErrTmNotFound)
+	res, err := r.List(ctx, &model.SearchParams{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 1)
+
+	assert.ErrorIs(t, r.Delete(ctx, sqliteTestId2), ErrTmNotFound)
+	assert.Error(t, r.Delete(ctx, "invalid-id"))
+	assert.NoError(t, r.Index(ctx, sqliteTestId2))
+}
+
+func TestCreateSqliteRepoConfig(t *testing.T) {
+	wd, _ := os.Getwd()
+
+	tests := []struct {
+		strConf  string
+		fileConf string
+		expLoc   string
+		expErr   bool
+	}{
+		{"dir/catalog.db", "", filepath.Join(wd, "dir/catalog.db"), false},
+		{"/dir/catalog.db", "", filepath.Join(filepath.VolumeName(wd), "/dir/catalog.db"), false},
+		{"~/catalog.db", "", "~/catalog.db", false},
+		{"", `{}`, "", true},
+		{"", `{"loc":"dir/catalog.db"}`, filepath.Join(wd, "dir/catalog.db"), false},
+		{"", `{"loc":"dir/catalog.db", "type":"file"}`, "", true},
+	}
+
+	for i, test := range tests {
+		cf, err := createSqliteRepoConfig(test.strConf, []byte(test.fileConf))
+		if test.expErr {
+			assert.Error(t, err, "error expected in test %d for %s %s", i, test.strConf, test.fileConf)
+			continue
+		}
+		assert.NoError(t, err, "no error expected in test %d for %s %s", i, test.strConf, test.fileConf)
+		assert.Equalf(t, "sqlite", cf[KeyRepoType], "in test %d for %s %s", i, test.strConf, test.fileConf)
+		assert.Equalf(t, test.expLoc, cf[KeyRepoLoc], "in test %d for %s %s", i, test.strConf, test.fileConf)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
@@ -44,7 +44,7 @@ func (t TmcRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
 		return err
 	}
 	req.Header.Add(headerContentType, mimeJSON)
-	resp, err := doHttp(req, t.auth)
+	resp, err := t.doHttp(req)
 	if err != nil {
 		return err
 	}
@@ -86,6 +86,90 @@ func (t TmcRepo) Push(ctx context.Context, id model.TMID, raw []byte) error {
 		return errors.New(fmt.Sprintf("received unexpected HTTP response from remote TM catalog: %s", resp.Status))
 	}
 }
+
+// PushBulk uploads all files in a single multipart request, making the server index them only once.
+// Returns ErrBulkPushNotSupported if the server does not provide the bulk push endpoint
+func (t TmcRepo) PushBulk(ctx context.Context, files []BulkPushFile, optPath string, optTree bool) ([]BulkPushResult, error) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for _, f := range files {
+		fw, err := mw.CreateFormFile("files", f.Name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fw.Write(f.Raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	reqUrl := t.parsedRoot.JoinPath("thing-models", ".bulk")
+	vals := url.Values{}
+	if optPath != "" {
+		vals.Set("optPath", optPath)
+	}
+	if optTree {
+		vals.Set("optTree", "true")
+	}
+	reqUrl.RawQuery = vals.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add(headerContentType, mw.FormDataContentType())
+	resp, err := t.doHttp(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var pr server.PushThingModelsResponse
+		err = json.Unmarshal(b, &pr)
+		if err != nil {
+			return nil, err
+		}
+		var res []BulkPushResult
+		for _, r := range pr.Data {
+			br := BulkPushResult{
+				Name: r.Name,
+				Type: BulkPushResultType(r.Result),
+			}
+			if r.TmID != nil {
+				br.TMID = *r.TmID
+			}
+			if r.Message != nil {
+				br.Message = *r.Message
+			}
+			res = append(res, br)
+		}
+		return res, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, ErrBulkPushNotSupported
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusInternalServerError:
+		var e server.ErrorResponse
+		err = json.Unmarshal(b, &e)
+		if err != nil {
+			return nil, err
+		}
+		detail := e.Title
+		if e.Detail != nil {
+			detail = *e.Detail
+		}
+		return nil, errors.New(detail)
+	default:
+		return nil, errors.New(fmt.Sprintf("received unexpected HTTP response from remote TM catalog: %s", resp.Status))
+	}
+}
+
 func (t TmcRepo) Delete(ctx context.Context, id string) error {
 	reqUrl := t.parsedRoot.JoinPath("thing-models", id)
 	vals := url.Values{
@@ -97,7 +181,7 @@ func (t TmcRepo) Delete(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := doHttp(req, t.auth)
+	resp, err := t.doHttp(req)
 	if err != nil {
 		return err
 	}
@@ -136,7 +220,7 @@ func (t TmcRepo) Spec() model.RepoSpec {
 }
 func (t TmcRepo) Fetch(ctx context.Context, id string) (string, []byte, error) {
 	reqUrl := t.parsedRoot.JoinPath("thing-models", id)
-	return fetchTM(ctx, reqUrl.String(), t.auth)
+	return t.fetchTM(ctx, reqUrl.String())
 }
 
 func (t TmcRepo) Index(context.Context, ...string) error {
@@ -154,7 +238,7 @@ func (t TmcRepo) List(ctx context.Context, search *model.SearchParams) (model.Se
 		addSearchParams(reqUrl, search)
 	}
 
-	resp, err := doGet(ctx, reqUrl.String(), t.auth)
+	resp, err := t.doGet(ctx, reqUrl.String())
 	if err != nil {
 		return model.SearchResult{}, err
 	}
@@ -238,14 +322,14 @@ func appendQueryArray(u *url.URL, key string, values []string) {
 }
 
 func (t TmcRepo) Versions(ctx context.Context, name string) ([]model.FoundVersion, error) {
-	log := slog.Default()
+	log := utils.Logger(ctx)
 	name = strings.TrimSpace(name)
 	if len(name) == 0 {
 		log.Error("Please specify a repoName to show the TM.")
 		return nil, errors.New("please specify a repoName to show the TM")
 	}
 	reqUrl := t.parsedRoot.JoinPath("inventory", url.PathEscape(name), ".versions")
-	resp, err := doGet(ctx, reqUrl.String(), t.auth)
+	resp, err := t.doGet(ctx, reqUrl.String())
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +369,7 @@ func (t TmcRepo) ListCompletions(ctx context.Context, kind string, toComplete st
 	vals.Set("toComplete", toComplete)
 	u.RawQuery = vals.Encode()
 
-	resp, err := doGet(ctx, u.String(), t.auth)
+	resp, err := t.doGet(ctx, u.String())
 	if err != nil {
 		return nil, err
 	}
@@ -333,6 +417,22 @@ func createTmcRepoConfig(loc string, bytes []byte) (map[string]any, error) {
 			return nil, fmt.Errorf("invalid json config. must have string \"loc\"")
 		}
 		rc[KeyRepoLoc] = *l
+		err = validateTLSConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateProxyConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateRequestsConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		err = validateAuthConfig(rc)
+		if err != nil {
+			return nil, err
+		}
 		return rc, nil
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -541,3 +542,81 @@ func TestTmcRepo_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestTmcRepo_PushBulk(t *testing.T) {
+	files := []BulkPushFile{
+		{Name: "sub/one.json", Raw: []byte(`{"title":"one"}`)},
+		{Name: "two.json", Raw: []byte(`{"title":"two"}`)},
+	}
+	type ht struct {
+		name     string
+		status   int
+		respBody []byte
+		expRes   []BulkPushResult
+		expErr   error
+	}
+	htc := make(chan ht, 1)
+	defer close(htc)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := <-htc
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/thing-models/.bulk", r.URL.Path)
+		assert.Equal(t, url.Values{"optPath": []string{"opt"}, "optTree": []string{"true"}}, r.URL.Query())
+		mr, err := r.MultipartReader()
+		if assert.NoError(t, err) {
+			for _, f := range files {
+				part, err := mr.NextPart()
+				if assert.NoError(t, err) {
+					_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+					assert.Equal(t, f.Name, params["filename"])
+					b, _ := io.ReadAll(part)
+					assert.Equal(t, f.Raw, b)
+				}
+			}
+		}
+		w.WriteHeader(h.status)
+		_, _ = w.Write(h.respBody)
+	}))
+	defer srv.Close()
+
+	config, err := createTmcRepoConfig(srv.URL, nil)
+	assert.NoError(t, err)
+	r, err := NewTmcRepo(config, model.NewRepoSpec("nameless"))
+	assert.NoError(t, err)
+
+	tests := []ht{
+		{
+			name:     "results",
+			status:   http.StatusOK,
+			respBody: []byte(`{"data":[{"name":"sub/one.json","result":"ok","tmID":"a/b/c/v1.0.0-20240101000000-abcdef012345.tm.json"},{"name":"two.json","result":"error","message":"invalid"}]}`),
+			expRes: []BulkPushResult{
+				{Name: "sub/one.json", Type: BulkPushOK, TMID: "a/b/c/v1.0.0-20240101000000-abcdef012345.tm.json"},
+				{Name: "two.json", Type: BulkPushError, Message: "invalid"},
+			},
+		},
+		{
+			name:   "endpoint not supported",
+			status: http.StatusMethodNotAllowed,
+			expErr: ErrBulkPushNotSupported,
+		},
+		{
+			name:     "too large",
+			status:   http.StatusRequestEntityTooLarge,
+			respBody: []byte(`{"detail":"Request body exceeds the maximum size of 10 bytes"}`),
+			expErr:   errors.New("Request body exceeds the maximum size of 10 bytes"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			htc <- test
+			res, err := r.PushBulk(context.Background(), files, "opt", true)
+			if test.expErr == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expRes, res)
+			} else {
+				assert.Equal(t, test.expErr, err)
+			}
+		})
+	}
+}
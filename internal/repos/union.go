@@ -8,15 +8,21 @@ import (
 	"sync"
 
 	"github.com/wot-oss/tmc/internal/model"
+	"github.com/wot-oss/tmc/internal/tracing"
 )
 
+// Union combines several repos into one. The repos are ranked by their order in the union: when the same TM is found
+// in several repos, the one from the repo with the highest configured priority takes precedence
 type Union struct {
-	rs []Repo
+	rs       []Repo
+	priority model.PriorityFunc
 }
 
 type mapResult[T any] struct {
 	res T
 	err *RepoAccessError
+	// idx is the index of the repo which produced the result
+	idx int
 }
 
 type RepoAccessError struct {
@@ -48,7 +54,8 @@ func (e *RepoAccessError) Unwrap() error {
 
 func NewUnion(rs ...Repo) *Union {
 	return &Union{
-		rs: rs,
+		rs:       rs,
+		priority: Priorities(),
 	}
 }
 
@@ -59,7 +66,7 @@ func (u *Union) Fetch(ctx context.Context, id string) (string, []byte, error, []
 		err error
 	}
 
-	mapper := func(r Repo) mapResult[fetchRes] {
+	mapper := func(ctx context.Context, r Repo) mapResult[fetchRes] {
 		fid, thing, err := r.Fetch(ctx, id)
 		res := fetchRes{id: fid, b: thing, err: err}
 		if errors.Is(err, ErrTmNotFound) {
@@ -70,19 +77,32 @@ func (u *Union) Fetch(ctx context.Context, id string) (string, []byte, error, []
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	results := mapConcurrent(ctx, u.rs, mapper)
-	res := fetchRes{err: ErrTmNotFound}
-	res, errs := reduce(results, res, func(r1, r2 fetchRes) fetchRes {
-		if r1.err == nil {
-			cancel()
-			return r1
+	results := mapConcurrent(ctx, "Fetch", u.rs, mapper)
+	// the TM from the highest ranked repo wins, so wait for the answers of all repos ranked higher than the best found
+	answers := make([]*mapResult[fetchRes], len(u.rs))
+	var errs []*RepoAccessError
+	var res *fetchRes
+	for r := range results {
+		r := r
+		answers[r.idx] = &r
+		if r.err != nil {
+			errs = append(errs, r.err)
 		}
-		if r2.err == nil {
-			cancel()
+		for _, a := range answers {
+			if a == nil {
+				break
+			}
+			if a.res.err == nil {
+				res = &a.res
+				cancel()
+				break
+			}
 		}
-		return r2
-	})
-	if res.err != nil {
+		if res != nil {
+			break
+		}
+	}
+	if res == nil {
 		return "", nil, ErrTmNotFound, errs
 	}
 
@@ -90,26 +110,40 @@ func (u *Union) Fetch(ctx context.Context, id string) (string, []byte, error, []
 }
 
 func (u *Union) List(ctx context.Context, search *model.SearchParams) (model.SearchResult, []*RepoAccessError) {
-	mapper := func(r Repo) mapResult[*model.SearchResult] {
+	mapper := func(ctx context.Context, r Repo) mapResult[*model.SearchResult] {
 		idx, err := r.List(ctx, search)
 		return mapResult[*model.SearchResult]{res: &idx, err: newRepoAccessError(r, err)}
 	}
 
 	reducer := func(t1, t2 *model.SearchResult) *model.SearchResult {
-		t1.Merge(t2)
+		t1.Merge(t2, u.priority)
 		return t1
 	}
 
-	results := mapConcurrent(ctx, u.rs, mapper)
+	results := mapConcurrent(ctx, "List", u.rs, mapper)
 	r, errs := reduce(results, &model.SearchResult{}, reducer)
 	return *r, errs
 }
 
-// reduce reads results from ch until ch is closed and reduces them to a single result with identity as the starting value
+// repoName returns the name of r or its directory, if it has no name
+func repoName(r Repo) string {
+	if name := r.Spec().RepoName(); name != "" {
+		return name
+	}
+	return r.Spec().Dir()
+}
+
+// reduce reads results from ch until ch is closed and reduces them to a single result with identity as the starting value.
+// The results are reduced in the order of the repos which produced them, regardless of the order they arrive in
 func reduce[T any](ch <-chan mapResult[T], identity T, reducer func(t1, t2 T) T) (T, []*RepoAccessError) {
+	var results []mapResult[T]
+	for res := range ch {
+		results = append(results, res)
+	}
+	slices.SortFunc(results, func(a, b mapResult[T]) int { return a.idx - b.idx })
 	accumulator := identity
 	var errs []*RepoAccessError
-	for res := range ch {
+	for _, res := range results {
 		accumulator = reducer(accumulator, res.res)
 		if res.err != nil {
 			errs = append(errs, res.err)
@@ -118,22 +152,34 @@ func reduce[T any](ch <-chan mapResult[T], identity T, reducer func(t1, t2 T) T)
 	return accumulator, errs
 }
 
-// mapConcurrent concurrently maps all repo with the mapper to a mapResult.
+// mapConcurrent concurrently maps all repo with the mapper to a mapResult. Each call of mapper is traced in a span named
+// after op, whose context is passed to mapper.
 // Returns channel with results
-func mapConcurrent[T any](ctx context.Context, repos []Repo, mapper func(r Repo) mapResult[T]) (results <-chan mapResult[T]) {
+func mapConcurrent[T any](ctx context.Context, op string, repos []Repo, mapper func(ctx context.Context, r Repo) mapResult[T]) (results <-chan mapResult[T]) {
 	res := make(chan mapResult[T])
 	wg := sync.WaitGroup{}
 	wg.Add(len(repos))
 
 	// start goroutines with cancellable mapping functions
-	for _, repo := range repos {
-		go func(r Repo) {
+	for i, repo := range repos {
+		go func(i int, r Repo) {
 			defer wg.Done()
+			rctx, span := tracing.Start(ctx, "Union."+op)
+			if span.IsRecording() {
+				span.SetAttributes(tracing.AttrRepo.String(repoName(r)))
+			}
+			mr := mapper(rctx, r)
+			mr.idx = i
+			var err error
+			if mr.err != nil {
+				err = mr.err
+			}
+			tracing.End(span, err)
 			select {
 			case <-ctx.Done():
-			case res <- mapper(r):
+			case res <- mr:
 			}
-		}(repo)
+		}(i, repo)
 	}
 
 	// close results channel when all mapping goroutines have finished
@@ -146,7 +192,7 @@ func mapConcurrent[T any](ctx context.Context, repos []Repo, mapper func(r Repo)
 }
 
 func (u *Union) Versions(ctx context.Context, name string) ([]model.FoundVersion, []*RepoAccessError) {
-	mapper := func(r Repo) mapResult[[]model.FoundVersion] {
+	mapper := func(ctx context.Context, r Repo) mapResult[[]model.FoundVersion] {
 		vers, err := r.Versions(ctx, name)
 		if errors.Is(err, ErrTmNotFound) {
 			return mapResult[[]model.FoundVersion]{res: vers, err: nil}
@@ -154,13 +200,15 @@ func (u *Union) Versions(ctx context.Context, name string) ([]model.FoundVersion
 		return mapResult[[]model.FoundVersion]{res: vers, err: newRepoAccessError(r, err)}
 	}
 	var ident []model.FoundVersion
-	results := mapConcurrent(ctx, u.rs, mapper)
-	res, errs := reduce(results, ident, model.MergeFoundVersions)
+	results := mapConcurrent(ctx, "Versions", u.rs, mapper)
+	res, errs := reduce(results, ident, func(vs1, vs2 []model.FoundVersion) []model.FoundVersion {
+		return model.MergeFoundVersions(vs1, vs2, u.priority)
+	})
 	return res, errs
 }
 
 func (u *Union) ListCompletions(ctx context.Context, kind string, toComplete string) []string {
-	mapper := func(r Repo) mapResult[[]string] {
+	mapper := func(ctx context.Context, r Repo) mapResult[[]string] {
 		rcs, err := r.ListCompletions(ctx, kind, toComplete)
 		if err != nil {
 			rcs = nil
@@ -169,7 +217,7 @@ func (u *Union) ListCompletions(ctx context.Context, kind string, toComplete str
 	}
 	reducer := func(r1, r2 []string) []string { return append(r1, r2...) }
 	var cs []string
-	results := mapConcurrent(ctx, u.rs, mapper)
+	results := mapConcurrent(ctx, "ListCompletions", u.rs, mapper)
 	res, _ := reduce(results, cs, reducer)
 	slices.Sort(res)
 	return slices.Compact(res)
@@ -0,0 +1,238 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wot-oss/tmc/internal/utils"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileFormatVersion = 1
+	kdfScrypt         = "scrypt"
+
+	// scrypt parameters as recommended for interactive logins
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLength   = 16
+
+	secretsDirPermissions  = 0700
+	secretsFilePermissions = 0600
+)
+
+// encryptedFile is the content of the secrets file. The secrets are encrypted with AES-256-GCM with a key derived
+// from the passphrase with scrypt
+type encryptedFile struct {
+	Version int `json:"version"`
+	KDF     kdf `json:"kdf"`
+	// Nonce and Ciphertext are base64 encoded by encoding/json
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type kdf struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// FileStore is a Store which keeps the secrets in a file encrypted with a passphrase.
+// The decrypted secrets are cached until the file is modified, because deriving the key is slow by design
+type FileStore struct {
+	file       string
+	passphrase string
+
+	mu      sync.Mutex
+	modTime time.Time
+	secrets map[string]string
+}
+
+func NewFileStore(file, passphrase string) *FileStore {
+	return &FileStore{file: file, passphrase: passphrase}
+}
+
+func (s *FileStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return v, nil
+}
+
+func (s *FileStore) Set(name, value string) error {
+	if name == "" {
+		return errors.New("secret name must not be empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.save(secrets)
+}
+
+func (s *FileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	delete(secrets, name)
+	return s.save(secrets)
+}
+
+func (s *FileStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range secrets {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// load returns a copy of the secrets in the file, decrypting it only if it has been modified since last load.
+// Must be called with s.mu held
+func (s *FileStore) load() (map[string]string, error) {
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.secrets = nil
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	if s.secrets == nil || !stat.ModTime().Equal(s.modTime) {
+		b, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, err
+		}
+		secrets, err := decrypt(b, s.passphrase)
+		if err != nil {
+			return nil, err
+		}
+		s.secrets = secrets
+		s.modTime = stat.ModTime()
+	}
+	res := make(map[string]string, len(s.secrets))
+	for k, v := range s.secrets {
+		res[k] = v
+	}
+	return res, nil
+}
+
+// save encrypts secrets with a new salt and nonce and writes them to the file. Must be called with s.mu held
+func (s *FileStore) save(secrets map[string]string) error {
+	b, err := encrypt(secrets, s.passphrase)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.file), secretsDirPermissions)
+	if err != nil {
+		return err
+	}
+	err = utils.AtomicWriteFile(s.file, b, secretsFilePermissions)
+	if err != nil {
+		return err
+	}
+	// force reload on next access
+	s.secrets = nil
+	return nil
+}
+
+func encrypt(secrets map[string]string, passphrase string) ([]byte, error) {
+	k := kdf{Name: kdfScrypt, Salt: make([]byte, saltLength), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(k.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(k, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	f := encryptedFile{
+		Version:    fileFormatVersion,
+		KDF:        k,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plain, nil),
+	}
+	return json.MarshalIndent(f, "", "  ")
+}
+
+func decrypt(data []byte, passphrase string) (map[string]string, error) {
+	var f encryptedFile
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets file: %w", err)
+	}
+	if f.Version != fileFormatVersion || f.KDF.Name != kdfScrypt {
+		return nil, fmt.Errorf("invalid secrets file: unsupported version %d or key derivation %q", f.Version, f.KDF.Name)
+	}
+	aead, err := newAEAD(f.KDF, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid secrets file: invalid nonce")
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	secrets := map[string]string{}
+	err = json.Unmarshal(plain, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets file: %w", err)
+	}
+	return secrets, nil
+}
+
+func newAEAD(k kdf, passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), k.Salt, k.N, k.R, k.P, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets file: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
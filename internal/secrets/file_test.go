@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sub", "secrets.enc")
+	s := NewFileStore(file, "correct horse")
+
+	names, err := s.List()
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+	_, err = s.Get("gitlab")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	assert.NoError(t, s.Set("gitlab", "glpat-s3cr3t"))
+	assert.NoError(t, s.Set("artifactory", "AKCp8s3cr3t"))
+
+	t.Run("encrypted at rest", func(t *testing.T) {
+		b, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), "s3cr3t")
+		assert.NotContains(t, string(b), "gitlab")
+		stat, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(secretsFilePermissions), stat.Mode().Perm())
+	})
+	t.Run("read by another store", func(t *testing.T) {
+		s2 := NewFileStore(file, "correct horse")
+		v, err := s2.Get("gitlab")
+		assert.NoError(t, err)
+		assert.Equal(t, "glpat-s3cr3t", v)
+		names, err := s2.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"artifactory", "gitlab"}, names)
+	})
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, err := NewFileStore(file, "battery staple").Get("gitlab")
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+		err = NewFileStore(file, "battery staple").Set("other", "value")
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, s.Delete("artifactory"))
+		assert.ErrorIs(t, s.Delete("artifactory"), ErrSecretNotFound)
+		names, err := s.List()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"gitlab"}, names)
+	})
+	t.Run("invalid file", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "secrets.enc")
+		assert.NoError(t, os.WriteFile(invalid, []byte(`{"version":2}`), 0600))
+		_, err := NewFileStore(invalid, "correct horse").List()
+		assert.ErrorContains(t, err, "invalid secrets file")
+	})
+}
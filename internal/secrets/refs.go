@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	RefKindEnv    = "env"
+	RefKindFile   = "file"
+	RefKindSecret = "secret"
+)
+
+// refRegex matches references of the form ${<kind>:<name>}
+var refRegex = regexp.MustCompile(`\$\{(env|file|secret):([^}]*)}`)
+
+// Reference returns a reference to the value named name of given kind, e.g. ${env:GITLAB_TOKEN}
+func Reference(kind, name string) string {
+	return fmt.Sprintf("${%s:%s}", kind, name)
+}
+
+// HasReference reports whether s contains a reference
+func HasReference(s string) bool {
+	return refRegex.MatchString(s)
+}
+
+// Resolve replaces all references in s with the values they refer to:
+//   - ${env:VAR} with the value of environment variable VAR, which must be set
+//   - ${file:/path} with the contents of the file, without trailing line breaks
+//   - ${secret:name} with the secret from the Default store
+func Resolve(s string) (string, error) {
+	return resolve(s, Default)
+}
+
+func resolve(s string, store func() (Store, error)) (string, error) {
+	var rErr error
+	res := refRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if rErr != nil {
+			return ""
+		}
+		m := refRegex.FindStringSubmatch(ref)
+		kind, name := m[1], m[2]
+		if name == "" {
+			rErr = fmt.Errorf("%w: %s", ErrInvalidReference, ref)
+			return ""
+		}
+		switch kind {
+		case RefKindEnv:
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				rErr = fmt.Errorf("cannot resolve %s: environment variable %s is not set", ref, name)
+			}
+			return v
+		case RefKindFile:
+			b, err := os.ReadFile(name)
+			if err != nil {
+				rErr = fmt.Errorf("cannot resolve %s: %w", ref, err)
+			}
+			return strings.TrimRight(string(b), "\r\n")
+		default: // RefKindSecret
+			st, err := store()
+			if err != nil {
+				rErr = fmt.Errorf("cannot resolve %s: %w", ref, err)
+				return ""
+			}
+			v, err := st.Get(name)
+			if err != nil {
+				rErr = fmt.Errorf("cannot resolve %s: %w", ref, err)
+			}
+			return v
+		}
+	})
+	if rErr != nil {
+		return "", rErr
+	}
+	return res, nil
+}
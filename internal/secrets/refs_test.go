@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("TMC_TEST_TOKEN", "from-env")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("from-file\r\n"), 0600))
+	store := NewFileStore(filepath.Join(dir, "secrets.enc"), "pass")
+	assert.NoError(t, store.Set("gitlab", "from-store"))
+	openStore := func() (Store, error) { return store, nil }
+
+	tests := []struct {
+		in     string
+		exp    string
+		expErr string
+	}{
+		{"plain", "plain", ""},
+		{"${env:TMC_TEST_TOKEN}", "from-env", ""},
+		{"${file:" + tokenFile + "}", "from-file", ""},
+		{"${secret:gitlab}", "from-store", ""},
+		{"Bearer ${env:TMC_TEST_TOKEN}/${secret:gitlab}", "Bearer from-env/from-store", ""},
+		{"${vault:gitlab}", "${vault:gitlab}", ""},
+		{"${env:TMC_TEST_UNSET}", "", "TMC_TEST_UNSET is not set"},
+		{"${file:" + filepath.Join(dir, "missing") + "}", "", "cannot resolve"},
+		{"${secret:missing}", "", ErrSecretNotFound.Error()},
+		{"${env:}", "", ErrInvalidReference.Error()},
+	}
+	for i, test := range tests {
+		res, err := resolve(test.in, openStore)
+		if test.expErr == "" {
+			assert.NoError(t, err, "test %d", i)
+			assert.Equal(t, test.exp, res, "test %d", i)
+		} else {
+			assert.ErrorContains(t, err, test.expErr, "test %d", i)
+		}
+	}
+
+	t.Run("store is opened only for secrets", func(t *testing.T) {
+		locked := func() (Store, error) { return nil, ErrNoPassphrase }
+		res, err := resolve("${env:TMC_TEST_TOKEN}", locked)
+		assert.NoError(t, err)
+		assert.Equal(t, "from-env", res)
+		_, err = resolve("${secret:gitlab}", locked)
+		assert.True(t, errors.Is(err, ErrNoPassphrase))
+	})
+}
+
+func TestHasReference(t *testing.T) {
+	assert.True(t, HasReference("${env:TOKEN}"))
+	assert.True(t, HasReference("Bearer ${secret:gitlab}"))
+	assert.False(t, HasReference("${TOKEN}"))
+	assert.False(t, HasReference("s3cr3t"))
+	assert.Equal(t, "${secret:my-repo.bearer}", Reference(RefKindSecret, "my-repo.bearer"))
+}
@@ -0,0 +1,64 @@
+// Package secrets keeps credentials out of the plaintext config file. It provides a store for named secrets, which is
+// backed by an encrypted file, and resolves references to secrets, environment variables and files in config values
+package secrets
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmc/internal/config"
+)
+
+var (
+	ErrSecretNotFound   = errors.New("secret not found")
+	ErrNoPassphrase     = errors.New("secret store is locked. set the passphrase with env var TMC_SECRETSPASSPHRASE")
+	ErrWrongPassphrase  = errors.New("cannot decrypt secret store. wrong passphrase?")
+	ErrInvalidReference = errors.New("invalid secret reference")
+)
+
+// Store holds named secrets
+type Store interface {
+	// Get returns the secret with given name. Returns ErrSecretNotFound if there is none
+	Get(name string) (string, error)
+	// Set stores the secret with given name, replacing an existing one
+	Set(name, value string) error
+	// Delete removes the secret with given name. Returns ErrSecretNotFound if there is none
+	Delete(name string) error
+	// List returns the names of all secrets in lexical order
+	List() ([]string, error)
+}
+
+// PromptPassphrase is called to ask for the passphrase of the secret store if none is configured. It is set by the
+// CLI when running on a terminal
+var PromptPassphrase func() (string, error)
+
+var (
+	defaultMu    sync.Mutex
+	defaultStore *FileStore
+)
+
+// Default returns the secret store of this process, which is the encrypted file given by config.KeySecretsFile.
+// The passphrase is taken from config.KeySecretsPassphrase or, if not set, asked for with PromptPassphrase.
+// Returns ErrNoPassphrase if there is neither
+func Default() (Store, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	file := viper.GetString(config.KeySecretsFile)
+	if defaultStore != nil && defaultStore.file == file {
+		return defaultStore, nil
+	}
+	pass := viper.GetString(config.KeySecretsPassphrase)
+	if pass == "" && PromptPassphrase != nil {
+		var err error
+		pass, err = PromptPassphrase()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pass == "" {
+		return nil, ErrNoPassphrase
+	}
+	defaultStore = NewFileStore(file, pass)
+	return defaultStore, nil
+}
@@ -0,0 +1,111 @@
+// Package oauth2fake provides an in-process stand-in for an OAuth2 authorization server, to be used in tests.
+// It issues access tokens with the client credentials grant to a single client and can tell whether a token is valid
+package oauth2fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Server is a fake authorization server. The zero value is not usable, use NewServer
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	// ExpiresIn is the lifetime of issued tokens. Tokens do not expire, if zero
+	ExpiresIn time.Duration
+
+	mu     sync.Mutex
+	issued int
+	tokens map[string]time.Time // token to expiry
+	// LastForm is the form of the last token request
+	LastForm url.Values
+}
+
+// NewServer starts a new fake authorization server issuing tokens to the client with given credentials. The token
+// endpoint is at /token. The caller should call Close when finished
+func NewServer(clientID, clientSecret string) *Server {
+	s := &Server{ClientID: clientID, ClientSecret: clientSecret, tokens: map[string]time.Time{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// TokenURL returns the URL of the token endpoint
+func (s *Server) TokenURL() string {
+	return s.URL + "/token"
+}
+
+// Issued returns the number of tokens issued so far
+func (s *Server) Issued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// Valid returns true if the Authorization header value is a bearer token issued by the server and not yet expired
+// or revoked
+func (s *Server) Valid(authorization string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tok string
+	if _, err := fmt.Sscanf(authorization, "Bearer %s", &tok); err != nil {
+		return false
+	}
+	exp, ok := s.tokens[tok]
+	return ok && (exp.IsZero() || time.Now().Before(exp))
+}
+
+// RevokeAll makes all tokens issued so far invalid, as if the server's signing keys had been rotated
+func (s *Server) RevokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/token" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_request"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastForm = r.PostForm
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "unsupported_grant_type"})
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	}
+	if !ok || id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "invalid_client", "error_description": "client authentication failed"})
+		return
+	}
+	s.issued++
+	tok := fmt.Sprintf("token-%d", s.issued)
+	resp := map[string]any{"access_token": tok, "token_type": "Bearer"}
+	var exp time.Time
+	if s.ExpiresIn > 0 {
+		exp = time.Now().Add(s.ExpiresIn)
+		resp["expires_in"] = int(s.ExpiresIn.Seconds())
+	}
+	s.tokens[tok] = exp
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
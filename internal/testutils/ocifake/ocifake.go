@@ -0,0 +1,320 @@
+// Package ocifake provides an in-process stand-in for an OCI distribution registry, to be used in tests.
+// It supports pulling and pushing manifests and blobs, with monolithic blob uploads, deleting manifests, and listing
+// tags and repositories with pagination. Optionally, it requires token authentication
+package ocifake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultPageSize = 100
+
+type manifest struct {
+	data      []byte
+	mediaType string
+}
+
+type descriptor struct {
+	Digest string `json:"digest"`
+}
+
+type repository struct {
+	blobs     map[string][]byte
+	manifests map[string]manifest
+	tags      map[string]string // tag to manifest digest
+}
+
+// Server is a fake registry. The zero value is not usable, use NewServer
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	repos    map[string]*repository
+	uploads  map[string]string // upload id to repository name
+	uploadID int
+	// PageSize limits the number of tags or repositories returned per page, unless the client requests fewer. Defaults to 100
+	PageSize int
+	// Token, if not empty, must be presented as bearer token with every request. It is handed out by the token
+	// endpoint /token to anyone asking, unless TokenAuthorization is set
+	Token string
+	// TokenAuthorization, if not empty, must be presented as Authorization header to the token endpoint
+	TokenAuthorization string
+	// DisableCatalog makes the server respond to catalog requests with 404, as many public registries do
+	DisableCatalog bool
+}
+
+// NewServer starts a new fake registry. The caller should call Close when finished
+func NewServer() *Server {
+	s := &Server{repos: map[string]*repository{}, uploads: map[string]string{}, PageSize: defaultPageSize}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Tags returns the sorted tags of the repository with given name
+func (s *Server) Tags(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.repos[name]
+	if !ok {
+		return nil
+	}
+	var tags []string
+	for t := range r.tags {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+func digestOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (s *Server) repo(name string) *repository {
+	r, ok := s.repos[name]
+	if !ok {
+		r = &repository{blobs: map[string][]byte{}, manifests: map[string]manifest{}, tags: map[string]string{}}
+		s.repos[name] = r
+	}
+	return r
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if s.TokenAuthorization != "" && r.Header.Get("Authorization") != s.TokenAuthorization {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"token": s.Token})
+		return
+	}
+	p, ok := strings.CutPrefix(r.URL.Path, "/v2/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		name := p
+		for _, sep := range []string{"/manifests/", "/blobs/", "/tags/list"} {
+			if i := strings.LastIndex(name, sep); i >= 0 {
+				name = name[:i]
+			}
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="ocifake",scope="repository:%s:pull,push"`, s.URL, name))
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case p == "":
+		w.WriteHeader(http.StatusOK)
+	case p == "_catalog":
+		if s.DisableCatalog {
+			writeError(w, http.StatusNotFound, "UNSUPPORTED", "catalog not supported")
+			return
+		}
+		var names []string
+		for n, repo := range s.repos {
+			if len(repo.tags) > 0 {
+				names = append(names, n)
+			}
+		}
+		s.writePage(w, r, "repositories", names)
+	case strings.HasSuffix(p, "/tags/list"):
+		repo, ok := s.repos[strings.TrimSuffix(p, "/tags/list")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+			return
+		}
+		var tags []string
+		for t := range repo.tags {
+			tags = append(tags, t)
+		}
+		s.writePage(w, r, "tags", tags)
+	case strings.Contains(p, "/manifests/"):
+		i := strings.LastIndex(p, "/manifests/")
+		s.handleManifest(w, r, p[:i], p[i+len("/manifests/"):])
+	case strings.Contains(p, "/blobs/uploads/"):
+		i := strings.LastIndex(p, "/blobs/uploads/")
+		s.handleUpload(w, r, p[:i], p[i+len("/blobs/uploads/"):])
+	case strings.Contains(p, "/blobs/"):
+		i := strings.LastIndex(p, "/blobs/")
+		s.handleBlob(w, r, p[:i], p[i+len("/blobs/"):])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// writePage writes a page of the sorted items as JSON object with key and a Link header pointing to the next page
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, key string, items []string) {
+	slices.Sort(items)
+	n := s.PageSize
+	if qn, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && qn > 0 && qn < n {
+		n = qn
+	}
+	if last := r.URL.Query().Get("last"); last != "" {
+		i, _ := slices.BinarySearch(items, last)
+		for i < len(items) && items[i] <= last {
+			i++
+		}
+		items = items[i:]
+	}
+	if len(items) > n {
+		items = items[:n]
+		w.Header().Set("Link", fmt.Sprintf(`<%s?n=%d&last=%s>; rel="next"`, r.URL.Path, n, items[n-1]))
+	}
+	if items == nil {
+		items = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{key: items})
+}
+
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request, name, ref string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		repo, ok := s.repos[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+			return
+		}
+		digest := ref
+		if d, isTag := repo.tags[ref]; isTag {
+			digest = d
+		}
+		m, ok := repo.manifests[digest]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(m.data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		var parsed struct {
+			Config descriptor   `json:"config"`
+			Layers []descriptor `json:"layers"`
+		}
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		repo := s.repo(name)
+		for _, d := range append(parsed.Layers, parsed.Config) {
+			if _, ok := repo.blobs[d.Digest]; !ok {
+				writeError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob unknown to registry: "+d.Digest)
+				return
+			}
+		}
+		digest := digestOf(data)
+		repo.manifests[digest] = manifest{data: data, mediaType: r.Header.Get("Content-Type")}
+		if !strings.HasPrefix(ref, "sha256:") {
+			repo.tags[ref] = digest
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		repo, ok := s.repos[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+			return
+		}
+		if _, ok := repo.manifests[ref]; !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		delete(repo.manifests, ref)
+		for t, d := range repo.tags {
+			if d == ref {
+				delete(repo.tags, t)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, name, id string) {
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		s.uploadID++
+		uid := strconv.Itoa(s.uploadID)
+		s.uploads[uid] = name
+		w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+uid)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && id != "":
+		if s.uploads[id] != name {
+			writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		digest := r.URL.Query().Get("digest")
+		if digest != digestOf(data) {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+			return
+		}
+		delete(s.uploads, id)
+		s.repo(name).blobs[digest] = data
+		w.Header().Set("Location", "/v2/"+name+"/blobs/"+digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request, name, digest string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	repo, ok := s.repos[name]
+	var data []byte
+	if ok {
+		data, ok = repo.blobs[digest]
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, map[string]any{"errors": []map[string]string{{"code": code, "message": msg}}})
+}
@@ -0,0 +1,184 @@
+// Package s3fake provides an in-process stand-in for an S3-compatible object store, to be used in tests.
+// It serves path-style requests for any bucket and supports the subset of the S3 REST API used by tmc:
+// GetObject, HeadObject, PutObject and DeleteObject with If-Match and If-None-Match conditions, and ListObjectsV2.
+// Request signatures are not checked
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultMaxKeys = 1000
+
+type object struct {
+	data []byte
+	etag string
+}
+
+// Server is a fake S3 server. The zero value is not usable, use NewServer
+type Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string]object // by bucket + "/" + key
+	// MaxKeys limits the number of keys returned per ListObjectsV2 page. Defaults to 1000
+	MaxKeys int
+}
+
+// NewServer starts a new fake S3 server. The caller should call Close when finished
+func NewServer() *Server {
+	s := &Server{objects: map[string]object{}, MaxKeys: defaultMaxKeys}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Object returns the contents of the object with given key in bucket and whether it exists
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[bucket+"/"+key]
+	return o.data, ok
+}
+
+// PutObject stores an object directly, bypassing the HTTP API
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = newObject(data)
+}
+
+func newObject(data []byte) object {
+	sum := md5.Sum(data)
+	return object{data: slices.Clone(data), etag: `"` + hex.EncodeToString(sum[:]) + `"`}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName", "bucket name missing")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			s.list(w, r, bucket)
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "operation not supported by fake")
+		return
+	}
+	fullKey := bucket + "/" + key
+	o, exists := s.objects[fullKey]
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", o.etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(o.data)
+		}
+	case http.MethodPut:
+		if !checkConditions(w, r, o, exists) {
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		o = newObject(data)
+		s.objects[fullKey] = o
+		w.Header().Set("ETag", o.etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if exists && !checkConditions(w, r, o, exists) {
+			return
+		}
+		delete(s.objects, fullKey)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+func checkConditions(w http.ResponseWriter, r *http.Request, o object, exists bool) bool {
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return false
+	}
+	if im := r.Header.Get("If-Match"); im != "" && (!exists || im != o.etag) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return false
+	}
+	return true
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name    `xml:"ListBucketResult"`
+	Name                  string      `xml:"Name"`
+	Prefix                string      `xml:"Prefix"`
+	KeyCount              int         `xml:"KeyCount"`
+	IsTruncated           bool        `xml:"IsTruncated"`
+	NextContinuationToken string      `xml:"NextContinuationToken,omitempty"`
+	Contents              []listEntry `xml:"Contents"`
+}
+
+type listEntry struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int    `xml:"Size"`
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	// the continuation token is simply the last key returned
+	after := r.URL.Query().Get("continuation-token")
+	var keys []string
+	for k := range s.objects {
+		key, ok := strings.CutPrefix(k, bucket+"/")
+		if ok && strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	res := listBucketResult{Name: bucket, Prefix: prefix}
+	if len(keys) > s.MaxKeys {
+		keys = keys[:s.MaxKeys]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+	res.KeyCount = len(keys)
+	for _, k := range keys {
+		o := s.objects[bucket+"/"+k]
+		res.Contents = append(res.Contents, listEntry{Key: k, ETag: o.etag, Size: len(o.data)})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: msg})
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP exports spans to an OpenTelemetry collector with OTLP over HTTP
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to stderr for local testing. Stderr is used instead of stdout to keep spans
+	// apart from the output of commands like fetch
+	ExporterStdout = "stdout"
+
+	serviceName        = "tmc"
+	tracerName         = "github.com/wot-oss/tmc"
+	defaultOTLPURLPath = "/v1/traces"
+
+	// AttrRepo is the name of the repo a span is about
+	AttrRepo = attribute.Key("tmc.repo")
+)
+
+var enabled bool
+
+// Options configure the export of spans
+type Options struct {
+	// Exporter is one of ExporterNone, ExporterOTLP or ExporterStdout. Empty means ExporterNone
+	Exporter string
+	// Endpoint is the URL of the OTLP collector, e.g. http://localhost:4318. If empty, the standard OTEL_EXPORTER_OTLP_*
+	// env vars apply
+	Endpoint string
+	// Version is the version of tmc to be recorded with the spans
+	Version string
+	// Batch exports spans in batches in the background. Long-running processes should use it. Otherwise, spans are
+	// exported synchronously as they end, so that they are not lost when a command exits early
+	Batch bool
+}
+
+// Init installs a global tracer provider exporting spans as configured in opts, together with the W3C trace context
+// propagator. Returns a function which flushes pending spans and must be called before the process exits.
+// Does nothing if tracing is disabled
+func Init(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+	var exp sdktrace.SpanExporter
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return noop, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOTLP:
+		var o []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			u, err := endpointURL(opts.Endpoint)
+			if err != nil {
+				return noop, err
+			}
+			o = append(o, otlptracehttp.WithEndpointURL(u))
+		}
+		exp, err = otlptracehttp.New(ctx, o...)
+	default:
+		return noop, fmt.Errorf("invalid tracing exporter %q. Must be one of %s, %s, %s", opts.Exporter, ExporterNone, ExporterOTLP, ExporterStdout)
+	}
+	if err != nil {
+		return noop, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName), semconv.ServiceVersion(opts.Version)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return noop, err
+	}
+	processor := sdktrace.WithSyncer(exp)
+	if opts.Batch {
+		processor = sdktrace.WithBatcher(exp)
+	}
+	tp := sdktrace.NewTracerProvider(processor, sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+	return tp.Shutdown, nil
+}
+
+// endpointURL validates the endpoint of an OTLP collector and adds the default path for traces if it has none
+func endpointURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid tracing endpoint %q. Must be a URL with scheme http or https", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultOTLPURLPath
+	}
+	return u.String(), nil
+}
+
+// Start starts a span with given name as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if not nil, in span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport wraps base so that outgoing requests are traced and carry the trace context. A nil base stands for
+// http.DefaultTransport. Returns base unchanged if tracing is disabled
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if !enabled {
+		return base
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// Handler wraps h so that incoming requests are traced, continuing the trace context sent by the client. Returns h
+// unchanged if tracing is disabled
+func Handler(h http.Handler) http.Handler {
+	if !enabled {
+		return h
+	}
+	return otelhttp.NewHandler(h, serviceName, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+}
+
+// SetRoute names the span of a server request in ctx after the route which handles it, which keeps the number of
+// distinct span names small
+func SetRoute(ctx context.Context, method, route string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetName(method + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+}
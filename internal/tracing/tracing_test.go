@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider recording all spans in memory until the test ends
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	orgTP, orgProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled = true
+	t.Cleanup(func() {
+		otel.SetTracerProvider(orgTP)
+		otel.SetTextMapPropagator(orgProp)
+		enabled = false
+	})
+	return exp
+}
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init(context.Background(), Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.False(t, enabled)
+
+	_, err = Init(context.Background(), Options{Exporter: "jaeger"})
+	assert.ErrorContains(t, err, "invalid tracing exporter")
+
+	_, err = Init(context.Background(), Options{Exporter: ExporterOTLP, Endpoint: "localhost:4318"})
+	assert.ErrorContains(t, err, "invalid tracing endpoint")
+}
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		exp      string
+		expErr   bool
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/traces", false},
+		{"https://collector.example.com/", "https://collector.example.com/v1/traces", false},
+		{"https://collector.example.com/otlp/v1/traces", "https://collector.example.com/otlp/v1/traces", false},
+		{"localhost:4318", "", true},
+		{"grpc://localhost:4317", "", true},
+	}
+	for _, test := range tests {
+		u, err := endpointURL(test.endpoint)
+		if test.expErr {
+			assert.Error(t, err, test.endpoint)
+		} else {
+			assert.NoError(t, err, test.endpoint)
+			assert.Equal(t, test.exp, u)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exp := recordSpans(t)
+
+	_, span := Start(context.Background(), "ok", AttrRepo.String("r1"))
+	End(span, nil)
+	_, span = Start(context.Background(), "failed")
+	End(span, errors.New("boom"))
+
+	spans := exp.GetSpans()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "ok", spans[0].Name)
+		assert.Equal(t, codes.Unset, spans[0].Status.Code)
+		assert.Contains(t, spans[0].Attributes, AttrRepo.String("r1"))
+		assert.Equal(t, "failed", spans[1].Name)
+		assert.Equal(t, codes.Error, spans[1].Status.Code)
+		assert.Equal(t, "boom", spans[1].Status.Description)
+	}
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	exp := recordSpans(t)
+
+	// given: a traced server
+	srv := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), r.Method, "/inventory/{name}")
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer srv.Close()
+
+	// when: sending a request with a traced client within a span
+	ctx, span := Start(context.Background(), "client")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/inventory/a", nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+	span.End()
+
+	// then: the server's span belongs to the client's trace and is named after the route
+	spans := exp.GetSpans()
+	var serverSpan *tracetest.SpanStub
+	for i, s := range spans {
+		assert.Equal(t, span.SpanContext().TraceID(), s.SpanContext.TraceID(), s.Name)
+		if s.Name == "GET /inventory/{name}" {
+			serverSpan = &spans[i]
+		}
+	}
+	assert.Len(t, spans, 3)
+	assert.NotNil(t, serverSpan)
+}
+
+func TestTransport_Disabled(t *testing.T) {
+	assert.Nil(t, Transport(nil))
+	tr := &http.Transport{}
+	assert.Same(t, tr, Transport(tr))
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+)
+
+const (
+	// LogKeyRequestID is the key of the request id in log lines
+	LogKeyRequestID = "requestId"
+
+	ctxRequestID = "requestId"
+)
+
+// ContextWithRequestID returns a copy of ctx carrying the id of the request handled within ctx
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxRequestID, id)
+}
+
+// RequestIDFromContext returns the id of the request handled within ctx or empty string if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(ctxRequestID).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Logger returns the default logger, which adds the id of the request handled within ctx, if any, to all log lines
+func Logger(ctx context.Context) *slog.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return slog.Default().With(LogKeyRequestID, id)
+	}
+	return slog.Default()
+}